@@ -0,0 +1,38 @@
+// 本地模拟的微信支付 v2 网关，在项目根目录运行，读取 config.yaml 中的 wechat_pay 配置：
+//
+//	go run ./cmd/wechatpay-fake -addr :9090 -notify-url http://127.0.0.1:8080/api/customer/payments/notify
+//
+// 并将 wechat_pay.base_url 配置为 http://127.0.0.1:9090、use_simulate 配置为 false。
+// 下单后调用 POST /fake/pay {"out_trade_no": "..."} 模拟用户支付并发送回调，
+// 退款后调用 POST /fake/refund {"out_refund_no": "..."} 完成退款并发送退款结果回调，
+// POST /fake/script 预设接口失败，GET /fake/orders/{out_trade_no} 查看订单
+package main
+
+import (
+	"admin-api/config"
+	"admin-api/pkg/wechatpayfake"
+	"flag"
+	"log"
+	"net/http"
+)
+
+func main() {
+	addr := flag.String("addr", ":9090", "监听地址")
+	notifyURL := flag.String("notify-url", "", "支付结果回调地址，为空时使用下单参数中的 notify_url")
+	refundNotifyURL := flag.String("refund-notify-url", "", "退款结果回调地址，为空时使用退款申请中的 notify_url")
+	flag.Parse()
+
+	server := wechatpayfake.NewServer(wechatpayfake.Config{
+		AppID:     config.Config.WechatPay.AppID,
+		MchID:     config.Config.WechatPay.MchID,
+		APIKey:    config.Config.WechatPay.APIKey,
+		NotifyURL: *notifyURL,
+
+		RefundNotifyURL: *refundNotifyURL,
+	})
+
+	log.Printf("✅ 模拟微信支付网关启动: %s", *addr)
+	if err := http.ListenAndServe(*addr, server); err != nil {
+		log.Fatalf("❌ 模拟微信支付网关退出: %v", err)
+	}
+}
@@ -0,0 +1,8 @@
+package constant
+
+import "time"
+
+const (
+	// 超时预约
+	AppointmentExpireInterval = time.Minute // 检查超时支付单和预约的间隔
+)
@@ -0,0 +1,8 @@
+package constant
+
+import "time"
+
+const (
+	// 员工外部日历
+	CalendarSyncInterval = 30 * time.Minute // 同步本地文件和订阅地址的间隔
+)
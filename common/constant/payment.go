@@ -0,0 +1,8 @@
+package constant
+
+import "time"
+
+const (
+	// 微信支付 APIv3 平台证书
+	WechatPayCertRefreshInterval = 12 * time.Hour // 定期重新下载平台证书的间隔
+)
@@ -0,0 +1,10 @@
+package constant
+
+import "time"
+
+const (
+	// 排班模板
+	ScheduleHorizonDays      = 30            // 按模板生成时间段的滚动天数
+	ScheduleGenerateInterval = 6 * time.Hour // 后台生成任务执行间隔
+	ScheduleGenerateMaxDays  = 90            // 手动生成时允许的最大天数
+)
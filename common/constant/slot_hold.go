@@ -0,0 +1,8 @@
+package constant
+
+const (
+	// 结账期间的时间段预留
+	SLOT_HOLD_KEY_PREFIX   = "slot:hold:" // Redis键前缀
+	SlotHoldDefaultMinutes = 10           // 默认预留时长（分钟）
+	SlotHoldMaxMinutes     = 30           // 允许的最长预留时长（分钟）
+)
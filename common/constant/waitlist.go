@@ -0,0 +1,8 @@
+package constant
+
+import "time"
+
+const (
+	// 候补
+	WaitlistExpireInterval = time.Minute // 检查候补保留名额是否超时的间隔
+)
@@ -13,6 +13,8 @@ package config
 import (
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 )
 
 type WechatPayConfig struct {
@@ -23,6 +25,15 @@ type WechatPayConfig struct {
 	KeyPath     string `yaml:"key_path"`
 	NotifyURL   string `yaml:"notify_url"`
 	UseSimulate bool   `yaml:"use_simulate"`
+	// 支付网关地址，为空时为 https://api.mch.weixin.qq.com；联调和集成测试时可指向本地测试服务器（cmd/wechatpay-fake）
+	BaseURL string `yaml:"base_url"`
+	// 接口版本：v2（默认，MD5签名的XML接口）或 v3（SHA256-RSA签名的JSON接口）
+	APIVersion string `yaml:"api_version"`
+	// 以下为 v3 配置
+	APIv3Key         string `yaml:"api_v3_key"`         // APIv3密钥，用于解密回调和平台证书
+	CertSerialNo     string `yaml:"cert_serial_no"`     // 商户证书序列号，为空时从 cert_path 读取
+	PlatformCertPath string `yaml:"platform_cert_path"` // 微信支付平台证书，为空时从接口下载
+	RefundNotifyURL  string `yaml:"refund_notify_url"`  // 退款结果回调地址（v2 和 v3 均使用），为空时使用 notify_url
 }
 
 // 总配文件
@@ -33,6 +44,7 @@ type config struct {
 	ImageSettings imageSettings   `yaml:"imageSettings"`
 	Log           log             `yaml:"log"`
 	WechatPay     WechatPayConfig `yaml:"wechat_pay"`
+	Calendar      calendar        `yaml:"calendar"`
 }
 
 // 项目端口配置
@@ -73,6 +85,12 @@ type log struct {
 	Model string `yaml:"model"`
 }
 
+// 日历订阅配置
+type calendar struct {
+	FeedSecret string `yaml:"feed_secret"` // 订阅链接签名密钥，可由环境变量 CALENDAR_FEED_SECRET 覆盖，未配置时不提供日历订阅
+	ImportDir  string `yaml:"import_dir"`  // 员工外部日历本地文件目录，各商家的文件放在以商家ID命名的子目录中，为空时不允许使用本地文件
+}
+
 type payment struct {
 	UseSimulate bool `yaml:"use_simulate"` // 新增模拟支付开关
 }
@@ -81,7 +99,7 @@ var Config *config
 
 // 配置初始化
 func init() {
-	yamlFile, err := ioutil.ReadFile("./config.yaml")
+	yamlFile, err := ioutil.ReadFile(configFile())
 	// 有错就down机
 	if err != nil {
 		panic(err)
@@ -91,6 +109,29 @@ func init() {
 	if err != nil {
 		panic(err)
 	}
+	// 密钥可通过环境变量注入，不必写入配置文件
+	if v := os.Getenv("CALENDAR_FEED_SECRET"); v != "" {
+		Config.Calendar.FeedSecret = v
+	}
+}
+
+// configFile 当前目录的 config.yaml；在子目录中运行（如 go test）时向上查找项目根目录的配置
+func configFile() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "./config.yaml"
+	}
+	for {
+		path := filepath.Join(dir, "config.yaml")
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "./config.yaml"
+		}
+		dir = parent
+	}
 }
 
 //type Config struct {
@@ -1,9 +1,15 @@
 package customer
 
 import (
+	"errors"
+	"log"
+	"net/http"
 	"strconv"
+	"time"
 
 	"admin-api/models"
+	"admin-api/payment"
+	"admin-api/pkg/qrcode"
 	"admin-api/utils"
 
 	"github.com/gin-gonic/gin"
@@ -20,7 +26,9 @@ type AppointmentResponse struct {
 	EndTime         string `json:"end_time"`
 	Status          string `json:"status"`
 	Amount          int    `json:"amount"`
-	CreatedAt       string `json:"created_at"`
+	SeriesID        uint   `json:"series_id,omitempty"` // 所属的周期预约
+	Timezone        string `json:"timezone"`            // 商家时区，预约日期和时间均为该时区的当地时间
+	CreatedAt       string `json:"created_at"`          // RFC3339，带时区偏移
 }
 
 // 获取用户预约列表
@@ -30,7 +38,7 @@ type AppointmentResponse struct {
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
-// @Param status query string false "预约状态筛选" Enums(pending, confirmed, completed, cancelled)
+// @Param status query string false "预约状态筛选" Enums(pending, confirmed, paid, completed, cancelled, rejected, no_show, refunding, refunded)
 // @Param Authorization header string true "Bearer Token"
 // @Success 200 {array} AppointmentResponse "成功返回预约列表"
 // @Failure 500 {object} utils.Response "获取预约列表失败"
@@ -58,9 +66,11 @@ func GetUserAppointments(c *gin.Context) {
 			AppointmentDate: appt.AppointmentDate.Format("2006-01-02"),
 			StartTime:       appt.StartTime,
 			EndTime:         appt.EndTime,
-			Status:          appt.Status,
+			Status:          models.NormalizeAppointmentStatus(appt.Status),
 			Amount:          appt.Amount,
-			CreatedAt:       appt.CreatedAt.Format("2006-01-02 15:04"),
+			SeriesID:        appt.SeriesID,
+			Timezone:        appt.Merchant.Location().String(),
+			CreatedAt:       appt.CreatedAt.In(appt.Merchant.Location()).Format(time.RFC3339),
 		})
 	}
 
@@ -69,22 +79,27 @@ func GetUserAppointments(c *gin.Context) {
 
 // 构建响应
 type DetailResponse struct {
-	ID              uint   `json:"id"`
-	OrderNo         string `json:"order_no"`
-	MerchantName    string `json:"merchant_name"`
-	MerchantAddress string `json:"merchant_address"`
-	MerchantPhone   string `json:"merchant_phone"`
-	ServiceName     string `json:"service_name"`
-	ServiceImage    string `json:"service_image"`
-	StaffName       string `json:"staff_name"`
-	StaffAvatar     string `json:"staff_avatar"`
-	AppointmentDate string `json:"appointment_date"`
-	StartTime       string `json:"start_time"`
-	EndTime         string `json:"end_time"`
-	Status          string `json:"status"`
-	Amount          int    `json:"amount"`
-	Remark          string `json:"remark"`
-	CreatedAt       string `json:"created_at"`
+	ID              uint                      `json:"id"`
+	OrderNo         string                    `json:"order_no"`
+	MerchantName    string                    `json:"merchant_name"`
+	MerchantAddress string                    `json:"merchant_address"`
+	MerchantPhone   string                    `json:"merchant_phone"`
+	ServiceName     string                    `json:"service_name"`
+	ServiceImage    string                    `json:"service_image"`
+	StaffName       string                    `json:"staff_name"`
+	StaffAvatar     string                    `json:"staff_avatar"`
+	AppointmentDate string                    `json:"appointment_date"`
+	StartTime       string                    `json:"start_time"`
+	EndTime         string                    `json:"end_time"`
+	Status          string                    `json:"status"`
+	Amount          int                       `json:"amount"`
+	Remark          string                    `json:"remark"`
+	SeriesID        uint                      `json:"series_id,omitempty"`       // 所属的周期预约
+	Timezone        string                    `json:"timezone"`                  // 商家时区，预约日期和时间均为该时区的当地时间
+	CreatedAt       string                    `json:"created_at"`                // RFC3339，带时区偏移
+	ActualStartAt   string                    `json:"actual_start_at,omitempty"` // 到店签到时间，RFC3339
+	ActualEndAt     string                    `json:"actual_end_at,omitempty"`   // 签退时间，RFC3339
+	Events          []models.AppointmentEvent `json:"events"`                    // 状态变更记录
 	CouponUsed      *struct {
 		Code   string `json:"code"`
 		Name   string `json:"name"`
@@ -94,7 +109,7 @@ type DetailResponse struct {
 
 // 获取预约详情
 // @Summary 获取预约详情
-// @Description 获取特定预约的详细信息
+// @Description 获取特定预约的详细信息及状态变更记录
 // @Tags 预约管理
 // @Accept json
 // @Produce json
@@ -119,6 +134,12 @@ func GetAppointmentDetail(c *gin.Context) {
 		return
 	}
 
+	events, err := models.GetAppointmentEvents(appointment.ID)
+	if err != nil {
+		utils.InternalError(c, "获取预约详情失败")
+		return
+	}
+
 	response := DetailResponse{
 		ID:              appointment.ID,
 		OrderNo:         appointment.OrderNo,
@@ -132,10 +153,20 @@ func GetAppointmentDetail(c *gin.Context) {
 		AppointmentDate: appointment.AppointmentDate.Format("2006-01-02"),
 		StartTime:       appointment.StartTime,
 		EndTime:         appointment.EndTime,
-		Status:          appointment.Status,
+		Status:          models.NormalizeAppointmentStatus(appointment.Status),
 		Amount:          appointment.Amount,
 		Remark:          appointment.Remark,
-		CreatedAt:       appointment.CreatedAt.Format("2006-01-02 15:04"),
+		SeriesID:        appointment.SeriesID,
+		Timezone:        appointment.Merchant.Location().String(),
+		CreatedAt:       appointment.CreatedAt.In(appointment.Merchant.Location()).Format(time.RFC3339),
+		Events:          events,
+	}
+
+	if appointment.ActualStartAt != nil {
+		response.ActualStartAt = appointment.ActualStartAt.In(appointment.Merchant.Location()).Format(time.RFC3339)
+	}
+	if appointment.ActualEndAt != nil {
+		response.ActualEndAt = appointment.ActualEndAt.In(appointment.Merchant.Location()).Format(time.RFC3339)
 	}
 
 	// 如果有使用优惠券
@@ -154,17 +185,58 @@ func GetAppointmentDetail(c *gin.Context) {
 	utils.Success(c, response)
 }
 
+// 预览取消结果
+// @Summary 预览取消结果
+// @Description 按商家的取消政策计算取消预约的结果：能否取消、违约金和可退金额，供客户确认后再取消
+// @Tags 预约管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param appointmentId path int true "预约ID"
+// @Param Authorization header string true "Bearer Token"
+// @Success 200 {object} models.CancellationQuote "取消结果"
+// @Failure 400 {object} utils.Response "无效的预约ID"
+// @Router /api/customer/appointments/{appointmentId}/cancel-preview [get]
+func PreviewCancelAppointment(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	appointmentID, err := strconv.Atoi(c.Param("appointmentId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的预约ID")
+		return
+	}
+
+	quote, err := models.QuoteUserCancellation(userID, uint(appointmentID))
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.Success(c, quote)
+}
+
+type CancelAppointmentRequest struct {
+	AcceptFee bool `json:"accept_fee"` // 确认扣除违约金，需扣除违约金时必须为 true
+}
+
+// CancelAppointmentResponse 取消结果
+type CancelAppointmentResponse struct {
+	Quote  *models.CancellationQuote `json:"quote"`            // 按取消政策计算的结果
+	Refund *models.Refund            `json:"refund,omitempty"` // 已支付预约的退款记录
+}
+
 // 取消预约
 // @Summary 取消预约
-// @Description 用户取消指定的预约
+// @Description 用户按商家的取消政策取消预约。已支付的预约扣除违约金后自动原路退款；
+// @Description 需扣除违约金时须传 accept_fee=true，否则返回 code=409 和取消结果供客户确认
 // @Tags 预约管理
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
 // @Param appointmentId path int true "预约ID"
 // @Param Authorization header string true "Bearer Token"
-// @Success 200 {string} string "预约已取消"
-// @Failure 400 {object} utils.Response "无效的预约ID"
+// @Param body body CancelAppointmentRequest false "确认违约金"
+// @Success 200 {object} CancelAppointmentResponse "预约已取消"
+// @Failure 400 {object} utils.Response "无效的预约ID或当前不能取消"
+// @Failure 409 {object} utils.Response{data=models.CancellationQuote} "需确认违约金"
 // @Failure 500 {object} utils.Response "取消预约失败"
 // @Router /api/customer/appointments/{appointmentId}/cancel [put]
 func CancelAppointment(c *gin.Context) {
@@ -175,10 +247,176 @@ func CancelAppointment(c *gin.Context) {
 		return
 	}
 
-	if err := models.CancelUserAppointment(userID, uint(appointmentID)); err != nil {
+	var req CancelAppointmentRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.BadRequest(c, "参数错误")
+			return
+		}
+	}
+
+	quote, refund, err := models.CancelUserAppointment(userID, uint(appointmentID), req.AcceptFee)
+	if errors.Is(err, models.ErrCancellationFeeNotAccepted) {
+		c.JSON(http.StatusOK, utils.Response{Code: http.StatusConflict, Msg: err.Error(), Data: quote})
+		return
+	}
+	if err != nil {
+		if quote != nil {
+			utils.BadRequest(c, "取消预约失败: "+err.Error())
+			return
+		}
 		utils.InternalError(c, "取消预约失败: "+err.Error())
 		return
 	}
 
-	utils.Success(c, "预约已取消")
+	// 退款未能发起时退款记录标记为失败，预约保持原状态，客户可重新取消
+	if refund != nil {
+		if err := payment.ExecuteRefund(refund, models.ActorCustomer, userID); err != nil {
+			log.Printf("预约 %d 取消退款失败: %v", appointmentID, err)
+			utils.InternalError(c, "退款发起失败，请稍后重试: "+err.Error())
+			return
+		}
+	}
+
+	utils.Success(c, CancelAppointmentResponse{Quote: quote, Refund: refund})
+}
+
+type RescheduleRequest struct {
+	TimeSlotID uint   `json:"time_slot_id" binding:"required"`
+	StaffID    uint   `json:"staff_id"` // 可选，为空时使用新时间段所属员工
+	Reason     string `json:"reason"`
+}
+
+// 改约
+// @Summary 改约
+// @Description 将预约改到新的时间段，支付和优惠券保持不变。需满足商家的改约规则（提前时间、改约次数）
+// @Tags 预约管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param appointmentId path int true "预约ID"
+// @Param Authorization header string true "Bearer Token"
+// @Param body body RescheduleRequest true "新的时间段"
+// @Success 200 {object} AppointmentResponse "改约成功，返回更新后的预约"
+// @Failure 400 {object} utils.Response "无效的预约ID、参数错误或不满足改约规则"
+// @Router /api/customer/appointments/{appointmentId}/reschedule [put]
+func RescheduleAppointment(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	appointmentID, err := strconv.Atoi(c.Param("appointmentId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的预约ID")
+		return
+	}
+
+	var req RescheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	appointment, err := models.RescheduleAppointment(uint(appointmentID), models.RescheduleByCustomer, userID,
+		req.StaffID, req.TimeSlotID, req.Reason)
+	if err != nil {
+		utils.BadRequest(c, "改约失败: "+err.Error())
+		return
+	}
+
+	utils.Success(c, AppointmentResponse{
+		ID:              appointment.ID,
+		OrderNo:         appointment.OrderNo,
+		MerchantName:    appointment.Merchant.Name,
+		ServiceName:     appointment.Service.Name,
+		StaffName:       appointment.Staff.Name,
+		AppointmentDate: appointment.AppointmentDate.Format("2006-01-02"),
+		StartTime:       appointment.StartTime,
+		EndTime:         appointment.EndTime,
+		Status:          appointment.Status,
+		Amount:          appointment.Amount,
+		Timezone:        appointment.Merchant.Location().String(),
+		CreatedAt:       appointment.CreatedAt.In(appointment.Merchant.Location()).Format(time.RFC3339),
+	})
+}
+
+// 获取改约记录
+// @Summary 获取改约记录
+// @Description 获取预约的改约历史
+// @Tags 预约管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param appointmentId path int true "预约ID"
+// @Param Authorization header string true "Bearer Token"
+// @Success 200 {array} models.AppointmentReschedule "成功返回改约记录"
+// @Failure 400 {object} utils.Response "无效的预约ID"
+// @Failure 404 {object} utils.Response "预约不存在"
+// @Router /api/customer/appointments/{appointmentId}/reschedules [get]
+func GetAppointmentReschedules(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	appointmentID, err := strconv.Atoi(c.Param("appointmentId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的预约ID")
+		return
+	}
+
+	if _, err := models.GetUserAppointmentDetail(userID, uint(appointmentID)); err != nil {
+		utils.NotFound(c, "预约不存在")
+		return
+	}
+
+	history, err := models.GetAppointmentReschedules(uint(appointmentID))
+	if err != nil {
+		utils.InternalError(c, "获取改约记录失败")
+		return
+	}
+
+	utils.Success(c, history)
+}
+
+// CheckInCodeResponse 到店签到码
+type CheckInCodeResponse struct {
+	AppointmentID   uint   `json:"appointment_id"`
+	Token           string `json:"token"`   // 签到码内容，扫码失败时可由店员手动输入
+	QRCode          string `json:"qr_code"` // 二维码图片，data:image/png;base64 格式
+	AppointmentDate string `json:"appointment_date"`
+	StartTime       string `json:"start_time"`
+}
+
+// 获取到店签到码
+// @Summary 获取到店签到码
+// @Description 获取预约的签到二维码，到店后由店员扫码登记到店。预约确认后可获取，仅在预约当天有效，签到后失效
+// @Tags 预约管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param appointmentId path int true "预约ID"
+// @Param Authorization header string true "Bearer Token"
+// @Success 200 {object} CheckInCodeResponse "签到码及二维码图片"
+// @Failure 400 {object} utils.Response "无效的预约ID或当前状态不能签到"
+// @Failure 500 {object} utils.Response "生成签到码失败"
+// @Router /api/customer/appointments/{appointmentId}/check-in-code [get]
+func GetCheckInCode(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	appointmentID, err := strconv.Atoi(c.Param("appointmentId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的预约ID")
+		return
+	}
+
+	appointment, err := models.GetCheckInToken(userID, uint(appointmentID))
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	img, err := qrcode.Base64PNG(appointment.CheckInToken, 8)
+	if err != nil {
+		utils.InternalError(c, "生成签到码失败")
+		return
+	}
+
+	utils.Success(c, CheckInCodeResponse{
+		AppointmentID:   appointment.ID,
+		Token:           appointment.CheckInToken,
+		QRCode:          img,
+		AppointmentDate: appointment.AppointmentDate.Format("2006-01-02"),
+		StartTime:       appointment.StartTime,
+	})
 }
@@ -0,0 +1,224 @@
+package customer
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"admin-api/models"
+	"admin-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateAppointmentSeriesRequest struct {
+	MerchantID uint   `json:"merchant_id" binding:"required"`
+	ServiceID  uint   `json:"service_id" binding:"required"`
+	StaffID    uint   `json:"staff_id" binding:"required"`
+	StartDate  string `json:"start_date" binding:"required"`                           // 第一次预约日期 YYYY-MM-DD
+	StartTime  string `json:"start_time" binding:"required"`                           // 每次预约的开始时间 HH:MM
+	Frequency  string `json:"frequency" binding:"required,oneof=daily weekly monthly"` // 重复频率
+	Interval   int    `json:"interval" binding:"omitempty,min=1,max=12"`               // 重复间隔，如每2周为2，默认1
+	Count      int    `json:"count" binding:"omitempty,min=1"`                         // 重复次数，与结束日期二选一
+	EndDate    string `json:"end_date"`                                                // 结束日期 YYYY-MM-DD（含），与重复次数二选一
+	Remark     string `json:"remark"`
+}
+
+type SeriesAppointmentItem struct {
+	AppointmentID   uint   `json:"appointment_id"`
+	OrderNo         string `json:"order_no"`
+	AppointmentDate string `json:"appointment_date"`
+	StartTime       string `json:"start_time"`
+	EndTime         string `json:"end_time"`
+	Status          string `json:"status"`
+	Amount          int    `json:"amount"`
+}
+
+type AppointmentSeriesResponse struct {
+	Series       models.AppointmentSeries   `json:"series"`
+	Appointments []SeriesAppointmentItem    `json:"appointments"`
+	Skipped      []models.SeriesSkippedDate `json:"skipped,omitempty"` // 未能预约的日期及原因
+	Timezone     string                     `json:"timezone"`          // 商家时区，日期和时间均为该时区的当地时间
+}
+
+func seriesAppointmentItems(appointments []models.Appointment) []SeriesAppointmentItem {
+	items := make([]SeriesAppointmentItem, 0, len(appointments))
+	for _, a := range appointments {
+		items = append(items, SeriesAppointmentItem{
+			AppointmentID:   a.ID,
+			OrderNo:         a.OrderNo,
+			AppointmentDate: a.AppointmentDate.Format("2006-01-02"),
+			StartTime:       a.StartTime,
+			EndTime:         a.EndTime,
+			Status:          a.Status,
+			Amount:          a.Amount,
+		})
+	}
+	return items
+}
+
+// 创建周期预约
+// @Summary 创建周期预约
+// @Description 按重复规则（每天/每周/每月，可设间隔）为同一服务、员工和开始时间批量预约，重复次数和结束日期二选一。有时间段的日期逐一预约，无法预约的日期在 skipped 中返回原因；单次预约可通过取消预约接口单独取消
+// @Tags 预约管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Bearer Token"
+// @Param body body CreateAppointmentSeriesRequest true "周期预约请求"
+// @Success 200 {object} AppointmentSeriesResponse "成功返回已预约和未能预约的日期"
+// @Failure 400 {object} utils.Response "参数错误或所选日期均无法预约"
+// @Router /api/customer/appointment-series [post]
+func CreateAppointmentSeries(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req CreateAppointmentSeriesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	startDate, err := time.Parse("2006-01-02", req.StartDate)
+	if err != nil {
+		utils.BadRequest(c, "日期格式错误")
+		return
+	}
+	series := models.AppointmentSeries{
+		UserID:     userID,
+		MerchantID: req.MerchantID,
+		ServiceID:  req.ServiceID,
+		StaffID:    req.StaffID,
+		Frequency:  req.Frequency,
+		Interval:   req.Interval,
+		Count:      req.Count,
+		StartDate:  startDate,
+		StartTime:  req.StartTime,
+		Remark:     req.Remark,
+	}
+	if series.Interval == 0 {
+		series.Interval = 1
+	}
+	if req.EndDate != "" {
+		endDate, err := time.Parse("2006-01-02", req.EndDate)
+		if err != nil {
+			utils.BadRequest(c, "日期格式错误")
+			return
+		}
+		series.EndDate = &endDate
+	}
+
+	appointments, skipped, err := models.CreateAppointmentSeries(&series)
+	if err != nil {
+		if len(skipped) > 0 {
+			// 所有日期均无法预约时一并返回各日期的原因
+			c.JSON(http.StatusOK, utils.Response{Code: 400, Msg: err.Error(), Data: gin.H{"skipped": skipped}})
+			return
+		}
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.Success(c, AppointmentSeriesResponse{
+		Series:       series,
+		Appointments: seriesAppointmentItems(appointments),
+		Skipped:      skipped,
+		Timezone:     models.MerchantLocation(series.MerchantID).String(),
+	})
+}
+
+// 获取我的周期预约
+// @Summary 获取我的周期预约
+// @Description 获取当前用户创建的周期预约及重复规则
+// @Tags 预约管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Bearer Token"
+// @Success 200 {array} models.AppointmentSeries "成功返回周期预约列表"
+// @Failure 500 {object} utils.Response "获取周期预约失败"
+// @Router /api/customer/appointment-series [get]
+func GetUserAppointmentSeries(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	series, err := models.GetUserAppointmentSeries(userID)
+	if err != nil {
+		utils.InternalError(c, "获取周期预约失败")
+		return
+	}
+
+	utils.Success(c, series)
+}
+
+// 获取周期预约详情
+// @Summary 获取周期预约详情
+// @Description 获取周期预约及其每次预约的状态
+// @Tags 预约管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Bearer Token"
+// @Param seriesId path int true "周期预约ID"
+// @Success 200 {object} AppointmentSeriesResponse "成功返回周期预约详情"
+// @Failure 400 {object} utils.Response "无效的周期预约ID"
+// @Failure 404 {object} utils.Response "周期预约不存在"
+// @Router /api/customer/appointment-series/{seriesId} [get]
+func GetAppointmentSeriesDetail(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	seriesID, err := strconv.Atoi(c.Param("seriesId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的周期预约ID")
+		return
+	}
+
+	series, err := models.GetUserAppointmentSeriesDetail(userID, uint(seriesID))
+	if err != nil {
+		utils.NotFound(c, "周期预约不存在")
+		return
+	}
+
+	utils.Success(c, AppointmentSeriesResponse{
+		Series:       *series,
+		Appointments: seriesAppointmentItems(series.Appointments),
+		Timezone:     models.MerchantLocation(series.MerchantID).String(),
+	})
+}
+
+type CancelAppointmentSeriesRequest struct {
+	FromAppointmentID uint `json:"from_appointment_id"` // 可选，只取消该次及之后的预约；不传时取消全部剩余预约并结束周期
+}
+
+// 取消周期预约
+// @Summary 取消周期预约
+// @Description 取消周期中尚未开始的预约。传 from_appointment_id 时取消该次及之后的预约，否则取消全部剩余预约并结束周期。只取消某一次请使用取消预约接口
+// @Tags 预约管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Bearer Token"
+// @Param seriesId path int true "周期预约ID"
+// @Param body body CancelAppointmentSeriesRequest false "取消范围"
+// @Success 200 {object} models.SeriesCancelResult "已取消和未能取消的预约"
+// @Failure 400 {object} utils.Response "无效的周期预约ID或周期预约不存在"
+// @Router /api/customer/appointment-series/{seriesId}/cancel [put]
+func CancelAppointmentSeries(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	seriesID, err := strconv.Atoi(c.Param("seriesId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的周期预约ID")
+		return
+	}
+
+	var req CancelAppointmentSeriesRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.BadRequest(c, "参数错误")
+			return
+		}
+	}
+
+	result, err := models.CancelAppointmentSeries(userID, uint(seriesID), req.FromAppointmentID)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.Success(c, result)
+}
@@ -0,0 +1,141 @@
+package customer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"admin-api/models"
+	"admin-api/pkg/auth"
+	"admin-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CalendarFeedResponse 日历订阅地址
+type CalendarFeedResponse struct {
+	URL       string `json:"url"`        // https 订阅地址
+	WebcalURL string `json:"webcal_url"` // webcal 地址，手机上点击可直接订阅
+}
+
+func customerFeedResponse(c *gin.Context, feed *models.CalendarFeed) (CalendarFeedResponse, error) {
+	token, err := auth.SignFeedToken(auth.FeedOwnerCustomer, feed.OwnerID, feed.Version)
+	if err != nil {
+		return CalendarFeedResponse{}, err
+	}
+	url := fmt.Sprintf("%s/api/customer/calendar/%d/appointments.ics?token=%s",
+		utils.RequestBaseURL(c), feed.OwnerID, token)
+	return CalendarFeedResponse{
+		URL:       url,
+		WebcalURL: "webcal://" + url[strings.Index(url, "://")+3:],
+	}, nil
+}
+
+// feedEnabled 未配置签名密钥时日历订阅不可用
+func feedEnabled(c *gin.Context) bool {
+	if !auth.FeedEnabled() {
+		utils.Error(c, 503, "日历订阅未启用")
+		return false
+	}
+	return true
+}
+
+// @Summary 获取预约日历订阅地址
+// @Description 获取当前用户预约的 .ics 订阅地址，可在手机日历中订阅，预约变更和取消会同步到日历
+// @Tags 预约管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Bearer Token"
+// @Success 200 {object} CalendarFeedResponse "订阅地址"
+// @Failure 500 {object} utils.Response "获取订阅地址失败"
+// @Failure 503 {object} utils.Response "日历订阅未启用"
+// @Router /api/customer/calendar-feed [get]
+func GetCalendarFeed(c *gin.Context) {
+	if !feedEnabled(c) {
+		return
+	}
+
+	userID := c.GetUint("user_id")
+
+	feed, err := models.GetCalendarFeed(auth.FeedOwnerCustomer, userID)
+	if err != nil {
+		utils.InternalError(c, "获取订阅地址失败")
+		return
+	}
+
+	response, err := customerFeedResponse(c, feed)
+	if err != nil {
+		utils.InternalError(c, "生成订阅地址失败")
+		return
+	}
+	utils.Success(c, response)
+}
+
+// @Summary 重置预约日历订阅地址
+// @Description 生成新的订阅地址，之前的订阅地址失效
+// @Tags 预约管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Bearer Token"
+// @Success 200 {object} CalendarFeedResponse "新的订阅地址"
+// @Failure 500 {object} utils.Response "重置订阅地址失败"
+// @Failure 503 {object} utils.Response "日历订阅未启用"
+// @Router /api/customer/calendar-feed/reset [post]
+func ResetCalendarFeed(c *gin.Context) {
+	if !feedEnabled(c) {
+		return
+	}
+
+	userID := c.GetUint("user_id")
+
+	feed, err := models.ResetCalendarFeed(auth.FeedOwnerCustomer, userID)
+	if err != nil {
+		utils.InternalError(c, "重置订阅地址失败")
+		return
+	}
+
+	response, err := customerFeedResponse(c, feed)
+	if err != nil {
+		utils.InternalError(c, "生成订阅地址失败")
+		return
+	}
+	utils.Success(c, response)
+}
+
+// @Summary 预约日历订阅
+// @Description 返回用户今天及以后预约的 iCalendar 内容，通过订阅地址中的签名校验，无需登录
+// @Tags 预约管理
+// @Produce text/calendar
+// @Param userId path int true "用户ID"
+// @Param token query string true "订阅签名"
+// @Success 200 {string} string "iCalendar 内容"
+// @Failure 403 {object} utils.Response "订阅地址无效"
+// @Failure 500 {object} utils.Response "生成日历失败"
+// @Failure 503 {object} utils.Response "日历订阅未启用"
+// @Router /api/customer/calendar/{userId}/appointments.ics [get]
+func GetCalendarFeedICS(c *gin.Context) {
+	if !feedEnabled(c) {
+		return
+	}
+
+	userID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		utils.Forbidden(c, "订阅地址无效")
+		return
+	}
+
+	feed, err := models.FindCalendarFeed(auth.FeedOwnerCustomer, uint(userID))
+	if err != nil || !auth.VerifyFeedToken(c.Query("token"), auth.FeedOwnerCustomer, feed.OwnerID, feed.Version) {
+		utils.Forbidden(c, "订阅地址无效")
+		return
+	}
+
+	cal, err := models.BuildCustomerCalendar(feed.OwnerID)
+	if err != nil {
+		utils.InternalError(c, "生成日历失败")
+		return
+	}
+
+	c.Header("Content-Disposition", `inline; filename="appointments.ics"`)
+	c.Data(200, "text/calendar; charset=utf-8", cal.Bytes())
+}
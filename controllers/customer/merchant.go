@@ -3,6 +3,7 @@ package customer
 
 import (
 	"strconv"
+	"time"
 
 	"admin-api/models"
 	"admin-api/utils"
@@ -28,13 +29,20 @@ func GetRecommendedMerchants(c *gin.Context) {
 	utils.Success(c, merchants)
 }
 
+// MerchantDetailResponse 商家详情，附带结构化营业时间和当前营业状态
+type MerchantDetailResponse struct {
+	models.Merchant
+	BusinessHoursDetail *models.BusinessHoursSchedule `json:"business_hours_detail"`
+	BusinessStatus      *models.BusinessStatus        `json:"business_status"`
+}
+
 // 获取商家详情
 // @Summary 获取商家详情
-// @Description 获取指定商家的详细信息（客户端）
+// @Description 获取指定商家的详细信息，包括营业时间和当前是否营业（客户端）
 // @Tags 客户-商家
 // @Produce json
 // @Param merchantId path int true "商家ID" example(123)
-// @Success 200 {object} utils.Response "成功返回商家详情"
+// @Success 200 {object} MerchantDetailResponse "成功返回商家详情"
 // @Failure 400 {object} utils.Response "无效的商家ID"
 // @Failure 404 {object} utils.Response "商家不存在"
 // @Router /api/customer/merchants/{merchantId} [get]
@@ -51,7 +59,17 @@ func GetMerchantDetail(c *gin.Context) {
 		return
 	}
 
-	utils.Success(c, merchant)
+	response := MerchantDetailResponse{Merchant: *merchant}
+
+	// 营业时间获取失败不影响商家详情展示
+	if schedule, err := models.GetMerchantBusinessHours(merchant.ID); err == nil {
+		response.BusinessHoursDetail = schedule
+	}
+	if status, err := models.GetBusinessStatus(merchant.ID, time.Now()); err == nil {
+		response.BusinessStatus = status
+	}
+
+	utils.Success(c, response)
 }
 
 // 获取商家服务分类
@@ -0,0 +1,65 @@
+package customer
+
+import (
+	"errors"
+	"strconv"
+
+	"admin-api/models"
+	"admin-api/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary 获取站内通知
+// @Description 获取当前用户最近的站内通知，如候补放位提醒
+// @Tags 用户
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Bearer Token"
+// @Param unread query bool false "只返回未读通知"
+// @Success 200 {array} models.Notification "成功返回通知列表"
+// @Failure 500 {object} utils.Response "获取通知失败"
+// @Router /api/customer/notifications [get]
+func GetNotifications(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	unreadOnly := c.Query("unread") == "true"
+
+	notifications, err := models.GetUserNotifications(userID, unreadOnly)
+	if err != nil {
+		utils.InternalError(c, "获取通知失败")
+		return
+	}
+
+	utils.Success(c, notifications)
+}
+
+// @Summary 标记通知已读
+// @Tags 用户
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Bearer Token"
+// @Param notificationId path int true "通知ID"
+// @Success 200 {object} utils.Response "标记成功"
+// @Failure 400 {object} utils.Response "无效的通知ID"
+// @Failure 404 {object} utils.Response "通知不存在"
+// @Router /api/customer/notifications/{notificationId}/read [put]
+func MarkNotificationRead(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	notificationID, err := strconv.Atoi(c.Param("notificationId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的通知ID")
+		return
+	}
+
+	if err := models.MarkNotificationRead(userID, uint(notificationID)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.NotFound(c, "通知不存在")
+		} else {
+			utils.InternalError(c, "标记通知失败")
+		}
+		return
+	}
+
+	utils.Success(c, "标记成功")
+}
@@ -0,0 +1,264 @@
+package customer
+
+import (
+	"strconv"
+	"time"
+
+	"admin-api/models"
+	"admin-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OrderLineRequest struct {
+	ServiceID  uint `json:"service_id" binding:"required"`
+	StaffID    uint `json:"staff_id" binding:"required"`
+	TimeSlotID uint `json:"time_slot_id" binding:"required"`
+}
+
+type CreateOrderRequest struct {
+	MerchantID uint               `json:"merchant_id" binding:"required"`
+	Lines      []OrderLineRequest `json:"lines" binding:"required,min=1,max=10,dive"`
+	CouponID   uint               `json:"coupon_id"` // 可选，按订单总价使用
+	Remark     string             `json:"remark"`
+}
+
+type OrderLineResponse struct {
+	AppointmentID   uint   `json:"appointment_id"`
+	OrderNo         string `json:"order_no"` // 单项预约的订单号
+	ServiceName     string `json:"service_name"`
+	StaffName       string `json:"staff_name"`
+	AppointmentDate string `json:"appointment_date"`
+	StartTime       string `json:"start_time"`
+	EndTime         string `json:"end_time"`
+	Status          string `json:"status"`
+	Amount          int    `json:"amount"` // 分摊优惠后的金额（分）
+}
+
+type OrderResponse struct {
+	ID             uint                `json:"id"`
+	OrderNo        string              `json:"order_no"`
+	MerchantName   string              `json:"merchant_name"`
+	Status         string              `json:"status"` // pending, paid, cancelled
+	OriginalAmount int                 `json:"original_amount"`
+	DiscountAmount int                 `json:"discount_amount"`
+	Amount         int                 `json:"amount"`
+	Remark         string              `json:"remark"`
+	Lines          []OrderLineResponse `json:"lines"`
+	Timezone       string              `json:"timezone"`   // 商家时区，预约日期和时间均为该时区的当地时间
+	CreatedAt      string              `json:"created_at"` // RFC3339，带时区偏移
+}
+
+func toOrderResponse(order *models.AppointmentOrder, merchant *models.Merchant) OrderResponse {
+	loc := merchant.Location()
+	lines := make([]OrderLineResponse, 0, len(order.Appointments))
+	for _, a := range order.Appointments {
+		lines = append(lines, OrderLineResponse{
+			AppointmentID:   a.ID,
+			OrderNo:         a.OrderNo,
+			ServiceName:     a.Service.Name,
+			StaffName:       a.Staff.Name,
+			AppointmentDate: a.AppointmentDate.Format("2006-01-02"),
+			StartTime:       a.StartTime,
+			EndTime:         a.EndTime,
+			Status:          a.Status,
+			Amount:          a.Amount,
+		})
+	}
+	return OrderResponse{
+		ID:             order.ID,
+		OrderNo:        order.OrderNo,
+		MerchantName:   merchant.Name,
+		Status:         order.Status,
+		OriginalAmount: order.OriginalAmount,
+		DiscountAmount: order.DiscountAmount,
+		Amount:         order.Amount,
+		Remark:         order.Remark,
+		Lines:          lines,
+		Timezone:       loc.String(),
+		CreatedAt:      order.CreatedAt.In(loc).Format(time.RFC3339),
+	}
+}
+
+// orderMerchant 订单所属商家，取自已预加载的项目
+func orderMerchant(order *models.AppointmentOrder) *models.Merchant {
+	if len(order.Appointments) > 0 {
+		return &order.Appointments[0].Merchant
+	}
+	return &models.Merchant{ID: order.MerchantID}
+}
+
+// 创建组合订单
+// @Summary 创建组合订单
+// @Description 一次预约同一商家的多个服务（如剪发+染发），全部项目同时预约成功或整单失败。优惠券按订单总价使用，之后通过订单一次支付
+// @Tags 预约管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Bearer Token"
+// @Param body body CreateOrderRequest true "订单项目"
+// @Success 200 {object} OrderResponse "成功返回订单"
+// @Failure 400 {object} utils.Response "参数错误或某一项目无法预约"
+// @Router /api/customer/orders [post]
+func CreateOrder(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req CreateOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	lines := make([]models.OrderLine, 0, len(req.Lines))
+	for _, l := range req.Lines {
+		lines = append(lines, models.OrderLine{
+			ServiceID:  l.ServiceID,
+			StaffID:    l.StaffID,
+			TimeSlotID: l.TimeSlotID,
+		})
+	}
+
+	order, err := models.CreateAppointmentOrder(userID, req.MerchantID, lines, req.CouponID, req.Remark)
+	if err != nil {
+		utils.BadRequest(c, "预约失败: "+err.Error())
+		return
+	}
+
+	order, err = models.GetOrderByID(order.ID)
+	if err != nil {
+		utils.InternalError(c, "获取订单失败")
+		return
+	}
+
+	utils.Success(c, toOrderResponse(order, orderMerchant(order)))
+}
+
+// 获取我的组合订单
+// @Summary 获取我的组合订单
+// @Description 获取当前用户的组合订单及其项目
+// @Tags 预约管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Bearer Token"
+// @Success 200 {array} OrderResponse "成功返回订单列表"
+// @Failure 500 {object} utils.Response "获取订单列表失败"
+// @Router /api/customer/orders [get]
+func GetUserOrders(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	orders, err := models.GetUserOrders(userID)
+	if err != nil {
+		utils.InternalError(c, "获取订单列表失败")
+		return
+	}
+
+	response := make([]OrderResponse, 0, len(orders))
+	for i := range orders {
+		response = append(response, toOrderResponse(&orders[i], orderMerchant(&orders[i])))
+	}
+
+	utils.Success(c, response)
+}
+
+// userOrder 校验订单属于当前用户
+func userOrder(c *gin.Context) (*models.AppointmentOrder, bool) {
+	orderID, err := strconv.Atoi(c.Param("orderId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的订单ID")
+		return nil, false
+	}
+
+	order, err := models.GetOrderByID(uint(orderID))
+	if err != nil || order.UserID != c.GetUint("user_id") {
+		utils.NotFound(c, "订单不存在")
+		return nil, false
+	}
+	return order, true
+}
+
+// 获取组合订单详情
+// @Summary 获取组合订单详情
+// @Description 获取组合订单及其各项目的状态
+// @Tags 预约管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Bearer Token"
+// @Param orderId path int true "订单ID"
+// @Success 200 {object} OrderResponse "成功返回订单详情"
+// @Failure 400 {object} utils.Response "无效的订单ID"
+// @Failure 404 {object} utils.Response "订单不存在"
+// @Router /api/customer/orders/{orderId} [get]
+func GetOrderDetail(c *gin.Context) {
+	order, ok := userOrder(c)
+	if !ok {
+		return
+	}
+
+	utils.Success(c, toOrderResponse(order, orderMerchant(order)))
+}
+
+// 取消组合订单
+// @Summary 取消组合订单
+// @Description 取消订单中全部待确认的项目并释放时间段，恢复优惠券。已有项目被商家确认时需联系商家取消
+// @Tags 预约管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Bearer Token"
+// @Param orderId path int true "订单ID"
+// @Success 200 {string} string "订单已取消"
+// @Failure 400 {object} utils.Response "无效的订单ID或当前状态不允许取消"
+// @Router /api/customer/orders/{orderId}/cancel [put]
+func CancelOrder(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	orderID, err := strconv.Atoi(c.Param("orderId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的订单ID")
+		return
+	}
+
+	if err := models.CancelUserOrder(userID, uint(orderID)); err != nil {
+		utils.BadRequest(c, "取消订单失败: "+err.Error())
+		return
+	}
+
+	utils.Success(c, "订单已取消")
+}
+
+// PayForOrder 为组合订单支付
+// @Summary 为组合订单支付
+// @Description 订单中未取消的项目均被商家确认后，一次支付全部项目
+// @Tags 客户支付
+// @Produce json
+// @Security ApiKeyAuth
+// @Param orderId path int true "订单ID"
+// @Param Authorization header string true "Bearer Token"
+// @Success 200 {object} payment.PrepayResponse "支付预订单信息"
+// @Failure 400 {object} utils.Response "订单状态不允许支付"
+// @Failure 404 {object} utils.Response "订单不存在"
+// @Failure 500 {object} utils.Response "创建支付失败"
+// @Router /api/customer/orders/{orderId}/pay [post]
+func PayForOrder(c *gin.Context) {
+	order, ok := userOrder(c)
+	if !ok {
+		return
+	}
+
+	customer, err := models.GetUserByID(order.UserID)
+	if err != nil {
+		utils.Unauthorized(c, "用户信息错误")
+		return
+	}
+
+	amount, err := models.CheckOrderPayable(order)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	checkout(c, customer, models.Payment{
+		CustomerID: customer.ID,
+		MerchantID: order.MerchantID,
+		OrderID:    order.ID,
+		Amount:     amount,
+	}, order.OrderNo)
+}
@@ -1,16 +1,14 @@
 package customer
 
 import (
-	"admin-api/config"
-	"admin-api/database"
 	"admin-api/models"
 	"admin-api/payment"
 	"admin-api/utils"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"strconv"
-	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -54,6 +52,12 @@ func CreatePayment(c *gin.Context) {
 		return
 	}
 
+	provider, err := payment.ProviderForMerchant(0)
+	if err != nil {
+		utils.InternalError(c, "获取支付渠道失败: "+err.Error())
+		return
+	}
+
 	// 创建本地支付记录
 	paymentRecord := models.Payment{
 		CustomerID:    customer.ID,
@@ -61,7 +65,8 @@ func CreatePayment(c *gin.Context) {
 		Amount:        req.Amount,
 		Description:   req.Description,
 		Status:        models.PaymentStatusPending,
-		OutTradeNo:    utils.GenerateTradeNo("P"),
+		Provider:      provider.Name(),
+		OutTradeNo:    utils.GenerateTradeNo(provider.TradeNoPrefix()),
 	}
 
 	if err := models.CreatePayment(&paymentRecord); err != nil {
@@ -70,25 +75,7 @@ func CreatePayment(c *gin.Context) {
 		return
 	}
 
-	// 调用微信支付
-	prepayResp, err := payment.CreateWechatPayOrder(payment.OutTradeNo(paymentRecord.OutTradeNo),
-		payment.Amount(req.Amount),
-		payment.Description(req.Description),
-		payment.OpenID(customer.Openid),
-	)
-
-	if err != nil {
-		// 更新支付状态为失败
-		fmt.Println(err)
-		paymentRecord.Status = models.PaymentStatusFailed
-		paymentRecord.FailReason = err.Error()
-		models.UpdatePayment(&paymentRecord)
-
-		utils.InternalError(c, "创建微信支付失败: "+err.Error())
-		return
-	}
-
-	utils.Success(c, prepayResp)
+	createOrder(c, provider, customer, &paymentRecord)
 }
 
 // PayForAppointment 为预约支付
@@ -144,78 +131,61 @@ func PayForAppointment(c *gin.Context) {
 		return
 	}
 
-	//模拟支付
-	if config.Config.WechatPay.UseSimulate {
-		// 创建模拟支付记录
-		paymentRecord := models.Payment{
-			CustomerID:    customer.ID,
-			MerchantID:    appointment.MerchantID,
-			AppointmentID: appointment.ID,
-			Amount:        appointment.Amount,
-			Description:   fmt.Sprintf("模拟支付-%s", appointment.OrderNo),
-			Status:        models.PaymentStatusPending,
-			OutTradeNo:    utils.GenerateTradeNo("SIM"), // 添加SIM前缀标识模拟支付
-		}
-
-		if err := models.CreatePayment(&paymentRecord); err != nil {
-			utils.InternalError(c, "创建模拟支付记录失败: "+err.Error())
-			return
-		}
-
-		// 返回模拟支付信息
-		utils.Success(c, gin.H{
-			"simulate":   true,
-			"paymentId":  paymentRecord.ID,
-			"outTradeNo": paymentRecord.OutTradeNo,
-			//"simulateUrl": fmt.Sprintf("%s/pay/simulate?paymentId=%d&outTradeNo=%s",
-			//	config.Config.App.BaseURL, paymentRecord.ID, paymentRecord.OutTradeNo),
-		})
+	if appointment.OrderID != 0 {
+		utils.BadRequest(c, "该预约属于组合订单，请通过订单支付")
 		return
 	}
 
-	// 创建支付请求
-	req := PaymentRequest{
-		Amount:        appointment.Amount, // 单位:分
-		Description:   fmt.Sprintf("预约支付-%s", appointment.OrderNo),
+	checkout(c, customer, models.Payment{
+		CustomerID:    customer.ID,
+		MerchantID:    appointment.MerchantID,
 		AppointmentID: appointment.ID,
-	}
+		Amount:        appointment.Amount,
+	}, appointment.OrderNo)
+}
 
-	paymentRecord := models.Payment{
-		CustomerID:    customer.ID,
-		AppointmentID: req.AppointmentID,
-		Amount:        req.Amount,
-		Description:   req.Description,
-		Status:        models.PaymentStatusPending,
-		OutTradeNo:    utils.GenerateTradeNo("P"),
+// checkout 为预约或组合订单创建支付记录，并通过商家使用的支付渠道下单
+func checkout(c *gin.Context, customer *models.User, paymentRecord models.Payment, orderNo string) {
+	provider, err := payment.ProviderForMerchant(paymentRecord.MerchantID)
+	if err != nil {
+		utils.InternalError(c, "获取支付渠道失败: "+err.Error())
+		return
 	}
 
+	paymentRecord.Status = models.PaymentStatusPending
+	paymentRecord.Provider = provider.Name()
+	paymentRecord.Description = fmt.Sprintf("预约支付-%s", orderNo)
+	paymentRecord.OutTradeNo = utils.GenerateTradeNo(provider.TradeNoPrefix())
+
 	if err := models.CreatePayment(&paymentRecord); err != nil {
 		utils.InternalError(c, "创建支付记录失败: "+err.Error())
 		return
 	}
 
-	// 调用微信支付
-	prepayResp, err := payment.CreateWechatPayOrder(payment.OutTradeNo(paymentRecord.OutTradeNo),
-		payment.Amount(req.Amount),
-		payment.Description(req.Description),
-		payment.OpenID(customer.Openid),
-	)
+	createOrder(c, provider, customer, &paymentRecord)
+}
+
+// createOrder 在支付渠道下单，返回前端调起支付所需的参数，下单失败时支付记录标记为失败
+func createOrder(c *gin.Context, provider payment.Provider, customer *models.User, paymentRecord *models.Payment) {
+	result, err := provider.CreateOrder(payment.OrderRequest{
+		PaymentID:   paymentRecord.ID,
+		OutTradeNo:  paymentRecord.OutTradeNo,
+		Amount:      paymentRecord.Amount,
+		Description: paymentRecord.Description,
+		OpenID:      customer.Openid,
+	})
 
 	if err != nil {
 		// 更新支付状态为失败
 		paymentRecord.Status = models.PaymentStatusFailed
 		paymentRecord.FailReason = err.Error()
-		models.UpdatePayment(&paymentRecord)
+		models.UpdatePayment(paymentRecord)
 
-		utils.InternalError(c, "创建微信支付失败: "+err.Error())
+		utils.InternalError(c, "创建支付失败: "+err.Error())
 		return
 	}
 
-	utils.Success(c, prepayResp)
-
-	// 使用CreatePayment逻辑
-	//c.Set("paymentRequest", req)
-	//CreatePayment(c)
+	utils.Success(c, result)
 }
 
 // GetPayment 获取支付状态
@@ -257,7 +227,8 @@ func GetPayment(c *gin.Context) {
 
 // HandlePaymentNotify 支付回调通知
 // @Summary 微信支付回调
-// @Description 微信支付结果通知
+// @Description 微信支付结果通知，由 wechat_pay.api_version 选择的微信支付渠道处理。v2 为签名的XML；
+// @Description v3 为签名的JSON，支付和退款结果均通知到此地址，内容经 AES-256-GCM 加密
 // @Tags 支付回调
 // @Accept xml
 // @Produce xml
@@ -265,141 +236,62 @@ func GetPayment(c *gin.Context) {
 // @Success 200 {object} payment.WechatNotifyResponse "处理结果"
 // @Router /api/customer/payments/notify [post]
 func HandlePaymentNotify(c *gin.Context) {
-	var notifyReq payment.WechatNotifyRequest
-
-	// 解析XML请求
-	if err := c.ShouldBindXML(&notifyReq); err != nil {
-		c.XML(http.StatusBadRequest, payment.WechatNotifyResponse{
-			ReturnCode: "FAIL",
-			ReturnMsg:  "解析XML失败",
-		})
-		return
-	}
-
-	// 验证签名
-	if valid := payment.VerifyWechatSign(notifyReq, config.Config.WechatPay.APIKey); !valid {
-		c.XML(http.StatusBadRequest, payment.WechatNotifyResponse{
-			ReturnCode: "FAIL",
-			ReturnMsg:  "签名验证失败",
-		})
-		return
-	}
+	handleProviderNotify(c, payment.WechatProvider())
+}
 
-	// 处理支付结果
-	err := payment.HandlePaymentResult(notifyReq)
+// HandleProviderNotify 指定支付渠道的回调通知
+// @Summary 支付渠道回调
+// @Description 按路径中的渠道名称（wechat_v2, wechat_v3, simulate）验签并处理支付或退款结果，应答格式由渠道决定
+// @Tags 支付回调
+// @Param provider path string true "支付渠道"
+// @Success 200 {string} string "处理结果"
+// @Failure 404 {object} utils.Response "不支持的支付渠道"
+// @Router /api/customer/payments/notify/{provider} [post]
+func HandleProviderNotify(c *gin.Context) {
+	provider, err := payment.GetProvider(c.Param("provider"))
 	if err != nil {
-		// 记录错误日志
-		//utils.LogError("支付回调处理失败", "out_trade_no", notifyReq.OutTradeNo, "error", err.Error())
-
-		c.XML(http.StatusOK, payment.WechatNotifyResponse{
-			ReturnCode: "FAIL",
-			ReturnMsg:  "处理失败",
-		})
+		c.JSON(http.StatusNotFound, utils.Response{Code: http.StatusNotFound, Msg: err.Error()})
 		return
 	}
-
-	// 返回成功响应
-	c.XML(http.StatusOK, payment.WechatNotifyResponse{
-		ReturnCode: "SUCCESS",
-		ReturnMsg:  "OK",
-	})
-}
-
-// SimulatePaymentNotifyRequest 模拟支付回调请求
-type SimulatePaymentNotifyRequest struct {
-	PaymentID  uint   `json:"paymentId" binding:"required"`
-	OutTradeNo string `json:"outTradeNo" binding:"required"`
-	Status     string `json:"status" binding:"required,oneof=success failed"`
+	handleProviderNotify(c, provider)
 }
 
 // HandleSimulatePaymentNotify 模拟支付回调
 // @Summary 模拟支付回调
-// @Description 用于开发环境的模拟支付回调
+// @Description 用于开发环境的模拟支付回调，仅处理模拟支付渠道创建的支付单，未开启 use_simulate 时返回 404
 // @Tags 支付回调
 // @Accept json
 // @Produce json
-// @Param body body SimulatePaymentNotifyRequest true "回调数据"
+// @Param body body payment.SimulateNotifyRequest true "回调数据"
 // @Success 200 {object} utils.Response
+// @Failure 404 {object} utils.Response "未开启模拟支付"
 // @Router /api/customer/payments/simulate-notify [post]
 func HandleSimulatePaymentNotify(c *gin.Context) {
-	var req SimulatePaymentNotifyRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.BadRequest(c, "参数错误: "+err.Error())
-		return
-	}
-
-	// 获取支付记录
-	payment, err := models.GetPaymentByID(req.PaymentID)
+	// 未开启模拟支付时模拟渠道未注册
+	provider, err := payment.GetProvider(payment.ProviderSimulate)
 	if err != nil {
-		utils.NotFound(c, "支付记录不存在")
+		c.JSON(http.StatusNotFound, utils.Response{Code: http.StatusNotFound, Msg: "未开启模拟支付"})
 		return
 	}
+	handleProviderNotify(c, provider)
+}
 
-	// 验证订单号
-	if payment.OutTradeNo != req.OutTradeNo {
-		utils.BadRequest(c, "订单号不匹配")
-		return
-	}
-
-	// 验证是模拟支付
-	if !strings.HasPrefix(payment.OutTradeNo, "SIM") {
-		utils.Forbidden(c, "仅支持模拟支付订单")
-		return
-	}
-
-	// 使用事务确保数据一致性
-	tx := database.DB.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-
-	// 更新支付状态
-	updateData := map[string]interface{}{
-		"status": req.Status,
-	}
-
-	if req.Status == models.PaymentStatusSucceeded {
-		now := time.Now()
-		updateData["paid_at"] = &now
+// handleProviderNotify 验签、解析并处理回调，按渠道要求的格式应答
+func handleProviderNotify(c *gin.Context, provider payment.Provider) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err == nil {
+		err = provider.VerifySignature(c.Request.Header, body)
 	}
-
-	if err := tx.Model(&models.Payment{}).
-		Where("id = ?", payment.ID).
-		Updates(updateData).Error; err != nil {
-		tx.Rollback()
-		utils.InternalError(c, "更新支付状态失败: "+err.Error())
-		return
+	var notification *payment.Notification
+	if err == nil {
+		notification, err = provider.ParseNotify(c.Request.Header, body)
 	}
-
-	// 只有在支付成功时才更新预约状态
-	if req.Status == models.PaymentStatusSucceeded {
-		// 获取关联的预约
-		appointment, err := models.GetAppointmentByID(payment.AppointmentID)
-		if err != nil {
-			tx.Rollback()
-			utils.InternalError(c, "获取预约信息失败: "+err.Error())
-			return
-		}
-
-		// 更新预约状态为已确认
-		appointment.Status = models.AppointmentStatusCompleted
-		appointment.PaymentID = payment.ID
-		//appointment.PaymentStatus = models.PaymentStatusSucceeded
-
-		if err := tx.Save(&appointment).Error; err != nil {
-			tx.Rollback()
-			utils.InternalError(c, "更新预约状态失败: "+err.Error())
-			return
-		}
+	if err == nil {
+		err = payment.HandleNotification(provider, notification)
 	}
-
-	// 提交事务
-	if err := tx.Commit().Error; err != nil {
-		utils.InternalError(c, "提交事务失败: "+err.Error())
-		return
+	if err != nil {
+		log.Printf("%s 回调处理失败: %v", provider.Name(), err)
 	}
 
-	utils.Success(c, "支付状态更新成功")
+	provider.WriteNotifyResponse(c.Writer, err)
 }
@@ -0,0 +1,261 @@
+package customer
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"admin-api/models"
+	"admin-api/payment"
+	"admin-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateRefundRequestRequest struct {
+	Amount int    `json:"amount" binding:"required,min=1"` // 申请退款金额(分)
+	Reason string `json:"reason" binding:"required"`       // 申请原因
+}
+
+type RefundRequestResponse struct {
+	ID              uint                        `json:"id"`
+	AppointmentID   uint                        `json:"appointment_id"`
+	OrderNo         string                      `json:"order_no"`
+	MerchantName    string                      `json:"merchant_name"`
+	ServiceName     string                      `json:"service_name"`
+	AppointmentDate string                      `json:"appointment_date"`
+	StartTime       string                      `json:"start_time"`
+	Amount          int                         `json:"amount"`                    // 申请退款金额(分)
+	Reason          string                      `json:"reason"`                    // 申请原因
+	Status          string                      `json:"status"`                    // pending, countered, approved, rejected, withdrawn
+	CounterAmount   int                         `json:"counter_amount,omitempty"`  // 商家提出的退款金额(分)
+	ApprovedAmount  int                         `json:"approved_amount,omitempty"` // 最终退款金额(分)
+	MerchantReply   string                      `json:"merchant_reply"`            // 商家答复
+	Refund          *models.Refund              `json:"refund,omitempty"`          // 同意后的退款记录，仅详情返回
+	Events          []models.RefundRequestEvent `json:"events,omitempty"`          // 处理记录，仅详情返回
+	CreatedAt       string                      `json:"created_at"`                // RFC3339，带时区偏移
+	UpdatedAt       string                      `json:"updated_at"`                // RFC3339，带时区偏移
+}
+
+func toRefundRequestResponse(r *models.RefundRequest) RefundRequestResponse {
+	loc := r.Appointment.Merchant.Location()
+	return RefundRequestResponse{
+		ID:              r.ID,
+		AppointmentID:   r.AppointmentID,
+		OrderNo:         r.Appointment.OrderNo,
+		MerchantName:    r.Appointment.Merchant.Name,
+		ServiceName:     r.Appointment.Service.Name,
+		AppointmentDate: r.Appointment.AppointmentDate.Format("2006-01-02"),
+		StartTime:       r.Appointment.StartTime,
+		Amount:          r.Amount,
+		Reason:          r.Reason,
+		Status:          r.Status,
+		CounterAmount:   r.CounterAmount,
+		ApprovedAmount:  r.ApprovedAmount,
+		MerchantReply:   r.MerchantReply,
+		CreatedAt:       r.CreatedAt.In(loc).Format(time.RFC3339),
+		UpdatedAt:       r.UpdatedAt.In(loc).Format(time.RFC3339),
+	}
+}
+
+// refundRequestDetail 读取退款申请详情，包含处理记录和退款记录
+func refundRequestDetail(userID, requestID uint) (*RefundRequestResponse, error) {
+	request, events, err := models.GetRefundRequestDetail(userID, 0, requestID)
+	if err != nil {
+		return nil, err
+	}
+	response := toRefundRequestResponse(request)
+	response.Events = events
+	if request.RefundID != 0 {
+		if refund, err := models.GetRefundByID(request.RefundID); err == nil {
+			response.Refund = refund
+		}
+	}
+	return &response, nil
+}
+
+// 申请退款
+// @Summary 申请退款
+// @Description 为已支付的预约向商家申请退款，商家可同意、拒绝或提出新的退款金额
+// @Tags 退款申请
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param appointmentId path int true "预约ID"
+// @Param Authorization header string true "Bearer Token"
+// @Param body body CreateRefundRequestRequest true "退款金额和原因"
+// @Success 200 {object} RefundRequestResponse "申请已提交"
+// @Failure 400 {object} utils.Response "参数错误或当前不能申请退款"
+// @Router /api/customer/appointments/{appointmentId}/refund-requests [post]
+func CreateRefundRequest(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	appointmentID, err := strconv.Atoi(c.Param("appointmentId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的预约ID")
+		return
+	}
+
+	var req CreateRefundRequestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	request, err := models.CreateRefundRequest(userID, uint(appointmentID), req.Amount, req.Reason)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	response, err := refundRequestDetail(userID, request.ID)
+	if err != nil {
+		utils.InternalError(c, "获取退款申请失败")
+		return
+	}
+	utils.Success(c, response)
+}
+
+// 获取我的退款申请
+// @Summary 获取我的退款申请
+// @Description 获取当前用户的退款申请列表，可按状态筛选
+// @Tags 退款申请
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Bearer Token"
+// @Param status query string false "申请状态" Enums(pending, countered, approved, rejected, withdrawn)
+// @Success 200 {array} RefundRequestResponse "退款申请列表"
+// @Failure 500 {object} utils.Response "获取退款申请失败"
+// @Router /api/customer/refund-requests [get]
+func GetUserRefundRequests(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	requests, err := models.GetUserRefundRequests(userID, c.Query("status"))
+	if err != nil {
+		utils.InternalError(c, "获取退款申请失败")
+		return
+	}
+
+	response := make([]RefundRequestResponse, 0, len(requests))
+	for i := range requests {
+		response = append(response, toRefundRequestResponse(&requests[i]))
+	}
+	utils.Success(c, response)
+}
+
+// 获取退款申请详情
+// @Summary 获取退款申请详情
+// @Description 获取退款申请、处理记录及退款结果
+// @Tags 退款申请
+// @Produce json
+// @Security ApiKeyAuth
+// @Param requestId path int true "退款申请ID"
+// @Param Authorization header string true "Bearer Token"
+// @Success 200 {object} RefundRequestResponse "退款申请详情"
+// @Failure 400 {object} utils.Response "无效的退款申请ID"
+// @Failure 404 {object} utils.Response "退款申请不存在"
+// @Router /api/customer/refund-requests/{requestId} [get]
+func GetRefundRequestDetail(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	requestID, err := strconv.Atoi(c.Param("requestId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的退款申请ID")
+		return
+	}
+
+	response, err := refundRequestDetail(userID, uint(requestID))
+	if err != nil {
+		utils.NotFound(c, "退款申请不存在")
+		return
+	}
+	utils.Success(c, response)
+}
+
+// 接受商家提出的退款金额
+// @Summary 接受商家提出的退款金额
+// @Description 接受商家提出的新退款金额，按该金额原路退款
+// @Tags 退款申请
+// @Produce json
+// @Security ApiKeyAuth
+// @Param requestId path int true "退款申请ID"
+// @Param Authorization header string true "Bearer Token"
+// @Success 200 {object} RefundRequestResponse "已接受并发起退款"
+// @Failure 400 {object} utils.Response "无效的退款申请ID或当前状态不能接受"
+// @Failure 500 {object} utils.Response "发起退款失败"
+// @Router /api/customer/refund-requests/{requestId}/accept [put]
+func AcceptRefundCounter(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	requestID, err := strconv.Atoi(c.Param("requestId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的退款申请ID")
+		return
+	}
+
+	request, refund, err := models.AcceptRefundCounter(userID, uint(requestID))
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	if err := payment.ExecuteRefund(refund, models.ActorCustomer, userID); err != nil {
+		log.Printf("退款申请 %d 发起退款失败: %v", request.ID, err)
+		if reopenErr := models.ReopenRefundRequest(request.ID, "发起退款失败: "+err.Error()); reopenErr != nil {
+			log.Printf("退款申请 %d 状态恢复失败: %v", request.ID, reopenErr)
+		}
+		utils.InternalError(c, "发起退款失败，请稍后重试: "+err.Error())
+		return
+	}
+
+	response, err := refundRequestDetail(userID, request.ID)
+	if err != nil {
+		utils.InternalError(c, "获取退款申请失败")
+		return
+	}
+	utils.Success(c, response)
+}
+
+type WithdrawRefundRequestRequest struct {
+	Remark string `json:"remark"` // 可选，撤回原因
+}
+
+// 撤回退款申请
+// @Summary 撤回退款申请
+// @Description 撤回待处理的退款申请，或不接受商家提出的退款金额
+// @Tags 退款申请
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param requestId path int true "退款申请ID"
+// @Param Authorization header string true "Bearer Token"
+// @Param body body WithdrawRefundRequestRequest false "撤回原因"
+// @Success 200 {object} RefundRequestResponse "已撤回"
+// @Failure 400 {object} utils.Response "无效的退款申请ID或当前状态不能撤回"
+// @Router /api/customer/refund-requests/{requestId}/withdraw [put]
+func WithdrawRefundRequest(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	requestID, err := strconv.Atoi(c.Param("requestId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的退款申请ID")
+		return
+	}
+
+	var req WithdrawRefundRequestRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.BadRequest(c, "参数错误")
+			return
+		}
+	}
+
+	request, err := models.WithdrawRefundRequest(userID, uint(requestID), req.Remark)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	response, err := refundRequestDetail(userID, request.ID)
+	if err != nil {
+		utils.InternalError(c, "获取退款申请失败")
+		return
+	}
+	utils.Success(c, response)
+}
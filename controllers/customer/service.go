@@ -44,13 +44,14 @@ func GetMerchantServices(c *gin.Context) {
 
 // 获取服务可选员工
 // @Summary 获取服务的可用员工
-// @Description 根据服务ID获取可提供该服务的员工列表
+// @Description 根据服务ID获取服务所属商家中可提供该服务的在职员工，Price 和 Duration 为该员工的实际价格和时长
 // @Tags 服务管理
 // @Accept json
 // @Produce json
 // @Param serviceId path int true "服务ID" Example(789)
-// @Success 200 {array} models.Staff "成功返回可用员工列表"
+// @Success 200 {array} models.ServiceStaff "成功返回可用员工列表"
 // @Failure 400 {object} utils.Response "无效的服务ID"
+// @Failure 404 {object} utils.Response "服务不存在"
 // @Failure 500 {object} utils.Response "获取可选员工失败"
 // @Router /api/customer/services/{serviceId}/staff [get]
 func GetServiceAvailableStaff(c *gin.Context) {
@@ -60,6 +61,11 @@ func GetServiceAvailableStaff(c *gin.Context) {
 		return
 	}
 
+	if _, err := models.GetServiceByID(uint(serviceID)); err != nil {
+		utils.NotFound(c, "服务不存在")
+		return
+	}
+
 	staff, err := models.GetServiceAvailableStaff(uint(serviceID))
 	if err != nil {
 		utils.InternalError(c, "获取可选员工失败")
@@ -111,9 +117,11 @@ func GetAvailableDates(c *gin.Context) {
 
 // 转换格式
 type SlotResponse struct {
-	ID        uint   `json:"id"`
-	StartTime string `json:"start_time"`
-	EndTime   string `json:"end_time"`
+	ID             uint   `json:"id"`
+	StartTime      string `json:"start_time"`
+	EndTime        string `json:"end_time"`
+	Capacity       int    `json:"capacity"`        // 可预约人数
+	RemainingSeats int    `json:"remaining_seats"` // 剩余名额
 }
 
 // 获取某天的可预约时间段
@@ -125,6 +133,7 @@ type SlotResponse struct {
 // @Security ApiKeyAuth
 // @Param merchantId query int true "商家ID"
 // @Param staffId query int true "技师ID"
+// @Param serviceId query int false "服务ID，传入时只返回能容纳该员工服务时长的起始时间段"
 // @Param date query string true "日期 (格式: YYYY-MM-DD)" Example(2023-06-15)
 // @Param Authorization header string true "Bearer Token"
 // @Success 200 {array} SlotResponse "成功返回可预约时间段列表"
@@ -151,7 +160,17 @@ func GetTimeSlots(c *gin.Context) {
 		return
 	}
 
-	slots, err := models.GetAvailableTimeSlots(uint(merchantID), uint(staffID), date)
+	// 按服务时长和前后缓冲时间过滤
+	var service *models.Service
+	if serviceID, _ := strconv.Atoi(c.Query("serviceId")); serviceID > 0 {
+		service, err = models.GetStaffService(uint(serviceID), uint(staffID))
+		if err != nil {
+			utils.BadRequest(c, err.Error())
+			return
+		}
+	}
+
+	slots, err := models.GetAvailableTimeSlots(uint(merchantID), uint(staffID), date, service)
 	if err != nil {
 		utils.InternalError(c, "获取时间段失败")
 		return
@@ -160,9 +179,11 @@ func GetTimeSlots(c *gin.Context) {
 	var response []SlotResponse
 	for _, slot := range slots {
 		response = append(response, SlotResponse{
-			ID:        slot.ID,
-			StartTime: slot.StartTime,
-			EndTime:   slot.EndTime,
+			ID:             slot.ID,
+			StartTime:      slot.StartTime,
+			EndTime:        slot.EndTime,
+			Capacity:       slot.Capacity,
+			RemainingSeats: slot.RemainingSeats(),
 		})
 	}
 
@@ -176,6 +197,7 @@ type CreateAppointmentRequest struct {
 	TimeSlotID uint   `json:"time_slot_id" binding:"required"`
 	Date       string `json:"date" binding:"required"`
 	CouponID   uint   `json:"coupon_id"` // 可选
+	HoldID     string `json:"hold_id"`   // 可选，结账前预留的ID
 	Remark     string `json:"remark"`
 }
 
@@ -210,6 +232,15 @@ func CreateAppointment(c *gin.Context) {
 		return
 	}
 
+	// 带预留ID时校验预留仍然有效
+	if req.HoldID != "" {
+		hold, err := models.GetSlotHold(userID, req.HoldID)
+		if err != nil || hold.TimeSlotID != req.TimeSlotID {
+			utils.BadRequest(c, "预留不存在或已过期")
+			return
+		}
+	}
+
 	// 创建预约
 	appointment, err := models.CreateCustomerAppointment(userID, req.MerchantID, req.ServiceID,
 		req.StaffID, req.TimeSlotID, date, req.CouponID, req.Remark)
@@ -227,3 +258,99 @@ func CreateAppointment(c *gin.Context) {
 		"status":           appointment.Status,
 	})
 }
+
+type CreateAnyStaffAppointmentRequest struct {
+	MerchantID uint   `json:"merchant_id" binding:"required"`
+	ServiceID  uint   `json:"service_id" binding:"required"`
+	Date       string `json:"date" binding:"required"`       // YYYY-MM-DD
+	StartTime  string `json:"start_time" binding:"required"` // HH:MM
+	CouponID   uint   `json:"coupon_id"`                     // 可选
+	Remark     string `json:"remark"`
+}
+
+// 不指定员工预约
+// @Summary 不指定员工预约
+// @Description 用户只选择服务、日期和开始时间，系统按商家配置的分配方式（轮流、当天预约最少、评分最高）分配有空的员工
+// @Tags 预约管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Bearer Token"
+// @Param body body CreateAnyStaffAppointmentRequest true "预约创建请求"
+// @Success 200 {object} utils.Response "成功返回预约信息及分配的员工"
+// @Failure 400 {object} utils.Response "参数错误或日期格式错误"
+// @Failure 500 {object} utils.Response "创建预约失败"
+// @Router /api/customer/appointments/any-staff [post]
+func CreateAnyStaffAppointment(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req CreateAnyStaffAppointmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	date, err := time.Parse("2006-01-02", req.Date)
+	if err != nil {
+		utils.BadRequest(c, "日期格式错误")
+		return
+	}
+
+	appointment, err := models.CreateAnyStaffAppointment(userID, req.MerchantID, req.ServiceID, date, req.StartTime,
+		req.CouponID, req.Remark)
+	if err != nil {
+		utils.InternalError(c, "创建预约失败: "+err.Error())
+		return
+	}
+
+	utils.Success(c, gin.H{
+		"appointment_id":   appointment.ID,
+		"order_no":         appointment.OrderNo,
+		"staff_id":         appointment.StaffID,
+		"time_slot_id":     appointment.TimeSlotID,
+		"appointment_date": appointment.AppointmentDate.Format("2006-01-02"),
+		"start_time":       appointment.StartTime,
+		"end_time":         appointment.EndTime,
+		"status":           appointment.Status,
+	})
+}
+
+// 获取不指定员工时的可预约时间
+// @Summary 获取不指定员工时的可预约时间
+// @Description 查询某天至少有一位可提供该服务的员工有空的开始时间，用于不指定员工预约
+// @Tags 时间槽管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param merchantId query int true "商家ID"
+// @Param serviceId query int true "服务ID"
+// @Param date query string true "日期 (格式: YYYY-MM-DD)" Example(2023-06-15)
+// @Param Authorization header string true "Bearer Token"
+// @Success 200 {array} string "成功返回开始时间列表（HH:MM格式）"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 500 {object} utils.Response "获取时间失败"
+// @Router /api/customer/timeslots/any-staff [get]
+func GetAnyStaffTimes(c *gin.Context) {
+	merchantID, err := strconv.Atoi(c.Query("merchantId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的商家ID")
+		return
+	}
+	serviceID, err := strconv.Atoi(c.Query("serviceId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的服务ID")
+		return
+	}
+	date, err := time.Parse("2006-01-02", c.Query("date"))
+	if err != nil {
+		utils.BadRequest(c, "无效的日期格式")
+		return
+	}
+
+	times, err := models.GetAnyStaffStartTimes(uint(merchantID), uint(serviceID), date)
+	if err != nil {
+		utils.InternalError(c, "获取时间失败")
+		return
+	}
+
+	utils.Success(c, times)
+}
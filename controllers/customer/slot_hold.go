@@ -0,0 +1,98 @@
+package customer
+
+import (
+	"admin-api/common/constant"
+	"admin-api/models"
+	"admin-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateSlotHoldRequest struct {
+	MerchantID uint `json:"merchant_id" binding:"required"`
+	ServiceID  uint `json:"service_id" binding:"required"`
+	StaffID    uint `json:"staff_id" binding:"required"`
+	TimeSlotID uint `json:"time_slot_id" binding:"required"`
+	Minutes    int  `json:"minutes"` // 预留时长（分钟），默认10，最长30
+}
+
+// @Summary 预留时间段
+// @Description 在结账期间临时预留时间段，预留期间其他用户无法预约该名额，到期自动释放。每个用户同时只保留一个预留，创建预约时自动消费
+// @Tags 预约管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Bearer Token"
+// @Param body body CreateSlotHoldRequest true "预留信息"
+// @Success 200 {object} models.SlotHold "成功返回预留信息"
+// @Failure 400 {object} utils.Response "参数错误或时间段不可预约"
+// @Router /api/customer/holds [post]
+func CreateSlotHold(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req CreateSlotHoldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	minutes := req.Minutes
+	if minutes == 0 {
+		minutes = constant.SlotHoldDefaultMinutes
+	}
+	if minutes < 1 || minutes > constant.SlotHoldMaxMinutes {
+		utils.BadRequest(c, "无效的预留时长")
+		return
+	}
+
+	hold, err := models.CreateSlotHold(userID, req.MerchantID, req.ServiceID, req.StaffID, req.TimeSlotID, minutes)
+	if err != nil {
+		utils.BadRequest(c, "预留失败: "+err.Error())
+		return
+	}
+
+	utils.Success(c, hold)
+}
+
+// @Summary 获取预留
+// @Description 获取当前用户的时间段预留，已过期时返回错误
+// @Tags 预约管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Bearer Token"
+// @Param holdId path string true "预留ID"
+// @Success 200 {object} models.SlotHold "成功返回预留信息"
+// @Failure 404 {object} utils.Response "预留不存在或已过期"
+// @Router /api/customer/holds/{holdId} [get]
+func GetSlotHold(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	hold, err := models.GetSlotHold(userID, c.Param("holdId"))
+	if err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+
+	utils.Success(c, hold)
+}
+
+// @Summary 释放预留
+// @Description 放弃结账时主动释放时间段预留
+// @Tags 预约管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Bearer Token"
+// @Param holdId path string true "预留ID"
+// @Success 200 {object} utils.Response "释放成功"
+// @Failure 404 {object} utils.Response "预留不存在或已过期"
+// @Router /api/customer/holds/{holdId} [delete]
+func ReleaseSlotHold(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	if err := models.ReleaseSlotHold(userID, c.Param("holdId")); err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+
+	utils.Success(c, "预留已释放")
+}
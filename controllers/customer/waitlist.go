@@ -0,0 +1,187 @@
+package customer
+
+import (
+	"strconv"
+	"time"
+
+	"admin-api/models"
+	"admin-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JoinWaitlistRequest struct {
+	MerchantID uint   `json:"merchant_id" binding:"required"`
+	ServiceID  uint   `json:"service_id" binding:"required"`
+	StaffID    uint   `json:"staff_id" binding:"required"`
+	TimeSlotID uint   `json:"time_slot_id" binding:"required"`
+	Remark     string `json:"remark"`
+}
+
+type WaitlistResponse struct {
+	ID            uint   `json:"id"`
+	MerchantName  string `json:"merchant_name"`
+	ServiceName   string `json:"service_name"`
+	StaffName     string `json:"staff_name"`
+	TimeSlotID    uint   `json:"time_slot_id"`
+	Date          string `json:"date"`
+	StartTime     string `json:"start_time"`
+	EndTime       string `json:"end_time"`
+	Status        string `json:"status"`                    // waiting, held, booked, expired, cancelled
+	Position      int    `json:"position,omitempty"`        // 排队位置，仅排队中返回
+	HoldExpiresAt string `json:"hold_expires_at,omitempty"` // 保留名额截止时间，仅已保留时返回
+	AppointmentID uint   `json:"appointment_id,omitempty"`
+	Timezone      string `json:"timezone"`   // 商家时区，日期和时间均为该时区的当地时间
+	CreatedAt     string `json:"created_at"` // RFC3339，带时区偏移
+}
+
+// @Summary 加入候补
+// @Description 时间段约满时加入候补名单，有人取消后按加入顺序为候补用户保留名额或直接预约
+// @Tags 预约管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Bearer Token"
+// @Param body body JoinWaitlistRequest true "候补信息"
+// @Success 200 {object} models.WaitlistEntry "成功返回候补记录"
+// @Failure 400 {object} utils.Response "参数错误或时间段仍可预约"
+// @Router /api/customer/waitlist [post]
+func JoinWaitlist(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req JoinWaitlistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	entry, err := models.JoinWaitlist(userID, req.MerchantID, req.ServiceID, req.StaffID, req.TimeSlotID, req.Remark)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.Success(c, entry)
+}
+
+// @Summary 获取我的候补
+// @Description 获取当前用户的候补记录及排队位置
+// @Tags 预约管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Bearer Token"
+// @Success 200 {array} WaitlistResponse "成功返回候补列表"
+// @Failure 500 {object} utils.Response "获取候补列表失败"
+// @Router /api/customer/waitlist [get]
+func GetUserWaitlist(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	entries, err := models.GetUserWaitlist(userID)
+	if err != nil {
+		utils.InternalError(c, "获取候补列表失败")
+		return
+	}
+
+	response := make([]WaitlistResponse, 0, len(entries))
+	for i, e := range entries {
+		loc := e.Merchant.Location()
+		item := WaitlistResponse{
+			ID:            e.ID,
+			MerchantName:  e.Merchant.Name,
+			ServiceName:   e.Service.Name,
+			StaffName:     e.Staff.Name,
+			TimeSlotID:    e.TimeSlotID,
+			Date:          e.Date.Format("2006-01-02"),
+			StartTime:     e.StartTime,
+			EndTime:       e.EndTime,
+			Status:        e.Status,
+			AppointmentID: e.AppointmentID,
+			Timezone:      loc.String(),
+			CreatedAt:     e.CreatedAt.In(loc).Format(time.RFC3339),
+		}
+		if position, err := models.GetWaitlistPosition(&entries[i]); err == nil {
+			item.Position = position
+		}
+		if e.Status == models.WaitlistStatusHeld && e.HoldExpiresAt != nil {
+			item.HoldExpiresAt = e.HoldExpiresAt.In(loc).Format(time.RFC3339)
+		}
+		response = append(response, item)
+	}
+
+	utils.Success(c, response)
+}
+
+// @Summary 退出候补
+// @Description 退出候补名单，已为自己保留的名额会释放给下一位候补用户
+// @Tags 预约管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Bearer Token"
+// @Param waitlistId path int true "候补记录ID"
+// @Success 200 {object} utils.Response "退出成功"
+// @Failure 400 {object} utils.Response "无效的候补记录ID或当前状态不允许取消"
+// @Router /api/customer/waitlist/{waitlistId} [delete]
+func CancelWaitlist(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	entryID, err := strconv.Atoi(c.Param("waitlistId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的候补记录ID")
+		return
+	}
+
+	if err := models.CancelWaitlistEntry(userID, uint(entryID)); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.Success(c, "已退出候补")
+}
+
+type BookFromWaitlistRequest struct {
+	CouponID uint   `json:"coupon_id"` // 可选
+	Remark   string `json:"remark"`
+}
+
+// @Summary 确认候补预约
+// @Description 在保留时限内将候补转为正式预约
+// @Tags 预约管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Bearer Token"
+// @Param waitlistId path int true "候补记录ID"
+// @Param body body BookFromWaitlistRequest false "优惠券和备注"
+// @Success 200 {object} utils.Response "成功返回预约信息"
+// @Failure 400 {object} utils.Response "无效的候补记录ID或名额已过期"
+// @Router /api/customer/waitlist/{waitlistId}/book [post]
+func BookFromWaitlist(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	entryID, err := strconv.Atoi(c.Param("waitlistId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的候补记录ID")
+		return
+	}
+
+	var req BookFromWaitlistRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.BadRequest(c, "参数错误")
+			return
+		}
+	}
+
+	appointment, err := models.BookFromWaitlist(userID, uint(entryID), req.CouponID, req.Remark)
+	if err != nil {
+		utils.BadRequest(c, "预约失败: "+err.Error())
+		return
+	}
+
+	utils.Success(c, gin.H{
+		"appointment_id":   appointment.ID,
+		"order_no":         appointment.OrderNo,
+		"appointment_date": appointment.AppointmentDate.Format("2006-01-02"),
+		"start_time":       appointment.StartTime,
+		"end_time":         appointment.EndTime,
+		"status":           appointment.Status,
+	})
+}
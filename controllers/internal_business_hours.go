@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"errors"
+	"strconv"
+
+	"admin-api/models"
+	"admin-api/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary 获取商家营业时间
+// @Description 内部接口：获取指定商家的每周营业时段和例外日期
+// @Tags 内部管理
+// @Produce json
+// @Param merchantId path int true "商家ID"
+// @Success 200 {object} models.BusinessHoursSchedule "成功返回营业时间"
+// @Failure 400 {object} utils.Response "无效的商家ID"
+// @Failure 404 {object} utils.Response "商家不存在"
+// @Failure 500 {object} utils.Response "服务器错误"
+// @Router /api/internal/merchants/{merchantId}/business-hours [get]
+func GetMerchantBusinessHours(c *gin.Context) {
+	merchantID, err := strconv.Atoi(c.Param("merchantId"))
+	if err != nil || merchantID <= 0 {
+		utils.BadRequest(c, "无效的商家ID")
+		return
+	}
+
+	if _, err := models.GetMerchantByID(uint(merchantID)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.NotFound(c, "商家不存在")
+		} else {
+			utils.InternalError(c, "获取商家信息失败: "+err.Error())
+		}
+		return
+	}
+
+	schedule, err := models.GetMerchantBusinessHours(uint(merchantID))
+	if err != nil {
+		utils.InternalError(c, "获取营业时间失败: "+err.Error())
+		return
+	}
+
+	utils.Success(c, schedule)
+}
+
+// @Summary 设置商家营业时间
+// @Description 内部接口：整体替换指定商家的每周营业时段和例外日期
+// @Tags 内部管理
+// @Accept json
+// @Produce json
+// @Param merchantId path int true "商家ID"
+// @Param body body models.BusinessHoursRequest true "营业时间"
+// @Success 200 {object} utils.Response "设置成功"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 404 {object} utils.Response "商家不存在"
+// @Failure 500 {object} utils.Response "服务器错误"
+// @Router /api/internal/merchants/{merchantId}/business-hours [put]
+func UpdateMerchantBusinessHours(c *gin.Context) {
+	merchantID, err := strconv.Atoi(c.Param("merchantId"))
+	if err != nil || merchantID <= 0 {
+		utils.BadRequest(c, "无效的商家ID")
+		return
+	}
+
+	var req models.BusinessHoursRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误: "+err.Error())
+		return
+	}
+
+	if _, err := models.GetMerchantByID(uint(merchantID)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.NotFound(c, "商家不存在")
+		} else {
+			utils.InternalError(c, "获取商家信息失败: "+err.Error())
+		}
+		return
+	}
+
+	schedule, err := req.ToSchedule()
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	if err := models.ValidateBusinessHours(schedule); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	if err := models.SetMerchantBusinessHours(uint(merchantID), schedule); err != nil {
+		utils.InternalError(c, "设置营业时间失败: "+err.Error())
+		return
+	}
+
+	utils.Success(c, "营业时间设置成功")
+}
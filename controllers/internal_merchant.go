@@ -20,6 +20,7 @@ type RegisterMerchantRequest struct {
 	Description  string `json:"description"`
 	Logo         string `json:"logo"`
 	BusinessHour string `json:"business_hour"`
+	Timezone     string `json:"timezone"` // IANA时区，如 Asia/Shanghai，不传时使用默认时区
 }
 
 // @Summary 注册新商家
@@ -50,6 +51,14 @@ func RegisterMerchant(c *gin.Context) {
 		return
 	}
 
+	if req.Timezone == "" {
+		req.Timezone = models.DefaultMerchantTimezone
+	}
+	if err := models.ValidateTimezone(req.Timezone); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
 	// 调用模型层创建商家
 	merchant, err := models.CreateMerchant(
 		req.Name,
@@ -58,6 +67,7 @@ func RegisterMerchant(c *gin.Context) {
 		req.Description,
 		req.Logo,
 		req.BusinessHour,
+		req.Timezone,
 	)
 
 	if err != nil {
@@ -567,3 +577,49 @@ func UploadBannerImage(c *gin.Context) {
 	imageURL := config.Config.Server.Address + "/uploads/banners/" + newFilename
 	utils.Success(c, gin.H{"image_url": imageURL})
 }
+
+type UpdateMerchantTimezoneRequest struct {
+	Timezone string `json:"timezone" binding:"required"` // IANA时区，如 Asia/Shanghai、America/New_York
+}
+
+// @Summary 设置商家时区
+// @Description 内部接口：设置商家所在时区，营业时间、可预约时间段和统计均按该时区计算
+// @Tags 内部管理
+// @Accept json
+// @Produce json
+// @Param merchantId path int true "商家ID"
+// @Param body body UpdateMerchantTimezoneRequest true "时区"
+// @Success 200 {object} utils.Response "设置成功"
+// @Failure 400 {object} utils.Response "参数错误或无效的时区"
+// @Failure 404 {object} utils.Response "商家不存在"
+// @Failure 500 {object} utils.Response "服务器错误"
+// @Router /api/internal/merchants/{merchantId}/timezone [put]
+func UpdateMerchantTimezone(c *gin.Context) {
+	merchantID, err := strconv.Atoi(c.Param("merchantId"))
+	if err != nil || merchantID <= 0 {
+		utils.BadRequest(c, "无效的商家ID")
+		return
+	}
+
+	var req UpdateMerchantTimezoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误: "+err.Error())
+		return
+	}
+
+	if _, err := models.GetMerchantByID(uint(merchantID)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.NotFound(c, "商家不存在")
+		} else {
+			utils.InternalError(c, "获取商家信息失败: "+err.Error())
+		}
+		return
+	}
+
+	if err := models.UpdateMerchantTimezone(uint(merchantID), req.Timezone); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.Success(c, "设置成功")
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"admin-api/models"
+	"admin-api/payment"
 	"admin-api/utils"
 
 	"github.com/gin-gonic/gin"
@@ -20,7 +21,7 @@ import (
 // @Produce json
 // @Security ApiKeyAuth
 // @Param Authorization header string true "Bearer token"
-// @Param status query string false "预约状态（pending, confirmed, completed, canceled）"
+// @Param status query string false "预约状态（pending, confirmed, paid, completed, cancelled, rejected, no_show, refunding, refunded）"
 // @Param date query string false "预约日期（格式: YYYY-MM-DD）"
 // @Success 200 {array} map[string]string "预约列表"
 // @Failure 401 {object} map[string]string "未授权" Example({"error": "身份认证失败"})
@@ -46,24 +47,70 @@ func GetMerchantAppointments(c *gin.Context) {
 		return
 	}
 
+	// 团课时间段附带同一时间段的全部学员
+	slotIDs := make([]uint, 0, len(appointments))
+	for _, appt := range appointments {
+		slotIDs = append(slotIDs, appt.TimeSlotID)
+	}
+	slots, err := models.GetTimeSlotsByIDs(slotIDs)
+	if err != nil {
+		utils.InternalError(c, "获取预约列表失败")
+		return
+	}
+	slotByID := make(map[uint]models.TimeSlot, len(slots))
+	var groupSlotIDs []uint
+	for _, slot := range slots {
+		slotByID[slot.ID] = slot
+		if slot.Capacity > 1 {
+			groupSlotIDs = append(groupSlotIDs, slot.ID)
+		}
+	}
+	attendees, err := models.GetSlotAttendees(groupSlotIDs)
+	if err != nil {
+		utils.InternalError(c, "获取预约列表失败")
+		return
+	}
+
+	// 组合订单的项目附带所属订单号
+	orderIDs := make([]uint, 0)
+	for _, appt := range appointments {
+		if appt.OrderID != 0 {
+			orderIDs = append(orderIDs, appt.OrderID)
+		}
+	}
+	orderNos, err := models.GetOrderNos(orderIDs)
+	if err != nil {
+		utils.InternalError(c, "获取预约列表失败")
+		return
+	}
+
 	// 转换为响应格式
 	type AppointmentResponse struct {
-		ID              uint   `json:"id"`
-		OrderNo         string `json:"order_no"`
-		UserName        string `json:"user_name"`
-		UserPhone       string `json:"user_phone"`
-		ServiceName     string `json:"service_name"`
-		StaffName       string `json:"staff_name"`
-		AppointmentDate string `json:"appointment_date"`
-		StartTime       string `json:"start_time"`
-		EndTime         string `json:"end_time"`
-		Status          string `json:"status"`
-		Amount          int    `json:"amount"`
-		CreatedAt       string `json:"created_at"`
+		ID              uint               `json:"id"`
+		OrderNo         string             `json:"order_no"`
+		UserName        string             `json:"user_name"`
+		UserPhone       string             `json:"user_phone"`
+		ServiceName     string             `json:"service_name"`
+		StaffName       string             `json:"staff_name"`
+		AppointmentDate string             `json:"appointment_date"`
+		StartTime       string             `json:"start_time"`
+		EndTime         string             `json:"end_time"`
+		Status          string             `json:"status"`
+		Amount          int                `json:"amount"`
+		Timezone        string             `json:"timezone"`   // 商家时区，预约日期和时间均为该时区的当地时间
+		CreatedAt       string             `json:"created_at"` // RFC3339，带时区偏移
+		TimeSlotID      uint               `json:"time_slot_id"`
+		Capacity        int                `json:"capacity"`            // 时间段可预约人数
+		BookedCount     int                `json:"booked_count"`        // 时间段已预约人数
+		Attendees       []AttendeeResponse `json:"attendees,omitempty"` // 团课同一时间段的学员
+		OrderID         uint               `json:"order_id,omitempty"`  // 所属组合订单
+		GroupOrderNo    string             `json:"group_order_no,omitempty"`
 	}
 
+	loc := models.MerchantLocation(merchantID)
 	response := make([]AppointmentResponse, 0, len(appointments))
 	for _, appt := range appointments {
+		slot := slotByID[appt.TimeSlotID]
 		response = append(response, AppointmentResponse{
 			ID:              appt.ID,
 			OrderNo:         appt.OrderNo,
@@ -74,24 +121,57 @@ func GetMerchantAppointments(c *gin.Context) {
 			AppointmentDate: appt.AppointmentDate.Format("2006-01-02"),
 			StartTime:       appt.StartTime,
 			EndTime:         appt.EndTime,
-			Status:          appt.Status,
+			Status:          models.NormalizeAppointmentStatus(appt.Status),
 			Amount:          appt.Amount,
-			CreatedAt:       appt.CreatedAt.Format("2006-01-02 15:04"),
+			Timezone:        loc.String(),
+			CreatedAt:       appt.CreatedAt.In(loc).Format(time.RFC3339),
+			TimeSlotID:      appt.TimeSlotID,
+			Capacity:        slot.Capacity,
+			BookedCount:     slot.BookedCount,
+			Attendees:       toAttendees(attendees[appt.TimeSlotID]),
+			OrderID:         appt.OrderID,
+			GroupOrderNo:    orderNos[appt.OrderID],
 		})
 	}
 
 	utils.Success(c, response)
 }
 
+// AttendeeResponse 时间段上的一位预约学员
+type AttendeeResponse struct {
+	AppointmentID uint   `json:"appointment_id"`
+	OrderNo       string `json:"order_no"`
+	UserName      string `json:"user_name"`
+	UserPhone     string `json:"user_phone"`
+	Status        string `json:"status"`
+}
+
+func toAttendees(appointments []models.Appointment) []AttendeeResponse {
+	if len(appointments) == 0 {
+		return nil
+	}
+	response := make([]AttendeeResponse, 0, len(appointments))
+	for _, appt := range appointments {
+		response = append(response, AttendeeResponse{
+			AppointmentID: appt.ID,
+			OrderNo:       appt.OrderNo,
+			UserName:      appt.User.Nickname,
+			UserPhone:     appt.User.Phone,
+			Status:        appt.Status,
+		})
+	}
+	return response
+}
+
 type UpdateAppointRequest struct {
-	Status string `json:"status" binding:"required,oneof=confirmed completed canceled rejected"`
+	Status string `json:"status" binding:"required,oneof=confirmed completed cancelled canceled rejected no_show"` // canceled 为旧写法，等同于 cancelled
 	Reason string `json:"reason"`
 }
 
 // 更新预约状态
 // UpdateAppointmentStatus 更新预约状态
 // @Summary      更新预约状态
-// @Description  商家更新预约的状态（confirmed/completed/canceled/rejected）
+// @Description  商家更新预约的状态（confirmed/completed/cancelled/rejected/no_show），按预约状态机校验并记录状态变更
 // @Tags         商家预约管理
 // @Accept       json
 // @Produce      json
@@ -119,35 +199,44 @@ func UpdateAppointmentStatus(c *gin.Context) {
 		fmt.Println(err)
 		return
 	}
+	status := models.NormalizeAppointmentStatus(req.Status)
 
 	// 验证预约属于该商家
 	appointment, err := models.GetAppointmentByID(uint(appointmentID))
-
-	fmt.Println("1111111111111", merchantID)
-
 	if err != nil || appointment.MerchantID != merchantID {
-		fmt.Println(err)
 		utils.NotFound(c, "预约不存在")
 		return
 	}
 
 	// 检查状态转换是否有效
-	if !isValidStatusTransition(appointment.Status, req.Status) {
+	if !merchantCanTransition(appointment.Status, status) {
 		utils.BadRequest(c, "无效的状态转换")
 		return
 	}
 
-	// 更新状态
-	if err := models.UpdateAppointmentStatus(uint(appointmentID), req.Status, req.Reason); err != nil {
+	// 取消或拒绝时在同一事务中释放时间段名额
+	if err := models.UpdateAppointmentStatus(merchantID, uint(appointmentID), status, req.Reason); err != nil {
+		log.Printf("更新预约状态失败: %v", err)
 		utils.InternalError(c, "更新状态失败")
 		return
 	}
 
-	// 如果是取消或拒绝，释放时间段
-	if req.Status == "canceled" || req.Status == "rejected" {
-		if err := models.ReleaseTimeSlot(appointment.TimeSlotID); err != nil {
-			// 记录错误但继续
-			log.Printf("释放时间段失败: %v", err)
+	// 已支付的预约未到店时，按取消政策扣除违约金后退还余额
+	if status == models.AppointmentStatusNoShow && appointment.Status == models.AppointmentStatusPaid {
+		refund, err := models.CreateNoShowRefund(merchantID, uint(appointmentID))
+		if err != nil {
+			log.Printf("预约 %d 未到店退款失败: %v", appointmentID, err)
+			utils.Success(c, "状态更新成功，未到店退款失败，请手动发起退款")
+			return
+		}
+		if refund != nil {
+			if err := payment.ExecuteRefund(refund, models.ActorMerchant, merchantID); err != nil {
+				log.Printf("预约 %d 未到店退款失败: %v", appointmentID, err)
+				utils.Success(c, "状态更新成功，未到店退款失败，请手动发起退款")
+				return
+			}
+			utils.Success(c, fmt.Sprintf("状态更新成功，已按未到店政策退款%.2f元", float64(refund.Amount)/100))
+			return
 		}
 	}
 
@@ -156,20 +245,198 @@ func UpdateAppointmentStatus(c *gin.Context) {
 	utils.Success(c, "状态更新成功")
 }
 
-func isValidStatusTransition(oldStatus, newStatus string) bool {
-	validTransitions := map[string][]string{
-		"pending":   {"confirmed", "rejected"},
-		"confirmed": {"completed", "canceled"},
-		"paid":      {"completed", "refunding"},
-		"completed": {},
-		"canceled":  {},
-		"rejected":  {},
+// merchantCanTransition 已支付的预约只能由客户按取消政策取消，商家需发起退款
+func merchantCanTransition(from, to string) bool {
+	if models.NormalizeAppointmentStatus(from) == models.AppointmentStatusPaid && to == models.AppointmentStatusCancelled {
+		return false
 	}
+	return models.CanTransitionAppointment(from, to)
+}
 
-	for _, s := range validTransitions[oldStatus] {
-		if s == newStatus {
-			return true
+func merchantNextStatuses(status string) []string {
+	next := []string{}
+	for _, s := range models.NextAppointmentStatuses(status) {
+		if merchantCanTransition(status, s) {
+			next = append(next, s)
 		}
 	}
-	return false
+	return next
+}
+
+// AppointmentDetailResponse 商家查看的预约详情
+type AppointmentDetailResponse struct {
+	ID              uint                      `json:"id"`
+	OrderNo         string                    `json:"order_no"`
+	UserName        string                    `json:"user_name"`
+	UserPhone       string                    `json:"user_phone"`
+	ServiceName     string                    `json:"service_name"`
+	StaffName       string                    `json:"staff_name"`
+	AppointmentDate string                    `json:"appointment_date"`
+	StartTime       string                    `json:"start_time"`
+	EndTime         string                    `json:"end_time"`
+	Status          string                    `json:"status"`
+	NextStatuses    []string                  `json:"next_statuses"` // 当前状态允许变更到的状态
+	Amount          int                       `json:"amount"`
+	Remark          string                    `json:"remark"`
+	PaymentID       uint                      `json:"payment_id,omitempty"`
+	OrderID         uint                      `json:"order_id,omitempty"`        // 所属组合订单
+	SeriesID        uint                      `json:"series_id,omitempty"`       // 所属周期预约
+	Timezone        string                    `json:"timezone"`                  // 商家时区，预约日期和时间均为该时区的当地时间
+	CreatedAt       string                    `json:"created_at"`                // RFC3339，带时区偏移
+	ActualStartAt   string                    `json:"actual_start_at,omitempty"` // 到店签到时间，RFC3339
+	ActualEndAt     string                    `json:"actual_end_at,omitempty"`   // 签退时间，RFC3339
+	Events          []models.AppointmentEvent `json:"events"`                    // 状态变更记录
+}
+
+// GetAppointmentDetail 获取预约详情
+// @Summary      获取预约详情
+// @Description  获取预约详情及状态变更记录
+// @Tags         商家预约管理
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        appointmentId path int true "预约ID"
+// @Param        Authorization header string true "Bearer Token"
+// @Success      200  {object}  AppointmentDetailResponse "预约详情"
+// @Failure      400  {object}  utils.Response "无效的预约ID"
+// @Failure      404  {object}  utils.Response "预约不存在"
+// @Router       /api/merchant/appointments/{appointmentId} [get]
+func GetAppointmentDetail(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+	appointmentID, err := strconv.Atoi(c.Param("appointmentId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的预约ID")
+		return
+	}
+
+	appointment, err := models.GetMerchantAppointmentDetail(merchantID, uint(appointmentID))
+	if err != nil {
+		utils.NotFound(c, "预约不存在")
+		return
+	}
+
+	events, err := models.GetAppointmentEvents(appointment.ID)
+	if err != nil {
+		utils.InternalError(c, "获取预约详情失败")
+		return
+	}
+
+	loc := models.MerchantLocation(merchantID)
+	status := models.NormalizeAppointmentStatus(appointment.Status)
+	response := AppointmentDetailResponse{
+		ID:              appointment.ID,
+		OrderNo:         appointment.OrderNo,
+		UserName:        appointment.User.Nickname,
+		UserPhone:       appointment.User.Phone,
+		ServiceName:     appointment.Service.Name,
+		StaffName:       appointment.Staff.Name,
+		AppointmentDate: appointment.AppointmentDate.Format("2006-01-02"),
+		StartTime:       appointment.StartTime,
+		EndTime:         appointment.EndTime,
+		Status:          status,
+		NextStatuses:    merchantNextStatuses(status),
+		Amount:          appointment.Amount,
+		Remark:          appointment.Remark,
+		PaymentID:       appointment.PaymentID,
+		OrderID:         appointment.OrderID,
+		SeriesID:        appointment.SeriesID,
+		Timezone:        loc.String(),
+		CreatedAt:       appointment.CreatedAt.In(loc).Format(time.RFC3339),
+		Events:          events,
+	}
+	if appointment.ActualStartAt != nil {
+		response.ActualStartAt = appointment.ActualStartAt.In(loc).Format(time.RFC3339)
+	}
+	if appointment.ActualEndAt != nil {
+		response.ActualEndAt = appointment.ActualEndAt.In(loc).Format(time.RFC3339)
+	}
+
+	utils.Success(c, response)
+}
+
+type RescheduleRequest struct {
+	TimeSlotID uint   `json:"time_slot_id" binding:"required"`
+	StaffID    uint   `json:"staff_id"` // 可选，为空时使用新时间段所属员工
+	Reason     string `json:"reason"`
+}
+
+// RescheduleAppointment 商家改约
+// @Summary      商家改约
+// @Description  将预约改到新的时间段或员工，支付和优惠券保持不变，不受客户改约规则限制，并通知客户
+// @Tags         商家预约管理
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        appointmentId path int true "预约ID"
+// @Param        body body RescheduleRequest true "新的时间段"
+// @Param        Authorization header string true "Bearer Token"
+// @Success      200  {object}  utils.Response "改约成功"
+// @Failure      400  {object}  utils.Response "无效的预约ID | 参数错误 | 时间段不可用"
+// @Router       /api/merchant/appointments/{appointmentId}/reschedule [put]
+func RescheduleAppointment(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+	appointmentID, err := strconv.Atoi(c.Param("appointmentId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的预约ID")
+		return
+	}
+
+	var req RescheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	appointment, err := models.RescheduleAppointment(uint(appointmentID), models.RescheduleByMerchant, merchantID,
+		req.StaffID, req.TimeSlotID, req.Reason)
+	if err != nil {
+		utils.BadRequest(c, "改约失败: "+err.Error())
+		return
+	}
+
+	utils.Success(c, gin.H{
+		"id":               appointment.ID,
+		"order_no":         appointment.OrderNo,
+		"staff_id":         appointment.StaffID,
+		"staff_name":       appointment.Staff.Name,
+		"time_slot_id":     appointment.TimeSlotID,
+		"appointment_date": appointment.AppointmentDate.Format("2006-01-02"),
+		"start_time":       appointment.StartTime,
+		"end_time":         appointment.EndTime,
+		"status":           appointment.Status,
+	})
+}
+
+// GetAppointmentReschedules 获取改约记录
+// @Summary      获取改约记录
+// @Description  获取预约的改约历史（客户和商家发起的）
+// @Tags         商家预约管理
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        appointmentId path int true "预约ID"
+// @Param        Authorization header string true "Bearer Token"
+// @Success      200  {array}   models.AppointmentReschedule "改约记录"
+// @Failure      400  {object}  utils.Response "无效的预约ID"
+// @Failure      404  {object}  utils.Response "预约不存在"
+// @Router       /api/merchant/appointments/{appointmentId}/reschedules [get]
+func GetAppointmentReschedules(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+	appointmentID, err := strconv.Atoi(c.Param("appointmentId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的预约ID")
+		return
+	}
+
+	appointment, err := models.GetAppointmentByID(uint(appointmentID))
+	if err != nil || appointment.MerchantID != merchantID {
+		utils.NotFound(c, "预约不存在")
+		return
+	}
+
+	history, err := models.GetAppointmentReschedules(appointment.ID)
+	if err != nil {
+		utils.InternalError(c, "获取改约记录失败")
+		return
+	}
+
+	utils.Success(c, history)
 }
@@ -0,0 +1,72 @@
+package merchant
+
+import (
+	"log"
+
+	"admin-api/models"
+	"admin-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary 获取营业时间
+// @Description 获取当前商户的每周营业时段和例外日期（商户端）
+// @Tags 商户-时间管理
+// @Security ApiKeyAuth
+// @Produce json
+// @Param Authorization header string true "Bearer Token"
+// @Success 200 {object} models.BusinessHoursSchedule "成功返回营业时间"
+// @Failure 500 {object} utils.Response "获取营业时间失败"
+// @Router /api/merchant/business-hours [get]
+func GetBusinessHours(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+
+	schedule, err := models.GetMerchantBusinessHours(merchantID)
+	if err != nil {
+		utils.InternalError(c, "获取营业时间失败")
+		return
+	}
+
+	utils.Success(c, schedule)
+}
+
+// @Summary 设置营业时间
+// @Description 整体替换当前商户的每周营业时段和例外日期，新建时间段须在营业时间内（商户端）
+// @Tags 商户-时间管理
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer Token"
+// @Param request body models.BusinessHoursRequest true "营业时间"
+// @Success 200 {object} utils.Response "设置成功"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 500 {object} utils.Response "设置失败"
+// @Router /api/merchant/business-hours [put]
+func UpdateBusinessHours(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+
+	var req models.BusinessHoursRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	schedule, err := req.ToSchedule()
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	if err := models.ValidateBusinessHours(schedule); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	if err := models.SetMerchantBusinessHours(merchantID, schedule); err != nil {
+		utils.InternalError(c, "设置营业时间失败")
+		log.Printf("设置营业时间失败: %v", err)
+		return
+	}
+
+	utils.Success(c, "营业时间设置成功")
+}
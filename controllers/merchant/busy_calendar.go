@@ -0,0 +1,285 @@
+package merchant
+
+import (
+	"strconv"
+	"time"
+
+	"admin-api/models"
+	"admin-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 上传的 .ics 文件大小上限
+const maxCalendarUploadSize = 5 << 20
+
+// UploadStaffBusyCalendar 上传员工外部日历
+// @Summary      上传员工外部日历
+// @Description  上传员工个人日历导出的 .ics 文件，其中的事件作为忙碌时段屏蔽重叠的可预约时间。再次上传时按事件 UID 增量更新，文件中已删除或已取消的事件会被移除
+// @Tags         商家员工管理
+// @Accept       multipart/form-data
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        staffId path int true "员工ID" example(123)
+// @Param        file formData file true ".ics 文件"
+// @Param        Authorization header string true "Bearer Token"
+// @Success      200  {object}  utils.Response{data=models.BusyImportResult} "导入结果"
+// @Failure      400  {object}  utils.Response "文件错误或解析失败"
+// @Failure      404  {object}  utils.Response "员工不存在"
+// @Router       /api/merchant/staff/{staffId}/busy-calendar/upload [post]
+func UploadStaffBusyCalendar(c *gin.Context) {
+	staff, ok := merchantStaff(c)
+	if !ok {
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		utils.BadRequest(c, "获取文件失败: "+err.Error())
+		return
+	}
+	if file.Size > maxCalendarUploadSize {
+		utils.BadRequest(c, "文件过大")
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		utils.BadRequest(c, "读取文件失败")
+		return
+	}
+	defer f.Close()
+
+	result, err := models.ImportStaffCalendarUpload(staff.MerchantID, staff.ID, f)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.Success(c, result)
+}
+
+// GetStaffCalendarSources 获取员工外部日历来源
+// @Summary      获取员工外部日历来源
+// @Description  获取员工已登记的外部日历（上传文件、本地文件、订阅地址）及最近同步情况
+// @Tags         商家员工管理
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        staffId path int true "员工ID" example(123)
+// @Param        Authorization header string true "Bearer Token"
+// @Success      200  {object}  utils.Response{data=[]models.StaffCalendarSource} "日历来源列表"
+// @Failure      404  {object}  utils.Response "员工不存在"
+// @Failure      500  {object}  utils.Response "获取日历来源失败"
+// @Router       /api/merchant/staff/{staffId}/busy-calendar/sources [get]
+func GetStaffCalendarSources(c *gin.Context) {
+	staff, ok := merchantStaff(c)
+	if !ok {
+		return
+	}
+
+	sources, err := models.GetStaffCalendarSources(staff.ID)
+	if err != nil {
+		utils.InternalError(c, "获取日历来源失败")
+		return
+	}
+
+	utils.Success(c, sources)
+}
+
+type CreateCalendarSourceRequest struct {
+	Type     string `json:"type" binding:"required,oneof=path url"` // path: 本商家导入目录内的本地文件, url: 订阅地址
+	Name     string `json:"name"`
+	Location string `json:"location" binding:"required,max=500"` // 相对于本商家导入目录（import_dir/商家ID）的文件路径，或公网 http(s)/webcal 地址
+}
+
+// CreateStaffCalendarSource 登记员工外部日历
+// @Summary      登记员工外部日历
+// @Description  登记本地文件或订阅地址，登记后立即同步一次，之后由后台任务定期同步
+// @Tags         商家员工管理
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        staffId path int true "员工ID" example(123)
+// @Param        body body CreateCalendarSourceRequest true "日历来源"
+// @Param        Authorization header string true "Bearer Token"
+// @Success      200  {object}  utils.Response "登记成功，返回来源及首次同步结果"
+// @Failure      400  {object}  utils.Response "参数错误"
+// @Failure      404  {object}  utils.Response "员工不存在"
+// @Failure      500  {object}  utils.Response "登记日历来源失败"
+// @Router       /api/merchant/staff/{staffId}/busy-calendar/sources [post]
+func CreateStaffCalendarSource(c *gin.Context) {
+	staff, ok := merchantStaff(c)
+	if !ok {
+		return
+	}
+
+	var req CreateCalendarSourceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	source := models.StaffCalendarSource{
+		MerchantID: staff.MerchantID,
+		StaffID:    staff.ID,
+		Type:       req.Type,
+		Name:       req.Name,
+		Location:   req.Location,
+		IsActive:   true,
+	}
+	if err := models.ValidateCalendarSource(&source); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	if err := models.CreateStaffCalendarSource(&source); err != nil {
+		utils.InternalError(c, "登记日历来源失败")
+		return
+	}
+
+	// 首次同步失败不影响登记，错误记录在 last_error 中，后台任务会继续重试
+	result, _ := models.SyncStaffCalendarSource(&source)
+
+	utils.Success(c, gin.H{
+		"source": source,
+		"result": result,
+	})
+}
+
+// calendarSource 校验日历来源属于该员工
+func calendarSource(c *gin.Context, staff *models.Staff) (*models.StaffCalendarSource, bool) {
+	sourceID, err := strconv.Atoi(c.Param("sourceId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的日历来源ID")
+		return nil, false
+	}
+
+	source, err := models.GetStaffCalendarSourceByID(uint(sourceID))
+	if err != nil || source.StaffID != staff.ID {
+		utils.NotFound(c, "日历来源不存在")
+		return nil, false
+	}
+	return source, true
+}
+
+// SyncStaffCalendarSource 立即同步员工外部日历
+// @Summary      同步员工外部日历
+// @Description  立即重新读取本地文件或订阅地址，按事件 UID 增量更新忙碌时段
+// @Tags         商家员工管理
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        staffId path int true "员工ID" example(123)
+// @Param        sourceId path int true "日历来源ID"
+// @Param        Authorization header string true "Bearer Token"
+// @Success      200  {object}  utils.Response{data=models.BusyImportResult} "导入结果"
+// @Failure      400  {object}  utils.Response "上传的日历不能同步或同步失败"
+// @Failure      404  {object}  utils.Response "员工或日历来源不存在"
+// @Router       /api/merchant/staff/{staffId}/busy-calendar/sources/{sourceId}/sync [post]
+func SyncStaffCalendarSource(c *gin.Context) {
+	staff, ok := merchantStaff(c)
+	if !ok {
+		return
+	}
+	source, ok := calendarSource(c, staff)
+	if !ok {
+		return
+	}
+	if source.Type == models.CalendarSourceUpload {
+		utils.BadRequest(c, "上传的日历请重新上传文件")
+		return
+	}
+
+	result, err := models.SyncStaffCalendarSource(source)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.Success(c, result)
+}
+
+// DeleteStaffCalendarSource 删除员工外部日历
+// @Summary      删除员工外部日历
+// @Description  删除日历来源及其导入的全部忙碌时段，对应时间恢复可预约
+// @Tags         商家员工管理
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        staffId path int true "员工ID" example(123)
+// @Param        sourceId path int true "日历来源ID"
+// @Param        Authorization header string true "Bearer Token"
+// @Success      200  {object}  utils.Response "删除成功"
+// @Failure      404  {object}  utils.Response "员工或日历来源不存在"
+// @Failure      500  {object}  utils.Response "删除日历来源失败"
+// @Router       /api/merchant/staff/{staffId}/busy-calendar/sources/{sourceId} [delete]
+func DeleteStaffCalendarSource(c *gin.Context) {
+	staff, ok := merchantStaff(c)
+	if !ok {
+		return
+	}
+	source, ok := calendarSource(c, staff)
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteStaffCalendarSource(source.ID); err != nil {
+		utils.InternalError(c, "删除日历来源失败")
+		return
+	}
+
+	utils.Success(c, "删除成功")
+}
+
+// GetStaffBusyBlocks 获取员工忙碌时段
+// @Summary      获取员工忙碌时段
+// @Description  获取从外部日历导入的忙碌时段，默认从今天起7天，时间为 RFC3339 格式
+// @Tags         商家员工管理
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        staffId path int true "员工ID" example(123)
+// @Param        from query string false "开始日期 YYYY-MM-DD"
+// @Param        to query string false "结束日期 YYYY-MM-DD（含）"
+// @Param        Authorization header string true "Bearer Token"
+// @Success      200  {object}  utils.Response{data=[]models.StaffBusyBlock} "忙碌时段列表"
+// @Failure      400  {object}  utils.Response "日期格式错误"
+// @Failure      404  {object}  utils.Response "员工不存在"
+// @Failure      500  {object}  utils.Response "获取忙碌时段失败"
+// @Router       /api/merchant/staff/{staffId}/busy-blocks [get]
+func GetStaffBusyBlocks(c *gin.Context) {
+	staff, ok := merchantStaff(c)
+	if !ok {
+		return
+	}
+
+	loc := models.MerchantLocation(staff.MerchantID)
+	now := time.Now().In(loc)
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	to := from.AddDate(0, 0, 7)
+	if v := c.Query("from"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, loc)
+		if err != nil {
+			utils.BadRequest(c, "日期格式错误")
+			return
+		}
+		from = t
+	}
+	if v := c.Query("to"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, loc)
+		if err != nil {
+			utils.BadRequest(c, "日期格式错误")
+			return
+		}
+		to = t.AddDate(0, 0, 1)
+	}
+
+	blocks, err := models.GetStaffBusyBlocks(staff.ID, from, to)
+	if err != nil {
+		utils.InternalError(c, "获取忙碌时段失败")
+		return
+	}
+	for i := range blocks {
+		blocks[i].StartAt = blocks[i].StartAt.In(loc)
+		blocks[i].EndAt = blocks[i].EndAt.In(loc)
+	}
+
+	utils.Success(c, blocks)
+}
@@ -0,0 +1,174 @@
+package merchant
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"admin-api/database"
+	"admin-api/models"
+	"admin-api/pkg/auth"
+	"admin-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CalendarFeedResponse 日历订阅地址
+type CalendarFeedResponse struct {
+	URL       string `json:"url"`        // https 订阅地址
+	WebcalURL string `json:"webcal_url"` // webcal 地址，手机上点击可直接订阅
+}
+
+func staffFeedResponse(c *gin.Context, feed *models.CalendarFeed) (CalendarFeedResponse, error) {
+	token, err := auth.SignFeedToken(auth.FeedOwnerStaff, feed.OwnerID, feed.Version)
+	if err != nil {
+		return CalendarFeedResponse{}, err
+	}
+	url := fmt.Sprintf("%s/api/merchant/calendar/staff/%d/appointments.ics?token=%s",
+		utils.RequestBaseURL(c), feed.OwnerID, token)
+	return CalendarFeedResponse{
+		URL:       url,
+		WebcalURL: "webcal://" + url[strings.Index(url, "://")+3:],
+	}, nil
+}
+
+// feedEnabled 未配置签名密钥时日历订阅不可用
+func feedEnabled(c *gin.Context) bool {
+	if !auth.FeedEnabled() {
+		utils.Error(c, 503, "日历订阅未启用")
+		return false
+	}
+	return true
+}
+
+// merchantStaff 校验员工属于当前商家
+func merchantStaff(c *gin.Context) (*models.Staff, bool) {
+	merchantID := c.GetUint("merchant_id")
+	staffID, err := strconv.Atoi(c.Param("staffId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的员工ID")
+		return nil, false
+	}
+
+	var staff models.Staff
+	if err := database.DB.First(&staff, staffID).Error; err != nil || staff.MerchantID != merchantID {
+		utils.NotFound(c, "员工不存在")
+		return nil, false
+	}
+	return &staff, true
+}
+
+// GetStaffCalendarFeed 获取员工日历订阅地址
+// @Summary      获取员工日历订阅地址
+// @Description  获取员工预约的 .ics 订阅地址，员工可在手机日历中订阅，预约变更和取消会同步到日历
+// @Tags         商家员工管理
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        staffId path int true "员工ID" example(123)
+// @Param        Authorization header string true "Bearer Token"
+// @Success      200  {object}  CalendarFeedResponse "订阅地址"
+// @Failure      400  {object}  utils.Response "无效的员工ID"
+// @Failure      404  {object}  utils.Response "员工不存在"
+// @Failure      500  {object}  utils.Response "获取订阅地址失败"
+// @Failure      503  {object}  utils.Response "日历订阅未启用"
+// @Router       /api/merchant/staff/{staffId}/calendar-feed [get]
+func GetStaffCalendarFeed(c *gin.Context) {
+	if !feedEnabled(c) {
+		return
+	}
+
+	staff, ok := merchantStaff(c)
+	if !ok {
+		return
+	}
+
+	feed, err := models.GetCalendarFeed(auth.FeedOwnerStaff, staff.ID)
+	if err != nil {
+		utils.InternalError(c, "获取订阅地址失败")
+		return
+	}
+
+	response, err := staffFeedResponse(c, feed)
+	if err != nil {
+		utils.InternalError(c, "生成订阅地址失败")
+		return
+	}
+	utils.Success(c, response)
+}
+
+// ResetStaffCalendarFeed 重置员工日历订阅地址
+// @Summary      重置员工日历订阅地址
+// @Description  生成新的订阅地址，之前的订阅地址失效（如员工离职或链接泄露）
+// @Tags         商家员工管理
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        staffId path int true "员工ID" example(123)
+// @Param        Authorization header string true "Bearer Token"
+// @Success      200  {object}  CalendarFeedResponse "新的订阅地址"
+// @Failure      400  {object}  utils.Response "无效的员工ID"
+// @Failure      404  {object}  utils.Response "员工不存在"
+// @Failure      500  {object}  utils.Response "重置订阅地址失败"
+// @Failure      503  {object}  utils.Response "日历订阅未启用"
+// @Router       /api/merchant/staff/{staffId}/calendar-feed/reset [post]
+func ResetStaffCalendarFeed(c *gin.Context) {
+	if !feedEnabled(c) {
+		return
+	}
+
+	staff, ok := merchantStaff(c)
+	if !ok {
+		return
+	}
+
+	feed, err := models.ResetCalendarFeed(auth.FeedOwnerStaff, staff.ID)
+	if err != nil {
+		utils.InternalError(c, "重置订阅地址失败")
+		return
+	}
+
+	response, err := staffFeedResponse(c, feed)
+	if err != nil {
+		utils.InternalError(c, "生成订阅地址失败")
+		return
+	}
+	utils.Success(c, response)
+}
+
+// GetStaffCalendarFeedICS 员工预约日历订阅
+// @Summary      员工预约日历订阅
+// @Description  返回员工近30天及以后预约的 iCalendar 内容，通过订阅地址中的签名校验，无需登录
+// @Tags         商家员工管理
+// @Produce      text/calendar
+// @Param        staffId path int true "员工ID" example(123)
+// @Param        token query string true "订阅签名"
+// @Success      200  {string}  string "iCalendar 内容"
+// @Failure      403  {object}  utils.Response "订阅地址无效"
+// @Failure      500  {object}  utils.Response "生成日历失败"
+// @Failure      503  {object}  utils.Response "日历订阅未启用"
+// @Router       /api/merchant/calendar/staff/{staffId}/appointments.ics [get]
+func GetStaffCalendarFeedICS(c *gin.Context) {
+	if !feedEnabled(c) {
+		return
+	}
+
+	staffID, err := strconv.Atoi(c.Param("staffId"))
+	if err != nil {
+		utils.Forbidden(c, "订阅地址无效")
+		return
+	}
+
+	feed, err := models.FindCalendarFeed(auth.FeedOwnerStaff, uint(staffID))
+	if err != nil || !auth.VerifyFeedToken(c.Query("token"), auth.FeedOwnerStaff, feed.OwnerID, feed.Version) {
+		utils.Forbidden(c, "订阅地址无效")
+		return
+	}
+
+	cal, err := models.BuildStaffCalendar(feed.OwnerID)
+	if err != nil {
+		utils.InternalError(c, "生成日历失败")
+		return
+	}
+
+	c.Header("Content-Disposition", `inline; filename="appointments.ics"`)
+	c.Data(200, "text/calendar; charset=utf-8", cal.Bytes())
+}
@@ -0,0 +1,138 @@
+package merchant
+
+import (
+	"strconv"
+	"time"
+
+	"admin-api/models"
+	"admin-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CheckInRequest struct {
+	Token string `json:"token" binding:"required"` // 扫描客户签到二维码得到的内容
+}
+
+// CheckInResponse 签到或签退后的预约
+type CheckInResponse struct {
+	AppointmentID   uint   `json:"appointment_id"`
+	OrderNo         string `json:"order_no"`
+	UserName        string `json:"user_name"`
+	ServiceName     string `json:"service_name"`
+	StaffName       string `json:"staff_name"`
+	AppointmentDate string `json:"appointment_date"`
+	StartTime       string `json:"start_time"`
+	EndTime         string `json:"end_time"`
+	Status          string `json:"status"`
+	ActualStartAt   string `json:"actual_start_at"`         // RFC3339
+	ActualEndAt     string `json:"actual_end_at,omitempty"` // RFC3339
+}
+
+func toCheckInResponse(merchantID uint, appointment *models.Appointment) (CheckInResponse, error) {
+	detail, err := models.GetMerchantAppointmentDetail(merchantID, appointment.ID)
+	if err != nil {
+		return CheckInResponse{}, err
+	}
+	loc := models.MerchantLocation(merchantID)
+	response := CheckInResponse{
+		AppointmentID:   detail.ID,
+		OrderNo:         detail.OrderNo,
+		UserName:        detail.User.Nickname,
+		ServiceName:     detail.Service.Name,
+		StaffName:       detail.Staff.Name,
+		AppointmentDate: detail.AppointmentDate.Format("2006-01-02"),
+		StartTime:       detail.StartTime,
+		EndTime:         detail.EndTime,
+		Status:          detail.Status,
+	}
+	if detail.ActualStartAt != nil {
+		response.ActualStartAt = detail.ActualStartAt.In(loc).Format(time.RFC3339)
+	}
+	if detail.ActualEndAt != nil {
+		response.ActualEndAt = detail.ActualEndAt.In(loc).Format(time.RFC3339)
+	}
+	return response, nil
+}
+
+// CheckInAppointment 扫码签到
+// @Summary      扫码签到
+// @Description  店员扫描客户的签到二维码登记到店，记录实际开始时间。其他门店、非当天或已签到的签到码会被拒绝
+// @Tags         商家预约管理
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        body body CheckInRequest true "签到码"
+// @Param        Authorization header string true "Bearer Token"
+// @Success      200  {object}  CheckInResponse "签到成功"
+// @Failure      400  {object}  utils.Response "参数错误或签到码无效"
+// @Router       /api/merchant/appointments/check-in [post]
+func CheckInAppointment(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+
+	var req CheckInRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	appointment, err := models.CheckInAppointment(merchantID, req.Token)
+	if err != nil {
+		utils.BadRequest(c, "签到失败: "+err.Error())
+		return
+	}
+
+	response, err := toCheckInResponse(merchantID, appointment)
+	if err != nil {
+		utils.InternalError(c, "获取预约信息失败")
+		return
+	}
+	utils.Success(c, response)
+}
+
+type CheckOutRequest struct {
+	Remark string `json:"remark"` // 可选，服务备注
+}
+
+// CheckOutAppointment 服务完成签退
+// @Summary      服务完成签退
+// @Description  已签到的预约服务结束后签退，记录实际结束时间并将预约标记为已完成
+// @Tags         商家预约管理
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        appointmentId path int true "预约ID"
+// @Param        body body CheckOutRequest false "签退备注"
+// @Param        Authorization header string true "Bearer Token"
+// @Success      200  {object}  CheckInResponse "签退成功"
+// @Failure      400  {object}  utils.Response "无效的预约ID或当前状态不能签退"
+// @Router       /api/merchant/appointments/{appointmentId}/check-out [put]
+func CheckOutAppointment(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+	appointmentID, err := strconv.Atoi(c.Param("appointmentId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的预约ID")
+		return
+	}
+
+	var req CheckOutRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.BadRequest(c, "参数错误")
+			return
+		}
+	}
+
+	appointment, err := models.CheckOutAppointment(merchantID, uint(appointmentID), req.Remark)
+	if err != nil {
+		utils.BadRequest(c, "签退失败: "+err.Error())
+		return
+	}
+
+	response, err := toCheckInResponse(merchantID, appointment)
+	if err != nil {
+		utils.InternalError(c, "获取预约信息失败")
+		return
+	}
+	utils.Success(c, response)
+}
@@ -0,0 +1,157 @@
+package merchant
+
+import (
+	"strconv"
+	"time"
+
+	"admin-api/models"
+	"admin-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OrderLineResponse 组合订单中的一个项目
+type OrderLineResponse struct {
+	AppointmentID   uint   `json:"appointment_id"`
+	OrderNo         string `json:"order_no"` // 单项预约的订单号
+	ServiceName     string `json:"service_name"`
+	StaffName       string `json:"staff_name"`
+	AppointmentDate string `json:"appointment_date"`
+	StartTime       string `json:"start_time"`
+	EndTime         string `json:"end_time"`
+	Status          string `json:"status"`
+	Amount          int    `json:"amount"` // 分摊优惠后的金额（分）
+}
+
+// OrderResponse 组合订单及其项目
+type OrderResponse struct {
+	ID             uint                `json:"id"`
+	OrderNo        string              `json:"order_no"`
+	UserName       string              `json:"user_name"`
+	UserPhone      string              `json:"user_phone"`
+	Status         string              `json:"status"` // pending, paid, cancelled
+	OriginalAmount int                 `json:"original_amount"`
+	DiscountAmount int                 `json:"discount_amount"`
+	Amount         int                 `json:"amount"`
+	Remark         string              `json:"remark"`
+	Lines          []OrderLineResponse `json:"lines"`
+	Timezone       string              `json:"timezone"`   // 商家时区，预约日期和时间均为该时区的当地时间
+	CreatedAt      string              `json:"created_at"` // RFC3339，带时区偏移
+}
+
+func toOrderResponse(order *models.AppointmentOrder, loc *time.Location) OrderResponse {
+	lines := make([]OrderLineResponse, 0, len(order.Appointments))
+	for _, a := range order.Appointments {
+		lines = append(lines, OrderLineResponse{
+			AppointmentID:   a.ID,
+			OrderNo:         a.OrderNo,
+			ServiceName:     a.Service.Name,
+			StaffName:       a.Staff.Name,
+			AppointmentDate: a.AppointmentDate.Format("2006-01-02"),
+			StartTime:       a.StartTime,
+			EndTime:         a.EndTime,
+			Status:          a.Status,
+			Amount:          a.Amount,
+		})
+	}
+	return OrderResponse{
+		ID:             order.ID,
+		OrderNo:        order.OrderNo,
+		UserName:       order.User.Nickname,
+		UserPhone:      order.User.Phone,
+		Status:         order.Status,
+		OriginalAmount: order.OriginalAmount,
+		DiscountAmount: order.DiscountAmount,
+		Amount:         order.Amount,
+		Remark:         order.Remark,
+		Lines:          lines,
+		Timezone:       loc.String(),
+		CreatedAt:      order.CreatedAt.In(loc).Format(time.RFC3339),
+	}
+}
+
+// GetMerchantOrders 获取组合订单列表
+// @Summary 获取组合订单列表
+// @Description 获取当前商户的组合订单，每个订单下列出其包含的预约项目
+// @Tags 商家预约管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Bearer Token"
+// @Param status query string false "订单状态" Enums(pending, paid, cancelled)
+// @Success 200 {array} OrderResponse "订单列表"
+// @Failure 500 {object} utils.Response "获取订单列表失败"
+// @Router /api/merchant/orders [get]
+func GetMerchantOrders(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+
+	orders, err := models.GetMerchantOrders(merchantID, c.Query("status"))
+	if err != nil {
+		utils.InternalError(c, "获取订单列表失败")
+		return
+	}
+
+	loc := models.MerchantLocation(merchantID)
+	response := make([]OrderResponse, 0, len(orders))
+	for i := range orders {
+		response = append(response, toOrderResponse(&orders[i], loc))
+	}
+
+	utils.Success(c, response)
+}
+
+// GetMerchantOrderDetail 获取组合订单详情
+// @Summary 获取组合订单详情
+// @Description 获取组合订单及其各项目的状态
+// @Tags 商家预约管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Bearer Token"
+// @Param orderId path int true "订单ID"
+// @Success 200 {object} OrderResponse "订单详情"
+// @Failure 400 {object} utils.Response "无效的订单ID"
+// @Failure 404 {object} utils.Response "订单不存在"
+// @Router /api/merchant/orders/{orderId} [get]
+func GetMerchantOrderDetail(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+	orderID, err := strconv.Atoi(c.Param("orderId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的订单ID")
+		return
+	}
+
+	order, err := models.GetOrderByID(uint(orderID))
+	if err != nil || order.MerchantID != merchantID {
+		utils.NotFound(c, "订单不存在")
+		return
+	}
+
+	utils.Success(c, toOrderResponse(order, models.MerchantLocation(merchantID)))
+}
+
+// ConfirmMerchantOrder 确认组合订单
+// @Summary 确认组合订单
+// @Description 一次确认订单中全部待确认的项目，确认后客户可一次支付。单个项目的确认或拒绝请使用预约状态接口
+// @Tags 商家预约管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param Authorization header string true "Bearer Token"
+// @Param orderId path int true "订单ID"
+// @Success 200 {object} utils.Response "确认成功，返回确认的项目数"
+// @Failure 400 {object} utils.Response "无效的订单ID或当前状态不允许确认"
+// @Router /api/merchant/orders/{orderId}/confirm [put]
+func ConfirmMerchantOrder(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+	orderID, err := strconv.Atoi(c.Param("orderId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的订单ID")
+		return
+	}
+
+	confirmed, err := models.ConfirmMerchantOrder(merchantID, uint(orderID))
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.Success(c, gin.H{"confirmed": confirmed})
+}
@@ -1,12 +1,9 @@
 package merchant
 
 import (
-	"admin-api/config"
-	"admin-api/database"
 	"admin-api/models"
 	"admin-api/payment"
 	"admin-api/utils"
-	"fmt"
 	"github.com/gin-gonic/gin"
 	"strconv"
 )
@@ -117,7 +114,7 @@ type RefundRequest struct {
 
 // InitiateRefund 发起退款
 // @Summary 发起退款
-// @Description 为已支付的预约发起退款
+// @Description 为已支付的预约发起退款，退款中的预约在上次退款失败后可重新发起
 // @Tags 商家支付
 // @Accept json
 // @Produce json
@@ -143,8 +140,6 @@ func InitiateRefund(c *gin.Context) {
 		return
 	}
 
-	//merchantID, _ := c.Get("merchantId")
-
 	// 获取预约信息
 	appointment, err := models.GetAppointmentByID(uint(appointmentID))
 	if err != nil {
@@ -158,27 +153,6 @@ func InitiateRefund(c *gin.Context) {
 		return
 	}
 
-	// 检查预约状态是否可退款
-	if appointment.Status != models.AppointmentStatusCompleted {
-
-		utils.BadRequest(c, "当前状态不允许退款")
-		return
-	}
-
-	// 获取关联的支付记录
-	payment_, err := models.GetPaymentByAppointment(appointment.ID)
-	if err != nil {
-		utils.BadRequest(c, "未找到支付记录")
-		return
-	}
-
-	// 检查支付状态
-	if payment_.Status != models.PaymentStatusSucceeded {
-		fmt.Println(payment_.Status)
-		utils.BadRequest(c, "支付未完成，无法退款")
-		return
-	}
-
 	// 解析退款请求
 	var req RefundRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -186,84 +160,18 @@ func InitiateRefund(c *gin.Context) {
 		return
 	}
 
-	// 验证退款金额
-	if req.RefundAmount > payment_.Amount {
-		utils.BadRequest(c, "退款金额不能超过支付金额")
-		return
-	}
-
-	// 创建退款记录
-
-	if config.Config.WechatPay.UseSimulate {
-		// 创建模拟退款记录
-		refundRecord := models.Refund{
-			PaymentID:     payment_.ID,
-			AppointmentID: appointment.ID,
-			Amount:        req.RefundAmount,
-			Reason:        req.RefundReason,
-			Status:        models.RefundStatusSuccess,    // 直接标记为成功
-			OutRefundNo:   utils.GenerateTradeNo("SIMR"), // 添加SIMR前缀
-		}
-
-		if err := models.CreateRefund(&refundRecord); err != nil {
-			utils.InternalError(c, "创建模拟退款记录失败: "+err.Error())
-			return
-		}
-
-		// 更新支付状态
-		payment_.Status = models.PaymentStatusRefunded
-		if err := models.UpdatePayment(payment_); err != nil {
-			utils.InternalError(c, "更新支付状态失败: "+err.Error())
-			return
-		}
-
-		// 更新预约状态
-		appointment.Status = models.AppointmentStatusCancelled
-		if err := database.DB.Save(&appointment).Error; err != nil {
-			utils.InternalError(c, "更新预约状态失败: "+err.Error())
-			return
-		}
-
-		utils.Success(c, refundRecord)
-		return
-	}
-
-	refundRecord := models.Refund{
-		PaymentID:     payment_.ID,
-		AppointmentID: appointment.ID,
-		Amount:        req.RefundAmount,
-		Reason:        req.RefundReason,
-		Status:        models.RefundStatusProcessing,
-		OutRefundNo:   utils.GenerateTradeNo("R"),
-	}
-
-	if err := models.CreateRefund(&refundRecord); err != nil {
-		utils.InternalError(c, "创建退款记录失败: "+err.Error())
+	// 校验预约和支付状态并创建退款记录，同一支付不会重复退款
+	refundRecord, err := models.CreateAppointmentRefund(merchantID.(uint), appointment.ID, req.RefundAmount, req.RefundReason)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
 		return
 	}
 
-	// 调用微信退款API
-	err = payment.CreateWechatRefund(
-		payment_.OutTradeNo,
-		refundRecord.OutRefundNo,
-		payment_.Amount,
-		refundRecord.Amount,
-		refundRecord.Reason,
-	)
-
-	if err != nil {
-		// 更新退款状态为失败
-		refundRecord.Status = models.RefundStatusFailed
-		refundRecord.FailReason = err.Error()
-		models.UpdateRefund(&refundRecord)
-
+	// 通过支付单所属的渠道发起退款，需等待退款回调的预约变为退款中
+	if err := payment.ExecuteRefund(refundRecord, models.ActorMerchant, merchantID.(uint)); err != nil {
 		utils.InternalError(c, "发起退款失败: "+err.Error())
 		return
 	}
 
-	// 更新支付状态为退款中
-	payment_.Status = models.PaymentStatusRefunding
-	models.UpdatePayment(payment_)
-
 	utils.Success(c, refundRecord)
 }
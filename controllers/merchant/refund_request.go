@@ -0,0 +1,289 @@
+package merchant
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"admin-api/models"
+	"admin-api/payment"
+	"admin-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RefundRequestResponse struct {
+	ID              uint                        `json:"id"`
+	AppointmentID   uint                        `json:"appointment_id"`
+	OrderNo         string                      `json:"order_no"`
+	UserName        string                      `json:"user_name"`
+	UserPhone       string                      `json:"user_phone"`
+	ServiceName     string                      `json:"service_name"`
+	AppointmentDate string                      `json:"appointment_date"`
+	StartTime       string                      `json:"start_time"`
+	PaymentID       uint                        `json:"payment_id"`
+	Amount          int                         `json:"amount"`                    // 申请退款金额(分)
+	Reason          string                      `json:"reason"`                    // 申请原因
+	Status          string                      `json:"status"`                    // pending, countered, approved, rejected, withdrawn
+	CounterAmount   int                         `json:"counter_amount,omitempty"`  // 提出的退款金额(分)
+	ApprovedAmount  int                         `json:"approved_amount,omitempty"` // 最终退款金额(分)
+	MerchantReply   string                      `json:"merchant_reply"`
+	Refund          *models.Refund              `json:"refund,omitempty"` // 同意后的退款记录，仅详情返回
+	Events          []models.RefundRequestEvent `json:"events,omitempty"` // 处理记录，仅详情返回
+	CreatedAt       string                      `json:"created_at"`       // RFC3339，带时区偏移
+	UpdatedAt       string                      `json:"updated_at"`       // RFC3339，带时区偏移
+}
+
+func toRefundRequestResponse(r *models.RefundRequest, loc *time.Location) RefundRequestResponse {
+	return RefundRequestResponse{
+		ID:              r.ID,
+		AppointmentID:   r.AppointmentID,
+		OrderNo:         r.Appointment.OrderNo,
+		UserName:        r.User.Nickname,
+		UserPhone:       r.User.Phone,
+		ServiceName:     r.Appointment.Service.Name,
+		AppointmentDate: r.Appointment.AppointmentDate.Format("2006-01-02"),
+		StartTime:       r.Appointment.StartTime,
+		PaymentID:       r.PaymentID,
+		Amount:          r.Amount,
+		Reason:          r.Reason,
+		Status:          r.Status,
+		CounterAmount:   r.CounterAmount,
+		ApprovedAmount:  r.ApprovedAmount,
+		MerchantReply:   r.MerchantReply,
+		CreatedAt:       r.CreatedAt.In(loc).Format(time.RFC3339),
+		UpdatedAt:       r.UpdatedAt.In(loc).Format(time.RFC3339),
+	}
+}
+
+// refundRequestDetail 读取退款申请详情，包含处理记录和退款记录
+func refundRequestDetail(merchantID, requestID uint) (*RefundRequestResponse, error) {
+	request, events, err := models.GetRefundRequestDetail(0, merchantID, requestID)
+	if err != nil {
+		return nil, err
+	}
+	response := toRefundRequestResponse(request, models.MerchantLocation(merchantID))
+	response.Events = events
+	if request.RefundID != 0 {
+		if refund, err := models.GetRefundByID(request.RefundID); err == nil {
+			response.Refund = refund
+		}
+	}
+	return &response, nil
+}
+
+// GetRefundRequests 获取退款申请列表
+// @Summary      获取退款申请列表
+// @Description  分页获取客户提交的退款申请，可按状态筛选
+// @Tags         商家支付
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        Authorization header string true "Bearer Token"
+// @Param        status query string false "申请状态" Enums(pending, countered, approved, rejected, withdrawn)
+// @Param        page query int false "页码" default(1)
+// @Param        limit query int false "每页数量" default(10)
+// @Success      200  {object}  utils.PaginatedResponse{data=[]RefundRequestResponse} "退款申请列表"
+// @Failure      500  {object}  utils.Response "获取退款申请失败"
+// @Router       /api/merchant/refund-requests [get]
+func GetRefundRequests(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+
+	requests, total, err := models.GetMerchantRefundRequests(merchantID, c.Query("status"), page, limit)
+	if err != nil {
+		utils.InternalError(c, "获取退款申请失败")
+		return
+	}
+
+	loc := models.MerchantLocation(merchantID)
+	response := make([]RefundRequestResponse, 0, len(requests))
+	for i := range requests {
+		response = append(response, toRefundRequestResponse(&requests[i], loc))
+	}
+	utils.PaginatedSuccess(c, response, total, page, limit)
+}
+
+// GetRefundRequestDetail 获取退款申请详情
+// @Summary      获取退款申请详情
+// @Description  获取退款申请、处理记录及退款结果
+// @Tags         商家支付
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        requestId path int true "退款申请ID"
+// @Param        Authorization header string true "Bearer Token"
+// @Success      200  {object}  RefundRequestResponse "退款申请详情"
+// @Failure      400  {object}  utils.Response "无效的退款申请ID"
+// @Failure      404  {object}  utils.Response "退款申请不存在"
+// @Router       /api/merchant/refund-requests/{requestId} [get]
+func GetRefundRequestDetail(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+	requestID, err := strconv.Atoi(c.Param("requestId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的退款申请ID")
+		return
+	}
+
+	response, err := refundRequestDetail(merchantID, uint(requestID))
+	if err != nil {
+		utils.NotFound(c, "退款申请不存在")
+		return
+	}
+	utils.Success(c, response)
+}
+
+type RefundRequestReplyRequest struct {
+	Reply string `json:"reply"` // 答复客户的内容
+}
+
+// ApproveRefundRequest 同意退款申请
+// @Summary      同意退款申请
+// @Description  按申请金额同意退款，走与发起退款相同的微信或模拟退款流程
+// @Tags         商家支付
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        requestId path int true "退款申请ID"
+// @Param        Authorization header string true "Bearer Token"
+// @Param        body body RefundRequestReplyRequest false "答复"
+// @Success      200  {object}  RefundRequestResponse "已同意并发起退款"
+// @Failure      400  {object}  utils.Response "无效的退款申请ID或当前状态不能同意"
+// @Failure      500  {object}  utils.Response "发起退款失败"
+// @Router       /api/merchant/refund-requests/{requestId}/approve [put]
+func ApproveRefundRequest(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+	requestID, err := strconv.Atoi(c.Param("requestId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的退款申请ID")
+		return
+	}
+
+	var req RefundRequestReplyRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.BadRequest(c, "参数错误")
+			return
+		}
+	}
+
+	request, refund, err := models.ApproveRefundRequest(merchantID, uint(requestID), req.Reply)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	// 模拟退款直接完成，否则调用微信退款API
+	if err := payment.ExecuteRefund(refund, models.ActorMerchant, merchantID); err != nil {
+		log.Printf("退款申请 %d 发起退款失败: %v", request.ID, err)
+		if reopenErr := models.ReopenRefundRequest(request.ID, "发起退款失败: "+err.Error()); reopenErr != nil {
+			log.Printf("退款申请 %d 状态恢复失败: %v", request.ID, reopenErr)
+		}
+		utils.InternalError(c, "发起退款失败: "+err.Error())
+		return
+	}
+
+	response, err := refundRequestDetail(merchantID, request.ID)
+	if err != nil {
+		utils.InternalError(c, "获取退款申请失败")
+		return
+	}
+	utils.Success(c, response)
+}
+
+type RejectRefundRequestRequest struct {
+	Reply string `json:"reply" binding:"required"` // 拒绝原因
+}
+
+// RejectRefundRequest 拒绝退款申请
+// @Summary      拒绝退款申请
+// @Description  拒绝待处理的退款申请，需填写拒绝原因
+// @Tags         商家支付
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        requestId path int true "退款申请ID"
+// @Param        Authorization header string true "Bearer Token"
+// @Param        body body RejectRefundRequestRequest true "拒绝原因"
+// @Success      200  {object}  RefundRequestResponse "已拒绝"
+// @Failure      400  {object}  utils.Response "参数错误或当前状态不能拒绝"
+// @Router       /api/merchant/refund-requests/{requestId}/reject [put]
+func RejectRefundRequest(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+	requestID, err := strconv.Atoi(c.Param("requestId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的退款申请ID")
+		return
+	}
+
+	var req RejectRefundRequestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "请填写拒绝原因")
+		return
+	}
+
+	request, err := models.RejectRefundRequest(merchantID, uint(requestID), req.Reply)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	response, err := refundRequestDetail(merchantID, request.ID)
+	if err != nil {
+		utils.InternalError(c, "获取退款申请失败")
+		return
+	}
+	utils.Success(c, response)
+}
+
+type CounterRefundRequestRequest struct {
+	Amount int    `json:"amount" binding:"required,min=1"` // 提出的退款金额(分)，须小于申请金额
+	Reply  string `json:"reply"`                           // 说明
+}
+
+// CounterRefundRequest 提出新的退款金额
+// @Summary      提出新的退款金额
+// @Description  对待处理的退款申请提出较低的退款金额，客户接受后按该金额退款
+// @Tags         商家支付
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        requestId path int true "退款申请ID"
+// @Param        Authorization header string true "Bearer Token"
+// @Param        body body CounterRefundRequestRequest true "退款金额和说明"
+// @Success      200  {object}  RefundRequestResponse "已提出新的金额"
+// @Failure      400  {object}  utils.Response "参数错误或当前状态不能提出新的金额"
+// @Router       /api/merchant/refund-requests/{requestId}/counter [put]
+func CounterRefundRequest(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+	requestID, err := strconv.Atoi(c.Param("requestId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的退款申请ID")
+		return
+	}
+
+	var req CounterRefundRequestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	request, err := models.CounterRefundRequest(merchantID, uint(requestID), req.Amount, req.Reply)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	response, err := refundRequestDetail(merchantID, request.ID)
+	if err != nil {
+		utils.InternalError(c, "获取退款申请失败")
+		return
+	}
+	utils.Success(c, response)
+}
@@ -0,0 +1,250 @@
+package merchant
+
+import (
+	"admin-api/common/constant"
+	"admin-api/database"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"admin-api/models"
+	"admin-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ScheduleTemplateRequest struct {
+	StaffID       uint                 `json:"staff_id" binding:"required"`
+	Weekday       int                  `json:"weekday" binding:"min=0,max=6"`         // 0-周日 ... 6-周六
+	StartTime     string               `json:"start_time" binding:"required"`         // HH:MM
+	EndTime       string               `json:"end_time" binding:"required"`           // HH:MM
+	SlotMinutes   int                  `json:"slot_minutes" binding:"required,min=5"` // 单个时间段长度(分钟)
+	Capacity      int                  `json:"capacity"`                              // 每个时间段可预约人数，默认1
+	Breaks        []models.BreakPeriod `json:"breaks"`                                // 休息时段
+	EffectiveFrom string               `json:"effective_from" binding:"required"`     // YYYY-MM-DD
+	EffectiveTo   string               `json:"effective_to"`                          // YYYY-MM-DD，可选
+	IsActive      *bool                `json:"is_active"`
+}
+
+// toTemplate 将请求转换为排班模板，校验员工归属
+func (r *ScheduleTemplateRequest) toTemplate(merchantID uint, template *models.StaffScheduleTemplate) error {
+	var staff models.Staff
+	if err := database.DB.First(&staff, r.StaffID).Error; err != nil || staff.MerchantID != merchantID {
+		return fmt.Errorf("员工不存在")
+	}
+
+	from, err := time.Parse("2006-01-02", r.EffectiveFrom)
+	if err != nil {
+		return fmt.Errorf("无效的生效开始日期")
+	}
+
+	var to *time.Time
+	if r.EffectiveTo != "" {
+		t, err := time.Parse("2006-01-02", r.EffectiveTo)
+		if err != nil {
+			return fmt.Errorf("无效的生效结束日期")
+		}
+		to = &t
+	}
+
+	template.MerchantID = merchantID
+	template.StaffID = r.StaffID
+	template.Weekday = r.Weekday
+	template.StartTime = r.StartTime
+	template.EndTime = r.EndTime
+	template.SlotMinutes = r.SlotMinutes
+	template.Capacity = r.Capacity
+	if template.Capacity == 0 {
+		template.Capacity = 1
+	}
+	template.Breaks = r.Breaks
+	template.EffectiveFrom = from
+	template.EffectiveTo = to
+	template.IsActive = r.IsActive == nil || *r.IsActive
+	return nil
+}
+
+// @Summary 获取排班模板列表
+// @Description 获取当前商户的员工每周排班模板，可按员工筛选（商户端）
+// @Tags 商户-时间管理
+// @Security ApiKeyAuth
+// @Produce json
+// @Param Authorization header string true "Bearer Token"
+// @Param staff_id query int false "员工ID" example(5)
+// @Success 200 {array} models.StaffScheduleTemplate "成功返回排班模板列表"
+// @Failure 500 {object} utils.Response "获取排班模板失败"
+// @Router /api/merchant/schedule-templates [get]
+func GetScheduleTemplates(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+	staffID, _ := strconv.Atoi(c.Query("staff_id"))
+
+	templates, err := models.GetScheduleTemplates(merchantID, uint(staffID))
+	if err != nil {
+		utils.InternalError(c, "获取排班模板失败")
+		return
+	}
+
+	utils.Success(c, templates)
+}
+
+// @Summary 创建排班模板
+// @Description 为员工创建每周排班模板，按生效日期范围自动生成时间段（商户端）
+// @Tags 商户-时间管理
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer Token"
+// @Param request body ScheduleTemplateRequest true "排班模板"
+// @Success 200 {object} models.StaffScheduleTemplate "创建成功"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 500 {object} utils.Response "创建失败"
+// @Router /api/merchant/schedule-templates [post]
+func CreateScheduleTemplate(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+
+	var req ScheduleTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	var template models.StaffScheduleTemplate
+	if err := req.toTemplate(merchantID, &template); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	if err := models.ValidateScheduleTemplate(&template); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	if err := models.CreateScheduleTemplate(&template); err != nil {
+		utils.InternalError(c, "创建排班模板失败")
+		log.Printf("创建排班模板失败: %v", err)
+		return
+	}
+
+	utils.Success(c, template)
+}
+
+// @Summary 更新排班模板
+// @Description 更新员工排班模板，变更在下次生成时生效，已被预约的时间段不受影响（商户端）
+// @Tags 商户-时间管理
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer Token"
+// @Param templateId path int true "排班模板ID" example(1)
+// @Param request body ScheduleTemplateRequest true "排班模板"
+// @Success 200 {object} models.StaffScheduleTemplate "更新成功"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 404 {object} utils.Response "排班模板不存在"
+// @Failure 500 {object} utils.Response "更新失败"
+// @Router /api/merchant/schedule-templates/{templateId} [put]
+func UpdateScheduleTemplate(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+	templateID, err := strconv.Atoi(c.Param("templateId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的排班模板ID")
+		return
+	}
+
+	var req ScheduleTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	template, err := models.GetScheduleTemplateByID(uint(templateID))
+	if err != nil || template.MerchantID != merchantID {
+		utils.NotFound(c, "排班模板不存在")
+		return
+	}
+
+	if err := req.toTemplate(merchantID, template); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	if err := models.ValidateScheduleTemplate(template); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	if err := models.UpdateScheduleTemplate(template); err != nil {
+		utils.InternalError(c, "更新排班模板失败")
+		log.Printf("更新排班模板失败: %v", err)
+		return
+	}
+
+	utils.Success(c, template)
+}
+
+// @Summary 删除排班模板
+// @Description 删除员工排班模板，已生成且未被预约的时间段在下次生成时清理（商户端）
+// @Tags 商户-时间管理
+// @Security ApiKeyAuth
+// @Produce json
+// @Param Authorization header string true "Bearer Token"
+// @Param templateId path int true "排班模板ID" example(1)
+// @Success 200 {object} utils.Response "删除成功"
+// @Failure 400 {object} utils.Response "无效的排班模板ID"
+// @Failure 404 {object} utils.Response "排班模板不存在"
+// @Failure 500 {object} utils.Response "删除失败"
+// @Router /api/merchant/schedule-templates/{templateId} [delete]
+func DeleteScheduleTemplate(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+	templateID, err := strconv.Atoi(c.Param("templateId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的排班模板ID")
+		return
+	}
+
+	template, err := models.GetScheduleTemplateByID(uint(templateID))
+	if err != nil || template.MerchantID != merchantID {
+		utils.NotFound(c, "排班模板不存在")
+		return
+	}
+
+	if err := models.DeleteScheduleTemplate(uint(templateID)); err != nil {
+		utils.InternalError(c, "删除排班模板失败")
+		return
+	}
+
+	utils.Success(c, "排班模板删除成功")
+}
+
+// @Summary 按排班模板生成时间段
+// @Description 立即按排班模板生成未来若干天的时间段，重复执行不会产生重复数据（商户端）
+// @Tags 商户-时间管理
+// @Security ApiKeyAuth
+// @Produce json
+// @Param Authorization header string true "Bearer Token"
+// @Param days query int false "生成天数（默认30，最大90）" example(30)
+// @Success 200 {object} models.ScheduleGenerateResult "生成结果"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 500 {object} utils.Response "生成失败"
+// @Router /api/merchant/schedule-templates/generate [post]
+func GenerateScheduleTimeSlots(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+
+	days := constant.ScheduleHorizonDays
+	if d := c.Query("days"); d != "" {
+		n, err := strconv.Atoi(d)
+		if err != nil || n < 1 || n > constant.ScheduleGenerateMaxDays {
+			utils.BadRequest(c, "无效的天数")
+			return
+		}
+		days = n
+	}
+
+	result, err := models.GenerateTimeSlotsFromTemplates(merchantID, days)
+	if err != nil {
+		utils.InternalError(c, "生成时间段失败: "+err.Error())
+		return
+	}
+
+	utils.Success(c, result)
+}
@@ -43,6 +43,9 @@ type CreateServiceRequest struct {
 	CoverImage  string `json:"cover_image"`
 	Price       int    `json:"price" binding:"required"`
 	Duration    int    `json:"duration" binding:"required"`
+	// 服务前后的缓冲时间（分钟），期间同一员工不可被预约
+	BufferBefore int `json:"buffer_before" binding:"min=0"`
+	BufferAfter  int `json:"buffer_after" binding:"min=0"`
 }
 
 // CreateService 创建新的商家服务
@@ -70,14 +73,16 @@ func CreateService(c *gin.Context) {
 	}
 
 	service := models.Service{
-		MerchantID:  merchantID,
-		CategoryID:  req.CategoryID,
-		Name:        req.Name,
-		Description: req.Description,
-		CoverImage:  req.CoverImage,
-		Price:       req.Price,
-		Duration:    req.Duration,
-		IsActive:    true,
+		MerchantID:   merchantID,
+		CategoryID:   req.CategoryID,
+		Name:         req.Name,
+		Description:  req.Description,
+		CoverImage:   req.CoverImage,
+		Price:        req.Price,
+		Duration:     req.Duration,
+		BufferBefore: req.BufferBefore,
+		BufferAfter:  req.BufferAfter,
+		IsActive:     true,
 	}
 
 	if err := models.CreateService(&service); err != nil {
@@ -96,6 +101,9 @@ type UpdateServiceRequest struct {
 	Price       float64 `json:"price"`
 	Duration    int     `json:"duration"`
 	IsActive    bool    `json:"is_active"`
+	// 服务前后的缓冲时间（分钟），不传时保持不变
+	BufferBefore *int `json:"buffer_before" binding:"omitempty,min=0"`
+	BufferAfter  *int `json:"buffer_after" binding:"omitempty,min=0"`
 }
 
 // UpdateService 更新商家服务
@@ -144,6 +152,12 @@ func UpdateService(c *gin.Context) {
 		"duration":    req.Duration,
 		"is_active":   req.IsActive,
 	}
+	if req.BufferBefore != nil {
+		updates["buffer_before"] = *req.BufferBefore
+	}
+	if req.BufferAfter != nil {
+		updates["buffer_after"] = *req.BufferAfter
+	}
 
 	if err := models.UpdateService(uint(serviceID), updates); err != nil {
 		utils.InternalError(c, "更新服务失败")
@@ -190,3 +204,96 @@ func DeleteService(c *gin.Context) {
 
 	utils.Success(c, "删除成功")
 }
+
+type ServiceStaffItem struct {
+	StaffID  uint `json:"staff_id" binding:"required"`
+	Price    *int `json:"price"`    // 员工单独定价（分），不传时使用服务价格
+	Duration *int `json:"duration"` // 员工单独时长（分钟），不传时使用服务时长
+}
+
+// GetServiceStaff 获取可提供服务的员工
+// @Summary      获取服务员工
+// @Description  获取可提供该服务的员工及单独设置的价格和时长
+// @Tags         商家服务管理
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        serviceId path int true "服务ID"
+// @Param        Authorization header string true "Bearer Token"
+// @Success      200  {object}  utils.Response{data=[]models.StaffService} "服务员工列表"
+// @Failure      400  {object}  utils.Response "无效的服务ID"
+// @Failure      404  {object}  utils.Response "服务不存在"
+// @Failure      500  {object}  utils.Response "获取服务员工失败"
+// @Router       /api/merchant/services/{serviceId}/staff [get]
+func GetServiceStaff(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+	serviceID, err := strconv.Atoi(c.Param("serviceId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的服务ID")
+		return
+	}
+
+	var service models.Service
+	if err := database.DB.First(&service, serviceID).Error; err != nil || service.MerchantID != merchantID {
+		utils.NotFound(c, "服务不存在")
+		return
+	}
+
+	items, err := models.GetServiceStaffSettings(service.ID)
+	if err != nil {
+		utils.InternalError(c, "获取服务员工失败")
+		return
+	}
+
+	utils.Success(c, items)
+}
+
+// UpdateServiceStaff 设置可提供服务的员工
+// @Summary      设置服务员工
+// @Description  用提交的列表替换可提供该服务的员工，可为员工单独设置价格和时长。只有关联了服务的员工才能被预约该服务
+// @Tags         商家服务管理
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        serviceId path int true "服务ID"
+// @Param        body body []ServiceStaffItem true "服务员工列表"
+// @Param        Authorization header string true "Bearer Token"
+// @Success      200  {object}  utils.Response "设置成功"
+// @Failure      400  {object}  utils.Response "无效的服务ID | 参数错误"
+// @Failure      404  {object}  utils.Response "服务不存在"
+// @Router       /api/merchant/services/{serviceId}/staff [put]
+func UpdateServiceStaff(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+	serviceID, err := strconv.Atoi(c.Param("serviceId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的服务ID")
+		return
+	}
+
+	var req []ServiceStaffItem
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	var service models.Service
+	if err := database.DB.First(&service, serviceID).Error; err != nil || service.MerchantID != merchantID {
+		utils.NotFound(c, "服务不存在")
+		return
+	}
+
+	items := make([]models.StaffService, 0, len(req))
+	for _, r := range req {
+		items = append(items, models.StaffService{
+			StaffID:  r.StaffID,
+			Price:    r.Price,
+			Duration: r.Duration,
+		})
+	}
+
+	if err := models.SetServiceStaff(merchantID, service.ID, items); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.Success(c, "设置成功")
+}
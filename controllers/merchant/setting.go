@@ -0,0 +1,150 @@
+package merchant
+
+import (
+	"log"
+	"time"
+
+	"admin-api/models"
+	"admin-api/payment"
+	"admin-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MerchantSettingRequest 商家配置，未传的字段保持不变
+type MerchantSettingRequest struct {
+	WaitlistMode        *string `json:"waitlist_mode"`         // hold-保留名额, auto_book-直接预约
+	WaitlistHoldMinutes *int    `json:"waitlist_hold_minutes"` // 候补保留名额的时长（分钟）
+	RescheduleMinHours  *int    `json:"reschedule_min_hours"`  // 客户距开始至少提前多少小时可改约
+	RescheduleMaxTimes  *int    `json:"reschedule_max_times"`  // 客户每个预约最多改约次数，0表示不允许
+	StaffAssignStrategy *string `json:"staff_assign_strategy"` // 不指定员工预约时的分配方式：round_robin, least_booked, highest_rated
+
+	PaymentTimeoutMinutes *int  `json:"payment_timeout_minutes"` // 待支付的支付单自动关闭时长（分钟）
+	UnpaidCancelMinutes   *int  `json:"unpaid_cancel_minutes"`   // 确认后未支付自动取消的时长（分钟），0表示不取消
+	AutoCompleteMinutes   *int  `json:"auto_complete_minutes"`   // 结束后自动标记完成或未到店的时长（分钟），0表示不处理
+	CheckInRequired       *bool `json:"check_in_required"`       // 是否使用到店签到，开启后结束时仍未签到的预约标记为未到店，未开启时标记为已完成
+
+	FreeCancelHours   *int    `json:"free_cancel_hours"`    // 距开始超过该小时数取消免费
+	LateCancelFeeType *string `json:"late_cancel_fee_type"` // 晚取消违约金计算方式：percent-按比例, fixed-固定金额
+	LateCancelFee     *int    `json:"late_cancel_fee"`      // 晚取消违约金，按比例时为百分比，固定金额时单位为分
+	NoShowFeeType     *string `json:"no_show_fee_type"`     // 未到店违约金计算方式：percent-按比例, fixed-固定金额
+	NoShowFee         *int    `json:"no_show_fee"`          // 未到店违约金，按比例时为百分比，固定金额时单位为分
+
+	PaymentProvider *string `json:"payment_provider"` // 支付渠道：wechat_v2, wechat_v3，开启模拟支付的部署可选 simulate；空字符串表示使用部署默认的渠道
+}
+
+// @Summary 获取商家配置
+// @Description 获取当前商户的预约相关配置，如候补放位方式、改约规则、员工分配方式、超时处理、取消政策、支付渠道（商户端）
+// @Tags 商户-设置
+// @Security ApiKeyAuth
+// @Produce json
+// @Param Authorization header string true "Bearer Token"
+// @Success 200 {object} models.MerchantSetting "成功返回商家配置"
+// @Failure 500 {object} utils.Response "获取配置失败"
+// @Router /api/merchant/settings [get]
+func GetMerchantSetting(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+
+	setting, err := models.GetMerchantSetting(merchantID)
+	if err != nil {
+		utils.InternalError(c, "获取配置失败")
+		return
+	}
+
+	utils.Success(c, setting)
+}
+
+// @Summary 更新商家配置
+// @Description 更新当前商户的预约相关配置，只修改传入的字段（商户端）
+// @Tags 商户-设置
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer Token"
+// @Param request body MerchantSettingRequest true "商家配置"
+// @Success 200 {object} models.MerchantSetting "更新成功"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 500 {object} utils.Response "更新配置失败"
+// @Router /api/merchant/settings [put]
+func UpdateMerchantSetting(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+
+	var req MerchantSettingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	setting, err := models.GetMerchantSetting(merchantID)
+	if err != nil {
+		utils.InternalError(c, "获取配置失败")
+		return
+	}
+	prev := *setting
+
+	if req.WaitlistMode != nil {
+		setting.WaitlistMode = *req.WaitlistMode
+	}
+	if req.WaitlistHoldMinutes != nil {
+		setting.WaitlistHoldMinutes = *req.WaitlistHoldMinutes
+	}
+	if req.RescheduleMinHours != nil {
+		setting.RescheduleMinHours = *req.RescheduleMinHours
+	}
+	if req.RescheduleMaxTimes != nil {
+		setting.RescheduleMaxTimes = *req.RescheduleMaxTimes
+	}
+	if req.StaffAssignStrategy != nil {
+		setting.StaffAssignStrategy = *req.StaffAssignStrategy
+	}
+	if req.PaymentTimeoutMinutes != nil {
+		setting.PaymentTimeoutMinutes = *req.PaymentTimeoutMinutes
+	}
+	if req.UnpaidCancelMinutes != nil {
+		setting.UnpaidCancelMinutes = *req.UnpaidCancelMinutes
+	}
+	if req.AutoCompleteMinutes != nil {
+		setting.AutoCompleteMinutes = *req.AutoCompleteMinutes
+	}
+	if req.CheckInRequired != nil {
+		setting.CheckInRequired = *req.CheckInRequired
+	}
+	if req.FreeCancelHours != nil {
+		setting.FreeCancelHours = *req.FreeCancelHours
+	}
+	if req.LateCancelFeeType != nil {
+		setting.LateCancelFeeType = *req.LateCancelFeeType
+	}
+	if req.LateCancelFee != nil {
+		setting.LateCancelFee = *req.LateCancelFee
+	}
+	if req.NoShowFeeType != nil {
+		setting.NoShowFeeType = *req.NoShowFeeType
+	}
+	if req.NoShowFee != nil {
+		setting.NoShowFee = *req.NoShowFee
+	}
+	if req.PaymentProvider != nil {
+		if *req.PaymentProvider != "" {
+			if _, err := payment.GetProvider(*req.PaymentProvider); err != nil {
+				utils.BadRequest(c, err.Error())
+				return
+			}
+		}
+		setting.PaymentProvider = *req.PaymentProvider
+	}
+
+	if err := models.ValidateMerchantSetting(setting); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	setting.RecordEnabledAt(&prev, time.Now())
+
+	if err := models.SaveMerchantSetting(setting); err != nil {
+		utils.InternalError(c, "更新配置失败")
+		log.Printf("更新配置失败: %v", err)
+		return
+	}
+
+	utils.Success(c, setting)
+}
@@ -85,12 +85,13 @@ func CreateStaff(c *gin.Context) {
 }
 
 type UpdateStaffRequest struct {
-	Name        string `json:"name"`
-	Avatar      string `json:"avatar"`
-	Position    string `json:"position"`
-	Description string `json:"description"`
-	Specialties string `json:"specialties"`
-	IsActive    bool   `json:"is_active"`
+	Name        string   `json:"name"`
+	Avatar      string   `json:"avatar"`
+	Position    string   `json:"position"`
+	Description string   `json:"description"`
+	Specialties string   `json:"specialties"`
+	IsActive    bool     `json:"is_active"`
+	Rating      *float64 `json:"rating" binding:"omitempty,min=0,max=5"` // 评分，不传时保持不变
 }
 
 // UpdateStaff 更新员工信息
@@ -138,6 +139,9 @@ func UpdateStaff(c *gin.Context) {
 		"specialties": req.Specialties,
 		"is_active":   req.IsActive,
 	}
+	if req.Rating != nil {
+		updates["rating"] = *req.Rating
+	}
 
 	if err := models.UpdateStaff(uint(staffID), updates); err != nil {
 		utils.InternalError(c, "更新员工失败")
@@ -185,3 +189,96 @@ func DeleteStaff(c *gin.Context) {
 
 	utils.Success(c, "员工删除成功")
 }
+
+type StaffServiceItem struct {
+	ServiceID uint `json:"service_id" binding:"required"`
+	Price     *int `json:"price"`    // 员工单独定价（分），不传时使用服务价格
+	Duration  *int `json:"duration"` // 员工单独时长（分钟），不传时使用服务时长
+}
+
+// GetStaffServices 获取员工可提供的服务
+// @Summary      获取员工服务
+// @Description  获取员工可提供的服务及单独设置的价格和时长
+// @Tags         商家员工管理
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        staffId path int true "员工ID" example(123)
+// @Param        Authorization header string true "Bearer Token"
+// @Success      200  {object}  utils.Response{data=[]models.StaffService} "员工服务列表"
+// @Failure      400  {object}  utils.Response "无效的员工ID"
+// @Failure      404  {object}  utils.Response "员工不存在"
+// @Failure      500  {object}  utils.Response "获取员工服务失败"
+// @Router       /api/merchant/staff/{staffId}/services [get]
+func GetStaffServices(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+	staffID, err := strconv.Atoi(c.Param("staffId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的员工ID")
+		return
+	}
+
+	var staff models.Staff
+	if err := database.DB.First(&staff, staffID).Error; err != nil || staff.MerchantID != merchantID {
+		utils.NotFound(c, "员工不存在")
+		return
+	}
+
+	items, err := models.GetStaffServices(staff.ID)
+	if err != nil {
+		utils.InternalError(c, "获取员工服务失败")
+		return
+	}
+
+	utils.Success(c, items)
+}
+
+// UpdateStaffServices 设置员工可提供的服务
+// @Summary      设置员工服务
+// @Description  用提交的列表替换员工可提供的服务，可为员工单独设置价格和时长。只有关联了服务的员工才能被预约该服务
+// @Tags         商家员工管理
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        staffId path int true "员工ID" example(123)
+// @Param        body body []StaffServiceItem true "员工服务列表"
+// @Param        Authorization header string true "Bearer Token"
+// @Success      200  {object}  utils.Response "设置成功"
+// @Failure      400  {object}  utils.Response "无效的员工ID | 参数错误"
+// @Failure      404  {object}  utils.Response "员工不存在"
+// @Router       /api/merchant/staff/{staffId}/services [put]
+func UpdateStaffServices(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+	staffID, err := strconv.Atoi(c.Param("staffId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的员工ID")
+		return
+	}
+
+	var req []StaffServiceItem
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	var staff models.Staff
+	if err := database.DB.First(&staff, staffID).Error; err != nil || staff.MerchantID != merchantID {
+		utils.NotFound(c, "员工不存在")
+		return
+	}
+
+	items := make([]models.StaffService, 0, len(req))
+	for _, r := range req {
+		items = append(items, models.StaffService{
+			ServiceID: r.ServiceID,
+			Price:     r.Price,
+			Duration:  r.Duration,
+		})
+	}
+
+	if err := models.SetStaffServices(merchantID, staff.ID, items); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.Success(c, "设置成功")
+}
@@ -20,7 +20,7 @@ type AppointmentStatsResponse struct {
 	Today  int64            `json:"today" example:"15"`  // 今日预约数
 	Week   int64            `json:"week" example:"120"`  // 本周预约数
 	Month  int64            `json:"month" example:"450"` // 本月预约数
-	Status map[string]int64 `json:"status"`              // 各状态预约数
+	Status map[string]int64 `json:"status"`              // 各状态预约数，canceled 为旧键名，与 cancelled 相同
 }
 
 // @Summary 获取预约统计数据
@@ -13,8 +13,10 @@ import (
 )
 
 type TimeSlotRequest struct {
+	ID        uint   `json:"id"`                            // 已有时间段ID，修改时传入
 	StartTime string `json:"start_time" binding:"required"` // HH:MM
 	EndTime   string `json:"end_time" binding:"required"`   // HH:MM
+	Capacity  int    `json:"capacity"`                      // 可预约人数，团课大于1；新建默认1，修改时为0表示不变
 }
 
 // @Summary 获取可用时间段
@@ -41,7 +43,7 @@ func GetTimeSlots(c *gin.Context) {
 		return
 	}
 
-	slots, err := models.GetAvailableTimeSlots(merchantID, uint(staffID), parsedDate)
+	slots, err := models.GetAvailableTimeSlots(merchantID, uint(staffID), parsedDate, nil)
 	if err != nil {
 		utils.InternalError(c, "获取时间段失败")
 		return
@@ -53,6 +55,8 @@ func GetTimeSlots(c *gin.Context) {
 		StartTime   string `json:"start_time"`
 		EndTime     string `json:"end_time"`
 		IsAvailable bool   `json:"is_available"`
+		Capacity    int    `json:"capacity"`
+		BookedCount int    `json:"booked_count"`
 	}
 
 	response := make([]SlotResponse, 0, len(slots))
@@ -62,14 +66,58 @@ func GetTimeSlots(c *gin.Context) {
 			StartTime:   slot.StartTime,
 			EndTime:     slot.EndTime,
 			IsAvailable: slot.IsAvailable,
+			Capacity:    slot.Capacity,
+			BookedCount: slot.BookedCount,
 		})
 	}
 
 	utils.Success(c, response)
 }
 
-// @Summary 批量创建时间段
-// @Description 为指定员工在特定日期批量创建时间段（商户端）
+// @Summary 获取员工日历
+// @Description 获取员工某天的全部时间段及状态（available 可预约、booked 已满、buffer 预约前后的缓冲时间、blocked 停业或请假），并单独列出缓冲时段（商户端）
+// @Tags 商户-时间管理
+// @Security ApiKeyAuth
+// @Produce json
+// @Param staff_id query int true "员工ID" example(5)
+// @Param date query string true "日期 (格式: YYYY-MM-DD)" example("2023-06-15")
+// @Param        Authorization header string true "Bearer Token"
+// @Success 200 {object} models.StaffDayCalendar "员工日历"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 404 {object} utils.Response "员工不存在"
+// @Failure 500 {object} utils.Response "获取日历失败"
+// @Router /api/merchant/timeslots/calendar [get]
+func GetStaffCalendar(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+	staffID, err := strconv.Atoi(c.Query("staff_id"))
+	if err != nil {
+		utils.BadRequest(c, "无效的员工ID")
+		return
+	}
+
+	parsedDate, err := time.Parse("2006-01-02", c.Query("date"))
+	if err != nil {
+		utils.BadRequest(c, "无效的日期格式")
+		return
+	}
+
+	var staff models.Staff
+	if err := database.DB.First(&staff, staffID).Error; err != nil || staff.MerchantID != merchantID {
+		utils.NotFound(c, "员工不存在")
+		return
+	}
+
+	calendar, err := models.GetStaffDayCalendar(merchantID, staff.ID, parsedDate)
+	if err != nil {
+		utils.InternalError(c, "获取日历失败")
+		return
+	}
+
+	utils.Success(c, calendar)
+}
+
+// @Summary 批量保存时间段
+// @Description 将员工在特定日期的时间段与提交的列表合并：新增缺失的、更新变化的、删除多余的空闲时间段。已有预约的时间段不会被修改或删除，返回冲突报告（商户端）
 // @Tags 商户-时间管理
 // @Accept json
 // @Produce json
@@ -78,8 +126,9 @@ func GetTimeSlots(c *gin.Context) {
 // @Param date query string true "日期 (格式: YYYY-MM-DD)" example("2023-06-15")
 // @Param        Authorization header string true "Bearer Token"
 // @Param request body []TimeSlotRequest true "时间段列表"
-// @Success 200 {object} utils.Response "创建成功"
+// @Success 200 {object} models.TimeSlotMergeReport "合并结果及冲突报告"
 // @Failure 400 {object} utils.Response "参数错误"
+// @Failure 404 {object} utils.Response "员工不存在"
 // @Failure 500 {object} utils.Response "创建失败"
 // @Router /api/merchant/timeslots/{staffId}/batch [post]
 func BatchCreateTimeSlots(c *gin.Context) {
@@ -104,38 +153,44 @@ func BatchCreateTimeSlots(c *gin.Context) {
 		return
 	}
 
+	// 验证员工属于该商家
+	var staff models.Staff
+	if err := database.DB.First(&staff, staffID).Error; err != nil || staff.MerchantID != merchantID {
+		utils.NotFound(c, "员工不存在")
+		return
+	}
+
 	// 转换为TimeSlot
 	var slots []models.TimeSlot
 	for _, r := range req {
-		//startTime, err := time.Parse("15:04", r.StartTime)
-		//if err != nil {
-		//	utils.BadRequest(c, "无效的开始时间")
-		//	return
-		//}
-		//
-		//endTime, err := time.Parse("15:04", r.EndTime)
-		//if err != nil {
-		//	utils.BadRequest(c, "无效的结束时间")
-		//	return
-		//}
-		if r.StartTime > r.EndTime {
-			utils.InternalError(c, "创建时间段不能开始时间晚于结束时间")
-		}
-
 		slots = append(slots, models.TimeSlot{
+			ID:          r.ID,
 			StartTime:   r.StartTime,
 			EndTime:     r.EndTime,
 			IsAvailable: true,
+			Capacity:    r.Capacity,
 		})
 	}
 
-	if err := models.BatchCreateTimeSlots(merchantID, uint(staffID), parsedDate, slots); err != nil {
-		utils.InternalError(c, "创建时间段失败")
+	if err := models.ValidateTimeSlots(slots); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	// 校验营业时间
+	if err := models.ValidateSlotsWithinBusinessHours(merchantID, parsedDate, slots); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	report, err := models.BatchCreateTimeSlots(merchantID, uint(staffID), parsedDate, slots)
+	if err != nil {
+		utils.InternalError(c, "保存时间段失败")
 		fmt.Println(err)
 		return
 	}
 
-	utils.Success(c, "时间段创建成功")
+	utils.Success(c, report)
 }
 
 // @Summary 删除时间段
@@ -174,3 +229,51 @@ func DeleteTimeSlot(c *gin.Context) {
 
 	utils.Success(c, "时间段删除成功")
 }
+
+// @Summary 获取时间段学员名单
+// @Description 获取时间段上的全部有效预约，用于团课签到和人数管理（商户端）
+// @Tags 商户-时间管理
+// @Security ApiKeyAuth
+// @Produce json
+// @Param Authorization header string true "Bearer Token"
+// @Param timeslotId path int true "时间段ID" example(123)
+// @Success 200 {object} utils.Response "成功返回时间段容量和学员名单"
+// @Failure 400 {object} utils.Response "无效的时间段ID"
+// @Failure 404 {object} utils.Response "时间段不存在"
+// @Failure 500 {object} utils.Response "获取失败"
+// @Router /api/merchant/timeslots/{timeslotId}/attendees [get]
+func GetTimeSlotAttendees(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+	slotID, err := strconv.Atoi(c.Param("timeslotId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的时间段ID")
+		return
+	}
+
+	var slot models.TimeSlot
+	if err := database.DB.First(&slot, slotID).Error; err != nil || slot.MerchantID != merchantID {
+		utils.NotFound(c, "时间段不存在")
+		return
+	}
+
+	attendees, err := models.GetSlotAttendees([]uint{slot.ID})
+	if err != nil {
+		utils.InternalError(c, "获取学员名单失败")
+		return
+	}
+
+	list := toAttendees(attendees[slot.ID])
+	if list == nil {
+		list = []AttendeeResponse{}
+	}
+
+	utils.Success(c, gin.H{
+		"time_slot_id": slot.ID,
+		"date":         slot.Date.Format("2006-01-02"),
+		"start_time":   slot.StartTime,
+		"end_time":     slot.EndTime,
+		"capacity":     slot.Capacity,
+		"booked_count": slot.BookedCount,
+		"attendees":    list,
+	})
+}
@@ -0,0 +1,326 @@
+package merchant
+
+import (
+	"admin-api/database"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"admin-api/models"
+	"admin-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AffectedAppointment 与新增屏蔽时段冲突、需要商家改约的预约
+type AffectedAppointment struct {
+	ID              uint   `json:"id"`
+	OrderNo         string `json:"order_no"`
+	UserName        string `json:"user_name"`
+	UserPhone       string `json:"user_phone"`
+	ServiceName     string `json:"service_name"`
+	StaffID         uint   `json:"staff_id"`
+	StaffName       string `json:"staff_name"`
+	AppointmentDate string `json:"appointment_date"`
+	StartTime       string `json:"start_time"`
+	EndTime         string `json:"end_time"`
+	Status          string `json:"status"`
+}
+
+func toAffectedAppointments(appointments []models.Appointment) []AffectedAppointment {
+	response := make([]AffectedAppointment, 0, len(appointments))
+	for _, appt := range appointments {
+		response = append(response, AffectedAppointment{
+			ID:              appt.ID,
+			OrderNo:         appt.OrderNo,
+			UserName:        appt.User.Nickname,
+			UserPhone:       appt.User.Phone,
+			ServiceName:     appt.Service.Name,
+			StaffID:         appt.StaffID,
+			StaffName:       appt.Staff.Name,
+			AppointmentDate: appt.AppointmentDate.Format("2006-01-02"),
+			StartTime:       appt.StartTime,
+			EndTime:         appt.EndTime,
+			Status:          appt.Status,
+		})
+	}
+	return response
+}
+
+// parseDateRange 解析开始和结束日期，结束日期为空时与开始日期相同
+func parseDateRange(start, end string) (time.Time, time.Time, error) {
+	startDate, err := time.Parse("2006-01-02", start)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("无效的开始日期")
+	}
+	endDate := startDate
+	if end != "" {
+		endDate, err = time.Parse("2006-01-02", end)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("无效的结束日期")
+		}
+	}
+	return startDate, endDate, nil
+}
+
+type StaffTimeOffRequest struct {
+	StaffID   uint   `json:"staff_id" binding:"required"`
+	Type      string `json:"type" binding:"required,oneof=vacation sick block"`
+	StartDate string `json:"start_date" binding:"required"` // YYYY-MM-DD
+	EndDate   string `json:"end_date"`                      // YYYY-MM-DD，默认与开始日期相同
+	StartTime string `json:"start_time"`                    // HH:MM，为空表示整天
+	EndTime   string `json:"end_time"`                      // HH:MM，为空表示整天
+	Reason    string `json:"reason"`
+}
+
+// @Summary 获取员工请假列表
+// @Description 获取当前商户员工的请假和临时占用记录，可按员工和日期范围筛选（商户端）
+// @Tags 商户-时间管理
+// @Security ApiKeyAuth
+// @Produce json
+// @Param Authorization header string true "Bearer Token"
+// @Param staff_id query int false "员工ID" example(5)
+// @Param start_date query string false "开始日期 (格式: YYYY-MM-DD)"
+// @Param end_date query string false "结束日期 (格式: YYYY-MM-DD)"
+// @Success 200 {array} models.StaffTimeOff "成功返回请假列表"
+// @Failure 500 {object} utils.Response "获取失败"
+// @Router /api/merchant/time-offs [get]
+func GetStaffTimeOffs(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+	staffID, _ := strconv.Atoi(c.Query("staff_id"))
+
+	timeOffs, err := models.GetStaffTimeOffs(merchantID, uint(staffID), c.Query("start_date"), c.Query("end_date"))
+	if err != nil {
+		utils.InternalError(c, "获取请假记录失败")
+		return
+	}
+
+	utils.Success(c, timeOffs)
+}
+
+// @Summary 创建员工请假
+// @Description 为员工登记休假、病假或部分时段占用，期间的时间段不再对客户开放。返回与之冲突、需要改约的预约（商户端）
+// @Tags 商户-时间管理
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer Token"
+// @Param request body StaffTimeOffRequest true "请假信息"
+// @Success 200 {object} utils.Response "创建成功，返回请假记录和受影响的预约"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 404 {object} utils.Response "员工不存在"
+// @Failure 500 {object} utils.Response "创建失败"
+// @Router /api/merchant/time-offs [post]
+func CreateStaffTimeOff(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+
+	var req StaffTimeOffRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	// 验证员工属于该商家
+	var staff models.Staff
+	if err := database.DB.First(&staff, req.StaffID).Error; err != nil || staff.MerchantID != merchantID {
+		utils.NotFound(c, "员工不存在")
+		return
+	}
+
+	startDate, endDate, err := parseDateRange(req.StartDate, req.EndDate)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	timeOff := models.StaffTimeOff{
+		MerchantID: merchantID,
+		StaffID:    req.StaffID,
+		Type:       req.Type,
+		StartDate:  startDate,
+		EndDate:    endDate,
+		StartTime:  req.StartTime,
+		EndTime:    req.EndTime,
+		Reason:     req.Reason,
+	}
+
+	if err := models.ValidateStaffTimeOff(&timeOff); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	if err := models.CreateStaffTimeOff(&timeOff); err != nil {
+		utils.InternalError(c, "创建请假记录失败")
+		log.Printf("创建请假记录失败: %v", err)
+		return
+	}
+
+	affected, err := models.GetAffectedAppointments(merchantID, req.StaffID, startDate, endDate,
+		req.StartTime, req.EndTime)
+	if err != nil {
+		utils.InternalError(c, "查询受影响的预约失败")
+		return
+	}
+
+	utils.Success(c, gin.H{
+		"time_off":              timeOff,
+		"affected_appointments": toAffectedAppointments(affected),
+	})
+}
+
+// @Summary 删除员工请假
+// @Description 删除员工请假记录，对应时间段恢复可预约（商户端）
+// @Tags 商户-时间管理
+// @Security ApiKeyAuth
+// @Produce json
+// @Param Authorization header string true "Bearer Token"
+// @Param timeOffId path int true "请假记录ID" example(1)
+// @Success 200 {object} utils.Response "删除成功"
+// @Failure 400 {object} utils.Response "无效的请假记录ID"
+// @Failure 404 {object} utils.Response "请假记录不存在"
+// @Failure 500 {object} utils.Response "删除失败"
+// @Router /api/merchant/time-offs/{timeOffId} [delete]
+func DeleteStaffTimeOff(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+	timeOffID, err := strconv.Atoi(c.Param("timeOffId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的请假记录ID")
+		return
+	}
+
+	timeOff, err := models.GetStaffTimeOffByID(uint(timeOffID))
+	if err != nil || timeOff.MerchantID != merchantID {
+		utils.NotFound(c, "请假记录不存在")
+		return
+	}
+
+	if err := models.DeleteStaffTimeOff(uint(timeOffID)); err != nil {
+		utils.InternalError(c, "删除请假记录失败")
+		return
+	}
+
+	utils.Success(c, "请假记录删除成功")
+}
+
+type MerchantClosureRequest struct {
+	Type      string `json:"type" binding:"required,oneof=holiday renovation other"`
+	StartDate string `json:"start_date" binding:"required"` // YYYY-MM-DD
+	EndDate   string `json:"end_date"`                      // YYYY-MM-DD，默认与开始日期相同
+	Reason    string `json:"reason"`
+}
+
+// @Summary 获取停业日列表
+// @Description 获取当前商户的停业日（节假日、装修等），可按日期范围筛选（商户端）
+// @Tags 商户-时间管理
+// @Security ApiKeyAuth
+// @Produce json
+// @Param Authorization header string true "Bearer Token"
+// @Param start_date query string false "开始日期 (格式: YYYY-MM-DD)"
+// @Param end_date query string false "结束日期 (格式: YYYY-MM-DD)"
+// @Success 200 {array} models.MerchantClosure "成功返回停业日列表"
+// @Failure 500 {object} utils.Response "获取失败"
+// @Router /api/merchant/closures [get]
+func GetMerchantClosures(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+
+	closures, err := models.GetMerchantClosures(merchantID, c.Query("start_date"), c.Query("end_date"))
+	if err != nil {
+		utils.InternalError(c, "获取停业日失败")
+		return
+	}
+
+	utils.Success(c, closures)
+}
+
+// @Summary 创建停业日
+// @Description 登记商家停业日期，期间所有员工的时间段不再对客户开放。返回与之冲突、需要改约的预约（商户端）
+// @Tags 商户-时间管理
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer Token"
+// @Param request body MerchantClosureRequest true "停业信息"
+// @Success 200 {object} utils.Response "创建成功，返回停业记录和受影响的预约"
+// @Failure 400 {object} utils.Response "参数错误"
+// @Failure 500 {object} utils.Response "创建失败"
+// @Router /api/merchant/closures [post]
+func CreateMerchantClosure(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+
+	var req MerchantClosureRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	startDate, endDate, err := parseDateRange(req.StartDate, req.EndDate)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	closure := models.MerchantClosure{
+		MerchantID: merchantID,
+		Type:       req.Type,
+		StartDate:  startDate,
+		EndDate:    endDate,
+		Reason:     req.Reason,
+	}
+
+	if err := models.ValidateMerchantClosure(&closure); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	if err := models.CreateMerchantClosure(&closure); err != nil {
+		utils.InternalError(c, "创建停业日失败")
+		log.Printf("创建停业日失败: %v", err)
+		return
+	}
+
+	affected, err := models.GetAffectedAppointments(merchantID, 0, startDate, endDate, "", "")
+	if err != nil {
+		utils.InternalError(c, "查询受影响的预约失败")
+		return
+	}
+
+	utils.Success(c, gin.H{
+		"closure":               closure,
+		"affected_appointments": toAffectedAppointments(affected),
+	})
+}
+
+// @Summary 删除停业日
+// @Description 删除商家停业记录，对应日期恢复可预约（商户端）
+// @Tags 商户-时间管理
+// @Security ApiKeyAuth
+// @Produce json
+// @Param Authorization header string true "Bearer Token"
+// @Param closureId path int true "停业记录ID" example(1)
+// @Success 200 {object} utils.Response "删除成功"
+// @Failure 400 {object} utils.Response "无效的停业记录ID"
+// @Failure 404 {object} utils.Response "停业记录不存在"
+// @Failure 500 {object} utils.Response "删除失败"
+// @Router /api/merchant/closures/{closureId} [delete]
+func DeleteMerchantClosure(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+	closureID, err := strconv.Atoi(c.Param("closureId"))
+	if err != nil {
+		utils.BadRequest(c, "无效的停业记录ID")
+		return
+	}
+
+	closure, err := models.GetMerchantClosureByID(uint(closureID))
+	if err != nil || closure.MerchantID != merchantID {
+		utils.NotFound(c, "停业记录不存在")
+		return
+	}
+
+	if err := models.DeleteMerchantClosure(uint(closureID)); err != nil {
+		utils.InternalError(c, "删除停业记录失败")
+		return
+	}
+
+	utils.Success(c, "停业记录删除成功")
+}
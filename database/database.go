@@ -6,6 +6,7 @@ import (
 	//"admin-api/models"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
 	"time"
 
@@ -15,6 +16,10 @@ import (
 
 var DB *gorm.DB
 
+// Location 数据库连接使用的时区，datetime 列按该时区读写。
+// 商家业务时间按各自时区计算（见 models.Merchant.Timezone），与此无关。
+var Location = time.Local
+
 func InitDB() {
 	// 1. 优先从环境变量获取配置
 	dbHost := os.Getenv("DB_HOST")
@@ -42,16 +47,27 @@ func InitDB() {
 		dbName = "appointment_db"
 	}
 
+	// 默认按服务器本地时间存取，与已有数据一致；可通过 DB_LOC 指定时区（如 UTC），
+	// 修改前须先将已有的 datetime 数据转换到新时区
+	dbLoc := os.Getenv("DB_LOC")
+	if dbLoc == "" {
+		dbLoc = "Local"
+	}
+	loc, err := time.LoadLocation(dbLoc)
+	if err != nil {
+		log.Fatalf("❌ 无效的数据库时区 %s: %v", dbLoc, err)
+	}
+	Location = loc
+
 	// 2. 构建DSN（添加关键参数）
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?"+
-		"charset=utf8mb4&parseTime=True&loc=Local&"+
+		"charset=utf8mb4&parseTime=True&loc=%s&"+
 		"timeout=30s&readTimeout=30s&writeTimeout=30s", // 添加超时设置
-		dbUser, dbPass, dbHost, dbPort, dbName)
+		dbUser, dbPass, dbHost, dbPort, dbName, url.QueryEscape(dbLoc))
 
 	log.Printf("📡 尝试连接数据库: %s@%s:%s", dbUser, dbHost, dbPort)
 
 	// 3. 添加重试逻辑
-	var err error
 	var sqlDB *sql.DB
 	for i := 0; i < 5; i++ {
 		DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
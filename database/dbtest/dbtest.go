@@ -0,0 +1,77 @@
+// Package dbtest 为需要数据库的测试提供连接：未设置 TEST_MYSQL_DSN 时跳过测试，
+// 否则连接该数据库，重建测试用到的表并替换 database.DB，测试结束后恢复
+package dbtest
+
+import (
+	"admin-api/database"
+	"os"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+// EnvDSN 测试数据库连接串的环境变量，如 root:@tcp(127.0.0.1:3306)/appointment_test?charset=utf8mb4&parseTime=True&loc=Local
+const EnvDSN = "TEST_MYSQL_DSN"
+
+// Setup 连接测试数据库并重建 models 对应的表，返回的连接同时赋值给 database.DB
+func Setup(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv(EnvDSN)
+	if dsn == "" {
+		t.Skipf("未设置 %s，跳过数据库测试", EnvDSN)
+	}
+
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{
+		Logger:                                   logger.Default.LogMode(logger.Silent),
+		DisableForeignKeyConstraintWhenMigrating: true,
+	})
+	if err != nil {
+		t.Fatalf("连接测试数据库失败: %v", err)
+	}
+	if err := db.Migrator().DropTable(models...); err != nil {
+		t.Fatalf("删除测试表失败: %v", err)
+	}
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatalf("创建测试表失败: %v", err)
+	}
+	for _, model := range models {
+		if err := restoreTimeColumns(db, model); err != nil {
+			t.Fatalf("修改测试表失败: %v", err)
+		}
+	}
+
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = previous
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// restoreTimeColumns 标记为 type:time 的字段会被 AutoMigrate 当作时间戳建为 datetime，改回 TIME
+func restoreTimeColumns(db *gorm.DB, model interface{}) error {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return err
+	}
+	for _, field := range stmt.Schema.Fields {
+		if !strings.EqualFold(field.TagSettings["TYPE"], "time") {
+			continue
+		}
+		sql := "ALTER TABLE ? MODIFY ? TIME"
+		if field.NotNull {
+			sql += " NOT NULL"
+		}
+		if err := db.Exec(sql, clause.Table{Name: stmt.Schema.Table}, clause.Column{Name: field.DBName}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
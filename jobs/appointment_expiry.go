@@ -0,0 +1,100 @@
+package jobs
+
+import (
+	"admin-api/common/constant"
+	"admin-api/models"
+	"admin-api/payment"
+	"errors"
+	"log"
+	"time"
+)
+
+// StartAppointmentExpirer 启动超时处理任务：关闭超时的支付单，取消超时未确认或未支付的预约，
+// 恢复未完成下单流程占用的优惠券，将已结束的预约标记为已完成或未到店，并按未到店政策为已支付的未到店预约退款
+func StartAppointmentExpirer() {
+	go func() {
+		ticker := time.NewTicker(constant.AppointmentExpireInterval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			expireAppointments(now)
+		}
+	}()
+}
+
+func expireAppointments(now time.Time) {
+	closed := closeExpiredPayments(now)
+
+	cancelled, err := models.ExpireUnpaidAppointments(now)
+	if err != nil {
+		log.Printf("❌ 超时预约取消失败: %v", err)
+	}
+
+	coupons, err := models.ReleaseStuckCoupons()
+	if err != nil {
+		log.Printf("❌ 优惠券恢复失败: %v", err)
+	}
+
+	completed, noShows, err := models.CompletePastAppointments(now)
+	if err != nil {
+		log.Printf("❌ 已结束预约处理失败: %v", err)
+	}
+	noShow := len(noShows)
+	refundNoShows(noShows)
+
+	if closed+cancelled+coupons+completed+noShow > 0 {
+		log.Printf("✅ 超时处理完成 (关闭支付:%d 取消预约:%d 恢复优惠券:%d 完成:%d 未到店:%d)",
+			closed, cancelled, coupons, completed, noShow)
+	}
+}
+
+// closeExpiredPayments 关闭超时的支付单，先在支付单所属的渠道关单，关单失败的留待下次处理
+func closeExpiredPayments(now time.Time) int {
+	payments, err := models.ExpiredPendingPayments(now)
+	if err != nil {
+		log.Printf("❌ 查询超时支付单失败: %v", err)
+		return 0
+	}
+
+	count := 0
+	for _, p := range payments {
+		provider, err := payment.ProviderForPayment(&p)
+		if err != nil {
+			log.Printf("支付单 %s 关单失败: %v", p.OutTradeNo, err)
+			continue
+		}
+		if err := provider.CloseOrder(p.OutTradeNo); err != nil {
+			// 已支付的等待支付回调
+			if !errors.Is(err, payment.ErrOrderPaid) {
+				log.Printf("支付单 %s 关单失败: %v", p.OutTradeNo, err)
+			}
+			continue
+		}
+		ok, err := models.ClosePayment(p.ID, "超时未支付")
+		if err != nil {
+			log.Printf("支付单 %s 关闭失败: %v", p.OutTradeNo, err)
+			continue
+		}
+		if ok {
+			count++
+		}
+	}
+	return count
+}
+
+// refundNoShows 已支付但未签到的预约按商家的未到店政策扣除违约金后退还余额，
+// 退款失败的记录日志，由商家手动发起退款
+func refundNoShows(appointments []models.Appointment) {
+	for _, a := range appointments {
+		refund, err := models.CreateNoShowRefund(a.MerchantID, a.ID)
+		if err != nil {
+			log.Printf("预约 %d 未到店退款失败: %v", a.ID, err)
+			continue
+		}
+		if refund == nil {
+			continue
+		}
+		if err := payment.ExecuteRefund(refund, models.ActorSystem, 0); err != nil {
+			log.Printf("预约 %d 未到店退款失败: %v", a.ID, err)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package jobs
+
+import (
+	"admin-api/common/constant"
+	"admin-api/models"
+	"log"
+	"time"
+)
+
+// StartCalendarSync 启动外部日历同步任务，定期读取员工登记的本地文件和订阅地址，更新忙碌时段
+func StartCalendarSync() {
+	go func() {
+		syncCalendars()
+
+		ticker := time.NewTicker(constant.CalendarSyncInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			syncCalendars()
+		}
+	}()
+}
+
+func syncCalendars() {
+	synced, failed, err := models.SyncAllCalendarSources()
+	if err != nil {
+		log.Printf("❌ 外部日历同步失败: %v", err)
+		return
+	}
+	if synced > 0 || failed > 0 {
+		log.Printf("✅ 外部日历同步完成 (成功:%d, 失败:%d)", synced, failed)
+	}
+}
@@ -0,0 +1,25 @@
+package jobs
+
+import (
+	"admin-api/common/constant"
+	"admin-api/payment"
+	"log"
+	"time"
+)
+
+// StartWechatPayCertRefresher 使用微信支付 APIv3 时启动平台证书刷新任务，
+// 定期重新下载平台证书，微信支付轮换证书后回调仍能验签
+func StartWechatPayCertRefresher() {
+	if !payment.APIv3Enabled() {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(constant.WechatPayCertRefreshInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := payment.RefreshWechatPayV3Certificates(); err != nil {
+				log.Printf("❌ 微信支付平台证书刷新失败: %v", err)
+			}
+		}
+	}()
+}
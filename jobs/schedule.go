@@ -0,0 +1,31 @@
+package jobs
+
+import (
+	"admin-api/common/constant"
+	"admin-api/models"
+	"log"
+	"time"
+)
+
+// StartScheduleGenerator 启动排班生成任务，定期按员工排班模板补齐未来的时间段
+func StartScheduleGenerator() {
+	go func() {
+		generateScheduledSlots()
+
+		ticker := time.NewTicker(constant.ScheduleGenerateInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			generateScheduledSlots()
+		}
+	}()
+}
+
+func generateScheduledSlots() {
+	result, err := models.GenerateAllTimeSlots(constant.ScheduleHorizonDays)
+	if err != nil {
+		log.Printf("❌ 排班时间段生成失败: %v", err)
+		return
+	}
+	log.Printf("✅ 排班时间段生成完成 (新增:%d, 移除:%d, 跳过:%d)",
+		result.Created, result.Removed, result.Skipped)
+}
@@ -0,0 +1,30 @@
+package jobs
+
+import (
+	"admin-api/common/constant"
+	"admin-api/models"
+	"log"
+	"time"
+)
+
+// StartWaitlistExpirer 启动候补过期任务，释放超时未确认的保留名额并放位给下一位候补
+func StartWaitlistExpirer() {
+	go func() {
+		ticker := time.NewTicker(constant.WaitlistExpireInterval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			expireWaitlist(now)
+		}
+	}()
+}
+
+func expireWaitlist(now time.Time) {
+	count, err := models.ExpireWaitlist(now)
+	if err != nil {
+		log.Printf("❌ 候补过期处理失败: %v", err)
+		return
+	}
+	if count > 0 {
+		log.Printf("✅ 候补过期处理完成 (过期:%d)", count)
+	}
+}
@@ -3,8 +3,12 @@ package main
 import (
 	"admin-api/database"
 	_ "admin-api/docs"
+	"admin-api/jobs"
 	"admin-api/middlewares"
+	"admin-api/pkg/auth"
+	"admin-api/pkg/redis"
 	"admin-api/routes"
+	"errors"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"log"
@@ -12,6 +16,7 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+	_ "time/tzdata" // 内置时区数据，容器中没有 zoneinfo 时商家时区也能解析
 
 	//"fmt"
 	"context"
@@ -58,10 +63,30 @@ func main() {
 	// 4. 全局CORS中间件
 	router.Use(middlewares.Cors())
 
+	// 日历订阅链接签名密钥须单独配置，未配置时不提供日历订阅，配置了但不安全时无法启动
+	if err := auth.ValidateFeedSecret(); errors.Is(err, auth.ErrFeedDisabled) {
+		log.Printf("⚠️ %v", err)
+	} else if err != nil {
+		log.Fatalf("❌ 日历订阅配置错误: %v", err)
+	}
+
 	// 5. 初始化数据库
 	database.InitDB()
 	log.Println("✅ 数据库初始化完成")
 
+	// 初始化Redis（验证码、登录限制和时间段预留依赖Redis）
+	if err := redis.SetupRedisDb(); err != nil {
+		log.Fatalf("❌ Redis初始化失败: %v", err)
+	}
+	log.Println("✅ Redis初始化成功")
+
+	// 启动后台任务
+	jobs.StartScheduleGenerator()
+	jobs.StartWaitlistExpirer()
+	jobs.StartCalendarSync()
+	jobs.StartAppointmentExpirer()
+	jobs.StartWechatPayCertRefresher()
+
 	// 6. 注册业务路由（必须先于健康检查！）
 	routes.SetupInternalRoutes(router) // 先注册内部路由
 	routes.SetupMerchantRoutes(router) // 再注册商家路由
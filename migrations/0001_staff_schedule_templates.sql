@@ -0,0 +1,26 @@
+-- 员工每周排班模板，按模板生成的时间段记录来源模板
+
+CREATE TABLE IF NOT EXISTS `staff_schedule_templates` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `merchant_id` bigint unsigned NOT NULL,
+  `staff_id` bigint unsigned NOT NULL,
+  `weekday` bigint NOT NULL,
+  `start_time` varchar(8) NOT NULL,
+  `end_time` varchar(8) NOT NULL,
+  `slot_minutes` bigint NOT NULL DEFAULT '30',
+  `capacity` bigint NOT NULL DEFAULT '1',
+  `breaks` text NULL,
+  `effective_from` date NOT NULL,
+  `effective_to` date NULL,
+  `is_active` tinyint(1) NOT NULL DEFAULT '1',
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_staff_schedule_templates_merchant_id` (`merchant_id`),
+  KEY `idx_staff_schedule_templates_staff_id` (`staff_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 手动创建的时间段 template_id 为 0
+ALTER TABLE `time_slots`
+  ADD COLUMN `template_id` bigint unsigned NOT NULL DEFAULT '0',
+  ADD INDEX `idx_time_slots_template_id` (`template_id`);
@@ -0,0 +1,11 @@
+-- 预约占用的全部时间段。之前的预约没有关联记录，按 appointments.time_slot_id 处理
+
+CREATE TABLE IF NOT EXISTS `appointment_time_slots` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `appointment_id` bigint unsigned NOT NULL,
+  `time_slot_id` bigint unsigned NOT NULL,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_appointment_time_slots_appointment_id` (`appointment_id`),
+  KEY `idx_appointment_time_slots_time_slot_id` (`time_slot_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
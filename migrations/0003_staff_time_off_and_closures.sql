@@ -0,0 +1,31 @@
+-- 员工请假和门店休息日
+
+CREATE TABLE IF NOT EXISTS `staff_time_offs` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `merchant_id` bigint unsigned NOT NULL,
+  `staff_id` bigint unsigned NOT NULL,
+  `type` varchar(20) NOT NULL DEFAULT 'vacation',
+  `start_date` date NOT NULL,
+  `end_date` date NOT NULL,
+  `start_time` varchar(8) NULL,
+  `end_time` varchar(8) NULL,
+  `reason` varchar(255) NULL,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_staff_time_offs_merchant_id` (`merchant_id`),
+  KEY `idx_staff_time_offs_staff_id` (`staff_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `merchant_closures` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `merchant_id` bigint unsigned NOT NULL,
+  `type` varchar(20) NOT NULL DEFAULT 'holiday',
+  `start_date` date NOT NULL,
+  `end_date` date NOT NULL,
+  `reason` varchar(255) NULL,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_merchant_closures_merchant_id` (`merchant_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
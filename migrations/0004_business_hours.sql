@@ -0,0 +1,28 @@
+-- 门店每周营业时间和特殊日期营业时间
+
+CREATE TABLE IF NOT EXISTS `merchant_business_hours` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `merchant_id` bigint unsigned NOT NULL,
+  `weekday` bigint NOT NULL,
+  `open_time` varchar(8) NOT NULL,
+  `close_time` varchar(8) NOT NULL,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_merchant_business_hours_merchant_id` (`merchant_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `merchant_business_hour_exceptions` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `merchant_id` bigint unsigned NOT NULL,
+  `date` date NOT NULL,
+  `is_closed` tinyint(1) NOT NULL DEFAULT '0',
+  `open_time` varchar(8) NULL,
+  `close_time` varchar(8) NULL,
+  `remark` varchar(255) NULL,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_merchant_business_hour_exceptions_date` (`date`),
+  KEY `idx_merchant_business_hour_exceptions_merchant_id` (`merchant_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,12 @@
+-- 时间段容量和已占用名额
+
+ALTER TABLE `time_slots`
+  ADD COLUMN `capacity` bigint NOT NULL DEFAULT '1',
+  ADD COLUMN `booked_count` bigint NOT NULL DEFAULT '0';
+
+-- 按未结束的预约回填已占用名额，is_available 保持不变（可能是商家手动关闭的）
+UPDATE `time_slots` ts
+SET ts.`booked_count` = (
+  SELECT COUNT(*) FROM `appointments` a
+  WHERE a.`time_slot_id` = ts.`id` AND a.`status` IN ('pending', 'confirmed', 'paid')
+);
@@ -0,0 +1,48 @@
+-- 候补、站内通知和商家配置
+
+CREATE TABLE IF NOT EXISTS `waitlist_entries` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned NOT NULL,
+  `merchant_id` bigint unsigned NOT NULL,
+  `service_id` bigint unsigned NOT NULL,
+  `staff_id` bigint unsigned NOT NULL,
+  `time_slot_id` bigint unsigned NOT NULL,
+  `date` date NOT NULL,
+  `start_time` varchar(8) NOT NULL,
+  `end_time` varchar(8) NOT NULL,
+  `status` varchar(20) NOT NULL DEFAULT 'waiting',
+  `remark` varchar(255) NULL,
+  `held_slot_ids` text NULL,
+  `hold_expires_at` datetime(3) NULL,
+  `appointment_id` bigint unsigned NOT NULL DEFAULT '0',
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_waitlist_entries_merchant_id` (`merchant_id`),
+  KEY `idx_waitlist_entries_staff_id` (`staff_id`),
+  KEY `idx_waitlist_entries_time_slot_id` (`time_slot_id`),
+  KEY `idx_waitlist_entries_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `notifications` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned NOT NULL,
+  `type` varchar(30) NOT NULL,
+  `title` varchar(100) NOT NULL,
+  `content` varchar(500) NULL,
+  `is_read` tinyint(1) NOT NULL DEFAULT '0',
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_notifications_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `merchant_settings` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `merchant_id` bigint unsigned NOT NULL,
+  `waitlist_mode` varchar(20) NOT NULL DEFAULT 'hold',
+  `waitlist_hold_minutes` bigint NOT NULL DEFAULT '30',
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_merchant_settings_merchant_id` (`merchant_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
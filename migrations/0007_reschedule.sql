@@ -0,0 +1,29 @@
+-- 预约改约记录和改约规则
+
+ALTER TABLE `appointments`
+  ADD COLUMN `reschedule_count` bigint NOT NULL DEFAULT '0';
+
+CREATE TABLE IF NOT EXISTS `appointment_reschedules` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `appointment_id` bigint unsigned NOT NULL,
+  `operator_type` varchar(20) NOT NULL,
+  `operator_id` bigint unsigned NOT NULL,
+  `from_staff_id` bigint unsigned NOT NULL,
+  `from_time_slot_id` bigint unsigned NOT NULL,
+  `from_date` date NOT NULL,
+  `from_start_time` varchar(8) NOT NULL,
+  `from_end_time` varchar(8) NOT NULL,
+  `to_staff_id` bigint unsigned NOT NULL,
+  `to_time_slot_id` bigint unsigned NOT NULL,
+  `to_date` date NOT NULL,
+  `to_start_time` varchar(8) NOT NULL,
+  `to_end_time` varchar(8) NOT NULL,
+  `reason` varchar(255) NULL,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_appointment_reschedules_appointment_id` (`appointment_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+ALTER TABLE `merchant_settings`
+  ADD COLUMN `reschedule_min_hours` bigint NOT NULL DEFAULT '2',
+  ADD COLUMN `reschedule_max_times` bigint NOT NULL DEFAULT '2';
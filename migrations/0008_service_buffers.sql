@@ -0,0 +1,5 @@
+-- 服务前后的准备和整理时间（分钟）
+
+ALTER TABLE `services`
+  ADD COLUMN `buffer_before` bigint NOT NULL DEFAULT '0',
+  ADD COLUMN `buffer_after` bigint NOT NULL DEFAULT '0';
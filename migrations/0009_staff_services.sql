@@ -0,0 +1,25 @@
+-- 员工可提供的服务及单独定价和时长
+
+CREATE TABLE IF NOT EXISTS `staff_services` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `merchant_id` bigint unsigned NOT NULL,
+  `staff_id` bigint unsigned NOT NULL,
+  `service_id` bigint unsigned NOT NULL,
+  `price` bigint NULL,
+  `duration` bigint NULL,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_staff_service` (`staff_id`,`service_id`),
+  KEY `idx_staff_services_merchant_id` (`merchant_id`),
+  KEY `idx_staff_services_service_id` (`service_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 之前任意员工都可预约门店的任意服务，为已有员工和服务补齐关联，价格和时长沿用服务设置
+INSERT INTO `staff_services` (`merchant_id`, `staff_id`, `service_id`, `created_at`, `updated_at`)
+SELECT s.`merchant_id`, st.`id`, s.`id`, NOW(3), NOW(3)
+FROM `services` s
+JOIN `staff` st ON st.`merchant_id` = s.`merchant_id`
+WHERE NOT EXISTS (
+  SELECT 1 FROM `staff_services` ss WHERE ss.`staff_id` = st.`id` AND ss.`service_id` = s.`id`
+);
@@ -0,0 +1,17 @@
+-- 不指定员工预约时的分配策略
+
+ALTER TABLE `staff`
+  ADD COLUMN `rating` decimal(3,2) NOT NULL DEFAULT '0';
+
+CREATE TABLE IF NOT EXISTS `staff_assign_cursors` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `merchant_id` bigint unsigned NOT NULL,
+  `service_id` bigint unsigned NOT NULL,
+  `last_staff_id` bigint unsigned NOT NULL DEFAULT '0',
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_staff_assign_cursor` (`merchant_id`,`service_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+ALTER TABLE `merchant_settings`
+  ADD COLUMN `staff_assign_strategy` varchar(20) NOT NULL DEFAULT 'least_booked';
@@ -0,0 +1,4 @@
+-- 门店时区
+
+ALTER TABLE `merchants`
+  ADD COLUMN `timezone` varchar(50) NOT NULL DEFAULT 'Asia/Shanghai';
@@ -0,0 +1,12 @@
+-- 日历订阅链接版本，重置后旧链接失效
+
+CREATE TABLE IF NOT EXISTS `calendar_feeds` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `owner_type` varchar(20) NOT NULL,
+  `owner_id` bigint unsigned NOT NULL,
+  `version` bigint NOT NULL DEFAULT '1',
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_calendar_feed_owner` (`owner_type`,`owner_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,37 @@
+-- 员工外部日历及导入的忙碌时段
+
+CREATE TABLE IF NOT EXISTS `staff_calendar_sources` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `merchant_id` bigint unsigned NOT NULL,
+  `staff_id` bigint unsigned NOT NULL,
+  `type` varchar(20) NOT NULL,
+  `name` varchar(100) NULL,
+  `location` varchar(500) NULL,
+  `is_active` tinyint(1) NOT NULL DEFAULT '1',
+  `last_synced_at` datetime(3) NULL,
+  `last_error` varchar(500) NULL,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_staff_calendar_sources_merchant_id` (`merchant_id`),
+  KEY `idx_staff_calendar_sources_staff_id` (`staff_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `staff_busy_blocks` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `merchant_id` bigint unsigned NOT NULL,
+  `staff_id` bigint unsigned NOT NULL,
+  `source_id` bigint unsigned NOT NULL,
+  `uid` varchar(255) NOT NULL,
+  `recurrence_id` varchar(32) NOT NULL DEFAULT '',
+  `start_at` datetime(3) NOT NULL,
+  `end_at` datetime(3) NOT NULL,
+  `all_day` tinyint(1) NOT NULL DEFAULT '0',
+  `summary` varchar(255) NULL,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_busy_block_staff` (`staff_id`,`start_at`),
+  UNIQUE KEY `idx_busy_block_uid` (`source_id`,`uid`,`recurrence_id`),
+  KEY `idx_staff_busy_blocks_merchant_id` (`merchant_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,26 @@
+-- 周期预约
+
+CREATE TABLE IF NOT EXISTS `appointment_series` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned NOT NULL,
+  `merchant_id` bigint unsigned NOT NULL,
+  `service_id` bigint unsigned NOT NULL,
+  `staff_id` bigint unsigned NOT NULL,
+  `frequency` varchar(20) NOT NULL,
+  `interval` bigint NOT NULL DEFAULT '1',
+  `count` bigint NOT NULL DEFAULT '0',
+  `start_date` date NOT NULL,
+  `end_date` date NULL,
+  `start_time` varchar(8) NOT NULL,
+  `status` varchar(20) NOT NULL DEFAULT 'active',
+  `remark` varchar(255) NULL,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_appointment_series_merchant_id` (`merchant_id`),
+  KEY `idx_appointment_series_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+ALTER TABLE `appointments`
+  ADD COLUMN `series_id` bigint unsigned NULL,
+  ADD INDEX `idx_appointments_series_id` (`series_id`);
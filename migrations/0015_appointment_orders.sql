@@ -0,0 +1,35 @@
+-- 组合订单：多个服务共用一张优惠券、一次支付
+
+CREATE TABLE IF NOT EXISTS `appointment_orders` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `order_no` varchar(32) NOT NULL,
+  `user_id` bigint unsigned NOT NULL,
+  `merchant_id` bigint unsigned NOT NULL,
+  `status` varchar(20) NOT NULL DEFAULT 'pending',
+  `original_amount` bigint NOT NULL DEFAULT '0',
+  `discount_amount` bigint NOT NULL DEFAULT '0',
+  `amount` bigint NOT NULL DEFAULT '0',
+  `coupon_id` bigint unsigned NULL,
+  `payment_id` bigint unsigned NULL,
+  `remark` varchar(255) NULL,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_appointment_orders_coupon_id` (`coupon_id`),
+  KEY `idx_appointment_orders_merchant_id` (`merchant_id`),
+  UNIQUE KEY `idx_appointment_orders_order_no` (`order_no`),
+  KEY `idx_appointment_orders_payment_id` (`payment_id`),
+  KEY `idx_appointment_orders_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+ALTER TABLE `appointments`
+  ADD COLUMN `order_id` bigint unsigned NULL,
+  ADD INDEX `idx_appointments_order_id` (`order_id`);
+
+ALTER TABLE `payments`
+  ADD COLUMN `order_id` bigint unsigned NULL,
+  ADD INDEX `idx_payments_order_id` (`order_id`);
+
+ALTER TABLE `user_coupons`
+  ADD COLUMN `order_id` bigint unsigned NULL,
+  ADD INDEX `idx_user_coupons_order_id` (`order_id`);
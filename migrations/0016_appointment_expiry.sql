@@ -0,0 +1,10 @@
+-- 未支付和过期预约的自动处理
+
+-- 之前确认的预约 confirmed_at 为空，按 updated_at 计算超时
+ALTER TABLE `appointments`
+  ADD COLUMN `confirmed_at` datetime(3) NULL;
+
+ALTER TABLE `merchant_settings`
+  ADD COLUMN `payment_timeout_minutes` bigint NOT NULL DEFAULT '15',
+  ADD COLUMN `unpaid_cancel_minutes` bigint NOT NULL DEFAULT '120',
+  ADD COLUMN `auto_complete_minutes` bigint NOT NULL DEFAULT '30';
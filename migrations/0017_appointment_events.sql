@@ -0,0 +1,14 @@
+-- 预约状态变更记录
+
+CREATE TABLE IF NOT EXISTS `appointment_events` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `appointment_id` bigint unsigned NOT NULL,
+  `from_status` varchar(20) NULL,
+  `to_status` varchar(20) NOT NULL,
+  `actor_type` varchar(20) NOT NULL,
+  `actor_id` bigint unsigned NOT NULL DEFAULT '0',
+  `reason` varchar(255) NULL,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_appointment_events_appointment_id` (`appointment_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
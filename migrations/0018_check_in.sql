@@ -0,0 +1,7 @@
+-- 到店签到码和实际开始、结束时间
+
+ALTER TABLE `appointments`
+  ADD COLUMN `check_in_token` varchar(64) NULL,
+  ADD COLUMN `actual_start_at` datetime(3) NULL,
+  ADD COLUMN `actual_end_at` datetime(3) NULL,
+  ADD INDEX `idx_appointments_check_in_token` (`check_in_token`);
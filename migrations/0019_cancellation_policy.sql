@@ -0,0 +1,8 @@
+-- 取消政策：免费取消时限、逾期取消费和爽约费
+
+ALTER TABLE `merchant_settings`
+  ADD COLUMN `free_cancel_hours` bigint NOT NULL DEFAULT '24',
+  ADD COLUMN `late_cancel_fee_type` varchar(10) NOT NULL DEFAULT 'percent',
+  ADD COLUMN `late_cancel_fee` bigint NOT NULL DEFAULT '50',
+  ADD COLUMN `no_show_fee_type` varchar(10) NOT NULL DEFAULT 'percent',
+  ADD COLUMN `no_show_fee` bigint NOT NULL DEFAULT '100';
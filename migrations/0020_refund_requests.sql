@@ -0,0 +1,38 @@
+-- 客户退款申请及处理记录
+
+CREATE TABLE IF NOT EXISTS `refund_requests` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `appointment_id` bigint unsigned NOT NULL,
+  `user_id` bigint unsigned NOT NULL,
+  `merchant_id` bigint unsigned NOT NULL,
+  `payment_id` bigint unsigned NOT NULL,
+  `amount` bigint NOT NULL,
+  `reason` varchar(255) NOT NULL,
+  `status` varchar(20) NOT NULL,
+  `counter_amount` bigint NOT NULL DEFAULT '0',
+  `approved_amount` bigint NOT NULL DEFAULT '0',
+  `merchant_reply` varchar(255) NULL,
+  `refund_id` bigint unsigned NOT NULL DEFAULT '0',
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_refund_requests_appointment_id` (`appointment_id`),
+  KEY `idx_refund_requests_merchant_id` (`merchant_id`),
+  KEY `idx_refund_requests_status` (`status`),
+  KEY `idx_refund_requests_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `refund_request_events` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `refund_request_id` bigint unsigned NOT NULL,
+  `action` varchar(20) NOT NULL,
+  `actor_type` varchar(20) NOT NULL,
+  `actor_id` bigint unsigned NOT NULL DEFAULT '0',
+  `from_status` varchar(20) NULL,
+  `to_status` varchar(20) NOT NULL,
+  `amount` bigint NOT NULL DEFAULT '0',
+  `remark` varchar(255) NULL,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_refund_request_events_refund_request_id` (`refund_request_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,7 @@
+-- 支付渠道。历史支付单 provider 为空，按订单号前缀推断
+
+ALTER TABLE `payments`
+  ADD COLUMN `provider` varchar(20) NULL;
+
+ALTER TABLE `merchant_settings`
+  ADD COLUMN `payment_provider` varchar(20) NOT NULL DEFAULT '';
@@ -0,0 +1,7 @@
+-- 自动完成和到店签到的开启时间。auto_complete_since 为空的商家由后台任务从首次运行时开始处理，
+-- 不处理升级前已结束的预约；到店签到默认关闭，开启前未签到的预约标记为已完成而不是未到店
+
+ALTER TABLE `merchant_settings`
+  ADD COLUMN `auto_complete_since` datetime(3) NULL,
+  ADD COLUMN `check_in_required` tinyint(1) NOT NULL DEFAULT '0',
+  ADD COLUMN `check_in_required_since` datetime(3) NULL;
@@ -2,29 +2,36 @@ package models
 
 import (
 	"admin-api/database"
-	"errors"
 	"fmt"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"math/rand"
 	"time"
 	//"gorm.io/gorm"
 )
 
 type Appointment struct {
-	ID              uint      `gorm:"primaryKey"`
-	OrderNo         string    `gorm:"size:32;uniqueIndex;not null"`
-	UserID          uint      `gorm:"index;not null"`
-	MerchantID      uint      `gorm:"index;not null"`
-	ServiceID       uint      `gorm:"index;not null"`
-	StaffID         uint      `gorm:"index;not null"`
-	TimeSlotID      uint      `gorm:"index;not null"`
-	AppointmentDate time.Time `gorm:"type:date;not null"`
-	StartTime       string    `gorm:"type:time;not null"`
-	EndTime         string    `gorm:"type:time;not null"`
-	Status          string    `gorm:"size:20;default:'pending';not null"`
-	Amount          int       `gorm:"type:int;default:0;not null"` // 改为分单位的整数
-	PaymentID       uint      `gorm:"index"`                       // 新增支付ID关联
-	Remark          string    `gorm:"size:255"`
+	ID              uint       `gorm:"primaryKey"`
+	OrderNo         string     `gorm:"size:32;uniqueIndex;not null"`
+	UserID          uint       `gorm:"index;not null"`
+	MerchantID      uint       `gorm:"index;not null"`
+	ServiceID       uint       `gorm:"index;not null"`
+	StaffID         uint       `gorm:"index;not null"`
+	TimeSlotID      uint       `gorm:"index;not null"`
+	AppointmentDate time.Time  `gorm:"type:date;not null"`
+	StartTime       string     `gorm:"type:time;not null"`
+	EndTime         string     `gorm:"type:time;not null"`
+	Status          string     `gorm:"size:20;default:'pending';not null"`
+	Amount          int        `gorm:"type:int;default:0;not null"` // 改为分单位的整数
+	PaymentID       uint       `gorm:"index"`                       // 新增支付ID关联
+	Remark          string     `gorm:"size:255"`
+	RescheduleCount int        `gorm:"default:0;not null"` // 客户改约次数
+	SeriesID        uint       `gorm:"index"`              // 所属的周期预约，单次预约为0
+	OrderID         uint       `gorm:"index"`              // 所属的组合订单，单独预约为0
+	ConfirmedAt     *time.Time // 商家确认时间，用于计算未支付超时
+	CheckInToken    string     `gorm:"size:64;index"` // 到店签到码，首次获取时生成
+	ActualStartAt   *time.Time // 到店签到时间，即实际开始时间
+	ActualEndAt     *time.Time // 签退时间，即实际结束时间
 	CreatedAt       time.Time
 	UpdatedAt       time.Time
 
@@ -43,32 +50,90 @@ const (
 	AppointmentStatusPaid      = "paid" // 新增已支付状态
 	AppointmentStatusCompleted = "completed"
 	AppointmentStatusCancelled = "cancelled"
+	AppointmentStatusRejected  = "rejected"  // 商家拒绝
+	AppointmentStatusNoShow    = "no_show"   // 未到店
+	AppointmentStatusRefunding = "refunding" // 退款中
+	AppointmentStatusRefunded  = "refunded"  // 已退款
 )
 
+// AppointmentTimeSlot 预约占用的时间段，服务时长超过单个时间段时一个预约对应多条
+type AppointmentTimeSlot struct {
+	ID            uint `gorm:"primaryKey"`
+	AppointmentID uint `gorm:"index;not null"`
+	TimeSlotID    uint `gorm:"index;not null"`
+	CreatedAt     time.Time
+}
+
+// 占用时间段的预约状态
+var activeAppointmentStatuses = []string{
+	AppointmentStatusPending,
+	AppointmentStatusConfirmed,
+	AppointmentStatusPaid,
+}
+
 func CreateCustomerAppointment(userID, merchantID, serviceID, staffID, timeSlotID uint,
 	date time.Time, couponID uint, remark string) (*Appointment, error) {
 
 	// 开始事务
 	tx := database.DB.Begin()
 
+	appointment, err := createAppointmentTx(tx, userID, merchantID, serviceID, staffID, timeSlotID,
+		date, couponID, remark)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// 提交事务
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("提交事务失败")
+	}
+
+	// 消费用户对该时间段的临时预留
+	consumeSlotHold(userID, timeSlotID)
+
+	// TODO: 发送通知给商家
+
+	return appointment, nil
+}
+
+// createAppointmentTx 在调用方的事务中锁定时间段并创建预约，出错时由调用方回滚
+func createAppointmentTx(tx *gorm.DB, userID, merchantID, serviceID, staffID, timeSlotID uint,
+	date time.Time, couponID uint, remark string) (*Appointment, error) {
+
 	// 1. 获取时间段信息并锁定
 	var timeSlot TimeSlot
-	if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&timeSlot, timeSlotID).Error; err != nil {
-		tx.Rollback()
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&timeSlot, timeSlotID).Error; err != nil {
 		return nil, fmt.Errorf("时间段不存在")
 	}
 
-	// 检查时间段是否可用
-	if !timeSlot.IsAvailable {
-		tx.Rollback()
+	// 检查时间段是否还有名额
+	if timeSlot.RemainingSeats() <= 0 {
 		return nil, fmt.Errorf("该时间段已被预约")
 	}
 
-	// 2. 获取服务信息
-	var service Service
-	if err := tx.First(&service, serviceID).Error; err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("服务不存在")
+	if timeSlot.MerchantID != merchantID || timeSlot.StaffID != staffID {
+		return nil, fmt.Errorf("时间段与所选员工不匹配")
+	}
+
+	// 2. 获取服务信息，员工须可提供该服务，价格和时长以员工设置为准
+	service, err := staffServiceTx(tx, merchantID, serviceID, staffID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 按服务时长锁定后续连续的时间段
+	bookedSlots, err := lockBookingSlots(tx, timeSlot, service, userID, 0)
+	if err != nil {
+		return nil, err
+	}
+	slotIDs := make([]uint, 0, len(bookedSlots))
+	for _, slot := range bookedSlots {
+		slotIDs = append(slotIDs, slot.ID)
+	}
+
+	if err := checkDuplicateGroupBooking(tx, userID, timeSlot, slotIDs); err != nil {
+		return nil, err
 	}
 
 	// 3. 计算最终价格（考虑优惠券）
@@ -88,7 +153,6 @@ func CreateCustomerAppointment(userID, merchantID, serviceID, staffID, timeSlotI
 
 		c, err := ApplyCoupon(tx, userID, couponID, service.Price)
 		if err != nil {
-			tx.Rollback()
 			return nil, fmt.Errorf("优惠券不可用: %v", err)
 		}
 		finalAmount = c.FinalPrice
@@ -103,23 +167,30 @@ func CreateCustomerAppointment(userID, merchantID, serviceID, staffID, timeSlotI
 		ServiceID:       serviceID,
 		StaffID:         staffID,
 		TimeSlotID:      timeSlotID,
-		AppointmentDate: date,
+		AppointmentDate: civilDate(date),
 		StartTime:       timeSlot.StartTime,
-		EndTime:         timeSlot.EndTime,
-		Status:          "pending", // 待确认状态
+		EndTime:         bookedSlots[len(bookedSlots)-1].EndTime,
+		Status:          AppointmentStatusPending, // 待确认状态
 		Amount:          int(finalAmount),
 		Remark:          remark,
 	}
 
 	if err := tx.Create(appointment).Error; err != nil {
-		tx.Rollback()
 		return nil, fmt.Errorf("创建预约失败")
 	}
+	if err := recordAppointmentEvent(tx, appointment.ID, "", AppointmentStatusPending, ActorCustomer, userID, "创建预约"); err != nil {
+		return nil, fmt.Errorf("记录预约状态失败")
+	}
 
-	// 5. 标记时间段为不可用
-	if err := tx.Model(&TimeSlot{}).Where("id = ?", timeSlotID).Update("is_available", false).Error; err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("更新时间段状态失败")
+	// 5. 占用时间段名额（约满后标记为不可用），并记录预约占用的全部时间段
+	if err := occupySlots(tx, bookedSlots); err != nil {
+		return nil, fmt.Errorf("更新时间段状态失败: %v", err)
+	}
+
+	for _, id := range slotIDs {
+		if err := tx.Create(&AppointmentTimeSlot{AppointmentID: appointment.ID, TimeSlotID: id}).Error; err != nil {
+			return nil, fmt.Errorf("记录预约时间段失败")
+		}
 	}
 
 	// 6. 如果使用了优惠券，标记为已使用
@@ -128,21 +199,32 @@ func CreateCustomerAppointment(userID, merchantID, serviceID, staffID, timeSlotI
 		coupon.Status = "used"
 		coupon.UsedAt = time.Now()
 		if err := tx.Save(coupon).Error; err != nil {
-			tx.Rollback()
 			return nil, fmt.Errorf("更新优惠券状态失败")
 		}
 	}
 
-	// 提交事务
-	if err := tx.Commit().Error; err != nil {
-		return nil, fmt.Errorf("提交事务失败")
-	}
-
-	// TODO: 发送通知给商家
-
 	return appointment, nil
 }
 
+// checkDuplicateGroupBooking 团课时间段同一用户不能重复预约
+func checkDuplicateGroupBooking(tx *gorm.DB, userID uint, first TimeSlot, slotIDs []uint) error {
+	if first.Capacity <= 1 {
+		return nil
+	}
+	var count int64
+	if err := tx.Model(&AppointmentTimeSlot{}).
+		Joins("JOIN appointments ON appointments.id = appointment_time_slots.appointment_id").
+		Where("appointment_time_slots.time_slot_id IN (?) AND appointments.user_id = ? AND appointments.status IN (?)",
+			slotIDs, userID, activeAppointmentStatuses).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("您已预约该时间段")
+	}
+	return nil
+}
+
 // 生成订单号
 func generateOrderNo() string {
 	return fmt.Sprintf("ORD%d%06d", time.Now().Unix(), rand.Intn(1000000))
@@ -156,7 +238,7 @@ func GetUserAppointments(userID uint, status string) ([]Appointment, error) {
 		Order("appointment_date DESC, start_time DESC")
 
 	if status != "" {
-		query = query.Where("status = ?", status)
+		query = query.Where("status IN (?)", appointmentStatusValues(status))
 	}
 
 	err := query.Find(&appointments).Error
@@ -171,59 +253,31 @@ func GetUserAppointmentDetail(userID, appointmentID uint) (*Appointment, error)
 	return &appointment, err
 }
 
-func CancelUserAppointment(userID, appointmentID uint) error {
-	tx := database.DB.Begin()
-
-	// 直接查询预约信息（无需预加载Appointments）
-	var appointment Appointment
-	if err := tx.First(&appointment, appointmentID).Error; err != nil {
-		tx.Rollback()
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return errors.New("预约不存在")
-		}
-		return errors.New("查询预约失败")
-	}
-
-	// 验证用户权限
-	if appointment.UserID != userID {
-		tx.Rollback()
-		return errors.New("无权操作此预约")
+// appointmentSlotIDs 返回预约占用的全部时间段ID
+func appointmentSlotIDs(tx *gorm.DB, appointment *Appointment) ([]uint, error) {
+	var ids []uint
+	if err := tx.Model(&AppointmentTimeSlot{}).
+		Where("appointment_id = ?", appointment.ID).
+		Pluck("time_slot_id", &ids).Error; err != nil {
+		return nil, err
 	}
-
-	// 检查是否允许取消
-	if appointment.Status != "pending" {
-		tx.Rollback()
-		return errors.New("当前状态不允许取消")
+	// 兼容没有关联记录的旧预约
+	if len(ids) == 0 && appointment.TimeSlotID > 0 {
+		ids = []uint{appointment.TimeSlotID}
 	}
+	return ids, nil
+}
 
-	// 更新预约状态
-	if err := tx.Model(&Appointment{}).Where("id = ?", appointmentID).
-		Update("status", "canceled").Error; err != nil {
-		tx.Rollback()
+// releaseAppointmentSlots 释放预约在每个时间段上占用的名额，并为候补用户放位
+func releaseAppointmentSlots(tx *gorm.DB, appointment *Appointment) error {
+	ids, err := appointmentSlotIDs(tx, appointment)
+	if err != nil {
 		return err
 	}
-
-	// 释放时间段
-	if err := tx.Model(&TimeSlot{}).Where("id = ?", appointment.TimeSlotID).
-		Update("is_available", true).Error; err != nil {
-		tx.Rollback()
+	if err := freeSlots(tx, ids); err != nil {
 		return err
 	}
-
-	// 如果使用了优惠券，恢复优惠券
-	// 注意：这里需要确保已经预加载了Coupon关系
-	if appointment.Coupon != nil {
-		if err := tx.Model(&UserCoupon{}).Where("id = ?", appointment.Coupon.ID).
-			Updates(map[string]interface{}{
-				"status":  "unused",
-				"used_at": nil,
-			}).Error; err != nil {
-			tx.Rollback()
-			return err
-		}
-	}
-
-	return tx.Commit().Error
+	return promoteWaitlist(tx, ids)
 }
 
 func UpdateAppointment(appointment *Appointment) error {
@@ -0,0 +1,281 @@
+package models
+
+import (
+	"admin-api/database"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 优惠券在 ApplyCoupon 中被标记为使用中，预约或订单创建成功后改为已使用。
+// 没有关联预约和订单的使用中优惠券说明下单流程未完成，需要恢复
+const couponStatusUsing = "using"
+
+// ExpiredPendingPayments 返回超过商家支付超时时长仍未支付的支付单
+func ExpiredPendingPayments(now time.Time) ([]Payment, error) {
+	var merchantIDs []uint
+	if err := database.DB.Model(&Payment{}).
+		Where("status = ?", PaymentStatusPending).
+		Distinct().
+		Pluck("merchant_id", &merchantIDs).Error; err != nil {
+		return nil, err
+	}
+
+	var expired []Payment
+	for _, merchantID := range merchantIDs {
+		setting, err := getMerchantSetting(database.DB, merchantID)
+		if err != nil {
+			return expired, err
+		}
+		deadline := now.Add(-time.Duration(setting.PaymentTimeoutMinutes) * time.Minute)
+
+		var payments []Payment
+		if err := database.DB.Where("merchant_id = ? AND status = ? AND created_at < ?",
+			merchantID, PaymentStatusPending, deadline).
+			Find(&payments).Error; err != nil {
+			return expired, err
+		}
+		expired = append(expired, payments...)
+	}
+	return expired, nil
+}
+
+// ClosePayment 关闭仍处于待支付状态的支付单，期间已收到支付回调的不受影响
+func ClosePayment(paymentID uint, reason string) (bool, error) {
+	result := database.DB.Model(&Payment{}).
+		Where("id = ? AND status = ?", paymentID, PaymentStatusPending).
+		Updates(map[string]interface{}{
+			"status":      PaymentStatusClosed,
+			"fail_reason": reason,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// ExpireUnpaidAppointments 自动取消超时的预约并释放时间段和优惠券：
+// 开始时间已过仍未被商家确认的预约，以及确认后超过商家设置时长仍未支付的预约。
+// 仍有待支付支付单的预约跳过，等支付单关闭后再处理；已签到（服务进行中）的预约不取消
+func ExpireUnpaidAppointments(now time.Time) (int, error) {
+	var merchantIDs []uint
+	if err := database.DB.Model(&Appointment{}).
+		Where("status IN (?)", []string{AppointmentStatusPending, AppointmentStatusConfirmed}).
+		Distinct().
+		Pluck("merchant_id", &merchantIDs).Error; err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, merchantID := range merchantIDs {
+		setting, err := getMerchantSetting(database.DB, merchantID)
+		if err != nil {
+			return count, err
+		}
+		loc := merchantLocation(database.DB, merchantID)
+		today := now.In(loc).Format("2006-01-02")
+
+		var pending []Appointment
+		if err := database.DB.Where("merchant_id = ? AND status = ? AND appointment_date <= ?",
+			merchantID, AppointmentStatusPending, today).
+			Find(&pending).Error; err != nil {
+			return count, err
+		}
+		for _, a := range pending {
+			if wallClockAt(a.AppointmentDate, a.StartTime, loc).After(now) {
+				continue
+			}
+			if err := expireAppointment(a.ID, AppointmentStatusPending, "商家未在开始前确认"); err != nil {
+				log.Printf("预约 %d 自动取消失败: %v", a.ID, err)
+				continue
+			}
+			count++
+		}
+
+		// 0 表示到店支付，不因未支付取消
+		if setting.UnpaidCancelMinutes == 0 {
+			continue
+		}
+		deadline := now.Add(-time.Duration(setting.UnpaidCancelMinutes) * time.Minute)
+		var unpaid []Appointment
+		if err := database.DB.Where("merchant_id = ? AND status = ?", merchantID, AppointmentStatusConfirmed).
+			Where("COALESCE(confirmed_at, updated_at) < ?", deadline).
+			Find(&unpaid).Error; err != nil {
+			return count, err
+		}
+		for _, a := range unpaid {
+			if err := expireAppointment(a.ID, AppointmentStatusConfirmed,
+				fmt.Sprintf("确认后%d分钟内未支付", setting.UnpaidCancelMinutes)); err != nil {
+				log.Printf("预约 %d 自动取消失败: %v", a.ID, err)
+				continue
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// expireAppointment 在独立事务中取消一条超时预约，status 为查询时的状态，加锁后状态已变化的跳过
+func expireAppointment(appointmentID uint, status, reason string) error {
+	tx := database.DB.Begin()
+
+	appointment, err := lockAppointment(tx, appointmentID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	// 加锁后重新确认，期间商家可能已确认、客户已支付或已到店签到
+	if appointment.Status != status || appointment.ActualStartAt != nil {
+		tx.Rollback()
+		return nil
+	}
+	if status == AppointmentStatusConfirmed {
+		var paying int64
+		query := tx.Model(&Payment{}).Where("status = ?", PaymentStatusPending)
+		if appointment.OrderID != 0 {
+			query = query.Where("appointment_id = ? OR order_id = ?", appointment.ID, appointment.OrderID)
+		} else {
+			query = query.Where("appointment_id = ?", appointment.ID)
+		}
+		if err := query.Count(&paying).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		if paying > 0 {
+			tx.Rollback()
+			return nil
+		}
+	}
+
+	if err := TransitionAppointmentTx(tx, appointment, AppointmentStatusCancelled, ActorSystem, 0,
+		"自动取消："+reason, nil); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := restoreAppointmentCoupon(tx, appointment.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := syncOrderAfterLineCancel(tx, appointment.OrderID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := notifyUser(tx, appointment.UserID, NotificationTypeExpired, "预约已自动取消",
+		fmt.Sprintf("您 %s %s 的预约（订单号 %s）因%s已自动取消，如需服务请重新预约",
+			appointment.AppointmentDate.Format("2006-01-02"), formatSlotClock(appointment.StartTime),
+			appointment.OrderNo, reason)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// restoreAppointmentCoupon 恢复预约使用的优惠券
+func restoreAppointmentCoupon(tx *gorm.DB, appointmentID uint) error {
+	return tx.Model(&UserCoupon{}).
+		Where("appointment_id = ? AND status IN (?)", appointmentID, []string{"used", couponStatusUsing}).
+		Updates(map[string]interface{}{
+			"status":         "unused",
+			"used_at":        nil,
+			"appointment_id": nil,
+		}).Error
+}
+
+// ReleaseStuckCoupons 恢复没有关联预约或订单的使用中优惠券。
+// 下单事务中的优惠券会被行锁阻塞到事务结束，届时已关联预约或订单，不会被误恢复
+func ReleaseStuckCoupons() (int, error) {
+	result := database.DB.Model(&UserCoupon{}).
+		Where("status = ? AND appointment_id IS NULL AND order_id IS NULL", couponStatusUsing).
+		Updates(map[string]interface{}{
+			"status":  "unused",
+			"used_at": nil,
+		})
+	return int(result.RowsAffected), result.Error
+}
+
+// CompletePastAppointments 结束时间超过商家设置时长后处理已确认或已支付的预约：开启到店签到的商家，
+// 开启后开始且结束时仍未签到的预约标记为未到店，其余标记为已完成。只处理开启自动完成后结束的预约，
+// 不处理历史积压。返回已完成的数量和标记为未到店的预约，其中已支付的由调用方按未到店政策退款
+func CompletePastAppointments(now time.Time) (completed int, noShows []Appointment, err error) {
+	var merchantIDs []uint
+	if err := database.DB.Model(&Appointment{}).
+		Where("status IN (?)", []string{AppointmentStatusConfirmed, AppointmentStatusPaid}).
+		Distinct().
+		Pluck("merchant_id", &merchantIDs).Error; err != nil {
+		return 0, nil, err
+	}
+
+	for _, merchantID := range merchantIDs {
+		setting, err := getMerchantSetting(database.DB, merchantID)
+		if err != nil {
+			return completed, noShows, err
+		}
+		if setting.AutoCompleteMinutes == 0 {
+			continue
+		}
+		// 没有开启时间的（未保存过配置或升级前的配置）从现在开始处理
+		if setting.AutoCompleteSince == nil {
+			setting.AutoCompleteSince = &now
+			if err := SaveMerchantSetting(setting); err != nil {
+				return completed, noShows, err
+			}
+			continue
+		}
+		since := *setting.AutoCompleteSince
+		loc := merchantLocation(database.DB, merchantID)
+		grace := time.Duration(setting.AutoCompleteMinutes) * time.Minute
+
+		var appointments []Appointment
+		if err := database.DB.Where("merchant_id = ? AND status IN (?) AND appointment_date BETWEEN ? AND ?",
+			merchantID, []string{AppointmentStatusConfirmed, AppointmentStatusPaid},
+			since.In(loc).Format("2006-01-02"), now.In(loc).Format("2006-01-02")).
+			Find(&appointments).Error; err != nil {
+			return completed, noShows, err
+		}
+		for _, a := range appointments {
+			end := wallClockAt(a.AppointmentDate, a.EndTime, loc)
+			if !end.After(since) || end.Add(grace).After(now) {
+				continue
+			}
+			var next string
+			// 加锁后按最新的状态和签到时间处理，期间状态已变化的跳过
+			if err := database.DB.Transaction(func(tx *gorm.DB) error {
+				appointment, err := lockAppointment(tx, a.ID)
+				if err != nil {
+					return err
+				}
+				if appointment.Status != a.Status {
+					return nil
+				}
+				reason := "结束后自动完成"
+				next = AppointmentStatusCompleted
+				if appointment.ActualStartAt == nil && requiresCheckIn(setting, appointment, loc) {
+					next, reason = AppointmentStatusNoShow, "结束时仍未签到，自动标记为未到店"
+				}
+				if err := TransitionAppointmentTx(tx, appointment, next, ActorSystem, 0, reason, nil); err != nil {
+					return err
+				}
+				a = *appointment
+				return nil
+			}); err != nil {
+				log.Printf("预约 %d 自动完成失败: %v", a.ID, err)
+				continue
+			}
+			switch next {
+			case AppointmentStatusCompleted:
+				completed++
+			case AppointmentStatusNoShow:
+				noShows = append(noShows, a)
+			}
+		}
+	}
+	return completed, noShows, nil
+}
+
+// requiresCheckIn 预约是否需要到店签到：商家开启了到店签到，且预约在开启后开始
+func requiresCheckIn(setting *MerchantSetting, appointment *Appointment, loc *time.Location) bool {
+	if !setting.CheckInRequired || setting.CheckInRequiredSince == nil {
+		return false
+	}
+	return !wallClockAt(appointment.AppointmentDate, appointment.StartTime, loc).Before(*setting.CheckInRequiredSince)
+}
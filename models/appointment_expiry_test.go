@@ -0,0 +1,134 @@
+package models
+
+import (
+	"admin-api/database"
+	"testing"
+	"time"
+)
+
+func TestCompletePastAppointments(t *testing.T) {
+	setupBookingDB(t)
+
+	// 预约为明天 10:00-11:00，以下时间均相对 10:00
+	hours := func(h float64) *time.Duration {
+		d := time.Duration(h * float64(time.Hour))
+		return &d
+	}
+	tests := []struct {
+		name           string
+		autoMinutes    int
+		autoSince      *time.Duration // 开启自动完成的时间，nil 表示没有记录
+		checkInSince   *time.Duration // 开启到店签到的时间，nil 表示未开启
+		checkedIn      bool
+		now            time.Duration
+		wantStatus     string
+		wantSinceSaved bool // 是否记录了自动完成的开启时间
+	}{
+		{"未开启签到时未签到的预约标记为已完成", 30, hours(-24), nil, false, 3 * time.Hour, AppointmentStatusCompleted, true},
+		{"开启签到后未签到标记为未到店", 30, hours(-24), hours(-1), false, 3 * time.Hour, AppointmentStatusNoShow, true},
+		{"开启签到且已签到标记为已完成", 30, hours(-24), hours(-1), true, 3 * time.Hour, AppointmentStatusCompleted, true},
+		{"预约开始后才开启签到", 30, hours(-24), hours(0.5), false, 3 * time.Hour, AppointmentStatusCompleted, true},
+		{"开启自动完成前已结束的预约不处理", 30, hours(2), nil, false, 3 * time.Hour, AppointmentStatusPaid, true},
+		{"没有开启时间时从本次运行开始处理", 30, nil, hours(-1), false, 3 * time.Hour, AppointmentStatusPaid, true},
+		{"关闭自动完成", 0, nil, nil, false, 3 * time.Hour, AppointmentStatusPaid, false},
+		{"结束后未超过设置时长", 30, hours(-24), hours(-1), false, 70 * time.Minute, AppointmentStatusPaid, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newBookingFixture(t, 60)
+			slots := f.createSlots(t, slotSpec{1, 1}, slotSpec{1, 1})
+			appointment := f.bookAppointment(t, 1, slots)
+			start := wallClockAt(f.date, appointment.StartTime, f.merchant.Location())
+			if tt.checkedIn {
+				if err := database.DB.Model(appointment).Update("actual_start_at", start).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			setting := defaultMerchantSetting(f.merchant.ID)
+			setting.AutoCompleteMinutes = tt.autoMinutes
+			if tt.autoSince != nil {
+				since := start.Add(*tt.autoSince)
+				setting.AutoCompleteSince = &since
+			}
+			if tt.checkInSince != nil {
+				since := start.Add(*tt.checkInSince)
+				setting.CheckInRequired, setting.CheckInRequiredSince = true, &since
+			}
+			if err := SaveMerchantSetting(setting); err != nil {
+				t.Fatal(err)
+			}
+
+			now := start.Add(tt.now)
+			_, noShows, err := CompletePastAppointments(now)
+			if err != nil {
+				t.Fatalf("CompletePastAppointments err = %v", err)
+			}
+			var latest Appointment
+			if err := database.DB.First(&latest, appointment.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if latest.Status != tt.wantStatus {
+				t.Fatalf("预约状态 = %s, 期望 %s", latest.Status, tt.wantStatus)
+			}
+			returned := false
+			for _, a := range noShows {
+				returned = returned || a.ID == appointment.ID
+			}
+			if returned != (tt.wantStatus == AppointmentStatusNoShow) {
+				t.Fatalf("未到店列表 = %v, 期望包含预约: %v", noShows, tt.wantStatus == AppointmentStatusNoShow)
+			}
+
+			saved, err := GetMerchantSetting(f.merchant.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (saved.AutoCompleteSince != nil) != tt.wantSinceSaved {
+				t.Fatalf("自动完成开启时间 = %v, 期望记录: %v", saved.AutoCompleteSince, tt.wantSinceSaved)
+			}
+			if tt.autoSince == nil && tt.wantSinceSaved && !saved.AutoCompleteSince.Equal(now) {
+				t.Fatalf("自动完成开启时间 = %v, 期望 %v", saved.AutoCompleteSince, now)
+			}
+		})
+	}
+}
+
+func TestRecordEnabledAt(t *testing.T) {
+	earlier := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := earlier.Add(48 * time.Hour)
+	tests := []struct {
+		name             string
+		prev, next       MerchantSetting
+		wantAutoSince    *time.Time
+		wantCheckInSince *time.Time
+	}{
+		{"开启自动完成", MerchantSetting{}, MerchantSetting{AutoCompleteMinutes: 30}, &now, nil},
+		{"保持开启不改变开启时间",
+			MerchantSetting{AutoCompleteMinutes: 30, AutoCompleteSince: &earlier},
+			MerchantSetting{AutoCompleteMinutes: 60, AutoCompleteSince: &earlier}, &earlier, nil},
+		{"开启但没有记录时补记", MerchantSetting{AutoCompleteMinutes: 30}, MerchantSetting{AutoCompleteMinutes: 30}, &now, nil},
+		{"关闭自动完成", MerchantSetting{AutoCompleteMinutes: 30, AutoCompleteSince: &earlier},
+			MerchantSetting{AutoCompleteSince: &earlier}, nil, nil},
+		{"开启到店签到", MerchantSetting{}, MerchantSetting{CheckInRequired: true}, nil, &now},
+		{"保持开启到店签到",
+			MerchantSetting{CheckInRequired: true, CheckInRequiredSince: &earlier},
+			MerchantSetting{CheckInRequired: true, CheckInRequiredSince: &earlier}, nil, &earlier},
+		{"关闭到店签到", MerchantSetting{CheckInRequired: true, CheckInRequiredSince: &earlier},
+			MerchantSetting{CheckInRequiredSince: &earlier}, nil, nil},
+	}
+	equal := func(a, b *time.Time) bool {
+		return (a == nil && b == nil) || (a != nil && b != nil && a.Equal(*b))
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := tt.next
+			next.RecordEnabledAt(&tt.prev, now)
+			if !equal(next.AutoCompleteSince, tt.wantAutoSince) {
+				t.Errorf("AutoCompleteSince = %v, 期望 %v", next.AutoCompleteSince, tt.wantAutoSince)
+			}
+			if !equal(next.CheckInRequiredSince, tt.wantCheckInSince) {
+				t.Errorf("CheckInRequiredSince = %v, 期望 %v", next.CheckInRequiredSince, tt.wantCheckInSince)
+			}
+		})
+	}
+}
@@ -0,0 +1,398 @@
+package models
+
+import (
+	"admin-api/database"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 组合订单状态
+const (
+	OrderStatusPending   = "pending"   // 待支付（各项预约待商家确认或已确认）
+	OrderStatusPaid      = "paid"      // 已支付
+	OrderStatusCancelled = "cancelled" // 已取消
+)
+
+// 组合订单的项目数限制
+const (
+	orderMinLines = 1
+	orderMaxLines = 10
+)
+
+// AppointmentOrder 组合订单：一次下单预约多个服务（如剪发+染发），共用一张优惠券，一次支付。
+// 每个项目对应一条 Appointment，通过 OrderID 关联
+type AppointmentOrder struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	OrderNo        string    `gorm:"size:32;uniqueIndex;not null" json:"order_no"`
+	UserID         uint      `gorm:"index;not null" json:"user_id"`
+	MerchantID     uint      `gorm:"index;not null" json:"merchant_id"`
+	Status         string    `gorm:"size:20;default:'pending';not null" json:"status"`
+	OriginalAmount int       `gorm:"default:0;not null" json:"original_amount"` // 各项目原价合计（分）
+	DiscountAmount int       `gorm:"default:0;not null" json:"discount_amount"` // 优惠金额（分）
+	Amount         int       `gorm:"default:0;not null" json:"amount"`          // 应付金额（分）
+	CouponID       uint      `gorm:"index" json:"coupon_id"`
+	PaymentID      uint      `gorm:"index" json:"payment_id"`
+	Remark         string    `gorm:"size:255" json:"remark"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	User         User          `gorm:"foreignKey:UserID" json:"-"`
+	Appointments []Appointment `gorm:"foreignKey:OrderID" json:"-"`
+}
+
+// OrderLine 组合订单中的一个项目
+type OrderLine struct {
+	ServiceID  uint
+	StaffID    uint
+	TimeSlotID uint
+}
+
+// CreateAppointmentOrder 创建组合订单：在同一事务中预约全部项目，任一项目无法预约时整单失败。
+// 优惠券按订单总价计算，优惠金额按各项目原价比例分摊到每条预约
+func CreateAppointmentOrder(userID, merchantID uint, lines []OrderLine, couponID uint, remark string) (*AppointmentOrder, error) {
+	if len(lines) < orderMinLines || len(lines) > orderMaxLines {
+		return nil, fmt.Errorf("订单项目数需在%d到%d之间", orderMinLines, orderMaxLines)
+	}
+
+	tx := database.DB.Begin()
+
+	order, err := createAppointmentOrderTx(tx, userID, merchantID, lines, couponID, remark)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("提交事务失败")
+	}
+
+	for _, a := range order.Appointments {
+		consumeSlotHold(userID, a.TimeSlotID)
+	}
+
+	return order, nil
+}
+
+func createAppointmentOrderTx(tx *gorm.DB, userID, merchantID uint, lines []OrderLine,
+	couponID uint, remark string) (*AppointmentOrder, error) {
+
+	order := &AppointmentOrder{
+		OrderNo:    generateOrderNo(),
+		UserID:     userID,
+		MerchantID: merchantID,
+		Status:     OrderStatusPending,
+		Remark:     remark,
+	}
+	if err := tx.Create(order).Error; err != nil {
+		return nil, fmt.Errorf("创建订单失败")
+	}
+
+	// 逐项预约，优惠券在订单层面计算，不传给单个项目
+	appointments := make([]Appointment, 0, len(lines))
+	for i, line := range lines {
+		var slot TimeSlot
+		if err := tx.First(&slot, line.TimeSlotID).Error; err != nil {
+			return nil, fmt.Errorf("第%d项: 时间段不存在", i+1)
+		}
+		appointment, err := createAppointmentTx(tx, userID, merchantID, line.ServiceID, line.StaffID,
+			line.TimeSlotID, slot.Date, 0, remark)
+		if err != nil {
+			return nil, fmt.Errorf("第%d项: %v", i+1, err)
+		}
+		appointments = append(appointments, *appointment)
+		order.OriginalAmount += appointment.Amount
+	}
+
+	order.Amount = order.OriginalAmount
+	if couponID > 0 {
+		app, err := ApplyCoupon(tx, userID, couponID, order.OriginalAmount)
+		if err != nil {
+			return nil, fmt.Errorf("优惠券不可用: %v", err)
+		}
+		order.Amount = app.FinalPrice
+		order.DiscountAmount = order.OriginalAmount - app.FinalPrice
+		order.CouponID = app.UserCoupon.ID
+
+		if err := tx.Model(app.UserCoupon).Updates(map[string]interface{}{
+			"status":   "used",
+			"used_at":  time.Now(),
+			"order_id": order.ID,
+		}).Error; err != nil {
+			return nil, fmt.Errorf("更新优惠券状态失败")
+		}
+	}
+
+	// 按原价比例分摊优惠，最后一项补足差额，各项金额之和等于订单金额
+	remaining := order.DiscountAmount
+	for i := range appointments {
+		share := remaining
+		if i < len(appointments)-1 && order.OriginalAmount > 0 {
+			share = order.DiscountAmount * appointments[i].Amount / order.OriginalAmount
+		}
+		remaining -= share
+		appointments[i].Amount -= share
+		appointments[i].OrderID = order.ID
+		if err := tx.Model(&appointments[i]).Updates(map[string]interface{}{
+			"amount":   appointments[i].Amount,
+			"order_id": order.ID,
+		}).Error; err != nil {
+			return nil, fmt.Errorf("更新预约失败")
+		}
+	}
+
+	if err := tx.Model(order).Updates(map[string]interface{}{
+		"original_amount": order.OriginalAmount,
+		"discount_amount": order.DiscountAmount,
+		"amount":          order.Amount,
+		"coupon_id":       order.CouponID,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("更新订单失败")
+	}
+
+	order.Appointments = appointments
+	return order, nil
+}
+
+// orderActiveAmount 订单中未取消项目的应付金额合计，商家拒绝部分项目后按剩余项目收款
+func orderActiveAmount(order *AppointmentOrder) int {
+	total := 0
+	for _, a := range order.Appointments {
+		if containsString(activeAppointmentStatuses, a.Status) {
+			total += a.Amount
+		}
+	}
+	return total
+}
+
+// CheckOrderPayable 校验订单可以支付：订单待支付，且未取消的项目均已被商家确认。返回应付金额
+func CheckOrderPayable(order *AppointmentOrder) (int, error) {
+	if order.Status != OrderStatusPending {
+		return 0, errors.New("订单状态不允许支付")
+	}
+	active := 0
+	for _, a := range order.Appointments {
+		if !containsString(activeAppointmentStatuses, a.Status) {
+			continue
+		}
+		if a.Status != AppointmentStatusConfirmed {
+			return 0, errors.New("订单中有项目尚未确认")
+		}
+		active++
+	}
+	if active == 0 {
+		return 0, errors.New("订单中没有可支付的项目")
+	}
+	return orderActiveAmount(order), nil
+}
+
+// MarkOrderPaidTx 支付成功后将订单及其已确认的项目标记为已支付
+func MarkOrderPaidTx(tx *gorm.DB, orderID, paymentID uint) error {
+	if err := tx.Model(&AppointmentOrder{}).Where("id = ?", orderID).Updates(map[string]interface{}{
+		"status":     OrderStatusPaid,
+		"payment_id": paymentID,
+	}).Error; err != nil {
+		return err
+	}
+	var appointments []Appointment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("order_id = ? AND status = ?", orderID, AppointmentStatusConfirmed).
+		Find(&appointments).Error; err != nil {
+		return err
+	}
+	for i := range appointments {
+		if err := TransitionAppointmentTx(tx, &appointments[i], AppointmentStatusPaid, ActorPayment, paymentID,
+			"订单支付成功", map[string]interface{}{"payment_id": paymentID}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarkOrderPaid 支付成功后将订单标记为已支付
+func MarkOrderPaid(orderID, paymentID uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		return MarkOrderPaidTx(tx, orderID, paymentID)
+	})
+}
+
+// CancelUserOrder 用户取消整个订单：取消全部待确认的项目并释放时间段，恢复优惠券。已确认的项目需由商家处理
+func CancelUserOrder(userID, orderID uint) error {
+	tx := database.DB.Begin()
+
+	var order AppointmentOrder
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error; err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("订单不存在")
+		}
+		return errors.New("查询订单失败")
+	}
+	if order.UserID != userID {
+		tx.Rollback()
+		return errors.New("无权操作此订单")
+	}
+	if order.Status != OrderStatusPending {
+		tx.Rollback()
+		return errors.New("当前状态不允许取消")
+	}
+
+	var appointments []Appointment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("order_id = ? AND status IN (?)", order.ID, activeAppointmentStatuses).
+		Find(&appointments).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, a := range appointments {
+		if a.Status != AppointmentStatusPending {
+			tx.Rollback()
+			return errors.New("订单中有项目已确认，请联系商家取消")
+		}
+	}
+
+	for i := range appointments {
+		if err := TransitionAppointmentTx(tx, &appointments[i], AppointmentStatusCancelled, ActorCustomer, userID,
+			"客户取消订单", nil); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := cancelOrderTx(tx, &order); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// cancelOrderTx 将订单标记为已取消并恢复优惠券
+func cancelOrderTx(tx *gorm.DB, order *AppointmentOrder) error {
+	if err := tx.Model(order).Update("status", OrderStatusCancelled).Error; err != nil {
+		return err
+	}
+	if order.CouponID > 0 {
+		if err := tx.Model(&UserCoupon{}).Where("id = ?", order.CouponID).Updates(map[string]interface{}{
+			"status":   "unused",
+			"used_at":  nil,
+			"order_id": nil,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncOrderAfterLineCancel 订单中的项目被取消后，没有剩余有效项目的待支付订单随之取消
+func syncOrderAfterLineCancel(tx *gorm.DB, orderID uint) error {
+	if orderID == 0 {
+		return nil
+	}
+	var order AppointmentOrder
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error; err != nil {
+		return err
+	}
+	if order.Status != OrderStatusPending {
+		return nil
+	}
+	var active int64
+	if err := tx.Model(&Appointment{}).
+		Where("order_id = ? AND status IN (?)", orderID, activeAppointmentStatuses).
+		Count(&active).Error; err != nil {
+		return err
+	}
+	if active > 0 {
+		return nil
+	}
+	return cancelOrderTx(tx, &order)
+}
+
+func preloadOrderAppointments(db *gorm.DB) *gorm.DB {
+	return db.Order("appointment_date ASC, start_time ASC")
+}
+
+// GetUserOrders 获取用户的组合订单及其项目
+func GetUserOrders(userID uint) ([]AppointmentOrder, error) {
+	var orders []AppointmentOrder
+	err := database.DB.Preload("Appointments", preloadOrderAppointments).
+		Preload("Appointments.Merchant").Preload("Appointments.Service").Preload("Appointments.Staff").
+		Where("user_id = ?", userID).
+		Order("id DESC").
+		Find(&orders).Error
+	return orders, err
+}
+
+// GetOrderByID 获取组合订单及其项目
+func GetOrderByID(orderID uint) (*AppointmentOrder, error) {
+	var order AppointmentOrder
+	err := database.DB.Preload("User").Preload("Appointments", preloadOrderAppointments).
+		Preload("Appointments.Merchant").Preload("Appointments.Service").Preload("Appointments.Staff").
+		First(&order, orderID).Error
+	return &order, err
+}
+
+// GetMerchantOrders 获取商家的组合订单及其项目，status 为空时返回全部
+func GetMerchantOrders(merchantID uint, status string) ([]AppointmentOrder, error) {
+	var orders []AppointmentOrder
+	query := database.DB.Preload("User").Preload("Appointments", preloadOrderAppointments).
+		Preload("Appointments.Service").Preload("Appointments.Staff").
+		Where("merchant_id = ?", merchantID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Order("id DESC").Find(&orders).Error
+	return orders, err
+}
+
+// GetOrderNos 按订单ID查询订单号
+func GetOrderNos(orderIDs []uint) (map[uint]string, error) {
+	result := make(map[uint]string)
+	if len(orderIDs) == 0 {
+		return result, nil
+	}
+	var orders []AppointmentOrder
+	if err := database.DB.Select("id, order_no").Where("id IN (?)", orderIDs).Find(&orders).Error; err != nil {
+		return nil, err
+	}
+	for _, o := range orders {
+		result[o.ID] = o.OrderNo
+	}
+	return result, nil
+}
+
+// ConfirmMerchantOrder 商家一次确认订单中全部待确认的项目，返回确认的数量
+func ConfirmMerchantOrder(merchantID, orderID uint) (int64, error) {
+	var order AppointmentOrder
+	if err := database.DB.First(&order, orderID).Error; err != nil || order.MerchantID != merchantID {
+		return 0, errors.New("订单不存在")
+	}
+	if order.Status != OrderStatusPending {
+		return 0, errors.New("当前状态不允许确认")
+	}
+
+	tx := database.DB.Begin()
+
+	var appointments []Appointment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("order_id = ? AND status = ?", order.ID, AppointmentStatusPending).
+		Find(&appointments).Error; err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	for i := range appointments {
+		if err := TransitionAppointmentTx(tx, &appointments[i], AppointmentStatusConfirmed, ActorMerchant, merchantID,
+			"确认组合订单", nil); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return 0, err
+	}
+	return int64(len(appointments)), nil
+}
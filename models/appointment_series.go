@@ -0,0 +1,295 @@
+package models
+
+import (
+	"admin-api/database"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 周期预约频率
+const (
+	SeriesFrequencyDaily   = "daily"
+	SeriesFrequencyWeekly  = "weekly"
+	SeriesFrequencyMonthly = "monthly"
+)
+
+// 周期预约状态
+const (
+	SeriesStatusActive    = "active"
+	SeriesStatusCancelled = "cancelled"
+)
+
+// 周期预约的限制
+const (
+	seriesMaxOccurrences = 26  // 单个周期最多生成的预约次数
+	seriesMaxDays        = 180 // 结束日期距开始日期的最大天数
+)
+
+// AppointmentSeries 周期预约：同一服务、员工和开始时间按固定频率重复预约，每次对应一条 Appointment
+type AppointmentSeries struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index;not null" json:"user_id"`
+	MerchantID uint       `gorm:"index;not null" json:"merchant_id"`
+	ServiceID  uint       `gorm:"not null" json:"service_id"`
+	StaffID    uint       `gorm:"not null" json:"staff_id"`
+	Frequency  string     `gorm:"size:20;not null" json:"frequency"` // daily, weekly, monthly
+	Interval   int        `gorm:"default:1;not null" json:"interval"`
+	Count      int        `gorm:"default:0;not null" json:"count"` // 重复次数，0表示按结束日期
+	StartDate  time.Time  `gorm:"type:date;not null" json:"start_date"`
+	EndDate    *time.Time `gorm:"type:date" json:"end_date"`
+	StartTime  string     `gorm:"size:8;not null" json:"start_time"` // HH:MM
+	Status     string     `gorm:"size:20;default:'active';not null" json:"status"`
+	Remark     string     `gorm:"size:255" json:"remark"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+
+	Appointments []Appointment `gorm:"foreignKey:SeriesID" json:"-"`
+}
+
+// SeriesSkippedDate 周期中未能预约的日期及原因
+type SeriesSkippedDate struct {
+	Date   string `json:"date"`
+	Reason string `json:"reason"`
+}
+
+// SeriesCancelResult 取消周期预约的结果
+type SeriesCancelResult struct {
+	Cancelled []uint              `json:"cancelled"` // 已取消的预约ID
+	Skipped   []SeriesSkippedDate `json:"skipped"`   // 未能取消的预约（如已支付）
+}
+
+// ValidateAppointmentSeries 校验重复规则，次数和结束日期二选一
+func ValidateAppointmentSeries(series *AppointmentSeries) error {
+	switch series.Frequency {
+	case SeriesFrequencyDaily, SeriesFrequencyWeekly, SeriesFrequencyMonthly:
+	default:
+		return errors.New("无效的重复频率")
+	}
+	if series.Interval < 1 {
+		return errors.New("重复间隔至少为1")
+	}
+	if (series.Count > 0) == (series.EndDate != nil) {
+		return errors.New("重复次数和结束日期需填写其中一项")
+	}
+	if series.Count > seriesMaxOccurrences {
+		return fmt.Errorf("重复次数不能超过%d次", seriesMaxOccurrences)
+	}
+	if series.EndDate != nil {
+		if series.EndDate.Before(series.StartDate) {
+			return errors.New("结束日期不能早于开始日期")
+		}
+		if series.EndDate.After(series.StartDate.AddDate(0, 0, seriesMaxDays)) {
+			return fmt.Errorf("结束日期距开始日期不能超过%d天", seriesMaxDays)
+		}
+	}
+	if _, err := parseClock(series.StartTime); err != nil {
+		return errors.New("无效的开始时间")
+	}
+	return nil
+}
+
+// occurrenceDates 按重复规则计算每次预约的日期
+func (s *AppointmentSeries) occurrenceDates() []time.Time {
+	var dates []time.Time
+	for i := 0; len(dates) < seriesMaxOccurrences; i++ {
+		if s.Count > 0 && i >= s.Count {
+			break
+		}
+		var date time.Time
+		switch s.Frequency {
+		case SeriesFrequencyDaily:
+			date = s.StartDate.AddDate(0, 0, i*s.Interval)
+		case SeriesFrequencyWeekly:
+			date = s.StartDate.AddDate(0, 0, 7*i*s.Interval)
+		default:
+			date = s.StartDate.AddDate(0, i*s.Interval, 0)
+		}
+		if s.EndDate != nil && date.After(*s.EndDate) {
+			break
+		}
+		// 当月没有该日期（如31日）时跳过，仍计入次数
+		if s.Frequency == SeriesFrequencyMonthly && date.Day() != s.StartDate.Day() {
+			continue
+		}
+		dates = append(dates, date)
+	}
+	return dates
+}
+
+// CreateAppointmentSeries 创建周期预约：按重复规则为每个日期预约同一员工的同一开始时间，
+// 无法预约的日期（没有时间段、已约满、请假等）跳过并返回原因。所有日期都无法预约时不创建
+func CreateAppointmentSeries(series *AppointmentSeries) ([]Appointment, []SeriesSkippedDate, error) {
+	if err := ValidateAppointmentSeries(series); err != nil {
+		return nil, nil, err
+	}
+	start, _ := parseClock(series.StartTime)
+	series.StartTime = formatClock(start)
+	series.Status = SeriesStatusActive
+
+	tx := database.DB.Begin()
+
+	// 员工须可提供该服务
+	if _, err := staffServiceTx(tx, series.MerchantID, series.ServiceID, series.StaffID); err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+
+	if err := tx.Create(series).Error; err != nil {
+		tx.Rollback()
+		return nil, nil, errors.New("创建周期预约失败")
+	}
+
+	appointments := make([]Appointment, 0)
+	skipped := make([]SeriesSkippedDate, 0)
+	for _, date := range series.occurrenceDates() {
+		day := date.Format("2006-01-02")
+
+		var slots []TimeSlot
+		if err := tx.Where("merchant_id = ? AND staff_id = ? AND date = ?",
+			series.MerchantID, series.StaffID, day).Find(&slots).Error; err != nil {
+			tx.Rollback()
+			return nil, nil, err
+		}
+		var slotID uint
+		for _, slot := range slots {
+			if minutes, err := parseClock(slot.StartTime); err == nil && minutes == start {
+				slotID = slot.ID
+				break
+			}
+		}
+		if slotID == 0 {
+			skipped = append(skipped, SeriesSkippedDate{Date: day, Reason: "该时间没有可预约的时间段"})
+			continue
+		}
+
+		// 单次预约失败只回滚该次，不影响其他日期
+		if err := tx.SavePoint("series_occurrence").Error; err != nil {
+			tx.Rollback()
+			return nil, nil, err
+		}
+		appointment, err := createAppointmentTx(tx, series.UserID, series.MerchantID, series.ServiceID,
+			series.StaffID, slotID, date, 0, series.Remark)
+		if err == nil {
+			err = tx.Model(appointment).Update("series_id", series.ID).Error
+		}
+		if err != nil {
+			if rbErr := tx.RollbackTo("series_occurrence").Error; rbErr != nil {
+				tx.Rollback()
+				return nil, nil, rbErr
+			}
+			skipped = append(skipped, SeriesSkippedDate{Date: day, Reason: err.Error()})
+			continue
+		}
+		appointment.SeriesID = series.ID
+		appointments = append(appointments, *appointment)
+	}
+
+	if len(appointments) == 0 {
+		tx.Rollback()
+		return nil, skipped, errors.New("所选日期均无法预约")
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, nil, fmt.Errorf("提交事务失败")
+	}
+
+	for _, a := range appointments {
+		consumeSlotHold(series.UserID, a.TimeSlotID)
+	}
+
+	return appointments, skipped, nil
+}
+
+func GetUserAppointmentSeries(userID uint) ([]AppointmentSeries, error) {
+	var series []AppointmentSeries
+	err := database.DB.Where("user_id = ?", userID).Order("id DESC").Find(&series).Error
+	return series, err
+}
+
+// GetUserAppointmentSeriesDetail 获取周期预约及其全部预约，按日期排序
+func GetUserAppointmentSeriesDetail(userID, seriesID uint) (*AppointmentSeries, error) {
+	var series AppointmentSeries
+	err := database.DB.Preload("Appointments", func(db *gorm.DB) *gorm.DB {
+		return db.Order("appointment_date ASC, start_time ASC")
+	}).Preload("Appointments.Merchant").Preload("Appointments.Service").Preload("Appointments.Staff").
+		Where("id = ? AND user_id = ?", seriesID, userID).
+		First(&series).Error
+	return &series, err
+}
+
+// CancelAppointmentSeries 取消周期中尚未开始的预约。fromAppointmentID 不为0时只取消该次及之后的预约，
+// 否则取消全部剩余预约并结束周期。不允许取消的预约（如已支付）跳过并返回原因
+func CancelAppointmentSeries(userID, seriesID, fromAppointmentID uint) (*SeriesCancelResult, error) {
+	tx := database.DB.Begin()
+
+	var series AppointmentSeries
+	if err := tx.Where("id = ? AND user_id = ?", seriesID, userID).First(&series).Error; err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("周期预约不存在")
+		}
+		return nil, err
+	}
+
+	var appointments []Appointment
+	if err := tx.Where("series_id = ? AND status IN (?)", series.ID, activeAppointmentStatuses).
+		Order("appointment_date ASC, start_time ASC").
+		Find(&appointments).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	fromDate := ""
+	if fromAppointmentID > 0 {
+		var from Appointment
+		if err := tx.Where("id = ? AND series_id = ?", fromAppointmentID, series.ID).First(&from).Error; err != nil {
+			tx.Rollback()
+			return nil, errors.New("预约不属于该周期")
+		}
+		fromDate = from.AppointmentDate.Format("2006-01-02") + " " + formatSlotClock(from.StartTime)
+	}
+
+	now := time.Now().In(merchantLocation(tx, series.MerchantID))
+	result := &SeriesCancelResult{Cancelled: make([]uint, 0), Skipped: make([]SeriesSkippedDate, 0)}
+	for _, a := range appointments {
+		if fromDate != "" && a.AppointmentDate.Format("2006-01-02")+" "+formatSlotClock(a.StartTime) < fromDate {
+			continue
+		}
+		if !wallClockAt(a.AppointmentDate, a.StartTime, now.Location()).After(now) {
+			continue
+		}
+
+		if err := tx.SavePoint("series_cancel").Error; err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if err := cancelUserAppointmentTx(tx, userID, a.ID); err != nil {
+			if rbErr := tx.RollbackTo("series_cancel").Error; rbErr != nil {
+				tx.Rollback()
+				return nil, rbErr
+			}
+			result.Skipped = append(result.Skipped, SeriesSkippedDate{
+				Date:   a.AppointmentDate.Format("2006-01-02"),
+				Reason: err.Error(),
+			})
+			continue
+		}
+		result.Cancelled = append(result.Cancelled, a.ID)
+	}
+
+	// 取消全部剩余预约时结束周期
+	if fromAppointmentID == 0 {
+		if err := tx.Model(&series).Update("status", SeriesStatusCancelled).Error; err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("提交事务失败")
+	}
+	return result, nil
+}
@@ -0,0 +1,199 @@
+package models
+
+import (
+	"admin-api/database"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 状态变更的操作方
+const (
+	ActorCustomer = "customer"
+	ActorMerchant = "merchant"
+	ActorSystem   = "system"  // 后台任务
+	ActorPayment  = "payment" // 支付回调
+)
+
+// 旧版本写入的取消状态，读取时视为 AppointmentStatusCancelled
+const appointmentStatusCanceledLegacy = "canceled"
+
+// appointmentTransitions 预约状态机：每个状态允许变更到的状态
+var appointmentTransitions = map[string][]string{
+	AppointmentStatusPending:   {AppointmentStatusConfirmed, AppointmentStatusRejected, AppointmentStatusCancelled},
+	AppointmentStatusConfirmed: {AppointmentStatusPaid, AppointmentStatusCompleted, AppointmentStatusCancelled, AppointmentStatusNoShow},
+	// 已支付的预约只有客户晚取消且违约金为全额时直接取消，其余经退款取消
+	AppointmentStatusPaid:      {AppointmentStatusCompleted, AppointmentStatusNoShow, AppointmentStatusRefunding, AppointmentStatusRefunded, AppointmentStatusCancelled},
+	AppointmentStatusCompleted: {AppointmentStatusRefunding, AppointmentStatusRefunded},
+	AppointmentStatusNoShow:    {AppointmentStatusRefunding, AppointmentStatusRefunded},
+	AppointmentStatusRefunding: {AppointmentStatusRefunded},
+	AppointmentStatusCancelled: {},
+	AppointmentStatusRejected:  {},
+	AppointmentStatusRefunded:  {},
+}
+
+// 占用时间段名额的状态。退款中的预约已不再提供服务，进入退款中时即释放名额，不等待退款结果
+var slotHoldingAppointmentStatuses = activeAppointmentStatuses
+
+// 从占用名额的状态变更到这些状态时释放时间段
+var releasingAppointmentStatuses = []string{
+	AppointmentStatusCancelled,
+	AppointmentStatusRejected,
+	AppointmentStatusRefunding,
+	AppointmentStatusRefunded,
+}
+
+// AppointmentEvent 预约状态变更记录，创建预约时也记录一条 from_status 为空的记录
+type AppointmentEvent struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	AppointmentID uint      `gorm:"index;not null" json:"appointment_id"`
+	FromStatus    string    `gorm:"size:20" json:"from_status"`
+	ToStatus      string    `gorm:"size:20;not null" json:"to_status"`
+	ActorType     string    `gorm:"size:20;not null" json:"actor_type"` // customer, merchant, system, payment
+	ActorID       uint      `gorm:"default:0;not null" json:"actor_id"` // 用户ID、商家ID或支付ID，后台任务为0
+	Reason        string    `gorm:"size:255" json:"reason"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// NormalizeAppointmentStatus 统一状态写法，旧数据中的 canceled 视为 cancelled
+func NormalizeAppointmentStatus(status string) string {
+	if status == appointmentStatusCanceledLegacy {
+		return AppointmentStatusCancelled
+	}
+	return status
+}
+
+// appointmentStatusValues 按状态查询时匹配的取值，查询已取消时包含旧写法
+func appointmentStatusValues(status string) []string {
+	status = NormalizeAppointmentStatus(status)
+	if status == AppointmentStatusCancelled {
+		return []string{AppointmentStatusCancelled, appointmentStatusCanceledLegacy}
+	}
+	return []string{status}
+}
+
+// CanTransitionAppointment 判断预约能否从 from 变更到 to
+func CanTransitionAppointment(from, to string) bool {
+	return containsString(appointmentTransitions[NormalizeAppointmentStatus(from)], to)
+}
+
+// NextAppointmentStatuses 返回预约当前状态允许变更到的状态
+func NextAppointmentStatuses(status string) []string {
+	next := appointmentTransitions[NormalizeAppointmentStatus(status)]
+	if next == nil {
+		return []string{}
+	}
+	return next
+}
+
+// TransitionAppointmentTx 在调用方的事务中变更预约状态并记录变更。调用方应已对预约行加锁；
+// 按原状态条件更新，状态已被其他请求变更时返回错误。取消、拒绝和退款时释放预约占用的时间段。
+// extra 为同时更新的其他字段，可为 nil
+func TransitionAppointmentTx(tx *gorm.DB, appointment *Appointment, to, actorType string, actorID uint,
+	reason string, extra map[string]interface{}) error {
+	from := NormalizeAppointmentStatus(appointment.Status)
+	if !CanTransitionAppointment(from, to) {
+		return fmt.Errorf("预约状态不允许从 %s 变更为 %s", from, to)
+	}
+
+	updates := map[string]interface{}{"status": to}
+	for k, v := range extra {
+		updates[k] = v
+	}
+	if to == AppointmentStatusConfirmed {
+		updates["confirmed_at"] = time.Now()
+	}
+	result := tx.Model(&Appointment{}).
+		Where("id = ? AND status = ?", appointment.ID, appointment.Status).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("预约状态已变更")
+	}
+
+	if containsString(slotHoldingAppointmentStatuses, from) && containsString(releasingAppointmentStatuses, to) {
+		if err := releaseAppointmentSlots(tx, appointment); err != nil {
+			return err
+		}
+	}
+
+	if err := recordAppointmentEvent(tx, appointment.ID, from, to, actorType, actorID, reason); err != nil {
+		return err
+	}
+	appointment.Status = to
+	return nil
+}
+
+// TransitionAppointment 加锁读取预约并变更状态
+func TransitionAppointment(appointmentID uint, to, actorType string, actorID uint, reason string) error {
+	tx := database.DB.Begin()
+
+	appointment, err := lockAppointment(tx, appointmentID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := TransitionAppointmentTx(tx, appointment, to, actorType, actorID, reason, nil); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// lockAppointment 在事务中加锁读取预约
+func lockAppointment(tx *gorm.DB, appointmentID uint) (*Appointment, error) {
+	var appointment Appointment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&appointment, appointmentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("预约不存在")
+		}
+		return nil, errors.New("查询预约失败")
+	}
+	return &appointment, nil
+}
+
+func recordAppointmentEvent(tx *gorm.DB, appointmentID uint, from, to, actorType string, actorID uint, reason string) error {
+	if runes := []rune(reason); len(runes) > 255 {
+		reason = string(runes[:255])
+	}
+	return tx.Create(&AppointmentEvent{
+		AppointmentID: appointmentID,
+		FromStatus:    from,
+		ToStatus:      to,
+		ActorType:     actorType,
+		ActorID:       actorID,
+		Reason:        reason,
+	}).Error
+}
+
+// GetAppointmentEvents 获取预约的状态变更记录，按时间顺序
+func GetAppointmentEvents(appointmentID uint) ([]AppointmentEvent, error) {
+	var events []AppointmentEvent
+	err := database.DB.Where("appointment_id = ?", appointmentID).
+		Order("id ASC").
+		Find(&events).Error
+	return events, err
+}
+
+// MarkAppointmentPaidTx 支付成功后将已确认的预约标记为已支付并关联支付记录
+func MarkAppointmentPaidTx(tx *gorm.DB, appointmentID, paymentID uint) error {
+	appointment, err := lockAppointment(tx, appointmentID)
+	if err != nil {
+		return err
+	}
+	return TransitionAppointmentTx(tx, appointment, AppointmentStatusPaid, ActorPayment, paymentID, "支付成功",
+		map[string]interface{}{"payment_id": paymentID})
+}
+
+// MarkAppointmentPaid 支付成功后将预约标记为已支付
+func MarkAppointmentPaid(appointmentID, paymentID uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		return MarkAppointmentPaidTx(tx, appointmentID, paymentID)
+	})
+}
@@ -0,0 +1,231 @@
+package models
+
+import (
+	"admin-api/database"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// bufferedAppointment 员工某天的一个有效预约及其服务的前后缓冲时长
+type bufferedAppointment struct {
+	ID              uint
+	StaffID         uint
+	AppointmentDate time.Time
+	StartTime       string
+	EndTime         string
+	BufferBefore    int
+	BufferAfter     int
+}
+
+// BufferWindow 预约前后的缓冲时段（如消毒、整理房间），期间员工不可预约
+type BufferWindow struct {
+	AppointmentID uint   `json:"appointment_id"`
+	StaffID       uint   `json:"staff_id"`
+	Date          string `json:"date"`
+	StartTime     string `json:"start_time"` // HH:MM
+	EndTime       string `json:"end_time"`   // HH:MM
+	Position      string `json:"position"`   // before, after
+}
+
+// bufferCalendar 某段日期内商家的有效预约，用于计算服务缓冲时段
+type bufferCalendar struct {
+	appointments []bufferedAppointment
+}
+
+// loadBufferCalendar 加载 from 到 to（含）之间商家的有效预约，excludeAppointmentID 不计入（改约时排除自身）
+func loadBufferCalendar(db *gorm.DB, merchantID uint, from, to time.Time, excludeAppointmentID uint) (*bufferCalendar, error) {
+	cal := &bufferCalendar{}
+	query := db.Table("appointments").
+		Select("appointments.id, appointments.staff_id, appointments.appointment_date, "+
+			"appointments.start_time, appointments.end_time, services.buffer_before, services.buffer_after").
+		Joins("JOIN services ON services.id = appointments.service_id").
+		Where("appointments.merchant_id = ? AND appointments.status IN (?) AND appointments.appointment_date BETWEEN ? AND ?",
+			merchantID, activeAppointmentStatuses, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if excludeAppointmentID > 0 {
+		query = query.Where("appointments.id <> ?", excludeAppointmentID)
+	}
+	if err := query.Scan(&cal.appointments).Error; err != nil {
+		return nil, err
+	}
+	return cal, nil
+}
+
+// windows 返回员工某天全部预约的缓冲时段
+func (b *bufferCalendar) windows(staffID uint, day string) []BufferWindow {
+	var result []BufferWindow
+	for _, a := range b.appointments {
+		if a.StaffID != staffID || a.AppointmentDate.Format("2006-01-02") != day {
+			continue
+		}
+		start, err1 := parseClock(a.StartTime)
+		end, err2 := parseClock(a.EndTime)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		if a.BufferBefore > 0 {
+			result = append(result, BufferWindow{
+				AppointmentID: a.ID, StaffID: staffID, Date: day,
+				StartTime: formatClock(start - a.BufferBefore), EndTime: formatClock(start), Position: "before",
+			})
+		}
+		if a.BufferAfter > 0 {
+			result = append(result, BufferWindow{
+				AppointmentID: a.ID, StaffID: staffID, Date: day,
+				StartTime: formatClock(end), EndTime: formatClock(end + a.BufferAfter), Position: "after",
+			})
+		}
+	}
+	return result
+}
+
+// blocks 判断时间段是否落在已有预约的缓冲时段内
+func (b *bufferCalendar) blocks(slot TimeSlot) bool {
+	start, err1 := parseClock(slot.StartTime)
+	end, err2 := parseClock(slot.EndTime)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	for _, w := range b.windows(slot.StaffID, slot.Date.Format("2006-01-02")) {
+		ws, _ := parseClock(w.StartTime)
+		we, _ := parseClock(w.EndTime)
+		if start < we && end > ws {
+			return true
+		}
+	}
+	return false
+}
+
+// markBlocked 将落在缓冲时段内的时间段标记为不可用（仅修改内存中的数据）
+func (b *bufferCalendar) markBlocked(slots []TimeSlot) {
+	for i := range slots {
+		if slots[i].IsAvailable && b.blocks(slots[i]) {
+			slots[i].IsAvailable = false
+		}
+	}
+}
+
+// fits 判断新预约 run 的前后缓冲时段是否与员工已有的预约冲突
+func (b *bufferCalendar) fits(run []TimeSlot, service *Service) bool {
+	if service == nil || len(run) == 0 || (service.BufferBefore <= 0 && service.BufferAfter <= 0) {
+		return true
+	}
+	start, err1 := parseClock(run[0].StartTime)
+	end, err2 := parseClock(run[len(run)-1].EndTime)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+
+	day := run[0].Date.Format("2006-01-02")
+	for _, a := range b.appointments {
+		if a.StaffID != run[0].StaffID || a.AppointmentDate.Format("2006-01-02") != day {
+			continue
+		}
+		as, err1 := parseClock(a.StartTime)
+		ae, err2 := parseClock(a.EndTime)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		if service.BufferBefore > 0 && start-service.BufferBefore < ae && start > as {
+			return false
+		}
+		if service.BufferAfter > 0 && end < ae && end+service.BufferAfter > as {
+			return false
+		}
+	}
+	return true
+}
+
+// bookableRun 返回从 slots[i] 开始可容纳服务（含前后缓冲）的连续时间段，不可预约时返回nil
+func bookableRun(slots []TimeSlot, i int, service *Service, buffers *bufferCalendar) []TimeSlot {
+	duration := 0
+	if service != nil {
+		duration = service.Duration
+	}
+	run := contiguousRun(slots, i, duration)
+	if run == nil || !buffers.fits(run, service) {
+		return nil
+	}
+	return run
+}
+
+// 日历中时间段的状态
+const (
+	CalendarSlotAvailable = "available" // 可预约
+	CalendarSlotBooked    = "booked"    // 名额已满（含临时预留）
+	CalendarSlotBuffer    = "buffer"    // 处于预约前后的缓冲时间
+	CalendarSlotBlocked   = "blocked"   // 停业日或员工请假
+)
+
+// CalendarSlot 商家日历中的一个时间段
+type CalendarSlot struct {
+	ID          uint   `json:"id"`
+	StartTime   string `json:"start_time"`
+	EndTime     string `json:"end_time"`
+	Capacity    int    `json:"capacity"`
+	BookedCount int    `json:"booked_count"`
+	HeldCount   int    `json:"held_count"`
+	State       string `json:"state"`
+}
+
+// StaffDayCalendar 员工某天的日历：全部时间段及其状态，以及预约前后的缓冲时段
+type StaffDayCalendar struct {
+	StaffID uint           `json:"staff_id"`
+	Date    string         `json:"date"`
+	Slots   []CalendarSlot `json:"slots"`
+	Buffers []BufferWindow `json:"buffers"`
+}
+
+// GetStaffDayCalendar 获取员工某天的日历，缓冲时间与可预约时间分开标注
+func GetStaffDayCalendar(merchantID, staffID uint, date time.Time) (*StaffDayCalendar, error) {
+	var slots []TimeSlot
+	if err := database.DB.
+		Where("merchant_id = ? AND staff_id = ? AND date = ?", merchantID, staffID, date.Format("2006-01-02")).
+		Order("start_time ASC").
+		Find(&slots).Error; err != nil {
+		return nil, err
+	}
+
+	calendar, err := loadBlockCalendar(database.DB, merchantID, date, date)
+	if err != nil {
+		return nil, err
+	}
+	buffers, err := loadBufferCalendar(database.DB, merchantID, date, date, 0)
+	if err != nil {
+		return nil, err
+	}
+	applySlotHolds(slots, 0)
+
+	day := date.Format("2006-01-02")
+	result := &StaffDayCalendar{
+		StaffID: staffID,
+		Date:    day,
+		Slots:   make([]CalendarSlot, 0, len(slots)),
+		Buffers: buffers.windows(staffID, day),
+	}
+	if result.Buffers == nil {
+		result.Buffers = []BufferWindow{}
+	}
+
+	for _, slot := range slots {
+		state := CalendarSlotAvailable
+		switch {
+		case calendar.blocks(slot):
+			state = CalendarSlotBlocked
+		case slot.RemainingSeats() <= 0:
+			state = CalendarSlotBooked
+		case buffers.blocks(slot):
+			state = CalendarSlotBuffer
+		}
+		result.Slots = append(result.Slots, CalendarSlot{
+			ID:          slot.ID,
+			StartTime:   formatSlotClock(slot.StartTime),
+			EndTime:     formatSlotClock(slot.EndTime),
+			Capacity:    slot.Capacity,
+			BookedCount: slot.BookedCount,
+			HeldCount:   slot.HeldCount,
+			State:       state,
+		})
+	}
+	return result, nil
+}
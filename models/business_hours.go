@@ -0,0 +1,353 @@
+package models
+
+import (
+	"admin-api/database"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MerchantBusinessHour 商家每周营业时段，同一天可配置多个时段（如午休分段营业）
+type MerchantBusinessHour struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	MerchantID uint      `gorm:"index;not null" json:"merchant_id"`
+	Weekday    int       `gorm:"not null" json:"weekday"`           // 星期(0-周日, 1-周一 ... 6-周六)
+	OpenTime   string    `gorm:"size:8;not null" json:"open_time"`  // HH:MM
+	CloseTime  string    `gorm:"size:8;not null" json:"close_time"` // HH:MM
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// MerchantBusinessHourException 特定日期的营业时间例外，优先于每周营业时段
+// IsClosed 为 true 表示当天不营业，否则当天按该记录的时段营业（同一天可有多条）
+type MerchantBusinessHourException struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	MerchantID uint      `gorm:"index;not null" json:"merchant_id"`
+	Date       time.Time `gorm:"type:date;index;not null" json:"date"`
+	IsClosed   bool      `gorm:"default:false;not null" json:"is_closed"`
+	OpenTime   string    `gorm:"size:8" json:"open_time"`  // HH:MM
+	CloseTime  string    `gorm:"size:8" json:"close_time"` // HH:MM
+	Remark     string    `gorm:"size:255" json:"remark"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// BusinessHoursSchedule 商家完整的营业时间配置
+type BusinessHoursSchedule struct {
+	Weekly     []MerchantBusinessHour          `json:"weekly"`
+	Exceptions []MerchantBusinessHourException `json:"exceptions"`
+}
+
+// BusinessHourRequest 每周营业时段请求，商户端和内部接口共用
+type BusinessHourRequest struct {
+	Weekday   int    `json:"weekday" binding:"min=0,max=6"` // 0-周日 ... 6-周六
+	OpenTime  string `json:"open_time" binding:"required"`  // HH:MM
+	CloseTime string `json:"close_time" binding:"required"` // HH:MM
+}
+
+// BusinessHourExceptionRequest 例外日期请求
+type BusinessHourExceptionRequest struct {
+	Date      string `json:"date" binding:"required"` // YYYY-MM-DD
+	IsClosed  bool   `json:"is_closed"`               // 当天不营业
+	OpenTime  string `json:"open_time"`               // HH:MM，营业时填写
+	CloseTime string `json:"close_time"`              // HH:MM，营业时填写
+	Remark    string `json:"remark"`
+}
+
+// BusinessHoursRequest 整体设置营业时间的请求
+type BusinessHoursRequest struct {
+	Weekly     []BusinessHourRequest          `json:"weekly" binding:"dive"`
+	Exceptions []BusinessHourExceptionRequest `json:"exceptions" binding:"dive"`
+}
+
+// ToSchedule 将请求转换为营业时间，日期格式错误时返回错误
+func (r *BusinessHoursRequest) ToSchedule() (*BusinessHoursSchedule, error) {
+	schedule := &BusinessHoursSchedule{}
+	for _, h := range r.Weekly {
+		schedule.Weekly = append(schedule.Weekly, MerchantBusinessHour{
+			Weekday:   h.Weekday,
+			OpenTime:  h.OpenTime,
+			CloseTime: h.CloseTime,
+		})
+	}
+	for _, e := range r.Exceptions {
+		date, err := time.Parse("2006-01-02", e.Date)
+		if err != nil {
+			return nil, fmt.Errorf("无效的日期: %s", e.Date)
+		}
+		schedule.Exceptions = append(schedule.Exceptions, MerchantBusinessHourException{
+			Date:      date,
+			IsClosed:  e.IsClosed,
+			OpenTime:  e.OpenTime,
+			CloseTime: e.CloseTime,
+			Remark:    e.Remark,
+		})
+	}
+	return schedule, nil
+}
+
+// BusinessStatus 商家当前营业状态
+type BusinessStatus struct {
+	IsOpen   bool   `json:"is_open"`
+	ClosesAt string `json:"closes_at,omitempty"` // 营业中时本时段的结束时间 HH:MM
+	OpensAt  string `json:"opens_at,omitempty"`  // 未营业时下次开始营业的时间 YYYY-MM-DD HH:MM
+}
+
+// openInterval 营业区间（当天的分钟数）
+type openInterval struct {
+	start int
+	end   int
+}
+
+// ValidateBusinessHours 校验营业时间配置
+func ValidateBusinessHours(schedule *BusinessHoursSchedule) error {
+	byWeekday := make(map[int][]openInterval)
+	for _, h := range schedule.Weekly {
+		if h.Weekday < 0 || h.Weekday > 6 {
+			return errors.New("无效的星期")
+		}
+		interval, err := parseInterval(h.OpenTime, h.CloseTime)
+		if err != nil {
+			return err
+		}
+		for _, other := range byWeekday[h.Weekday] {
+			if interval.start < other.end && interval.end > other.start {
+				return fmt.Errorf("营业时段 %s-%s 与同一天的其他时段重叠", h.OpenTime, h.CloseTime)
+			}
+		}
+		byWeekday[h.Weekday] = append(byWeekday[h.Weekday], interval)
+	}
+
+	for _, e := range schedule.Exceptions {
+		if e.IsClosed {
+			continue
+		}
+		if _, err := parseInterval(e.OpenTime, e.CloseTime); err != nil {
+			return fmt.Errorf("%s: %v", e.Date.Format("2006-01-02"), err)
+		}
+	}
+	return nil
+}
+
+func parseInterval(open, close string) (openInterval, error) {
+	start, err := parseClock(open)
+	if err != nil {
+		return openInterval{}, err
+	}
+	end, err := parseClock(close)
+	if err != nil {
+		return openInterval{}, err
+	}
+	if start >= end {
+		return openInterval{}, fmt.Errorf("营业时段 %s-%s 开始时间必须早于结束时间", open, close)
+	}
+	return openInterval{start, end}, nil
+}
+
+// GetMerchantBusinessHours 获取商家营业时间配置，例外日期只返回今天及以后的
+func GetMerchantBusinessHours(merchantID uint) (*BusinessHoursSchedule, error) {
+	schedule := &BusinessHoursSchedule{}
+	if err := database.DB.Where("merchant_id = ?", merchantID).
+		Order("weekday ASC, open_time ASC").
+		Find(&schedule.Weekly).Error; err != nil {
+		return nil, err
+	}
+	if err := database.DB.Where("merchant_id = ? AND date >= ?", merchantID, merchantToday(database.DB, merchantID)).
+		Order("date ASC, open_time ASC").
+		Find(&schedule.Exceptions).Error; err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// SetMerchantBusinessHours 整体替换商家的每周营业时段和例外日期
+func SetMerchantBusinessHours(merchantID uint, schedule *BusinessHoursSchedule) error {
+	if err := ValidateBusinessHours(schedule); err != nil {
+		return err
+	}
+
+	tx := database.DB.Begin()
+
+	if err := tx.Where("merchant_id = ?", merchantID).Delete(&MerchantBusinessHour{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("merchant_id = ?", merchantID).Delete(&MerchantBusinessHourException{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, h := range schedule.Weekly {
+		h.ID = 0
+		h.MerchantID = merchantID
+		if err := tx.Create(&h).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for _, e := range schedule.Exceptions {
+		e.ID = 0
+		e.MerchantID = merchantID
+		if e.IsClosed {
+			e.OpenTime, e.CloseTime = "", ""
+		}
+		if err := tx.Create(&e).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit().Error
+}
+
+// businessCalendar 商家在一段日期内的营业时间
+type businessCalendar struct {
+	weekly     map[int][]openInterval
+	exceptions map[string][]MerchantBusinessHourException
+	closures   []MerchantClosure
+}
+
+func loadBusinessCalendar(merchantID uint, from, to time.Time) (*businessCalendar, error) {
+	var weekly []MerchantBusinessHour
+	if err := database.DB.Where("merchant_id = ?", merchantID).Find(&weekly).Error; err != nil {
+		return nil, err
+	}
+
+	var exceptions []MerchantBusinessHourException
+	if err := database.DB.Where("merchant_id = ? AND date BETWEEN ? AND ?",
+		merchantID, from.Format("2006-01-02"), to.Format("2006-01-02")).
+		Find(&exceptions).Error; err != nil {
+		return nil, err
+	}
+
+	var closures []MerchantClosure
+	if err := database.DB.Where("merchant_id = ? AND start_date <= ? AND end_date >= ?",
+		merchantID, to.Format("2006-01-02"), from.Format("2006-01-02")).
+		Find(&closures).Error; err != nil {
+		return nil, err
+	}
+
+	cal := &businessCalendar{
+		weekly:     make(map[int][]openInterval),
+		exceptions: make(map[string][]MerchantBusinessHourException),
+		closures:   closures,
+	}
+	for _, h := range weekly {
+		if interval, err := parseInterval(h.OpenTime, h.CloseTime); err == nil {
+			cal.weekly[h.Weekday] = append(cal.weekly[h.Weekday], interval)
+		}
+	}
+	for _, e := range exceptions {
+		day := e.Date.Format("2006-01-02")
+		cal.exceptions[day] = append(cal.exceptions[day], e)
+	}
+	return cal, nil
+}
+
+// configured 商家是否配置了结构化营业时间，未配置时不做营业时间校验
+func (b *businessCalendar) configured() bool {
+	return len(b.weekly) > 0 || len(b.exceptions) > 0
+}
+
+// intervalsOn 返回指定日期的营业区间，按开始时间排序
+func (b *businessCalendar) intervalsOn(date time.Time) []openInterval {
+	day := date.Format("2006-01-02")
+
+	for _, c := range b.closures {
+		if c.StartDate.Format("2006-01-02") <= day && c.EndDate.Format("2006-01-02") >= day {
+			return nil
+		}
+	}
+
+	var intervals []openInterval
+	if exceptions, ok := b.exceptions[day]; ok {
+		for _, e := range exceptions {
+			if e.IsClosed {
+				return nil
+			}
+			if interval, err := parseInterval(e.OpenTime, e.CloseTime); err == nil {
+				intervals = append(intervals, interval)
+			}
+		}
+	} else {
+		intervals = append(intervals, b.weekly[int(date.Weekday())]...)
+	}
+
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i].start < intervals[j].start })
+	return intervals
+}
+
+// within 判断时间段是否完整落在某个营业区间内
+func (b *businessCalendar) within(date time.Time, start, end int) bool {
+	for _, interval := range b.intervalsOn(date) {
+		if start >= interval.start && end <= interval.end {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateSlotsWithinBusinessHours 校验时间段均在商家营业时间内，商家未配置营业时间时不校验
+func ValidateSlotsWithinBusinessHours(merchantID uint, date time.Time, slots []TimeSlot) error {
+	cal, err := loadBusinessCalendar(merchantID, date, date)
+	if err != nil {
+		return err
+	}
+	if !cal.configured() {
+		return nil
+	}
+
+	for _, slot := range slots {
+		start, err := parseClock(slot.StartTime)
+		if err != nil {
+			return err
+		}
+		end, err := parseClock(slot.EndTime)
+		if err != nil {
+			return err
+		}
+		if !cal.within(date, start, end) {
+			return fmt.Errorf("时间段 %s-%s 不在营业时间内", slot.StartTime, slot.EndTime)
+		}
+	}
+	return nil
+}
+
+// GetBusinessStatus 计算商家在 now 时刻的营业状态，未营业时查找7天内的下次营业时间
+func GetBusinessStatus(merchantID uint, now time.Time) (*BusinessStatus, error) {
+	const lookAheadDays = 7
+
+	now = now.In(MerchantLocation(merchantID))
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	cal, err := loadBusinessCalendar(merchantID, today, today.AddDate(0, 0, lookAheadDays))
+	if err != nil {
+		return nil, err
+	}
+
+	status := &BusinessStatus{}
+	if !cal.configured() {
+		return status, nil
+	}
+
+	minute := now.Hour()*60 + now.Minute()
+	for _, interval := range cal.intervalsOn(today) {
+		if minute >= interval.start && minute < interval.end {
+			status.IsOpen = true
+			status.ClosesAt = formatClock(interval.end)
+			return status, nil
+		}
+	}
+
+	for i := 0; i <= lookAheadDays; i++ {
+		date := today.AddDate(0, 0, i)
+		for _, interval := range cal.intervalsOn(date) {
+			if i == 0 && interval.start <= minute {
+				continue
+			}
+			status.OpensAt = date.Format("2006-01-02") + " " + formatClock(interval.start)
+			return status, nil
+		}
+	}
+	return status, nil
+}
@@ -0,0 +1,402 @@
+package models
+
+import (
+	"admin-api/database"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"admin-api/config"
+	"admin-api/pkg/ical"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 外部日历来源类型
+const (
+	CalendarSourceUpload = "upload" // 商家上传的 .ics 文件，每个员工一个
+	CalendarSourcePath   = "path"   // 服务器本地文件，由后台任务定期读取
+	CalendarSourceURL    = "url"    // 远程订阅地址，由后台任务定期拉取
+)
+
+// 导入外部日历的时间范围
+const (
+	busyImportPastDays   = 1   // 保留最近一天已结束的事件
+	busyImportFutureDays = 180 // 重复事件最多展开到未来的天数
+	busyFetchTimeout     = 30 * time.Second
+	busyFetchMaxBytes    = 10 << 20
+)
+
+// StaffCalendarSource 员工的外部日历来源（如个人日历），导入的事件作为忙碌时段屏蔽可预约时间
+type StaffCalendarSource struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	MerchantID   uint       `gorm:"index;not null" json:"merchant_id"`
+	StaffID      uint       `gorm:"index;not null" json:"staff_id"`
+	Type         string     `gorm:"size:20;not null" json:"type"` // upload, path, url
+	Name         string     `gorm:"size:100" json:"name"`
+	Location     string     `gorm:"size:500" json:"location"` // 文件路径或订阅地址，上传类型为空
+	IsActive     bool       `gorm:"default:true;not null" json:"is_active"`
+	LastSyncedAt *time.Time `json:"last_synced_at"`
+	LastError    string     `gorm:"size:500" json:"last_error"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// StaffBusyBlock 从外部日历导入的忙碌时段。同一来源内按 UID 和 RecurrenceID 唯一，
+// 重复导入时按此更新，文件中已删除或已取消的事件会被移除
+type StaffBusyBlock struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	MerchantID   uint      `gorm:"index;not null" json:"merchant_id"`
+	StaffID      uint      `gorm:"index:idx_busy_block_staff;not null" json:"staff_id"`
+	SourceID     uint      `gorm:"uniqueIndex:idx_busy_block_uid;not null" json:"source_id"`
+	UID          string    `gorm:"size:255;uniqueIndex:idx_busy_block_uid;not null" json:"uid"`
+	RecurrenceID string    `gorm:"size:32;uniqueIndex:idx_busy_block_uid;not null;default:''" json:"recurrence_id"` // 重复事件的实例标识
+	StartAt      time.Time `gorm:"index:idx_busy_block_staff;not null" json:"start_at"`
+	EndAt        time.Time `gorm:"not null" json:"end_at"`
+	AllDay       bool      `gorm:"default:false;not null" json:"all_day"`
+	Summary      string    `gorm:"size:255" json:"summary"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// BusyImportResult 导入结果
+type BusyImportResult struct {
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Removed   int `json:"removed"`
+	Unchanged int `json:"unchanged"`
+}
+
+// ValidateCalendarSource 校验外部日历来源。本地文件必须位于导入目录下该商家的子目录内，
+// 订阅地址不能指向内网地址
+func ValidateCalendarSource(source *StaffCalendarSource) error {
+	switch source.Type {
+	case CalendarSourcePath:
+		_, err := calendarSourcePath(source)
+		return err
+	case CalendarSourceURL:
+		u, err := url.Parse(source.Location)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "webcal") || u.Hostname() == "" {
+			return errors.New("无效的日历地址")
+		}
+		if ip := net.ParseIP(u.Hostname()); ip != nil && !isPublicIP(ip) {
+			return errors.New("日历地址不能指向内网地址")
+		}
+	default:
+		return errors.New("无效的日历来源类型")
+	}
+	return nil
+}
+
+// calendarImportRoot 商家的日历导入目录。各商家只能读取导入目录下以商家ID命名的子目录
+func calendarImportRoot(merchantID uint) (string, error) {
+	dir := config.Config.Calendar.ImportDir
+	if dir == "" {
+		return "", errors.New("未配置日历导入目录，不能使用本地文件")
+	}
+	root, err := filepath.Abs(filepath.Join(dir, strconv.FormatUint(uint64(merchantID), 10)))
+	if err != nil || merchantID == 0 {
+		return "", errors.New("日历导入目录无效")
+	}
+	return root, nil
+}
+
+// calendarSourcePath 本地文件来源的绝对路径，登记的路径相对于商家的日历导入目录
+func calendarSourcePath(source *StaffCalendarSource) (string, error) {
+	root, err := calendarImportRoot(source.MerchantID)
+	if err != nil {
+		return "", err
+	}
+	path, err := filepath.Abs(filepath.Join(root, source.Location))
+	if err != nil || !strings.HasPrefix(path, root+string(filepath.Separator)) {
+		return "", errors.New("文件路径必须位于本商家的日历导入目录内")
+	}
+	return path, nil
+}
+
+func GetStaffCalendarSources(staffID uint) ([]StaffCalendarSource, error) {
+	var sources []StaffCalendarSource
+	err := database.DB.Where("staff_id = ?", staffID).Order("id ASC").Find(&sources).Error
+	return sources, err
+}
+
+func GetStaffCalendarSourceByID(id uint) (*StaffCalendarSource, error) {
+	var source StaffCalendarSource
+	err := database.DB.First(&source, id).Error
+	return &source, err
+}
+
+func CreateStaffCalendarSource(source *StaffCalendarSource) error {
+	return database.DB.Create(source).Error
+}
+
+// DeleteStaffCalendarSource 删除日历来源及其导入的忙碌时段
+func DeleteStaffCalendarSource(id uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("source_id = ?", id).Delete(&StaffBusyBlock{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&StaffCalendarSource{}, id).Error
+	})
+}
+
+// GetStaffBusyBlocks 查询员工在 [from, to) 内的忙碌时段
+func GetStaffBusyBlocks(staffID uint, from, to time.Time) ([]StaffBusyBlock, error) {
+	var blocks []StaffBusyBlock
+	err := database.DB.Where("staff_id = ? AND start_at < ? AND end_at > ?", staffID, to, from).
+		Order("start_at ASC").Find(&blocks).Error
+	return blocks, err
+}
+
+// ImportStaffCalendarUpload 导入商家上传的 .ics 文件，同一员工的多次上传按 UID 增量更新
+func ImportStaffCalendarUpload(merchantID, staffID uint, r io.Reader) (*BusyImportResult, error) {
+	var source StaffCalendarSource
+	err := database.DB.Where("staff_id = ? AND type = ?", staffID, CalendarSourceUpload).
+		Order("id ASC").First(&source).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		source = StaffCalendarSource{
+			MerchantID: merchantID,
+			StaffID:    staffID,
+			Type:       CalendarSourceUpload,
+			Name:       "上传的日历",
+			IsActive:   true,
+		}
+		err = database.DB.Create(&source).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := importBusyBlocks(&source, r)
+	recordCalendarSync(&source, err)
+	return result, err
+}
+
+// SyncStaffCalendarSource 读取本地文件或远程地址并导入
+func SyncStaffCalendarSource(source *StaffCalendarSource) (*BusyImportResult, error) {
+	body, err := openCalendarSource(source)
+	if err != nil {
+		recordCalendarSync(source, err)
+		return nil, err
+	}
+	defer body.Close()
+
+	result, err := importBusyBlocks(source, io.LimitReader(body, busyFetchMaxBytes))
+	recordCalendarSync(source, err)
+	return result, err
+}
+
+// SyncAllCalendarSources 同步所有启用的本地文件和远程地址来源，返回成功和失败的数量
+func SyncAllCalendarSources() (int, int, error) {
+	var sources []StaffCalendarSource
+	if err := database.DB.Where("is_active = ? AND type IN (?)", true,
+		[]string{CalendarSourcePath, CalendarSourceURL}).Find(&sources).Error; err != nil {
+		return 0, 0, err
+	}
+
+	synced, failed := 0, 0
+	for i := range sources {
+		if _, err := SyncStaffCalendarSource(&sources[i]); err != nil {
+			failed++
+			continue
+		}
+		synced++
+	}
+	return synced, failed, nil
+}
+
+// calendarHTTPClient 拉取订阅地址的客户端。在连接时按 DNS 解析后的地址拒绝内网地址（含重定向），
+// 不使用环境变量中的代理，避免绕过检查
+var calendarHTTPClient = &http.Client{
+	Timeout: busyFetchTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: busyFetchTimeout,
+			Control: denyPrivateAddress,
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+}
+
+// errCalendarFetch 拉取失败时记录到 last_error 的错误，不包含远端状态码等细节
+var errCalendarFetch = errors.New("获取日历失败，请检查订阅地址是否可以公开访问")
+
+func openCalendarSource(source *StaffCalendarSource) (io.ReadCloser, error) {
+	if err := ValidateCalendarSource(source); err != nil {
+		return nil, err
+	}
+
+	if source.Type == CalendarSourcePath {
+		path, _ := calendarSourcePath(source)
+		root, _ := calendarImportRoot(source.MerchantID)
+		// 不允许通过符号链接读取商家目录以外的文件
+		resolved, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return nil, errors.New("日历文件不存在")
+		}
+		realRoot, err := filepath.EvalSymlinks(root)
+		if err != nil || !strings.HasPrefix(resolved, realRoot+string(filepath.Separator)) {
+			return nil, errors.New("文件路径必须位于本商家的日历导入目录内")
+		}
+		return os.Open(resolved)
+	}
+
+	location := source.Location
+	if strings.HasPrefix(location, "webcal://") {
+		location = "https://" + strings.TrimPrefix(location, "webcal://")
+	}
+	resp, err := calendarHTTPClient.Get(location)
+	if err != nil {
+		log.Printf("日历来源 %d 获取失败: %v", source.ID, err)
+		return nil, errCalendarFetch
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		log.Printf("日历来源 %d 获取失败: HTTP %d", source.ID, resp.StatusCode)
+		return nil, errCalendarFetch
+	}
+	return resp.Body, nil
+}
+
+// denyPrivateAddress 拒绝连接回环、内网、链路本地（含云服务器元数据地址）等非公网地址
+func denyPrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("不允许访问的地址: %s", host)
+	}
+	return nil
+}
+
+// sharedAddressSpace 运营商级 NAT 地址段 100.64.0.0/10
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip))
+}
+
+// recordCalendarSync 记录同步时间和错误信息
+func recordCalendarSync(source *StaffCalendarSource, syncErr error) {
+	now := time.Now()
+	message := ""
+	if syncErr != nil {
+		message = syncErr.Error()
+		if runes := []rune(message); len(runes) > 500 {
+			message = string(runes[:500])
+		}
+	}
+	source.LastSyncedAt = &now
+	source.LastError = message
+	database.DB.Model(&StaffCalendarSource{}).Where("id = ?", source.ID).Updates(map[string]interface{}{
+		"last_synced_at": now,
+		"last_error":     message,
+	})
+}
+
+// importBusyBlocks 解析日历并按 UID 增量更新来源的忙碌时段：
+// 新事件创建，时间或标题变化的更新，文件中不再存在、已取消或标记为空闲的事件删除
+func importBusyBlocks(source *StaffCalendarSource, r io.Reader) (*BusyImportResult, error) {
+	loc := MerchantLocation(source.MerchantID)
+	now := time.Now()
+	from := now.AddDate(0, 0, -busyImportPastDays)
+	to := now.AddDate(0, 0, busyImportFutureDays)
+
+	events, err := ical.Parse(r, from, to, loc)
+	if err != nil {
+		return nil, fmt.Errorf("解析日历失败: %v", err)
+	}
+
+	incoming := make(map[string]StaffBusyBlock, len(events))
+	for _, e := range events {
+		if e.Status == "CANCELLED" || e.Transparent {
+			continue
+		}
+		summary := e.Summary
+		if len([]rune(summary)) > 255 {
+			summary = string([]rune(summary)[:255])
+		}
+		block := StaffBusyBlock{
+			MerchantID:   source.MerchantID,
+			StaffID:      source.StaffID,
+			SourceID:     source.ID,
+			UID:          e.UID,
+			RecurrenceID: e.RecurrenceID,
+			StartAt:      e.Start,
+			EndAt:        e.End,
+			AllDay:       e.AllDay,
+			Summary:      summary,
+		}
+		incoming[block.UID+"#"+block.RecurrenceID] = block
+	}
+
+	result := &BusyImportResult{}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var existing []StaffBusyBlock
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("source_id = ?", source.ID).Find(&existing).Error; err != nil {
+			return err
+		}
+
+		var removed []uint
+		for _, old := range existing {
+			key := old.UID + "#" + old.RecurrenceID
+			block, ok := incoming[key]
+			if !ok {
+				removed = append(removed, old.ID)
+				continue
+			}
+			delete(incoming, key)
+
+			if old.StartAt.Equal(block.StartAt) && old.EndAt.Equal(block.EndAt) &&
+				old.AllDay == block.AllDay && old.Summary == block.Summary && old.StaffID == block.StaffID {
+				result.Unchanged++
+				continue
+			}
+			if err := tx.Model(&old).Updates(map[string]interface{}{
+				"staff_id": block.StaffID,
+				"start_at": block.StartAt,
+				"end_at":   block.EndAt,
+				"all_day":  block.AllDay,
+				"summary":  block.Summary,
+			}).Error; err != nil {
+				return err
+			}
+			result.Updated++
+		}
+
+		if len(removed) > 0 {
+			if err := tx.Delete(&StaffBusyBlock{}, removed).Error; err != nil {
+				return err
+			}
+			result.Removed = len(removed)
+		}
+
+		for _, block := range incoming {
+			block := block
+			if err := tx.Create(&block).Error; err != nil {
+				return err
+			}
+			result.Created++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,184 @@
+package models
+
+import (
+	"admin-api/database"
+	"errors"
+	"fmt"
+	"time"
+
+	"admin-api/pkg/ical"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CalendarFeed 日历订阅，每个员工或客户一条。Version 递增后旧的订阅链接失效
+type CalendarFeed struct {
+	ID        uint   `gorm:"primaryKey"`
+	OwnerType string `gorm:"size:20;uniqueIndex:idx_calendar_feed_owner;not null"` // staff, customer
+	OwnerID   uint   `gorm:"uniqueIndex:idx_calendar_feed_owner;not null"`
+	Version   int    `gorm:"default:1;not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// 订阅中保留的历史预约天数，取消的预约在此期间内仍以 STATUS:CANCELLED 输出以便日历删除
+const calendarFeedHistoryDays = 30
+
+// 输出为已取消的预约状态
+var cancelledAppointmentStatuses = []string{
+	AppointmentStatusCancelled, appointmentStatusCanceledLegacy, AppointmentStatusRejected, AppointmentStatusRefunded,
+}
+
+// GetCalendarFeed 获取订阅，不存在时创建
+func GetCalendarFeed(ownerType string, ownerID uint) (*CalendarFeed, error) {
+	if err := database.DB.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&CalendarFeed{OwnerType: ownerType, OwnerID: ownerID, Version: 1}).Error; err != nil {
+		return nil, err
+	}
+	var feed CalendarFeed
+	err := database.DB.Where("owner_type = ? AND owner_id = ?", ownerType, ownerID).First(&feed).Error
+	return &feed, err
+}
+
+// ResetCalendarFeed 重置订阅地址，之前的链接全部失效
+func ResetCalendarFeed(ownerType string, ownerID uint) (*CalendarFeed, error) {
+	feed, err := GetCalendarFeed(ownerType, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if err := database.DB.Model(feed).Update("version", gorm.Expr("version + 1")).Error; err != nil {
+		return nil, err
+	}
+	return GetCalendarFeed(ownerType, ownerID)
+}
+
+// FindCalendarFeed 查找已有的订阅，用于校验订阅链接
+func FindCalendarFeed(ownerType string, ownerID uint) (*CalendarFeed, error) {
+	var feed CalendarFeed
+	err := database.DB.Where("owner_type = ? AND owner_id = ?", ownerType, ownerID).First(&feed).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("订阅不存在")
+	}
+	return &feed, err
+}
+
+// BuildStaffCalendar 生成员工的预约日历，包含近30天及以后的全部预约
+func BuildStaffCalendar(staffID uint) (*ical.Calendar, error) {
+	var staff Staff
+	if err := database.DB.First(&staff, staffID).Error; err != nil {
+		return nil, err
+	}
+
+	from := time.Now().AddDate(0, 0, -calendarFeedHistoryDays).Format("2006-01-02")
+	var appointments []Appointment
+	if err := database.DB.Preload("User").Preload("Service").Preload("Merchant").
+		Where("staff_id = ? AND appointment_date >= ?", staffID, from).
+		Order("appointment_date ASC, start_time ASC").
+		Find(&appointments).Error; err != nil {
+		return nil, err
+	}
+
+	return buildAppointmentCalendar(staff.Name+" 的预约", appointments, func(a *Appointment) (string, string) {
+		customer := a.User.Nickname
+		if a.User.Phone != "" {
+			customer += " " + a.User.Phone
+		}
+		return fmt.Sprintf("%s - %s", a.Service.Name, customer),
+			fmt.Sprintf("订单号: %s\n客户: %s\n备注: %s", a.OrderNo, customer, a.Remark)
+	})
+}
+
+// BuildCustomerCalendar 生成客户的预约日历，包含今天及以后的预约
+func BuildCustomerCalendar(userID uint) (*ical.Calendar, error) {
+	// 按最早的时区取“今天”，保证各时区商家的当天预约都在内
+	from := time.Now().AddDate(0, 0, -1).Format("2006-01-02")
+	var appointments []Appointment
+	if err := database.DB.Preload("Service").Preload("Merchant").Preload("Staff").
+		Where("user_id = ? AND appointment_date >= ?", userID, from).
+		Order("appointment_date ASC, start_time ASC").
+		Find(&appointments).Error; err != nil {
+		return nil, err
+	}
+
+	return buildAppointmentCalendar("我的预约", appointments, func(a *Appointment) (string, string) {
+		return fmt.Sprintf("%s @ %s", a.Service.Name, a.Merchant.Name),
+			fmt.Sprintf("订单号: %s\n服务人员: %s\n商家电话: %s", a.OrderNo, a.Staff.Name, a.Merchant.Phone)
+	})
+}
+
+// buildAppointmentCalendar 将预约转换为日历事件，describe 返回事件标题和描述
+func buildAppointmentCalendar(name string, appointments []Appointment,
+	describe func(a *Appointment) (string, string)) (*ical.Calendar, error) {
+
+	ids := make([]uint, 0, len(appointments))
+	for _, a := range appointments {
+		ids = append(ids, a.ID)
+	}
+	sequences, err := appointmentRescheduleCounts(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	cal := &ical.Calendar{Name: name, Events: make([]ical.Event, 0, len(appointments))}
+	for i := range appointments {
+		a := &appointments[i]
+		loc := a.Merchant.Location()
+		summary, description := describe(a)
+
+		status := ical.StatusConfirmed
+		sequence := sequences[a.ID]
+		switch {
+		case containsString(cancelledAppointmentStatuses, a.Status):
+			status = ical.StatusCancelled
+			sequence++
+		case a.Status == AppointmentStatusPending:
+			status = ical.StatusTentative
+		}
+
+		cal.Events = append(cal.Events, ical.Event{
+			UID:          fmt.Sprintf("appointment-%d-%s@admin-api", a.ID, a.OrderNo),
+			Sequence:     sequence,
+			Start:        wallClockAt(a.AppointmentDate, a.StartTime, loc),
+			End:          wallClockAt(a.AppointmentDate, a.EndTime, loc),
+			Summary:      summary,
+			Description:  description,
+			Location:     a.Merchant.Name + " " + a.Merchant.Address,
+			Status:       status,
+			LastModified: a.UpdatedAt,
+		})
+	}
+	return cal, nil
+}
+
+// appointmentRescheduleCounts 统计各预约的改约次数（含商家改约），作为日历事件的 SEQUENCE
+func appointmentRescheduleCounts(appointmentIDs []uint) (map[uint]int, error) {
+	counts := make(map[uint]int)
+	if len(appointmentIDs) == 0 {
+		return counts, nil
+	}
+	var rows []struct {
+		AppointmentID uint
+		Total         int
+	}
+	if err := database.DB.Model(&AppointmentReschedule{}).
+		Select("appointment_id, COUNT(*) AS total").
+		Where("appointment_id IN (?)", appointmentIDs).
+		Group("appointment_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		counts[r.AppointmentID] = r.Total
+	}
+	return counts, nil
+}
+
+func containsString(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,315 @@
+package models
+
+import (
+	"admin-api/database"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrCancellationFeeNotAccepted 取消需扣除违约金但客户尚未确认
+var ErrCancellationFeeNotAccepted = errors.New("取消需扣除违约金，请确认后再取消")
+
+// CancellationQuote 按商家取消政策计算的取消结果，客户确认取消前展示
+type CancellationQuote struct {
+	AppointmentID   uint   `json:"appointment_id"`
+	Cancellable     bool   `json:"cancellable"`
+	Reason          string `json:"reason,omitempty"`  // 不能取消的原因
+	Paid            bool   `json:"paid"`              // 是否已在线支付
+	PaidAmount      int    `json:"paid_amount"`       // 已支付金额(分)
+	Late            bool   `json:"late"`              // 是否已过免费取消时间
+	Fee             int    `json:"fee"`               // 违约金(分)
+	RefundAmount    int    `json:"refund_amount"`     // 取消后退还的金额(分)
+	FreeCancelUntil string `json:"free_cancel_until"` // 免费取消截止时间，RFC3339
+	Policy          string `json:"policy"`            // 取消政策说明
+}
+
+func validateCancelFee(feeType string, fee int) error {
+	switch feeType {
+	case CancelFeePercent:
+		if fee < 0 || fee > 100 {
+			return errors.New("违约金比例须在0到100之间")
+		}
+	case CancelFeeFixed:
+		if fee < 0 {
+			return errors.New("违约金不能为负数")
+		}
+	default:
+		return errors.New("无效的违约金计算方式")
+	}
+	return nil
+}
+
+// cancelFee 计算违约金，不超过已支付金额
+func cancelFee(feeType string, fee, amount int) int {
+	charged := fee
+	if feeType == CancelFeePercent {
+		charged = amount * fee / 100
+	}
+	if charged > amount {
+		return amount
+	}
+	return charged
+}
+
+func describeCancelFee(feeType string, fee int) string {
+	if fee == 0 {
+		return "免费"
+	}
+	if feeType == CancelFeePercent {
+		return fmt.Sprintf("收取已付金额的%d%%", fee)
+	}
+	return fmt.Sprintf("收取%.2f元", float64(fee)/100)
+}
+
+// CancellationPolicyText 商家取消政策说明
+func (s *MerchantSetting) CancellationPolicyText() string {
+	return fmt.Sprintf("开始前%d小时以上取消免费；之后取消%s；未到店%s。违约金从已支付金额中扣除，其余原路退回",
+		s.FreeCancelHours, describeCancelFee(s.LateCancelFeeType, s.LateCancelFee),
+		describeCancelFee(s.NoShowFeeType, s.NoShowFee))
+}
+
+// appointmentSucceededPayment 查询预约单独支付成功的支付单，没有时返回 nil
+func appointmentSucceededPayment(tx *gorm.DB, appointmentID uint) (*Payment, error) {
+	var payments []Payment
+	if err := tx.Where("appointment_id = ? AND status = ?", appointmentID, PaymentStatusSucceeded).
+		Order("id DESC").Limit(1).
+		Find(&payments).Error; err != nil {
+		return nil, err
+	}
+	if len(payments) == 0 {
+		return nil, nil
+	}
+	return &payments[0], nil
+}
+
+// quoteCancellationTx 按商家取消政策计算客户取消预约的结果，已支付时同时返回支付单
+func quoteCancellationTx(tx *gorm.DB, appointment *Appointment, now time.Time) (*CancellationQuote, *Payment, error) {
+	setting, err := getMerchantSetting(tx, appointment.MerchantID)
+	if err != nil {
+		return nil, nil, err
+	}
+	loc := merchantLocation(tx, appointment.MerchantID)
+	start := appointmentStartAt(appointment, loc)
+	freeUntil := start.Add(-time.Duration(setting.FreeCancelHours) * time.Hour)
+
+	quote := &CancellationQuote{
+		AppointmentID:   appointment.ID,
+		FreeCancelUntil: freeUntil.In(loc).Format(time.RFC3339),
+		Policy:          setting.CancellationPolicyText(),
+	}
+
+	status := NormalizeAppointmentStatus(appointment.Status)
+	switch {
+	case appointment.OrderID != 0:
+		quote.Reason = "该预约属于组合订单，请取消整个订单"
+	case !containsString(activeAppointmentStatuses, status):
+		quote.Reason = "当前状态不允许取消"
+	case appointment.ActualStartAt != nil:
+		quote.Reason = "已签到的预约不能取消"
+	case !now.Before(start):
+		quote.Reason = "预约已开始，无法取消"
+	}
+	if quote.Reason != "" {
+		return quote, nil, nil
+	}
+
+	var payment *Payment
+	if status == AppointmentStatusPaid {
+		payment, err = appointmentSucceededPayment(tx, appointment.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if payment == nil {
+			quote.Reason = "未找到支付记录，请联系商家取消"
+			return quote, nil, nil
+		}
+		var refunding int64
+		if err := tx.Model(&Refund{}).
+			Where("payment_id = ? AND status IN (?)", payment.ID,
+				[]string{RefundStatusProcessing, RefundStatusSuccess}).
+			Count(&refunding).Error; err != nil {
+			return nil, nil, err
+		}
+		if refunding > 0 {
+			quote.Reason = "该预约已在退款中"
+			return quote, nil, nil
+		}
+		quote.Paid = true
+		quote.PaidAmount = payment.Amount
+	} else {
+		// 支付中取消会导致支付成功后无法关联预约
+		var paying int64
+		if err := tx.Model(&Payment{}).
+			Where("appointment_id = ? AND status = ?", appointment.ID, PaymentStatusPending).
+			Count(&paying).Error; err != nil {
+			return nil, nil, err
+		}
+		if paying > 0 {
+			quote.Reason = "支付处理中，请稍后再取消"
+			return quote, nil, nil
+		}
+	}
+
+	quote.Cancellable = true
+	quote.Late = now.After(freeUntil)
+	// 到店支付的预约没有可扣除的金额，晚取消不收取违约金
+	if quote.Late && quote.Paid {
+		quote.Fee = cancelFee(setting.LateCancelFeeType, setting.LateCancelFee, quote.PaidAmount)
+	}
+	quote.RefundAmount = quote.PaidAmount - quote.Fee
+	return quote, payment, nil
+}
+
+// QuoteUserCancellation 预览客户取消预约的结果，不修改数据
+func QuoteUserCancellation(userID, appointmentID uint) (*CancellationQuote, error) {
+	var appointment Appointment
+	if err := database.DB.First(&appointment, appointmentID).Error; err != nil {
+		return nil, errors.New("预约不存在")
+	}
+	if appointment.UserID != userID {
+		return nil, errors.New("无权操作此预约")
+	}
+	quote, _, err := quoteCancellationTx(database.DB, &appointment, time.Now())
+	return quote, err
+}
+
+// CancelUserAppointment 客户按商家取消政策取消预约。未支付的预约直接取消并恢复优惠券；
+// 已支付的预约扣除违约金后创建退款记录，由调用方发起退款，退款完成后预约变为已退款；
+// 违约金等于已支付金额时直接取消，不退款。需扣除违约金而 acceptFee 为 false 时
+// 返回 ErrCancellationFeeNotAccepted 和计算结果，不做修改
+func CancelUserAppointment(userID, appointmentID uint, acceptFee bool) (*CancellationQuote, *Refund, error) {
+	tx := database.DB.Begin()
+
+	// 直接查询预约信息并加锁，避免并发取消重复释放名额或重复退款
+	appointment, err := lockAppointment(tx, appointmentID)
+	if err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+	if appointment.UserID != userID {
+		tx.Rollback()
+		return nil, nil, errors.New("无权操作此预约")
+	}
+
+	quote, payment, err := quoteCancellationTx(tx, appointment, time.Now())
+	if err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+	if !quote.Cancellable {
+		tx.Rollback()
+		return quote, nil, errors.New(quote.Reason)
+	}
+	if quote.Fee > 0 && !acceptFee {
+		tx.Rollback()
+		return quote, nil, ErrCancellationFeeNotAccepted
+	}
+
+	var refund *Refund
+	switch {
+	case !quote.Paid:
+		err = cancelUnpaidAppointmentTx(tx, appointment, userID)
+	case quote.RefundAmount == 0:
+		err = TransitionAppointmentTx(tx, appointment, AppointmentStatusCancelled, ActorCustomer, userID,
+			fmt.Sprintf("客户取消，扣除违约金%.2f元，不退款", float64(quote.Fee)/100), nil)
+	default:
+		reason := "客户取消"
+		if quote.Fee > 0 {
+			reason = fmt.Sprintf("客户取消，扣除违约金%.2f元", float64(quote.Fee)/100)
+		}
+		refund, err = createRefundTx(tx, appointment, payment, quote.RefundAmount, reason)
+	}
+	if err != nil {
+		tx.Rollback()
+		return quote, nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return quote, nil, err
+	}
+	return quote, refund, nil
+}
+
+// cancelUserAppointmentTx 在调用方的事务中取消用户未支付的预约，出错时由调用方回滚。
+// 已支付的预约涉及退款，需单独取消
+func cancelUserAppointmentTx(tx *gorm.DB, userID, appointmentID uint) error {
+	appointment, err := lockAppointment(tx, appointmentID)
+	if err != nil {
+		return err
+	}
+	if appointment.UserID != userID {
+		return errors.New("无权操作此预约")
+	}
+
+	quote, _, err := quoteCancellationTx(tx, appointment, time.Now())
+	if err != nil {
+		return err
+	}
+	if !quote.Cancellable {
+		return errors.New(quote.Reason)
+	}
+	if quote.Paid {
+		return errors.New("已支付的预约请单独取消")
+	}
+	return cancelUnpaidAppointmentTx(tx, appointment, userID)
+}
+
+// cancelUnpaidAppointmentTx 取消未支付的预约，释放时间段并恢复优惠券
+func cancelUnpaidAppointmentTx(tx *gorm.DB, appointment *Appointment, userID uint) error {
+	if err := TransitionAppointmentTx(tx, appointment, AppointmentStatusCancelled, ActorCustomer, userID,
+		"客户取消", nil); err != nil {
+		return err
+	}
+	return restoreAppointmentCoupon(tx, appointment.ID)
+}
+
+// CreateNoShowRefund 已支付的预约标记为未到店后，按商家政策扣除违约金，
+// 有剩余金额时创建退款记录并返回，由调用方发起退款；不需要退款时返回 nil
+func CreateNoShowRefund(merchantID, appointmentID uint) (*Refund, error) {
+	tx := database.DB.Begin()
+
+	appointment, err := lockAppointment(tx, appointmentID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if appointment.MerchantID != merchantID {
+		tx.Rollback()
+		return nil, errors.New("预约不存在")
+	}
+	if appointment.Status != AppointmentStatusNoShow {
+		tx.Rollback()
+		return nil, errors.New("预约未标记为未到店")
+	}
+
+	payment, err := appointmentSucceededPayment(tx, appointment.ID)
+	if err != nil || payment == nil {
+		tx.Rollback()
+		return nil, err
+	}
+	setting, err := getMerchantSetting(tx, merchantID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	fee := cancelFee(setting.NoShowFeeType, setting.NoShowFee, payment.Amount)
+	if fee >= payment.Amount {
+		tx.Rollback()
+		return nil, nil
+	}
+
+	refund, err := createRefundTx(tx, appointment, payment, payment.Amount-fee,
+		fmt.Sprintf("未到店，扣除违约金%.2f元", float64(fee)/100))
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
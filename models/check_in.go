@@ -0,0 +1,155 @@
+package models
+
+import (
+	"admin-api/database"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 可以签到的预约状态，到店支付的预约确认后即可签到
+var checkInStatuses = []string{AppointmentStatusConfirmed, AppointmentStatusPaid}
+
+func newCheckInToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GetCheckInToken 获取用户预约的签到码，首次获取时生成。已签到或状态不允许签到的预约不返回签到码
+func GetCheckInToken(userID, appointmentID uint) (*Appointment, error) {
+	tx := database.DB.Begin()
+
+	appointment, err := lockAppointment(tx, appointmentID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if appointment.UserID != userID {
+		tx.Rollback()
+		return nil, errors.New("预约不存在")
+	}
+	if appointment.ActualStartAt != nil {
+		tx.Rollback()
+		return nil, errors.New("该预约已签到")
+	}
+	if !containsString(checkInStatuses, appointment.Status) {
+		tx.Rollback()
+		return nil, errors.New("预约确认后才能获取签到码")
+	}
+
+	if appointment.CheckInToken == "" {
+		token, err := newCheckInToken()
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if err := tx.Model(appointment).Update("check_in_token", token).Error; err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		appointment.CheckInToken = token
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return appointment, nil
+}
+
+// CheckInAppointment 商家扫描签到码登记客户到店，记录实际开始时间。
+// 签到码须属于本店、为商家时区当天的预约且尚未签到
+func CheckInAppointment(merchantID uint, token string) (*Appointment, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, errors.New("签到码无效")
+	}
+
+	tx := database.DB.Begin()
+
+	var appointment Appointment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("check_in_token = ?", token).
+		First(&appointment).Error; err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("签到码无效")
+		}
+		return nil, err
+	}
+	if appointment.MerchantID != merchantID {
+		tx.Rollback()
+		return nil, errors.New("签到码不属于本店的预约")
+	}
+	if appointment.ActualStartAt != nil {
+		tx.Rollback()
+		return nil, errors.New("该预约已签到")
+	}
+	if !containsString(checkInStatuses, appointment.Status) {
+		tx.Rollback()
+		return nil, errors.New("当前状态不允许签到")
+	}
+	now := time.Now().In(merchantLocation(tx, merchantID))
+	if appointment.AppointmentDate.Format("2006-01-02") != now.Format("2006-01-02") {
+		tx.Rollback()
+		return nil, errors.New("签到码不是今天的预约")
+	}
+
+	if err := tx.Model(&appointment).Update("actual_start_at", now).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	appointment.ActualStartAt = &now
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return &appointment, nil
+}
+
+// CheckOutAppointment 服务结束签退，记录实际结束时间并将预约标记为已完成
+func CheckOutAppointment(merchantID, appointmentID uint, remark string) (*Appointment, error) {
+	tx := database.DB.Begin()
+
+	appointment, err := lockAppointment(tx, appointmentID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if appointment.MerchantID != merchantID {
+		tx.Rollback()
+		return nil, errors.New("预约不存在")
+	}
+	if appointment.ActualStartAt == nil {
+		tx.Rollback()
+		return nil, errors.New("该预约尚未签到")
+	}
+	if appointment.ActualEndAt != nil {
+		tx.Rollback()
+		return nil, errors.New("该预约已签退")
+	}
+
+	now := time.Now()
+	reason := "服务完成签退"
+	if remark != "" {
+		reason += ": " + remark
+	}
+	if err := TransitionAppointmentTx(tx, appointment, AppointmentStatusCompleted, ActorMerchant, merchantID, reason,
+		map[string]interface{}{"actual_end_at": now}); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	appointment.ActualEndAt = &now
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return appointment, nil
+}
@@ -34,6 +34,7 @@ type UserCoupon struct {
 	ValidTo       time.Time `gorm:"type:date;not null"`
 	UsedAt        time.Time
 	AppointmentID *uint `gorm:"index"`
+	OrderID       *uint `gorm:"index"` // 用于组合订单时关联订单
 	CreatedAt     time.Time
 
 	Template CouponTemplate `gorm:"foreignKey:TemplateID"`
@@ -76,7 +77,7 @@ func ApplyCoupon(tx *gorm.DB, userID, couponID uint, originalPrice int) (*Coupon
 	// 4. 验证使用条件
 	template := userCoupon.Template
 	if originalPrice < template.MinAmount {
-		return nil, fmt.Errorf("未达到最低消费金额 %.2f", template.MinAmount)
+		return nil, fmt.Errorf("未达到最低消费金额 %.2f", float64(template.MinAmount)/100)
 	}
 	//if template.ServiceType != "" && template.ServiceType != "any" {
 	//	// 这里需要根据实际服务类型验证
@@ -7,7 +7,7 @@ import (
 	"gorm.io/gorm"
 )
 
-func CreateMerchant(name, address, phone, description, logo, businessHour string) (*Merchant, error) {
+func CreateMerchant(name, address, phone, description, logo, businessHour, timezone string) (*Merchant, error) {
 	// 基本字段验证
 	if name == "" {
 		return nil, errors.New("商家名称不能为空")
@@ -27,6 +27,7 @@ func CreateMerchant(name, address, phone, description, logo, businessHour string
 		Description:   description,
 		Logo:          logo,
 		BusinessHours: businessHour,
+		Timezone:      timezone,
 	}
 
 	// 保存到数据库
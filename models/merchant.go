@@ -4,6 +4,7 @@ import (
 	"admin-api/database"
 	"database/sql/driver"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -18,6 +19,7 @@ type Merchant struct {
 	Description   string `gorm:"type:text"`
 	Logo          string `gorm:"size:255"`
 	BusinessHours string `gorm:"size:100"`
+	Timezone      string `gorm:"size:50;default:'Asia/Shanghai';not null"` // IANA时区，如 Asia/Shanghai
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 }
@@ -64,7 +66,7 @@ func GetMerchantAppointments(merchantID uint, status string, date *time.Time) ([
 		Where("merchant_id = ?", merchantID)
 
 	if status != "" {
-		query = query.Where("status = ?", status)
+		query = query.Where("status IN (?)", appointmentStatusValues(status))
 	}
 
 	if date != nil {
@@ -75,19 +77,50 @@ func GetMerchantAppointments(merchantID uint, status string, date *time.Time) ([
 	return appointments, err
 }
 
-func UpdateAppointmentStatus(appointmentID uint, status, reason string) error {
-	return database.DB.Model(&Appointment{}).
-		Where("id = ?", appointmentID).
-		Updates(map[string]interface{}{
-			"status": status,
-			"remark": gorm.Expr("CONCAT(remark, ?)", " | 商家备注: "+reason),
-		}).Error
+// GetMerchantAppointmentDetail 获取商家的预约详情
+func GetMerchantAppointmentDetail(merchantID, appointmentID uint) (*Appointment, error) {
+	var appointment Appointment
+	err := database.DB.Preload("User").Preload("Service").Preload("Staff").
+		Where("id = ? AND merchant_id = ?", appointmentID, merchantID).
+		First(&appointment).Error
+	return &appointment, err
 }
 
-func ReleaseTimeSlot(timeSlotID uint) error {
-	return database.DB.Model(&TimeSlot{}).
-		Where("id = ?", timeSlotID).
-		Update("is_available", true).Error
+// UpdateAppointmentStatus 商家变更预约状态，按状态机校验并记录变更。
+// 预约行加锁后重新校验状态，取消或拒绝时在同一事务中释放时间段名额并恢复优惠券，避免并发请求重复释放
+func UpdateAppointmentStatus(merchantID, appointmentID uint, status, reason string) error {
+	tx := database.DB.Begin()
+
+	appointment, err := lockAppointment(tx, appointmentID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if appointment.MerchantID != merchantID {
+		tx.Rollback()
+		return errors.New("预约不存在")
+	}
+
+	extra := map[string]interface{}{
+		"remark": gorm.Expr("CONCAT(remark, ?)", " | 商家备注: "+reason),
+	}
+	if err := TransitionAppointmentTx(tx, appointment, status, ActorMerchant, merchantID, reason, extra); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if status == AppointmentStatusCancelled || status == AppointmentStatusRejected {
+		if err := restoreAppointmentCoupon(tx, appointment.ID); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := syncOrderAfterLineCancel(tx, appointment.OrderID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit().Error
 }
 
 func GetRecommendedMerchants() ([]Merchant, error) {
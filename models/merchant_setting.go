@@ -0,0 +1,166 @@
+package models
+
+import (
+	"admin-api/database"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 候补放位方式
+const (
+	WaitlistModeHold     = "hold"      // 为候补用户保留名额，限时内确认预约
+	WaitlistModeAutoBook = "auto_book" // 直接为候补用户创建预约
+)
+
+// 不指定员工预约时的分配方式
+const (
+	StaffAssignRoundRobin   = "round_robin"   // 轮流分配
+	StaffAssignLeastBooked  = "least_booked"  // 当天预约最少的员工
+	StaffAssignHighestRated = "highest_rated" // 评分最高的员工
+)
+
+// 取消违约金的计算方式
+const (
+	CancelFeePercent = "percent" // 按已支付金额的百分比
+	CancelFeeFixed   = "fixed"   // 固定金额（分）
+)
+
+// MerchantSetting 商家预约相关配置，未配置的商家使用默认值
+type MerchantSetting struct {
+	ID                  uint   `gorm:"primaryKey" json:"id"`
+	MerchantID          uint   `gorm:"uniqueIndex;not null" json:"merchant_id"`
+	WaitlistMode        string `gorm:"size:20;default:'hold';not null" json:"waitlist_mode"`
+	WaitlistHoldMinutes int    `gorm:"default:30;not null" json:"waitlist_hold_minutes"` // 候补保留名额的时长
+	// 客户改约规则，商家改约不受限制
+	RescheduleMinHours  int    `gorm:"default:2;not null" json:"reschedule_min_hours"`                       // 距开始至少提前多少小时可改约
+	RescheduleMaxTimes  int    `gorm:"default:2;not null" json:"reschedule_max_times"`                       // 每个预约最多改约次数，0表示不允许改约
+	StaffAssignStrategy string `gorm:"size:20;default:'least_booked';not null" json:"staff_assign_strategy"` // 不指定员工预约时的分配方式
+	// 超时处理，由后台任务执行
+	PaymentTimeoutMinutes int        `gorm:"default:15;not null" json:"payment_timeout_minutes"` // 待支付的支付单超过该时长自动关闭
+	UnpaidCancelMinutes   int        `gorm:"default:120;not null" json:"unpaid_cancel_minutes"`  // 确认后超过该时长未支付的预约自动取消，0表示不取消（到店支付）
+	AutoCompleteMinutes   int        `gorm:"default:30;not null" json:"auto_complete_minutes"`   // 结束后超过该时长，开启到店签到时未签到的预约标记为未到店，其余标记为已完成，0表示不处理
+	AutoCompleteSince     *time.Time `json:"auto_complete_since"`                                // 开启自动完成的时间，只处理此后结束的预约
+	// 到店签到，未开启的商家不因未签到标记未到店
+	CheckInRequired      bool       `gorm:"default:false;not null" json:"check_in_required"` // 开启后结束时仍未签到的预约标记为未到店
+	CheckInRequiredSince *time.Time `json:"check_in_required_since"`                         // 开启到店签到的时间，此前开始的预约不标记为未到店
+	// 取消政策，违约金从已支付金额中扣除，到店支付的预约不收取
+	FreeCancelHours   int       `gorm:"default:24;not null" json:"free_cancel_hours"`                   // 距开始超过该小时数取消免费，全额退款
+	LateCancelFeeType string    `gorm:"size:10;default:'percent';not null" json:"late_cancel_fee_type"` // 晚取消违约金计算方式：percent, fixed
+	LateCancelFee     int       `gorm:"default:50;not null" json:"late_cancel_fee"`                     // 晚取消违约金，按比例时为百分比，固定金额时单位为分
+	NoShowFeeType     string    `gorm:"size:10;default:'percent';not null" json:"no_show_fee_type"`     // 未到店违约金计算方式：percent, fixed
+	NoShowFee         int       `gorm:"default:100;not null" json:"no_show_fee"`                        // 未到店违约金，扣除后的余额退还给客户
+	PaymentProvider   string    `gorm:"size:20;default:'';not null" json:"payment_provider"`            // 支付渠道，为空时使用部署默认的渠道
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+func defaultMerchantSetting(merchantID uint) *MerchantSetting {
+	return &MerchantSetting{
+		MerchantID:          merchantID,
+		WaitlistMode:        WaitlistModeHold,
+		WaitlistHoldMinutes: 30,
+		RescheduleMinHours:  2,
+		RescheduleMaxTimes:  2,
+		StaffAssignStrategy: StaffAssignLeastBooked,
+
+		PaymentTimeoutMinutes: 15,
+		UnpaidCancelMinutes:   120,
+		AutoCompleteMinutes:   30,
+
+		FreeCancelHours:   24,
+		LateCancelFeeType: CancelFeePercent,
+		LateCancelFee:     50,
+		NoShowFeeType:     CancelFeePercent,
+		NoShowFee:         100,
+	}
+}
+
+// ValidateMerchantSetting 校验商家配置
+func ValidateMerchantSetting(s *MerchantSetting) error {
+	switch s.WaitlistMode {
+	case WaitlistModeHold, WaitlistModeAutoBook:
+	default:
+		return errors.New("无效的候补放位方式")
+	}
+	if s.WaitlistHoldMinutes < 1 {
+		return errors.New("候补保留时长必须大于0")
+	}
+	if s.RescheduleMinHours < 0 {
+		return errors.New("改约提前时间不能为负数")
+	}
+	if s.RescheduleMaxTimes < 0 {
+		return errors.New("改约次数不能为负数")
+	}
+	switch s.StaffAssignStrategy {
+	case StaffAssignRoundRobin, StaffAssignLeastBooked, StaffAssignHighestRated:
+	default:
+		return errors.New("无效的员工分配方式")
+	}
+	if s.PaymentTimeoutMinutes < 1 {
+		return errors.New("支付超时时长必须大于0")
+	}
+	if s.UnpaidCancelMinutes < 0 || s.AutoCompleteMinutes < 0 {
+		return errors.New("超时时长不能为负数")
+	}
+	if s.FreeCancelHours < 0 {
+		return errors.New("免费取消时间不能为负数")
+	}
+	if err := validateCancelFee(s.LateCancelFeeType, s.LateCancelFee); err != nil {
+		return fmt.Errorf("晚取消%v", err)
+	}
+	if err := validateCancelFee(s.NoShowFeeType, s.NoShowFee); err != nil {
+		return fmt.Errorf("未到店%v", err)
+	}
+	return nil
+}
+
+// RecordEnabledAt 记录自动完成和到店签到的开启时间，后台任务只处理开启后的预约。prev 为修改前的配置
+func (s *MerchantSetting) RecordEnabledAt(prev *MerchantSetting, now time.Time) {
+	if s.AutoCompleteMinutes == 0 {
+		s.AutoCompleteSince = nil
+	} else if prev.AutoCompleteMinutes == 0 || s.AutoCompleteSince == nil {
+		s.AutoCompleteSince = &now
+	}
+	if !s.CheckInRequired {
+		s.CheckInRequiredSince = nil
+	} else if !prev.CheckInRequired || s.CheckInRequiredSince == nil {
+		s.CheckInRequiredSince = &now
+	}
+}
+
+// GetMerchantSetting 获取商家配置，没有记录时返回默认配置
+func GetMerchantSetting(merchantID uint) (*MerchantSetting, error) {
+	return getMerchantSetting(database.DB, merchantID)
+}
+
+func getMerchantSetting(db *gorm.DB, merchantID uint) (*MerchantSetting, error) {
+	var setting MerchantSetting
+	err := db.Where("merchant_id = ?", merchantID).First(&setting).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return defaultMerchantSetting(merchantID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &setting, nil
+}
+
+// SaveMerchantSetting 保存商家配置，不存在时创建
+func SaveMerchantSetting(setting *MerchantSetting) error {
+	if setting.ID == 0 {
+		// 带默认值的字段为零值（如 auto_complete_minutes 为 0）时 Create 会改写为默认值，创建后按原值再保存一次
+		return database.DB.Transaction(func(tx *gorm.DB) error {
+			values := *setting
+			if err := tx.Create(setting).Error; err != nil {
+				return err
+			}
+			values.ID, values.CreatedAt = setting.ID, setting.CreatedAt
+			*setting = values
+			return tx.Save(setting).Error
+		})
+	}
+	return database.DB.Save(setting).Error
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"admin-api/database"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestUpdateAppointmentStatusRestoresCoupon 商家取消或拒绝预约时释放时间段并恢复优惠券
+func TestUpdateAppointmentStatusRestoresCoupon(t *testing.T) {
+	setupBookingDB(t)
+
+	tests := []struct {
+		name       string
+		from, to   string
+		wantCoupon string
+		wantBooked []int
+	}{
+		{"商家取消已确认的预约", AppointmentStatusConfirmed, AppointmentStatusCancelled, "unused", []int{0, 0}},
+		{"商家拒绝待确认的预约", AppointmentStatusPending, AppointmentStatusRejected, "unused", []int{0, 0}},
+		{"商家确认预约不影响优惠券", AppointmentStatusPending, AppointmentStatusConfirmed, "used", []int{1, 1}},
+		{"商家标记完成不影响优惠券", AppointmentStatusConfirmed, AppointmentStatusCompleted, "used", []int{1, 1}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newBookingFixture(t, 60)
+			slots := f.createSlots(t, slotSpec{1, 1}, slotSpec{1, 1})
+			appointment := f.bookAppointment(t, 1, slots)
+			if err := database.DB.Model(appointment).Update("status", tt.from).Error; err != nil {
+				t.Fatal(err)
+			}
+			coupon := UserCoupon{
+				UserID: appointment.UserID, TemplateID: 1, CouponCode: fmt.Sprintf("TEST%d", i), Status: "used",
+				ValidFrom: f.date, ValidTo: f.date, UsedAt: time.Now(), AppointmentID: &appointment.ID,
+			}
+			mustCreate(t, &coupon)
+
+			if err := UpdateAppointmentStatus(f.merchant.ID, appointment.ID, tt.to, "测试"); err != nil {
+				t.Fatalf("UpdateAppointmentStatus err = %v", err)
+			}
+			if booked := bookedCounts(t, slots); !equalInts(booked, tt.wantBooked) {
+				t.Fatalf("已占用名额 = %v, 期望 %v", booked, tt.wantBooked)
+			}
+			var latest UserCoupon
+			if err := database.DB.First(&latest, coupon.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if latest.Status != tt.wantCoupon {
+				t.Fatalf("优惠券状态 = %s, 期望 %s", latest.Status, tt.wantCoupon)
+			}
+			if restored := latest.AppointmentID == nil; restored != (tt.wantCoupon == "unused") {
+				t.Fatalf("优惠券关联的预约 = %v", latest.AppointmentID)
+			}
+		})
+	}
+}
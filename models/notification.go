@@ -0,0 +1,58 @@
+package models
+
+import (
+	"admin-api/database"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 用户通知类型
+const (
+	NotificationTypeWaitlistHold    = "waitlist_hold"    // 候补获得保留名额
+	NotificationTypeWaitlistBooked  = "waitlist_booked"  // 候补已自动预约
+	NotificationTypeWaitlistExpired = "waitlist_expired" // 候补保留名额已过期
+	NotificationTypeRescheduled     = "rescheduled"      // 商家调整了预约时间
+	NotificationTypeExpired         = "expired"          // 预约超时未支付或未确认，已自动取消
+	NotificationTypeRefundRequest   = "refund_request"   // 商家处理了退款申请
+)
+
+// Notification 站内通知
+type Notification struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"index;not null" json:"user_id"`
+	Type      string    `gorm:"size:30;not null" json:"type"`
+	Title     string    `gorm:"size:100;not null" json:"title"`
+	Content   string    `gorm:"size:500" json:"content"`
+	IsRead    bool      `gorm:"default:false;not null" json:"is_read"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// notifyUser 在调用方的事务中给用户发送站内通知
+func notifyUser(tx *gorm.DB, userID uint, notifyType, title, content string) error {
+	return tx.Create(&Notification{
+		UserID:  userID,
+		Type:    notifyType,
+		Title:   title,
+		Content: content,
+	}).Error
+}
+
+func GetUserNotifications(userID uint, unreadOnly bool) ([]Notification, error) {
+	var notifications []Notification
+	query := database.DB.Where("user_id = ?", userID)
+	if unreadOnly {
+		query = query.Where("is_read = ?", false)
+	}
+	err := query.Order("created_at DESC").Limit(100).Find(&notifications).Error
+	return notifications, err
+}
+
+func MarkNotificationRead(userID, notificationID uint) error {
+	var notification Notification
+	if err := database.DB.Where("id = ? AND user_id = ?", notificationID, userID).
+		First(&notification).Error; err != nil {
+		return err
+	}
+	return database.DB.Model(&notification).Update("is_read", true).Error
+}
@@ -31,7 +31,9 @@ type Payment struct {
 	CustomerID    uint `gorm:"index" json:"customerId"`    // 用户ID
 	MerchantID    uint `gorm:"index" json:"merchantId"`    // 商家ID
 	AppointmentID uint `gorm:"index" json:"appointmentId"` // 关联预约ID
+	OrderID       uint `gorm:"index" json:"orderId"`       // 关联组合订单ID
 
+	Provider      string `gorm:"size:20" json:"provider"`               // 支付渠道，为空的历史记录按订单号前缀推断
 	OutTradeNo    string `gorm:"size:64;uniqueIndex" json:"outTradeNo"` // 商户订单号
 	TransactionID string `gorm:"size:64" json:"transactionId"`          // 微信交易号
 
@@ -89,6 +91,30 @@ func GetPaymentByOutTradeNo(outTradeNo string) (*Payment, error) {
 	return &payment, err
 }
 
+// MarkPaymentSucceeded 将待支付的支付单标记为支付成功，支付单已不是待支付状态时返回 false
+func MarkPaymentSucceeded(paymentID uint, transactionID, rawNotify string) (bool, error) {
+	result := database.DB.Model(&Payment{}).
+		Where("id = ? AND status = ?", paymentID, PaymentStatusPending).
+		Updates(map[string]interface{}{
+			"status":         PaymentStatusSucceeded,
+			"paid_at":        time.Now(),
+			"transaction_id": transactionID,
+			"raw_notify":     rawNotify,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// MarkPaymentFailed 将待支付的支付单标记为支付失败，支付单已不是待支付状态时返回 false
+func MarkPaymentFailed(paymentID uint, reason string) (bool, error) {
+	result := database.DB.Model(&Payment{}).
+		Where("id = ? AND status = ?", paymentID, PaymentStatusPending).
+		Updates(map[string]interface{}{
+			"status":      PaymentStatusFailed,
+			"fail_reason": reason,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
 // GetPaymentByAppointment 通过预约ID获取支付记录
 func GetPaymentByAppointment(appointmentID uint) (*Payment, error) {
 	var payment Payment
@@ -0,0 +1,226 @@
+package models
+
+import (
+	"admin-api/database"
+	"admin-api/utils"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// createRefundTx 为预约的支付单创建处理中的退款记录，同一支付单已有处理中或成功的退款时拒绝
+func createRefundTx(tx *gorm.DB, appointment *Appointment, payment *Payment, amount int, reason string) (*Refund, error) {
+	if amount <= 0 || amount > payment.Amount {
+		return nil, errors.New("退款金额无效")
+	}
+
+	var active int64
+	if err := tx.Model(&Refund{}).
+		Where("payment_id = ? AND status IN (?)", payment.ID, []string{RefundStatusProcessing, RefundStatusSuccess}).
+		Count(&active).Error; err != nil {
+		return nil, err
+	}
+	if active > 0 {
+		return nil, errors.New("该支付已在退款中")
+	}
+
+	if runes := []rune(reason); len(runes) > 255 {
+		reason = string(runes[:255])
+	}
+	refund := &Refund{
+		PaymentID:     payment.ID,
+		AppointmentID: appointment.ID,
+		Amount:        amount,
+		Reason:        reason,
+		Status:        RefundStatusProcessing,
+		OutRefundNo:   utils.GenerateTradeNo("R"),
+	}
+	if err := tx.Create(refund).Error; err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+// CreateAppointmentRefund 商家为预约发起退款，创建处理中的退款记录，由调用方发起退款
+func CreateAppointmentRefund(merchantID, appointmentID uint, amount int, reason string) (*Refund, error) {
+	tx := database.DB.Begin()
+
+	appointment, err := lockAppointment(tx, appointmentID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if appointment.MerchantID != merchantID {
+		tx.Rollback()
+		return nil, errors.New("无权操作此预约")
+	}
+	// 退款中的预约在上次退款失败后可重新发起
+	if appointment.Status != AppointmentStatusRefunding &&
+		!CanTransitionAppointment(appointment.Status, AppointmentStatusRefunding) {
+		tx.Rollback()
+		return nil, errors.New("当前状态不允许退款")
+	}
+
+	payment, err := appointmentSucceededPayment(tx, appointment.ID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if payment == nil {
+		tx.Rollback()
+		return nil, errors.New("支付未完成，无法退款")
+	}
+	if amount > payment.Amount {
+		tx.Rollback()
+		return nil, errors.New("退款金额不能超过支付金额")
+	}
+
+	refund, err := createRefundTx(tx, appointment, payment, amount, reason)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+// lockProcessingRefund 加锁读取处理中的退款记录
+func lockProcessingRefund(tx *gorm.DB, refundID uint) (*Refund, error) {
+	var refund Refund
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&refund, refundID).Error; err != nil {
+		return nil, err
+	}
+	if refund.Status != RefundStatusProcessing {
+		return nil, errors.New("退款已处理")
+	}
+	return &refund, nil
+}
+
+// transitionRefundAppointment 退款后变更预约状态，预约已是目标状态时跳过
+func transitionRefundAppointment(tx *gorm.DB, refund *Refund, to, actorType string, actorID uint) error {
+	appointment, err := lockAppointment(tx, refund.AppointmentID)
+	if err != nil {
+		return err
+	}
+	if appointment.Status == to {
+		return nil
+	}
+	return TransitionAppointmentTx(tx, appointment, to, actorType, actorID, refund.Reason, nil)
+}
+
+// CompleteRefund 退款成功：更新退款记录和支付单，预约变为已退款并释放时间段
+func CompleteRefund(refundID uint, actorType string, actorID uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		refund, err := lockProcessingRefund(tx, refundID)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if err := tx.Model(refund).Updates(map[string]interface{}{
+			"status":      RefundStatusSuccess,
+			"refunded_at": now,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&Payment{}).Where("id = ?", refund.PaymentID).
+			Update("status", PaymentStatusRefunded).Error; err != nil {
+			return err
+		}
+		return transitionRefundAppointment(tx, refund, AppointmentStatusRefunded, actorType, actorID)
+	})
+}
+
+// MarkRefundSubmitted 退款申请已提交到支付渠道：支付单和预约变为退款中
+func MarkRefundSubmitted(refundID uint, actorType string, actorID uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		refund, err := lockProcessingRefund(tx, refundID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&Payment{}).Where("id = ?", refund.PaymentID).
+			Update("status", PaymentStatusRefunding).Error; err != nil {
+			return err
+		}
+		return transitionRefundAppointment(tx, refund, AppointmentStatusRefunding, actorType, actorID)
+	})
+}
+
+// FailRefund 退款申请失败，预约和支付单保持原状态
+func FailRefund(refundID uint, reason string) error {
+	if runes := []rune(reason); len(runes) > 255 {
+		reason = string(runes[:255])
+	}
+	return database.DB.Model(&Refund{}).
+		Where("id = ? AND status = ?", refundID, RefundStatusProcessing).
+		Updates(map[string]interface{}{
+			"status":      RefundStatusFailed,
+			"fail_reason": reason,
+		}).Error
+}
+
+// GetRefundByID 通过ID获取退款记录
+func GetRefundByID(id uint) (*Refund, error) {
+	var refund Refund
+	err := database.DB.First(&refund, id).Error
+	return &refund, err
+}
+
+// GetRefundByOutRefundNo 通过商户退款单号获取退款记录
+func GetRefundByOutRefundNo(outRefundNo string) (*Refund, error) {
+	var refund Refund
+	err := database.DB.Where("out_refund_no = ?", outRefundNo).First(&refund).Error
+	return &refund, err
+}
+
+// CompleteChannelRefund 支付渠道通知退款成功，重复通知直接返回成功
+func CompleteChannelRefund(outRefundNo, channelRefundID string) error {
+	refund, err := GetRefundByOutRefundNo(outRefundNo)
+	if err != nil {
+		return fmt.Errorf("未找到退款记录: %s", outRefundNo)
+	}
+	if refund.Status == RefundStatusSuccess {
+		return nil
+	}
+	if channelRefundID != "" {
+		if err := database.DB.Model(refund).Update("refund_id", channelRefundID).Error; err != nil {
+			return err
+		}
+	}
+	return CompleteRefund(refund.ID, ActorPayment, refund.PaymentID)
+}
+
+// FailChannelRefund 支付渠道通知退款失败或关闭
+func FailChannelRefund(outRefundNo, reason string) error {
+	refund, err := GetRefundByOutRefundNo(outRefundNo)
+	if err != nil {
+		return fmt.Errorf("未找到退款记录: %s", outRefundNo)
+	}
+	if refund.Status != RefundStatusProcessing {
+		return nil
+	}
+	log.Printf("退款 %s 失败: %s，预约 %d 需商家重新发起退款", outRefundNo, reason, refund.AppointmentID)
+	if runes := []rune(reason); len(runes) > 255 {
+		reason = string(runes[:255])
+	}
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Refund{}).
+			Where("id = ? AND status = ?", refund.ID, RefundStatusProcessing).
+			Updates(map[string]interface{}{
+				"status":      RefundStatusFailed,
+				"fail_reason": reason,
+			}).Error; err != nil {
+			return err
+		}
+		// 支付单恢复为已支付，商家可再次发起退款
+		return tx.Model(&Payment{}).
+			Where("id = ? AND status = ?", refund.PaymentID, PaymentStatusRefunding).
+			Update("status", PaymentStatusSucceeded).Error
+	})
+}
@@ -0,0 +1,485 @@
+package models
+
+import (
+	"admin-api/database"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 退款申请状态
+const (
+	RefundRequestPending   = "pending"   // 待商家处理
+	RefundRequestCountered = "countered" // 商家提出了新的退款金额，待客户确认
+	RefundRequestApproved  = "approved"  // 已同意并发起退款
+	RefundRequestRejected  = "rejected"  // 商家已拒绝
+	RefundRequestWithdrawn = "withdrawn" // 客户已撤回
+)
+
+// 退款申请处理记录的操作
+const (
+	RefundRequestActionSubmit        = "submit"         // 客户提交申请
+	RefundRequestActionApprove       = "approve"        // 商家同意
+	RefundRequestActionReject        = "reject"         // 商家拒绝
+	RefundRequestActionCounter       = "counter"        // 商家提出新的退款金额
+	RefundRequestActionAcceptCounter = "accept_counter" // 客户接受商家提出的金额
+	RefundRequestActionWithdraw      = "withdraw"       // 客户撤回
+	RefundRequestActionRefundFailed  = "refund_failed"  // 发起退款失败，申请退回处理前的状态
+)
+
+// 未结束的退款申请状态，同一预约同时只能有一个
+var openRefundRequestStatuses = []string{RefundRequestPending, RefundRequestCountered}
+
+// RefundRequest 客户发起的退款申请，商家同意后按已有退款流程原路退款
+type RefundRequest struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	AppointmentID  uint      `gorm:"index;not null" json:"appointment_id"`
+	UserID         uint      `gorm:"index;not null" json:"user_id"`
+	MerchantID     uint      `gorm:"index;not null" json:"merchant_id"`
+	PaymentID      uint      `gorm:"not null" json:"payment_id"`
+	Amount         int       `gorm:"not null" json:"amount"`                        // 申请退款金额(分)
+	Reason         string    `gorm:"size:255;not null" json:"reason"`               // 申请原因
+	Status         string    `gorm:"size:20;not null;index" json:"status"`          // 申请状态
+	CounterAmount  int       `gorm:"default:0;not null" json:"counter_amount"`      // 商家提出的退款金额(分)
+	ApprovedAmount int       `gorm:"default:0;not null" json:"approved_amount"`     // 最终退款金额(分)
+	MerchantReply  string    `gorm:"size:255" json:"merchant_reply"`                // 商家最近一次答复
+	RefundID       uint      `gorm:"default:0;not null" json:"refund_id,omitempty"` // 同意后创建的退款记录
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	Appointment Appointment `gorm:"foreignKey:AppointmentID" json:"-"`
+	User        User        `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// RefundRequestEvent 退款申请的处理记录，客户和商家都可查看
+type RefundRequestEvent struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	RefundRequestID uint      `gorm:"index;not null" json:"refund_request_id"`
+	Action          string    `gorm:"size:20;not null" json:"action"`
+	ActorType       string    `gorm:"size:20;not null" json:"actor_type"` // customer, merchant, system
+	ActorID         uint      `gorm:"default:0;not null" json:"actor_id"`
+	FromStatus      string    `gorm:"size:20" json:"from_status"`
+	ToStatus        string    `gorm:"size:20;not null" json:"to_status"`
+	Amount          int       `gorm:"default:0;not null" json:"amount"` // 本次操作涉及的金额(分)
+	Remark          string    `gorm:"size:255" json:"remark"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+func recordRefundRequestEvent(tx *gorm.DB, request *RefundRequest, action, fromStatus, actorType string,
+	actorID uint, amount int, remark string) error {
+	if runes := []rune(remark); len(runes) > 255 {
+		remark = string(runes[:255])
+	}
+	return tx.Create(&RefundRequestEvent{
+		RefundRequestID: request.ID,
+		Action:          action,
+		ActorType:       actorType,
+		ActorID:         actorID,
+		FromStatus:      fromStatus,
+		ToStatus:        request.Status,
+		Amount:          amount,
+		Remark:          remark,
+	}).Error
+}
+
+// updateRefundRequestTx 变更退款申请状态并记录处理记录
+func updateRefundRequestTx(tx *gorm.DB, request *RefundRequest, action, to, actorType string, actorID uint,
+	amount int, remark string, extra map[string]interface{}) error {
+	from := request.Status
+	updates := map[string]interface{}{"status": to}
+	for k, v := range extra {
+		updates[k] = v
+	}
+	if err := tx.Model(request).Updates(updates).Error; err != nil {
+		return err
+	}
+	request.Status = to
+	return recordRefundRequestEvent(tx, request, action, from, actorType, actorID, amount, remark)
+}
+
+func lockRefundRequest(tx *gorm.DB, requestID uint) (*RefundRequest, error) {
+	var request RefundRequest
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&request, requestID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("退款申请不存在")
+		}
+		return nil, err
+	}
+	return &request, nil
+}
+
+// CreateRefundRequest 客户为已支付的预约申请退款
+func CreateRefundRequest(userID, appointmentID uint, amount int, reason string) (*RefundRequest, error) {
+	tx := database.DB.Begin()
+
+	appointment, err := lockAppointment(tx, appointmentID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if appointment.UserID != userID {
+		tx.Rollback()
+		return nil, errors.New("预约不存在")
+	}
+	if !CanTransitionAppointment(appointment.Status, AppointmentStatusRefunding) {
+		tx.Rollback()
+		return nil, errors.New("当前状态不能申请退款")
+	}
+
+	payment, err := appointmentSucceededPayment(tx, appointment.ID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if payment == nil {
+		tx.Rollback()
+		return nil, errors.New("未找到支付记录")
+	}
+	if amount > payment.Amount {
+		tx.Rollback()
+		return nil, errors.New("退款金额不能超过支付金额")
+	}
+
+	var open int64
+	if err := tx.Model(&RefundRequest{}).
+		Where("appointment_id = ? AND status IN (?)", appointment.ID, openRefundRequestStatuses).
+		Count(&open).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if open > 0 {
+		tx.Rollback()
+		return nil, errors.New("该预约已有处理中的退款申请")
+	}
+	var refunding int64
+	if err := tx.Model(&Refund{}).
+		Where("payment_id = ? AND status IN (?)", payment.ID, []string{RefundStatusProcessing, RefundStatusSuccess}).
+		Count(&refunding).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if refunding > 0 {
+		tx.Rollback()
+		return nil, errors.New("该预约已在退款中")
+	}
+
+	if runes := []rune(reason); len(runes) > 255 {
+		reason = string(runes[:255])
+	}
+	request := &RefundRequest{
+		AppointmentID: appointment.ID,
+		UserID:        userID,
+		MerchantID:    appointment.MerchantID,
+		PaymentID:     payment.ID,
+		Amount:        amount,
+		Reason:        reason,
+		Status:        RefundRequestPending,
+	}
+	if err := tx.Create(request).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := recordRefundRequestEvent(tx, request, RefundRequestActionSubmit, "", ActorCustomer, userID,
+		amount, reason); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// lockUserRefundRequest 加锁读取用户的退款申请
+func lockUserRefundRequest(tx *gorm.DB, userID, requestID uint) (*RefundRequest, error) {
+	request, err := lockRefundRequest(tx, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if request.UserID != userID {
+		return nil, errors.New("退款申请不存在")
+	}
+	return request, nil
+}
+
+// lockMerchantRefundRequest 加锁读取商家的退款申请
+func lockMerchantRefundRequest(tx *gorm.DB, merchantID, requestID uint) (*RefundRequest, error) {
+	request, err := lockRefundRequest(tx, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if request.MerchantID != merchantID {
+		return nil, errors.New("退款申请不存在")
+	}
+	return request, nil
+}
+
+// approveRefundRequestTx 按 amount 同意退款申请并创建退款记录，由调用方发起退款
+func approveRefundRequestTx(tx *gorm.DB, request *RefundRequest, action, actorType string, actorID uint,
+	amount int, remark string) (*Refund, error) {
+	appointment, err := lockAppointment(tx, request.AppointmentID)
+	if err != nil {
+		return nil, err
+	}
+	if !CanTransitionAppointment(appointment.Status, AppointmentStatusRefunding) {
+		return nil, errors.New("预约当前状态不能退款")
+	}
+	var payment Payment
+	if err := tx.First(&payment, request.PaymentID).Error; err != nil {
+		return nil, errors.New("未找到支付记录")
+	}
+	if payment.Status != PaymentStatusSucceeded {
+		return nil, errors.New("支付未完成，无法退款")
+	}
+
+	refund, err := createRefundTx(tx, appointment, &payment, amount, "退款申请："+request.Reason)
+	if err != nil {
+		return nil, err
+	}
+	if err := updateRefundRequestTx(tx, request, action, RefundRequestApproved, actorType, actorID, amount, remark,
+		map[string]interface{}{"approved_amount": amount, "refund_id": refund.ID}); err != nil {
+		return nil, err
+	}
+	request.ApprovedAmount = amount
+	request.RefundID = refund.ID
+	return refund, nil
+}
+
+// ApproveRefundRequest 商家同意待处理的退款申请，按申请金额创建退款记录，由调用方发起退款
+func ApproveRefundRequest(merchantID, requestID uint, reply string) (*RefundRequest, *Refund, error) {
+	tx := database.DB.Begin()
+
+	request, err := lockMerchantRefundRequest(tx, merchantID, requestID)
+	if err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+	if request.Status != RefundRequestPending {
+		tx.Rollback()
+		return nil, nil, errors.New("当前状态不能同意")
+	}
+
+	refund, err := approveRefundRequestTx(tx, request, RefundRequestActionApprove, ActorMerchant, merchantID,
+		request.Amount, reply)
+	if err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+	if reply != "" {
+		if err := tx.Model(request).Update("merchant_reply", reply).Error; err != nil {
+			tx.Rollback()
+			return nil, nil, err
+		}
+		request.MerchantReply = reply
+	}
+	if err := notifyUser(tx, request.UserID, NotificationTypeRefundRequest, "退款申请已同意",
+		fmt.Sprintf("商家已同意您的退款申请，退款%.2f元将原路退回", float64(request.Amount)/100)); err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, nil, err
+	}
+	return request, refund, nil
+}
+
+// RejectRefundRequest 商家拒绝待处理的退款申请
+func RejectRefundRequest(merchantID, requestID uint, reply string) (*RefundRequest, error) {
+	tx := database.DB.Begin()
+
+	request, err := lockMerchantRefundRequest(tx, merchantID, requestID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if request.Status != RefundRequestPending {
+		tx.Rollback()
+		return nil, errors.New("当前状态不能拒绝")
+	}
+
+	if err := updateRefundRequestTx(tx, request, RefundRequestActionReject, RefundRequestRejected, ActorMerchant,
+		merchantID, 0, reply, map[string]interface{}{"merchant_reply": reply}); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	request.MerchantReply = reply
+	if err := notifyUser(tx, request.UserID, NotificationTypeRefundRequest, "退款申请未通过",
+		"商家拒绝了您的退款申请："+reply); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// CounterRefundRequest 商家对待处理的退款申请提出新的退款金额，由客户确认或撤回
+func CounterRefundRequest(merchantID, requestID uint, amount int, reply string) (*RefundRequest, error) {
+	tx := database.DB.Begin()
+
+	request, err := lockMerchantRefundRequest(tx, merchantID, requestID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if request.Status != RefundRequestPending {
+		tx.Rollback()
+		return nil, errors.New("当前状态不能提出新的金额")
+	}
+	if amount <= 0 || amount >= request.Amount {
+		tx.Rollback()
+		return nil, errors.New("提出的金额须大于0且小于申请金额")
+	}
+
+	if err := updateRefundRequestTx(tx, request, RefundRequestActionCounter, RefundRequestCountered, ActorMerchant,
+		merchantID, amount, reply, map[string]interface{}{"counter_amount": amount, "merchant_reply": reply}); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	request.CounterAmount = amount
+	request.MerchantReply = reply
+	if err := notifyUser(tx, request.UserID, NotificationTypeRefundRequest, "商家提出了新的退款金额",
+		fmt.Sprintf("商家建议退款%.2f元，请确认是否接受", float64(amount)/100)); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// AcceptRefundCounter 客户接受商家提出的退款金额，按该金额创建退款记录，由调用方发起退款
+func AcceptRefundCounter(userID, requestID uint) (*RefundRequest, *Refund, error) {
+	tx := database.DB.Begin()
+
+	request, err := lockUserRefundRequest(tx, userID, requestID)
+	if err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+	if request.Status != RefundRequestCountered {
+		tx.Rollback()
+		return nil, nil, errors.New("商家未提出新的退款金额")
+	}
+
+	refund, err := approveRefundRequestTx(tx, request, RefundRequestActionAcceptCounter, ActorCustomer, userID,
+		request.CounterAmount, "")
+	if err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, nil, err
+	}
+	return request, refund, nil
+}
+
+// WithdrawRefundRequest 客户撤回待处理的退款申请，或不接受商家提出的金额
+func WithdrawRefundRequest(userID, requestID uint, remark string) (*RefundRequest, error) {
+	tx := database.DB.Begin()
+
+	request, err := lockUserRefundRequest(tx, userID, requestID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if !containsString(openRefundRequestStatuses, request.Status) {
+		tx.Rollback()
+		return nil, errors.New("当前状态不能撤回")
+	}
+
+	if err := updateRefundRequestTx(tx, request, RefundRequestActionWithdraw, RefundRequestWithdrawn, ActorCustomer,
+		userID, 0, remark, nil); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// ReopenRefundRequest 同意后发起退款失败时，退款申请退回同意前的状态，可重新处理
+func ReopenRefundRequest(requestID uint, reason string) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		request, err := lockRefundRequest(tx, requestID)
+		if err != nil {
+			return err
+		}
+		if request.Status != RefundRequestApproved {
+			return nil
+		}
+		to := RefundRequestPending
+		if request.CounterAmount > 0 {
+			to = RefundRequestCountered
+		}
+		return updateRefundRequestTx(tx, request, RefundRequestActionRefundFailed, to, ActorSystem, 0,
+			request.ApprovedAmount, reason, map[string]interface{}{"approved_amount": 0, "refund_id": 0})
+	})
+}
+
+// GetUserRefundRequests 获取用户的退款申请
+func GetUserRefundRequests(userID uint, status string) ([]RefundRequest, error) {
+	var requests []RefundRequest
+	query := database.DB.Preload("Appointment").Preload("Appointment.Merchant").Preload("Appointment.Service").
+		Where("user_id = ?", userID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Order("id DESC").Find(&requests).Error
+	return requests, err
+}
+
+// GetMerchantRefundRequests 分页获取商家收到的退款申请
+func GetMerchantRefundRequests(merchantID uint, status string, page, limit int) ([]RefundRequest, int64, error) {
+	var requests []RefundRequest
+	var total int64
+
+	query := database.DB.Model(&RefundRequest{}).Where("merchant_id = ?", merchantID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.Preload("User").Preload("Appointment").Preload("Appointment.Service").
+		Order("id DESC").Offset((page - 1) * limit).Limit(limit).
+		Find(&requests).Error
+	return requests, total, err
+}
+
+// GetRefundRequestDetail 获取退款申请及处理记录，userID 或 merchantID 为0时不校验对应归属
+func GetRefundRequestDetail(userID, merchantID, requestID uint) (*RefundRequest, []RefundRequestEvent, error) {
+	var request RefundRequest
+	query := database.DB.Preload("User").Preload("Appointment").Preload("Appointment.Merchant").
+		Preload("Appointment.Service").Where("id = ?", requestID)
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if merchantID != 0 {
+		query = query.Where("merchant_id = ?", merchantID)
+	}
+	if err := query.First(&request).Error; err != nil {
+		return nil, nil, errors.New("退款申请不存在")
+	}
+
+	var events []RefundRequestEvent
+	if err := database.DB.Where("refund_request_id = ?", request.ID).
+		Order("id ASC").
+		Find(&events).Error; err != nil {
+		return nil, nil, err
+	}
+	return &request, events, nil
+}
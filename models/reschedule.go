@@ -0,0 +1,261 @@
+package models
+
+import (
+	"admin-api/database"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 改约发起方
+const (
+	RescheduleByCustomer = "customer"
+	RescheduleByMerchant = "merchant"
+)
+
+// AppointmentReschedule 预约改约记录
+type AppointmentReschedule struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	AppointmentID  uint      `gorm:"index;not null" json:"appointment_id"`
+	OperatorType   string    `gorm:"size:20;not null" json:"operator_type"` // customer, merchant
+	OperatorID     uint      `gorm:"not null" json:"operator_id"`           // 用户ID或商家ID
+	FromStaffID    uint      `gorm:"not null" json:"from_staff_id"`
+	FromTimeSlotID uint      `gorm:"not null" json:"from_time_slot_id"`
+	FromDate       time.Time `gorm:"type:date;not null" json:"from_date"`
+	FromStartTime  string    `gorm:"size:8;not null" json:"from_start_time"`
+	FromEndTime    string    `gorm:"size:8;not null" json:"from_end_time"`
+	ToStaffID      uint      `gorm:"not null" json:"to_staff_id"`
+	ToTimeSlotID   uint      `gorm:"not null" json:"to_time_slot_id"`
+	ToDate         time.Time `gorm:"type:date;not null" json:"to_date"`
+	ToStartTime    string    `gorm:"size:8;not null" json:"to_start_time"`
+	ToEndTime      string    `gorm:"size:8;not null" json:"to_end_time"`
+	Reason         string    `gorm:"size:255" json:"reason"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// 可以改约的预约状态
+var reschedulableStatuses = []string{
+	AppointmentStatusPending,
+	AppointmentStatusConfirmed,
+	AppointmentStatusPaid,
+}
+
+// appointmentStartAt 返回预约在商家时区开始的具体时刻
+func appointmentStartAt(appointment *Appointment, loc *time.Location) time.Time {
+	return wallClockAt(appointment.AppointmentDate, appointment.StartTime, loc)
+}
+
+// checkCustomerRescheduleRules 校验商家配置的客户改约规则
+func checkCustomerRescheduleRules(tx *gorm.DB, appointment *Appointment, now time.Time) error {
+	setting, err := getMerchantSetting(tx, appointment.MerchantID)
+	if err != nil {
+		return err
+	}
+	if setting.RescheduleMaxTimes == 0 {
+		return errors.New("该商家不支持改约")
+	}
+	if appointment.RescheduleCount >= setting.RescheduleMaxTimes {
+		return fmt.Errorf("每个预约最多改约%d次", setting.RescheduleMaxTimes)
+	}
+	deadline := appointmentStartAt(appointment, merchantLocation(tx, appointment.MerchantID)).Add(-time.Duration(setting.RescheduleMinHours) * time.Hour)
+	if now.After(deadline) {
+		return fmt.Errorf("需在预约开始前%d小时改约", setting.RescheduleMinHours)
+	}
+	return nil
+}
+
+// RescheduleAppointment 在一个事务中将预约改到新的时间段：释放原时间段名额、占用新时间段，
+// 更新员工和时间，支付与优惠券仍关联在原预约上，并记录改约历史。
+// operatorType 为客户时 operatorID 为用户ID并校验商家的改约规则；为商家时 operatorID 为商家ID。
+// staffID 为0时使用新时间段所属的员工。
+func RescheduleAppointment(appointmentID uint, operatorType string, operatorID, staffID, timeSlotID uint,
+	reason string) (*Appointment, error) {
+
+	tx := database.DB.Begin()
+
+	appointment, err := rescheduleAppointmentTx(tx, appointmentID, operatorType, operatorID, staffID, timeSlotID, reason)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("提交事务失败")
+	}
+
+	// 消费用户对新时间段的临时预留
+	consumeSlotHold(appointment.UserID, timeSlotID)
+
+	return appointment, nil
+}
+
+func rescheduleAppointmentTx(tx *gorm.DB, appointmentID uint, operatorType string, operatorID, staffID, timeSlotID uint,
+	reason string) (*Appointment, error) {
+
+	// 1. 锁定预约并校验权限和状态
+	var appointment Appointment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&appointment, appointmentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("预约不存在")
+		}
+		return nil, err
+	}
+
+	switch operatorType {
+	case RescheduleByCustomer:
+		if appointment.UserID != operatorID {
+			return nil, errors.New("预约不存在")
+		}
+	case RescheduleByMerchant:
+		if appointment.MerchantID != operatorID {
+			return nil, errors.New("预约不存在")
+		}
+	default:
+		return nil, errors.New("无效的改约发起方")
+	}
+
+	reschedulable := false
+	for _, s := range reschedulableStatuses {
+		if appointment.Status == s {
+			reschedulable = true
+			break
+		}
+	}
+	if !reschedulable {
+		return nil, errors.New("当前状态不允许改约")
+	}
+
+	if operatorType == RescheduleByCustomer {
+		if err := checkCustomerRescheduleRules(tx, &appointment, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	// 2. 校验新时间段
+	var target TimeSlot
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&target, timeSlotID).Error; err != nil {
+		return nil, errors.New("时间段不存在")
+	}
+	if target.MerchantID != appointment.MerchantID {
+		return nil, errors.New("时间段不存在")
+	}
+	if staffID > 0 && target.StaffID != staffID {
+		return nil, errors.New("时间段与所选员工不匹配")
+	}
+	if target.Date.Format("2006-01-02") < merchantToday(tx, appointment.MerchantID) {
+		return nil, errors.New("不能改约到已过去的日期")
+	}
+	if target.ID == appointment.TimeSlotID {
+		return nil, errors.New("新时间段与原时间段相同")
+	}
+
+	// 新员工须可提供该服务，时长以新员工的设置为准，价格保持不变
+	service, err := staffServiceTx(tx, appointment.MerchantID, appointment.ServiceID, target.StaffID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. 先释放原时间段的名额，新旧时间段有重叠时（如顺延半小时）也能改约成功
+	oldSlotIDs, err := appointmentSlotIDs(tx, &appointment)
+	if err != nil {
+		return nil, err
+	}
+	if err := freeSlots(tx, oldSlotIDs); err != nil {
+		return nil, err
+	}
+	if err := tx.Where("appointment_id = ?", appointment.ID).Delete(&AppointmentTimeSlot{}).Error; err != nil {
+		return nil, err
+	}
+
+	// 4. 锁定并占用新时间段
+	// 重新读取，使释放原名额后的状态生效
+	if err := tx.First(&target, timeSlotID).Error; err != nil {
+		return nil, err
+	}
+	run, err := lockBookingSlots(tx, target, service, appointment.UserID, appointment.ID)
+	if err != nil {
+		return nil, err
+	}
+	newSlotIDs := make([]uint, 0, len(run))
+	for _, s := range run {
+		newSlotIDs = append(newSlotIDs, s.ID)
+	}
+	if err := checkDuplicateGroupBooking(tx, appointment.UserID, target, newSlotIDs); err != nil {
+		return nil, err
+	}
+	if err := occupySlots(tx, run); err != nil {
+		return nil, err
+	}
+	for _, id := range newSlotIDs {
+		if err := tx.Create(&AppointmentTimeSlot{AppointmentID: appointment.ID, TimeSlotID: id}).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// 5. 记录改约历史并更新预约，支付和优惠券关联不变
+	history := AppointmentReschedule{
+		AppointmentID:  appointment.ID,
+		OperatorType:   operatorType,
+		OperatorID:     operatorID,
+		FromStaffID:    appointment.StaffID,
+		FromTimeSlotID: appointment.TimeSlotID,
+		FromDate:       appointment.AppointmentDate,
+		FromStartTime:  formatSlotClock(appointment.StartTime),
+		FromEndTime:    formatSlotClock(appointment.EndTime),
+		ToStaffID:      target.StaffID,
+		ToTimeSlotID:   target.ID,
+		ToDate:         target.Date,
+		ToStartTime:    formatSlotClock(target.StartTime),
+		ToEndTime:      formatSlotClock(run[len(run)-1].EndTime),
+		Reason:         reason,
+	}
+	if err := tx.Create(&history).Error; err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{
+		"staff_id":         target.StaffID,
+		"time_slot_id":     target.ID,
+		"appointment_date": target.Date,
+		"start_time":       target.StartTime,
+		"end_time":         run[len(run)-1].EndTime,
+	}
+	if operatorType == RescheduleByCustomer {
+		updates["reschedule_count"] = gorm.Expr("reschedule_count + 1")
+	}
+	if err := tx.Model(&Appointment{}).Where("id = ?", appointment.ID).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+
+	if operatorType == RescheduleByMerchant {
+		if err := notifyUser(tx, appointment.UserID, NotificationTypeRescheduled, "预约时间已调整",
+			fmt.Sprintf("您的预约（订单号 %s）已由商家从 %s %s 调整至 %s %s",
+				appointment.OrderNo,
+				history.FromDate.Format("2006-01-02"), history.FromStartTime,
+				history.ToDate.Format("2006-01-02"), history.ToStartTime)); err != nil {
+			return nil, err
+		}
+	}
+
+	// 6. 原时间段空出的名额放给候补
+	if err := promoteWaitlist(tx, oldSlotIDs); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Preload("Merchant").Preload("Service").Preload("Staff").First(&appointment, appointment.ID).Error; err != nil {
+		return nil, err
+	}
+	return &appointment, nil
+}
+
+// GetAppointmentReschedules 获取预约的改约历史，按时间先后排序
+func GetAppointmentReschedules(appointmentID uint) ([]AppointmentReschedule, error) {
+	var history []AppointmentReschedule
+	err := database.DB.Where("appointment_id = ?", appointmentID).
+		Order("created_at ASC").
+		Find(&history).Error
+	return history, err
+}
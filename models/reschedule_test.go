@@ -0,0 +1,91 @@
+package models
+
+import (
+	"admin-api/database"
+	"testing"
+)
+
+func TestRescheduleAppointment(t *testing.T) {
+	setupBookingDB(t)
+
+	// 服务时长 60 分钟，每个预约占用两个 30 分钟的时间段，原预约占用前两个时间段
+	tests := []struct {
+		name            string
+		specs           []slotSpec // 已占用名额含原预约
+		target          int        // 改约到的时间段下标
+		operator        string
+		rescheduleCount int
+		wantErr         bool
+		wantBooked      []int
+	}{
+		{"顺延半小时与原时间段重叠", []slotSpec{{1, 1}, {1, 1}, {1, 0}, {1, 0}}, 1, RescheduleByMerchant, 0, false, []int{0, 1, 1, 0}},
+		{"改到不重叠的时间段", []slotSpec{{1, 1}, {1, 1}, {1, 0}, {1, 0}}, 2, RescheduleByMerchant, 0, false, []int{0, 0, 1, 1}},
+		{"改到仍有名额的团课时间段", []slotSpec{{1, 1}, {1, 1}, {2, 1}, {2, 1}}, 2, RescheduleByMerchant, 0, false, []int{0, 0, 2, 2}},
+		{"客户改约", []slotSpec{{1, 1}, {1, 1}, {1, 0}, {1, 0}}, 2, RescheduleByCustomer, 1, false, []int{0, 0, 1, 1}},
+		{"目标时间段已约满", []slotSpec{{1, 1}, {1, 1}, {1, 1}, {1, 0}}, 2, RescheduleByMerchant, 0, true, []int{1, 1, 1, 0}},
+		{"重叠改约但后一个时间段已约满", []slotSpec{{1, 1}, {1, 1}, {1, 1}}, 1, RescheduleByMerchant, 0, true, []int{1, 1, 1}},
+		{"团课目标时间段已约满", []slotSpec{{1, 1}, {1, 1}, {2, 1}, {2, 2}}, 2, RescheduleByMerchant, 0, true, []int{1, 1, 1, 2}},
+		{"与原时间段相同", []slotSpec{{1, 1}, {1, 1}, {1, 0}}, 0, RescheduleByMerchant, 0, true, []int{1, 1, 0}},
+		{"客户超过改约次数", []slotSpec{{1, 1}, {1, 1}, {1, 0}, {1, 0}}, 2, RescheduleByCustomer, 2, true, []int{1, 1, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newBookingFixture(t, 60)
+			slots := f.createSlots(t, tt.specs...)
+			appointment := f.bookAppointment(t, 1, slots[:2])
+			if err := database.DB.Model(appointment).Update("reschedule_count", tt.rescheduleCount).Error; err != nil {
+				t.Fatal(err)
+			}
+			operatorID := f.merchant.ID
+			if tt.operator == RescheduleByCustomer {
+				operatorID = appointment.UserID
+			}
+
+			got, err := RescheduleAppointment(appointment.ID, tt.operator, operatorID, 0, slots[tt.target].ID, "测试改约")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RescheduleAppointment err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if booked := bookedCounts(t, slots); !equalInts(booked, tt.wantBooked) {
+				t.Fatalf("已占用名额 = %v, 期望 %v", booked, tt.wantBooked)
+			}
+
+			// 失败时预约保持原时间段，成功时改到新时间段并记录历史
+			wantFirst, wantLast, wantHistory := slots[0], slots[1], int64(0)
+			if !tt.wantErr {
+				wantFirst, wantLast, wantHistory = slots[tt.target], slots[tt.target+1], 1
+				if got.TimeSlotID != wantFirst.ID {
+					t.Fatalf("返回的预约时间段 = %d, 期望 %d", got.TimeSlotID, wantFirst.ID)
+				}
+			}
+			var latest Appointment
+			if err := database.DB.First(&latest, appointment.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if latest.TimeSlotID != wantFirst.ID || formatSlotClock(latest.EndTime) != formatSlotClock(wantLast.EndTime) {
+				t.Fatalf("预约时间段 = %d %s, 期望 %d %s", latest.TimeSlotID, latest.EndTime, wantFirst.ID, wantLast.EndTime)
+			}
+			var slotIDs []uint
+			if err := database.DB.Model(&AppointmentTimeSlot{}).Where("appointment_id = ?", appointment.ID).
+				Order("time_slot_id ASC").Pluck("time_slot_id", &slotIDs).Error; err != nil {
+				t.Fatal(err)
+			}
+			if len(slotIDs) != 2 || slotIDs[0] != wantFirst.ID || slotIDs[1] != wantLast.ID {
+				t.Fatalf("预约占用的时间段 = %v, 期望 [%d %d]", slotIDs, wantFirst.ID, wantLast.ID)
+			}
+			var history int64
+			if err := database.DB.Model(&AppointmentReschedule{}).Where("appointment_id = ?", appointment.ID).Count(&history).Error; err != nil {
+				t.Fatal(err)
+			}
+			if history != wantHistory {
+				t.Fatalf("改约记录 %d 条, 期望 %d", history, wantHistory)
+			}
+			wantCount := tt.rescheduleCount
+			if !tt.wantErr && tt.operator == RescheduleByCustomer {
+				wantCount++
+			}
+			if latest.RescheduleCount != wantCount {
+				t.Fatalf("改约次数 = %d, 期望 %d", latest.RescheduleCount, wantCount)
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@ package models
 import (
 	"admin-api/database"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type Service struct {
@@ -14,10 +16,13 @@ type Service struct {
 	CoverImage  string `gorm:"size:255"`
 	Price       int    `gorm:"type:int;default:0;not null"`
 	Duration    int    `gorm:"default:30;not null"` // 分钟
-	IsActive    bool   `gorm:"default:true;not null"`
-	Sort        int    `gorm:"default:0;not null"`
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	// 服务前后的缓冲时间（分钟），如准备、清洁整理，期间同一员工不可被预约
+	BufferBefore int  `gorm:"default:0;not null"`
+	BufferAfter  int  `gorm:"default:0;not null"`
+	IsActive     bool `gorm:"default:true;not null"`
+	Sort         int  `gorm:"default:0;not null"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
 }
 
 func GetMerchantServiceCategories(merchantID uint) ([]ServiceCategory, error) {
@@ -44,14 +49,6 @@ func GetServiceByID(id uint) (*Service, error) {
 	return &service, err
 }
 
-func GetServiceAvailableStaff(serviceID uint) ([]Staff, error) {
-	// 实际项目中这里应该根据服务关联的员工来查询
-	// 这里简化处理，返回商家所有在职员工
-	var staff []Staff
-	err := database.DB.Where("is_active = true").Find(&staff).Error
-	return staff, err
-}
-
 func CreateService(service *Service) error {
 	return database.DB.Create(service).Error
 }
@@ -61,5 +58,10 @@ func UpdateService(id uint, updates map[string]interface{}) error {
 }
 
 func DeleteService(id uint) error {
-	return database.DB.Delete(&Service{}, id).Error
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("service_id = ?", id).Delete(&StaffService{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Service{}, id).Error
+	})
 }
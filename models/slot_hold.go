@@ -0,0 +1,261 @@
+package models
+
+import (
+	"admin-api/common/constant"
+	"admin-api/database"
+	"admin-api/pkg/redis"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	"gorm.io/gorm/clause"
+)
+
+// SlotHold 用户在结账期间对时间段的临时预留，存储在Redis中，到期自动失效。
+// 预留期间其他用户看不到该名额，本人创建预约时自动消费预留。
+type SlotHold struct {
+	ID         string    `json:"hold_id"`
+	UserID     uint      `json:"user_id"`
+	MerchantID uint      `json:"merchant_id"`
+	ServiceID  uint      `json:"service_id"`
+	StaffID    uint      `json:"staff_id"`
+	TimeSlotID uint      `json:"time_slot_id"` // 预留的起始时间段
+	SlotIDs    []uint    `json:"slot_ids"`     // 覆盖服务时长的全部时间段
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Redis 键：
+//
+//	slot:hold:{holdID}        预留详情（JSON），带过期时间
+//	slot:hold:slot:{slotID}   时间段上的预留集合，成员为 {userID}:{holdID}，分数为过期时间戳
+//	slot:hold:user:{userID}   用户当前的预留ID，每个用户同时只保留一个
+func slotHoldKey(holdID string) string {
+	return constant.SLOT_HOLD_KEY_PREFIX + holdID
+}
+
+func slotHoldSlotKey(slotID uint) string {
+	return fmt.Sprintf("%sslot:%d", constant.SLOT_HOLD_KEY_PREFIX, slotID)
+}
+
+func slotHoldUserKey(userID uint) string {
+	return fmt.Sprintf("%suser:%d", constant.SLOT_HOLD_KEY_PREFIX, userID)
+}
+
+func newSlotHoldID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// CreateSlotHold 为用户预留从 timeSlotID 开始、覆盖服务时长的时间段 minutes 分钟。
+// 同一用户再次预留时，之前的预留自动释放。
+func CreateSlotHold(userID, merchantID, serviceID, staffID, timeSlotID uint, minutes int) (*SlotHold, error) {
+	if redis.RedisDb == nil {
+		return nil, errors.New("预留服务暂不可用")
+	}
+	ctx := context.Background()
+
+	// 先释放用户之前的预留，避免占用自己要预留的名额
+	if err := releaseUserSlotHold(ctx, userID, 0); err != nil {
+		return nil, err
+	}
+
+	// 锁定时间段，保证并发预留时名额判断和写入Redis是串行的
+	tx := database.DB.Begin()
+	defer tx.Rollback()
+
+	var first TimeSlot
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&first, timeSlotID).Error; err != nil {
+		return nil, errors.New("时间段不存在")
+	}
+	if first.MerchantID != merchantID || first.StaffID != staffID {
+		return nil, errors.New("时间段与所选员工不匹配")
+	}
+
+	service, err := staffServiceTx(tx, merchantID, serviceID, staffID)
+	if err != nil {
+		return nil, err
+	}
+
+	run, err := lockBookingSlots(tx, first, service, userID, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	holdID, err := newSlotHoldID()
+	if err != nil {
+		return nil, err
+	}
+	hold := &SlotHold{
+		ID:         holdID,
+		UserID:     userID,
+		MerchantID: merchantID,
+		ServiceID:  serviceID,
+		StaffID:    staffID,
+		TimeSlotID: timeSlotID,
+		ExpiresAt:  time.Now().Add(time.Duration(minutes) * time.Minute),
+	}
+	for _, s := range run {
+		hold.SlotIDs = append(hold.SlotIDs, s.ID)
+	}
+
+	data, err := json.Marshal(hold)
+	if err != nil {
+		return nil, err
+	}
+	ttl := time.Until(hold.ExpiresAt)
+	member := fmt.Sprintf("%d:%s", userID, holdID)
+
+	pipe := redis.RedisDb.TxPipeline()
+	pipe.Set(ctx, slotHoldKey(holdID), data, ttl)
+	pipe.Set(ctx, slotHoldUserKey(userID), holdID, ttl)
+	for _, id := range hold.SlotIDs {
+		key := slotHoldSlotKey(id)
+		pipe.ZAdd(ctx, key, &goredis.Z{Score: float64(hold.ExpiresAt.Unix()), Member: member})
+		// 集合本身在最后一个预留过期后不久自动删除
+		pipe.Expire(ctx, key, time.Duration(constant.SlotHoldMaxMinutes+1)*time.Minute)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("预留失败: %v", err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// GetSlotHold 获取用户的预留，已过期或不属于该用户时返回错误
+func GetSlotHold(userID uint, holdID string) (*SlotHold, error) {
+	if redis.RedisDb == nil {
+		return nil, errors.New("预留服务暂不可用")
+	}
+	data, err := redis.RedisDb.Get(context.Background(), slotHoldKey(holdID)).Bytes()
+	if err != nil {
+		if errors.Is(err, goredis.Nil) {
+			return nil, errors.New("预留不存在或已过期")
+		}
+		return nil, err
+	}
+	var hold SlotHold
+	if err := json.Unmarshal(data, &hold); err != nil {
+		return nil, err
+	}
+	if hold.UserID != userID {
+		return nil, errors.New("预留不存在或已过期")
+	}
+	return &hold, nil
+}
+
+// ReleaseSlotHold 用户主动释放预留
+func ReleaseSlotHold(userID uint, holdID string) error {
+	hold, err := GetSlotHold(userID, holdID)
+	if err != nil {
+		return err
+	}
+	return deleteSlotHold(context.Background(), hold)
+}
+
+// releaseUserSlotHold 释放用户当前的预留；timeSlotID 大于0时只释放起始于该时间段的预留
+func releaseUserSlotHold(ctx context.Context, userID, timeSlotID uint) error {
+	if redis.RedisDb == nil {
+		return nil
+	}
+	holdID, err := redis.RedisDb.Get(ctx, slotHoldUserKey(userID)).Result()
+	if errors.Is(err, goredis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	hold, err := GetSlotHold(userID, holdID)
+	if err != nil {
+		// 预留已过期，只清理用户索引
+		return redis.RedisDb.Del(ctx, slotHoldUserKey(userID)).Err()
+	}
+	if timeSlotID > 0 && hold.TimeSlotID != timeSlotID {
+		return nil
+	}
+	return deleteSlotHold(ctx, hold)
+}
+
+func deleteSlotHold(ctx context.Context, hold *SlotHold) error {
+	member := fmt.Sprintf("%d:%s", hold.UserID, hold.ID)
+	pipe := redis.RedisDb.TxPipeline()
+	pipe.Del(ctx, slotHoldKey(hold.ID), slotHoldUserKey(hold.UserID))
+	for _, id := range hold.SlotIDs {
+		pipe.ZRem(ctx, slotHoldSlotKey(id), member)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// consumeSlotHold 用户预约成功后消费其对该时间段的预留
+func consumeSlotHold(userID, timeSlotID uint) {
+	if err := releaseUserSlotHold(context.Background(), userID, timeSlotID); err != nil {
+		log.Printf("消费时间段预留失败: %v", err)
+	}
+}
+
+// slotHoldCounts 返回各时间段上未过期的预留数量，不计 excludeUserID 本人的预留
+func slotHoldCounts(slotIDs []uint, excludeUserID uint) (map[uint]int, error) {
+	counts := make(map[uint]int)
+	if redis.RedisDb == nil || len(slotIDs) == 0 {
+		return counts, nil
+	}
+	ctx := context.Background()
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	pipe := redis.RedisDb.Pipeline()
+	cmds := make(map[uint]*goredis.StringSliceCmd, len(slotIDs))
+	for _, id := range slotIDs {
+		key := slotHoldSlotKey(id)
+		// 顺带清理已过期的预留
+		pipe.ZRemRangeByScore(ctx, key, "-inf", "("+now)
+		cmds[id] = pipe.ZRangeByScore(ctx, key, &goredis.ZRangeBy{Min: now, Max: "+inf"})
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, goredis.Nil) {
+		return nil, err
+	}
+
+	exclude := fmt.Sprintf("%d:", excludeUserID)
+	for id, cmd := range cmds {
+		for _, member := range cmd.Val() {
+			if excludeUserID > 0 && strings.HasPrefix(member, exclude) {
+				continue
+			}
+			counts[id]++
+		}
+	}
+	return counts, nil
+}
+
+// applySlotHolds 将他人的预留计入时间段（仅修改内存中的数据），预留占满名额的时间段标记为不可用。
+// Redis 不可用时不影响正常预约。
+func applySlotHolds(slots []TimeSlot, excludeUserID uint) {
+	ids := make([]uint, 0, len(slots))
+	for _, s := range slots {
+		ids = append(ids, s.ID)
+	}
+	counts, err := slotHoldCounts(ids, excludeUserID)
+	if err != nil {
+		log.Printf("查询时间段预留失败: %v", err)
+		return
+	}
+	for i := range slots {
+		slots[i].HeldCount = counts[slots[i].ID]
+		if slots[i].IsAvailable && slots[i].RemainingSeats() <= 0 {
+			slots[i].IsAvailable = false
+		}
+	}
+}
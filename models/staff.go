@@ -6,14 +6,15 @@ import (
 )
 
 type Staff struct {
-	ID          uint   `gorm:"primaryKey"`
-	MerchantID  uint   `gorm:"index;not null"`
-	Name        string `gorm:"size:50;not null"`
-	Avatar      string `gorm:"size:255"`
-	Position    string `gorm:"size:50"`
-	Description string `gorm:"type:text"`
-	Specialties string `gorm:"type:text"`
-	IsActive    bool   `gorm:"default:true;not null"`
+	ID          uint    `gorm:"primaryKey"`
+	MerchantID  uint    `gorm:"index;not null"`
+	Name        string  `gorm:"size:50;not null"`
+	Avatar      string  `gorm:"size:255"`
+	Position    string  `gorm:"size:50"`
+	Description string  `gorm:"type:text"`
+	Specialties string  `gorm:"type:text"`
+	Rating      float64 `gorm:"type:decimal(3,2);default:0;not null"` // 评分（0-5），用于按评分分配员工
+	IsActive    bool    `gorm:"default:true;not null"`
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 }
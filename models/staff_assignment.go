@@ -0,0 +1,230 @@
+package models
+
+import (
+	"admin-api/database"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StaffAssignCursor 轮流分配员工的游标，每个商家的每个服务一条，记录上一次分配的员工
+type StaffAssignCursor struct {
+	ID          uint `gorm:"primaryKey"`
+	MerchantID  uint `gorm:"uniqueIndex:idx_staff_assign_cursor;not null"`
+	ServiceID   uint `gorm:"uniqueIndex:idx_staff_assign_cursor;not null"`
+	LastStaffID uint `gorm:"default:0;not null"`
+	UpdatedAt   time.Time
+}
+
+// CreateAnyStaffAppointment 不指定员工预约：按商家配置的分配方式，从可提供该服务且在 startTime 有空的员工中选择一位
+func CreateAnyStaffAppointment(userID, merchantID, serviceID uint, date time.Time, startTime string,
+	couponID uint, remark string) (*Appointment, error) {
+
+	tx := database.DB.Begin()
+
+	appointment, err := createAnyStaffAppointmentTx(tx, userID, merchantID, serviceID, date, startTime, couponID, remark)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("提交事务失败")
+	}
+
+	consumeSlotHold(userID, appointment.TimeSlotID)
+
+	return appointment, nil
+}
+
+func createAnyStaffAppointmentTx(tx *gorm.DB, userID, merchantID, serviceID uint, date time.Time, startTime string,
+	couponID uint, remark string) (*Appointment, error) {
+
+	start, err := parseClock(startTime)
+	if err != nil {
+		return nil, errors.New("无效的开始时间")
+	}
+
+	setting, err := getMerchantSetting(tx, merchantID)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates, err := qualifiedStaffIDs(tx, merchantID, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return nil, errors.New("暂无可提供该服务的员工")
+	}
+
+	// 轮流分配时先锁定游标，同一服务的并发预约依次分配
+	var cursor *StaffAssignCursor
+	if setting.StaffAssignStrategy == StaffAssignRoundRobin {
+		if cursor, err = lockStaffAssignCursor(tx, merchantID, serviceID); err != nil {
+			return nil, err
+		}
+	}
+
+	// 按ID顺序锁定候选员工当天的全部时间段，选择员工时看到的预约情况不会被并发请求改变
+	var slots []TimeSlot
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("merchant_id = ? AND staff_id IN (?) AND date = ?", merchantID, candidates, date.Format("2006-01-02")).
+		Order("id ASC").
+		Find(&slots).Error; err != nil {
+		return nil, err
+	}
+	firstByStaff := make(map[uint]TimeSlot)
+	for _, slot := range slots {
+		if minutes, err := parseClock(slot.StartTime); err == nil && minutes == start {
+			firstByStaff[slot.StaffID] = slot
+		}
+	}
+
+	ordered, err := orderStaffCandidates(tx, setting.StaffAssignStrategy, merchantID, date, candidates, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, staffID := range ordered {
+		first, ok := firstByStaff[staffID]
+		if !ok {
+			continue
+		}
+		service, err := staffServiceTx(tx, merchantID, serviceID, staffID)
+		if err != nil {
+			continue
+		}
+		run, err := lockBookingSlots(tx, first, service, userID, 0)
+		if err != nil {
+			continue
+		}
+		slotIDs := make([]uint, 0, len(run))
+		for _, s := range run {
+			slotIDs = append(slotIDs, s.ID)
+		}
+		if err := checkDuplicateGroupBooking(tx, userID, first, slotIDs); err != nil {
+			continue
+		}
+
+		appointment, err := createAppointmentTx(tx, userID, merchantID, serviceID, staffID, first.ID, date, couponID, remark)
+		if err != nil {
+			return nil, err
+		}
+		if cursor != nil {
+			if err := tx.Model(cursor).Update("last_staff_id", staffID).Error; err != nil {
+				return nil, err
+			}
+		}
+		return appointment, nil
+	}
+
+	return nil, errors.New("该时间暂无可预约的员工")
+}
+
+// qualifiedStaffIDs 返回商家中可提供该服务的在职员工ID，按ID升序
+func qualifiedStaffIDs(tx *gorm.DB, merchantID, serviceID uint) ([]uint, error) {
+	var ids []uint
+	err := tx.Model(&StaffService{}).
+		Joins("JOIN staff ON staff.id = staff_services.staff_id").
+		Where("staff_services.service_id = ? AND staff.merchant_id = ? AND staff.is_active = true", serviceID, merchantID).
+		Order("staff_services.staff_id ASC").
+		Pluck("staff_services.staff_id", &ids).Error
+	return ids, err
+}
+
+// lockStaffAssignCursor 锁定轮流分配游标，不存在时创建
+func lockStaffAssignCursor(tx *gorm.DB, merchantID, serviceID uint) (*StaffAssignCursor, error) {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&StaffAssignCursor{MerchantID: merchantID, ServiceID: serviceID}).Error; err != nil {
+		return nil, err
+	}
+	var cursor StaffAssignCursor
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("merchant_id = ? AND service_id = ?", merchantID, serviceID).
+		First(&cursor).Error; err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+// orderStaffCandidates 按分配方式对候选员工排序，依次尝试
+func orderStaffCandidates(tx *gorm.DB, strategy string, merchantID uint, date time.Time, candidates []uint,
+	cursor *StaffAssignCursor) ([]uint, error) {
+
+	ordered := append([]uint(nil), candidates...)
+
+	switch strategy {
+	case StaffAssignRoundRobin:
+		// 从上次分配的员工之后开始轮转
+		next := sort.Search(len(candidates), func(i int) bool { return candidates[i] > cursor.LastStaffID })
+		ordered = append(append([]uint(nil), candidates[next:]...), candidates[:next]...)
+
+	case StaffAssignHighestRated:
+		var staff []Staff
+		if err := tx.Select("id, rating").Where("id IN (?)", candidates).Find(&staff).Error; err != nil {
+			return nil, err
+		}
+		ratings := make(map[uint]float64, len(staff))
+		for _, s := range staff {
+			ratings[s.ID] = s.Rating
+		}
+		sort.SliceStable(ordered, func(i, j int) bool { return ratings[ordered[i]] > ratings[ordered[j]] })
+
+	default:
+		// 当天有效预约最少的员工优先
+		var rows []struct {
+			StaffID uint
+			Total   int
+		}
+		if err := tx.Model(&Appointment{}).
+			Select("staff_id, COUNT(*) AS total").
+			Where("merchant_id = ? AND appointment_date = ? AND staff_id IN (?) AND status IN (?)",
+				merchantID, date.Format("2006-01-02"), candidates, activeAppointmentStatuses).
+			Group("staff_id").
+			Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		counts := make(map[uint]int, len(rows))
+		for _, r := range rows {
+			counts[r.StaffID] = r.Total
+		}
+		sort.SliceStable(ordered, func(i, j int) bool { return counts[ordered[i]] < counts[ordered[j]] })
+	}
+
+	return ordered, nil
+}
+
+// GetAnyStaffStartTimes 获取某天至少有一位可提供该服务的员工有空的开始时间（HH:MM），用于不指定员工预约
+func GetAnyStaffStartTimes(merchantID, serviceID uint, date time.Time) ([]string, error) {
+	candidates, err := qualifiedStaffIDs(database.DB, merchantID, serviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	result := make([]string, 0)
+	for _, staffID := range candidates {
+		service, err := staffServiceTx(database.DB, merchantID, serviceID, staffID)
+		if err != nil {
+			continue
+		}
+		slots, err := GetAvailableTimeSlots(merchantID, staffID, date, service)
+		if err != nil {
+			return nil, err
+		}
+		for _, slot := range slots {
+			start := formatSlotClock(slot.StartTime)
+			if !seen[start] {
+				seen[start] = true
+				result = append(result, start)
+			}
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
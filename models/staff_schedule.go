@@ -0,0 +1,445 @@
+package models
+
+import (
+	"admin-api/database"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// BreakPeriod 排班中的休息时段
+type BreakPeriod struct {
+	StartTime string `json:"start_time"` // HH:MM
+	EndTime   string `json:"end_time"`   // HH:MM
+}
+
+// BreakPeriods 休息时段列表，以JSON文本存储
+type BreakPeriods []BreakPeriod
+
+func (b *BreakPeriods) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*b = nil
+		return nil
+	case []byte:
+		if len(v) == 0 {
+			*b = nil
+			return nil
+		}
+		return json.Unmarshal(v, b)
+	case string:
+		if v == "" {
+			*b = nil
+			return nil
+		}
+		return json.Unmarshal([]byte(v), b)
+	default:
+		return fmt.Errorf("无法扫描类型 %T 到 BreakPeriods", value)
+	}
+}
+
+func (b BreakPeriods) Value() (driver.Value, error) {
+	if len(b) == 0 {
+		return "[]", nil
+	}
+	data, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// StaffScheduleTemplate 员工每周排班模板
+type StaffScheduleTemplate struct {
+	ID            uint         `gorm:"primaryKey" json:"id"`
+	MerchantID    uint         `gorm:"index;not null" json:"merchant_id"`
+	StaffID       uint         `gorm:"index;not null" json:"staff_id"`
+	Weekday       int          `gorm:"not null" json:"weekday"`                 // 星期(0-周日, 1-周一 ... 6-周六)
+	StartTime     string       `gorm:"size:8;not null" json:"start_time"`       // 上班时间 HH:MM
+	EndTime       string       `gorm:"size:8;not null" json:"end_time"`         // 下班时间 HH:MM
+	SlotMinutes   int          `gorm:"default:30;not null" json:"slot_minutes"` // 单个时间段长度(分钟)
+	Capacity      int          `gorm:"default:1;not null" json:"capacity"`      // 每个时间段可预约人数，团课大于1
+	Breaks        BreakPeriods `gorm:"type:text" json:"breaks"`                 // 休息时段
+	EffectiveFrom time.Time    `gorm:"type:date;not null" json:"effective_from"`
+	EffectiveTo   *time.Time   `gorm:"type:date" json:"effective_to"` // 为空表示长期有效
+	IsActive      bool         `gorm:"default:true;not null" json:"is_active"`
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+}
+
+// ScheduleGenerateResult 排班生成结果
+type ScheduleGenerateResult struct {
+	Created int `json:"created"` // 新生成的时间段数
+	Removed int `json:"removed"` // 因模板变更移除的空闲时间段数
+	Skipped int `json:"skipped"` // 已存在或与现有时间段冲突而跳过的数量
+}
+
+// ValidateScheduleTemplate 校验排班模板
+func ValidateScheduleTemplate(t *StaffScheduleTemplate) error {
+	if t.Weekday < 0 || t.Weekday > 6 {
+		return errors.New("无效的星期")
+	}
+	if t.SlotMinutes <= 0 {
+		return errors.New("时间段长度必须大于0")
+	}
+
+	start, err := parseClock(t.StartTime)
+	if err != nil {
+		return err
+	}
+	end, err := parseClock(t.EndTime)
+	if err != nil {
+		return err
+	}
+	if start >= end {
+		return errors.New("开始时间必须早于结束时间")
+	}
+	if end-start < t.SlotMinutes {
+		return errors.New("工作时长不足一个时间段")
+	}
+
+	for _, b := range t.Breaks {
+		bs, err := parseClock(b.StartTime)
+		if err != nil {
+			return err
+		}
+		be, err := parseClock(b.EndTime)
+		if err != nil {
+			return err
+		}
+		if bs >= be || bs < start || be > end {
+			return fmt.Errorf("休息时段 %s-%s 无效", b.StartTime, b.EndTime)
+		}
+	}
+
+	if t.Capacity < 1 {
+		return errors.New("可预约人数必须大于0")
+	}
+
+	if t.EffectiveTo != nil && t.EffectiveTo.Before(t.EffectiveFrom) {
+		return errors.New("生效结束日期不能早于开始日期")
+	}
+	return nil
+}
+
+func GetScheduleTemplates(merchantID, staffID uint) ([]StaffScheduleTemplate, error) {
+	var templates []StaffScheduleTemplate
+	query := database.DB.Where("merchant_id = ?", merchantID)
+	if staffID > 0 {
+		query = query.Where("staff_id = ?", staffID)
+	}
+	err := query.Order("staff_id ASC, weekday ASC, start_time ASC").Find(&templates).Error
+	return templates, err
+}
+
+func GetScheduleTemplateByID(id uint) (*StaffScheduleTemplate, error) {
+	var template StaffScheduleTemplate
+	err := database.DB.First(&template, id).Error
+	return &template, err
+}
+
+func CreateScheduleTemplate(template *StaffScheduleTemplate) error {
+	return database.DB.Create(template).Error
+}
+
+func UpdateScheduleTemplate(template *StaffScheduleTemplate) error {
+	return database.DB.Save(template).Error
+}
+
+// DeleteScheduleTemplate 删除排班模板，已生成的时间段保留，下次生成时清理其中未被预约的部分
+func DeleteScheduleTemplate(id uint) error {
+	return database.DB.Delete(&StaffScheduleTemplate{}, id).Error
+}
+
+// GenerateTimeSlotsFromTemplates 按排班模板为商家生成未来 days 天（含今天）的时间段
+// 生成过程是幂等的：已存在的时间段不会重复创建，存在有效预约的时间段不会被修改
+func GenerateTimeSlotsFromTemplates(merchantID uint, days int) (*ScheduleGenerateResult, error) {
+	var templates []StaffScheduleTemplate
+	if err := database.DB.Where("merchant_id = ? AND is_active = true", merchantID).
+		Find(&templates).Error; err != nil {
+		return nil, err
+	}
+
+	// 按员工分组
+	byStaff := make(map[uint][]StaffScheduleTemplate)
+	for _, t := range templates {
+		byStaff[t.StaffID] = append(byStaff[t.StaffID], t)
+	}
+
+	// 已停用模板生成的时间段也需要清理，因此把这些员工一并纳入
+	var staffIDs []uint
+	if err := database.DB.Model(&TimeSlot{}).
+		Where("merchant_id = ? AND template_id > 0", merchantID).
+		Distinct("staff_id").Pluck("staff_id", &staffIDs).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range staffIDs {
+		if _, ok := byStaff[id]; !ok {
+			byStaff[id] = nil
+		}
+	}
+
+	result := &ScheduleGenerateResult{}
+	// 按商家时区的今天开始生成
+	today := civilDate(MerchantNow(merchantID))
+
+	// 模板时段超出营业时间的部分不生成
+	business, err := loadBusinessCalendar(merchantID, today, today.AddDate(0, 0, days))
+	if err != nil {
+		return nil, err
+	}
+
+	for staffID, staffTemplates := range byStaff {
+		for i := 0; i < days; i++ {
+			date := today.AddDate(0, 0, i)
+			if err := generateStaffDaySlots(merchantID, staffID, date, staffTemplates, business, result); err != nil {
+				return result, fmt.Errorf("生成员工%d在%s的时间段失败: %w",
+					staffID, date.Format("2006-01-02"), err)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// GenerateAllTimeSlots 为所有配置了排班模板的商家生成时间段。
+// 模板已全部删除的商家也会处理，以清理之前按模板生成的未来时间段
+func GenerateAllTimeSlots(days int) (*ScheduleGenerateResult, error) {
+	var merchantIDs []uint
+	if err := database.DB.Model(&StaffScheduleTemplate{}).
+		Distinct("merchant_id").Pluck("merchant_id", &merchantIDs).Error; err != nil {
+		return nil, err
+	}
+
+	// 各商家时区的今天可能比服务器早一天，多查一天
+	var generated []uint
+	if err := database.DB.Model(&TimeSlot{}).
+		Where("template_id > 0 AND date >= ?", civilDate(time.Now()).AddDate(0, 0, -1)).
+		Distinct("merchant_id").Pluck("merchant_id", &generated).Error; err != nil {
+		return nil, err
+	}
+	seen := make(map[uint]bool, len(merchantIDs))
+	for _, id := range merchantIDs {
+		seen[id] = true
+	}
+	for _, id := range generated {
+		if !seen[id] {
+			seen[id] = true
+			merchantIDs = append(merchantIDs, id)
+		}
+	}
+
+	total := &ScheduleGenerateResult{}
+	for _, merchantID := range merchantIDs {
+		result, err := GenerateTimeSlotsFromTemplates(merchantID, days)
+		if result != nil {
+			total.Created += result.Created
+			total.Removed += result.Removed
+			total.Skipped += result.Skipped
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// templateSlot 模板展开后的单个时间段
+type templateSlot struct {
+	templateID uint
+	start      int
+	end        int
+	capacity   int
+}
+
+// expandTemplate 将模板展开为时间段，跳过与休息时段重叠的部分
+func expandTemplate(t StaffScheduleTemplate) []templateSlot {
+	start, err := parseClock(t.StartTime)
+	if err != nil {
+		return nil
+	}
+	end, err := parseClock(t.EndTime)
+	if err != nil || t.SlotMinutes <= 0 {
+		return nil
+	}
+
+	type period struct{ start, end int }
+	var breaks []period
+	for _, b := range t.Breaks {
+		bs, err1 := parseClock(b.StartTime)
+		be, err2 := parseClock(b.EndTime)
+		if err1 == nil && err2 == nil {
+			breaks = append(breaks, period{bs, be})
+		}
+	}
+
+	capacity := t.Capacity
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	var slots []templateSlot
+	cursor := start
+	for cursor+t.SlotMinutes <= end {
+		slotEnd := cursor + t.SlotMinutes
+
+		// 与休息时段重叠时，从休息结束后重新开始排
+		overlapped := false
+		for _, b := range breaks {
+			if cursor < b.end && slotEnd > b.start {
+				cursor = b.end
+				overlapped = true
+				break
+			}
+		}
+		if overlapped {
+			continue
+		}
+
+		slots = append(slots, templateSlot{templateID: t.ID, start: cursor, end: slotEnd, capacity: capacity})
+		cursor = slotEnd
+	}
+	return slots
+}
+
+// templateAppliesOn 判断模板在指定日期是否生效
+func templateAppliesOn(t StaffScheduleTemplate, date time.Time) bool {
+	if int(date.Weekday()) != t.Weekday {
+		return false
+	}
+	day := date.Format("2006-01-02")
+	if t.EffectiveFrom.Format("2006-01-02") > day {
+		return false
+	}
+	if t.EffectiveTo != nil && t.EffectiveTo.Format("2006-01-02") < day {
+		return false
+	}
+	return true
+}
+
+func generateStaffDaySlots(merchantID, staffID uint, date time.Time, templates []StaffScheduleTemplate,
+	business *businessCalendar, result *ScheduleGenerateResult) error {
+
+	var desired []templateSlot
+	for _, t := range templates {
+		if !t.IsActive || !templateAppliesOn(t, date) {
+			continue
+		}
+		for _, slot := range expandTemplate(t) {
+			if business.configured() && !business.within(date, slot.start, slot.end) {
+				result.Skipped++
+				continue
+			}
+			desired = append(desired, slot)
+		}
+	}
+
+	tx := database.DB.Begin()
+
+	var existing []TimeSlot
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("merchant_id = ? AND staff_id = ? AND date = ?",
+			merchantID, staffID, date.Format("2006-01-02")).
+		Find(&existing).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	booked, err := bookedAppointmentsBySlot(tx, existing)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	applySlotHolds(existing, 0)
+
+	// 1. 清理模板已不再包含、且没有预约和保留名额的模板时间段
+	var kept []TimeSlot
+	for _, slot := range existing {
+		taken := len(booked[slot.ID]) > 0 || slot.BookedCount > 0 || slot.HeldCount > 0
+		if slot.TemplateID > 0 && slot.IsAvailable && !taken && !containsTemplateSlot(desired, slot) {
+			if err := tx.Delete(&TimeSlot{}, slot.ID).Error; err != nil {
+				tx.Rollback()
+				return err
+			}
+			result.Removed++
+			continue
+		}
+
+		// 模板容量调整后同步到已生成的时间段，不能小于已占用和保留的名额
+		if d := findTemplateSlot(desired, slot); d != nil && d.capacity != slot.Capacity &&
+			d.capacity >= slot.BookedCount+slot.HeldCount {
+			if err := tx.Model(&TimeSlot{}).Where("id = ?", slot.ID).
+				Updates(map[string]interface{}{
+					"capacity":     d.capacity,
+					"is_available": slot.BookedCount < d.capacity,
+				}).Error; err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		kept = append(kept, slot)
+	}
+
+	// 2. 创建缺失的时间段，与现有时间段重叠的跳过（包括手动创建和已被预约的）
+	for _, d := range desired {
+		if overlapsExisting(kept, d.start, d.end) {
+			result.Skipped++
+			continue
+		}
+		slot := TimeSlot{
+			MerchantID:  merchantID,
+			StaffID:     staffID,
+			Date:        date,
+			StartTime:   formatClock(d.start),
+			EndTime:     formatClock(d.end),
+			IsAvailable: true,
+			Capacity:    d.capacity,
+			TemplateID:  d.templateID,
+		}
+		if err := tx.Create(&slot).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		kept = append(kept, slot)
+		result.Created++
+	}
+
+	return tx.Commit().Error
+}
+
+func containsTemplateSlot(desired []templateSlot, slot TimeSlot) bool {
+	return findTemplateSlot(desired, slot) != nil
+}
+
+// findTemplateSlot 返回与已有时间段对应的模板时间段，不存在时返回nil
+func findTemplateSlot(desired []templateSlot, slot TimeSlot) *templateSlot {
+	start, err1 := parseClock(slot.StartTime)
+	end, err2 := parseClock(slot.EndTime)
+	if err1 != nil || err2 != nil {
+		return nil
+	}
+	for i, d := range desired {
+		if d.templateID == slot.TemplateID && d.start == start && d.end == end {
+			return &desired[i]
+		}
+	}
+	return nil
+}
+
+func overlapsExisting(slots []TimeSlot, start, end int) bool {
+	for _, s := range slots {
+		ss, err1 := parseClock(s.StartTime)
+		se, err2 := parseClock(s.EndTime)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		if start < se && end > ss {
+			return true
+		}
+	}
+	return false
+}
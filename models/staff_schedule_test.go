@@ -0,0 +1,37 @@
+package models
+
+import (
+	"admin-api/database"
+	"testing"
+)
+
+// TestGenerateAllTimeSlotsCleansMerchantWithoutTemplates 商家删除全部模板后，
+// 之前生成的未来时间段中没有预约和保留名额的应被清理
+func TestGenerateAllTimeSlotsCleansMerchantWithoutTemplates(t *testing.T) {
+	setupBookingDB(t, &StaffScheduleTemplate{}, &MerchantBusinessHour{}, &MerchantBusinessHourException{})
+
+	f := newBookingFixture(t, 30)
+	// 空闲、候补保留（无预约记录）、已预约、手动创建
+	slots := f.createSlots(t, slotSpec{1, 0}, slotSpec{2, 1}, slotSpec{1, 1}, slotSpec{1, 0})
+	f.bookAppointment(t, 1, slots[2:3])
+	if err := database.DB.Model(&TimeSlot{}).Where("id IN (?)", []uint{slots[0].ID, slots[1].ID, slots[2].ID}).
+		Update("template_id", 1).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := GenerateAllTimeSlots(7)
+	if err != nil {
+		t.Fatalf("生成时间段失败: %v", err)
+	}
+	if result.Removed != 1 {
+		t.Fatalf("清理 %d 个时间段, 期望 1", result.Removed)
+	}
+	var remaining []uint
+	if err := database.DB.Model(&TimeSlot{}).Order("start_time ASC").Pluck("id", &remaining).Error; err != nil {
+		t.Fatal(err)
+	}
+	want := []uint{slots[1].ID, slots[2].ID, slots[3].ID}
+	if len(remaining) != len(want) || remaining[0] != want[0] || remaining[1] != want[1] || remaining[2] != want[2] {
+		t.Fatalf("剩余时间段 = %v, 期望 %v", remaining, want)
+	}
+}
@@ -0,0 +1,222 @@
+package models
+
+import (
+	"admin-api/database"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StaffService 员工可提供的服务（技能），可按员工单独设置价格和时长
+type StaffService struct {
+	ID         uint `gorm:"primaryKey"`
+	MerchantID uint `gorm:"index;not null"`
+	StaffID    uint `gorm:"uniqueIndex:idx_staff_service;not null"`
+	ServiceID  uint `gorm:"uniqueIndex:idx_staff_service;index;not null"`
+	Price      *int `gorm:"type:int"` // 员工单独定价（分），为空时使用服务价格
+	Duration   *int // 员工单独时长（分钟），为空时使用服务时长
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+
+	Staff   Staff   `gorm:"foreignKey:StaffID" json:"-"`
+	Service Service `gorm:"foreignKey:ServiceID" json:"-"`
+}
+
+// ServiceStaff 可提供某服务的员工，Price 和 Duration 为该员工的实际价格和时长
+type ServiceStaff struct {
+	Staff
+	Price    int
+	Duration int
+}
+
+// applyTo 返回应用员工单独定价和时长后的服务
+func (s *StaffService) applyTo(service Service) Service {
+	if s.Price != nil {
+		service.Price = *s.Price
+	}
+	if s.Duration != nil {
+		service.Duration = *s.Duration
+	}
+	return service
+}
+
+// ValidateStaffServices 校验员工服务设置
+func ValidateStaffServices(items []StaffService) error {
+	seen := make(map[[2]uint]bool, len(items))
+	for _, item := range items {
+		if item.Price != nil && *item.Price < 0 {
+			return errors.New("价格不能为负数")
+		}
+		if item.Duration != nil && *item.Duration <= 0 {
+			return errors.New("服务时长必须大于0")
+		}
+		key := [2]uint{item.StaffID, item.ServiceID}
+		if seen[key] {
+			return errors.New("存在重复的员工服务设置")
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// GetStaffServices 获取员工可提供的服务设置
+func GetStaffServices(staffID uint) ([]StaffService, error) {
+	var items []StaffService
+	err := database.DB.Where("staff_id = ?", staffID).Order("service_id ASC").Find(&items).Error
+	return items, err
+}
+
+// GetServiceStaffSettings 获取服务关联的员工设置
+func GetServiceStaffSettings(serviceID uint) ([]StaffService, error) {
+	var items []StaffService
+	err := database.DB.Where("service_id = ?", serviceID).Order("staff_id ASC").Find(&items).Error
+	return items, err
+}
+
+// SetStaffServices 替换员工可提供的服务，服务须属于同一商家
+func SetStaffServices(merchantID, staffID uint, items []StaffService) error {
+	serviceIDs := make([]uint, 0, len(items))
+	for i := range items {
+		items[i].MerchantID = merchantID
+		items[i].StaffID = staffID
+		serviceIDs = append(serviceIDs, items[i].ServiceID)
+	}
+	if err := ValidateStaffServices(items); err != nil {
+		return err
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkMerchantOwns(tx, &Service{}, merchantID, serviceIDs, "服务不存在"); err != nil {
+			return err
+		}
+		if err := tx.Where("staff_id = ?", staffID).Delete(&StaffService{}).Error; err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		return tx.Create(&items).Error
+	})
+}
+
+// SetServiceStaff 替换可提供服务的员工，员工须属于同一商家
+func SetServiceStaff(merchantID, serviceID uint, items []StaffService) error {
+	staffIDs := make([]uint, 0, len(items))
+	for i := range items {
+		items[i].MerchantID = merchantID
+		items[i].ServiceID = serviceID
+		staffIDs = append(staffIDs, items[i].StaffID)
+	}
+	if err := ValidateStaffServices(items); err != nil {
+		return err
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkMerchantOwns(tx, &Staff{}, merchantID, staffIDs, "员工不存在"); err != nil {
+			return err
+		}
+		if err := tx.Where("service_id = ?", serviceID).Delete(&StaffService{}).Error; err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		return tx.Create(&items).Error
+	})
+}
+
+// checkMerchantOwns 校验 ids 对应的记录都属于该商家
+func checkMerchantOwns(tx *gorm.DB, model interface{}, merchantID uint, ids []uint, message string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	var count int64
+	if err := tx.Model(model).Where("id IN (?) AND merchant_id = ?", ids, merchantID).Count(&count).Error; err != nil {
+		return err
+	}
+	if int(count) != len(ids) {
+		return errors.New(message)
+	}
+	return nil
+}
+
+// GetServiceAvailableStaff 获取可提供该服务的在职员工，只返回服务所属商家的员工
+func GetServiceAvailableStaff(serviceID uint) ([]ServiceStaff, error) {
+	service, err := GetServiceByID(serviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []StaffService
+	if err := database.DB.Preload("Staff").
+		Joins("JOIN staff ON staff.id = staff_services.staff_id").
+		Where("staff_services.service_id = ? AND staff.merchant_id = ? AND staff.is_active = true",
+			serviceID, service.MerchantID).
+		Order("staff_services.staff_id ASC").
+		Find(&items).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]ServiceStaff, 0, len(items))
+	for _, item := range items {
+		effective := item.applyTo(*service)
+		result = append(result, ServiceStaff{
+			Staff:    item.Staff,
+			Price:    effective.Price,
+			Duration: effective.Duration,
+		})
+	}
+	return result, nil
+}
+
+// GetStaffService 获取员工提供该服务时的实际服务信息（已应用员工单独定价和时长）
+func GetStaffService(serviceID, staffID uint) (*Service, error) {
+	return staffServiceTx(database.DB, 0, serviceID, staffID)
+}
+
+// staffServiceTx 校验员工是否可提供该服务，返回应用员工单独定价和时长后的服务。
+// merchantID 大于0时同时校验服务属于该商家
+func staffServiceTx(tx *gorm.DB, merchantID, serviceID, staffID uint) (*Service, error) {
+	var service Service
+	if err := tx.First(&service, serviceID).Error; err != nil {
+		return nil, errors.New("服务不存在")
+	}
+	if merchantID > 0 && service.MerchantID != merchantID {
+		return nil, errors.New("服务不存在")
+	}
+
+	var staff Staff
+	if err := tx.First(&staff, staffID).Error; err != nil || staff.MerchantID != service.MerchantID || !staff.IsActive {
+		return nil, errors.New("员工不存在")
+	}
+
+	var item StaffService
+	if err := tx.Where("staff_id = ? AND service_id = ?", staffID, serviceID).First(&item).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("该员工不提供此服务")
+		}
+		return nil, err
+	}
+
+	effective := item.applyTo(service)
+	return &effective, nil
+}
+
+// staffServicesByStaff 获取服务下各员工的实际服务信息，key 为员工ID
+func staffServicesByStaff(db *gorm.DB, serviceID uint) (map[uint]*Service, error) {
+	var service Service
+	if err := db.First(&service, serviceID).Error; err != nil {
+		return nil, err
+	}
+	var items []StaffService
+	if err := db.Where("service_id = ?", serviceID).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	result := make(map[uint]*Service, len(items))
+	for _, item := range items {
+		effective := item.applyTo(service)
+		result[item.StaffID] = &effective
+	}
+	return result, nil
+}
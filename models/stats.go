@@ -8,7 +8,7 @@ import (
 
 func GetAppointmentStats(merchantID uint, startDate, endDate string) (gin.H, error) {
 	stats := gin.H{}
-	now := time.Now()
+	now := MerchantNow(merchantID)
 
 	// 1. 获取今日预约数
 	today := now.Format("2006-01-02")
@@ -52,7 +52,11 @@ func GetAppointmentStats(merchantID uint, startDate, endDate string) (gin.H, err
 
 	// 4. 获取不同状态预约数
 	statusStats := make(map[string]int64)
-	statuses := []string{"pending", "confirmed", "completed", "canceled", "rejected"}
+	statuses := []string{
+		AppointmentStatusPending, AppointmentStatusConfirmed, AppointmentStatusPaid, AppointmentStatusCompleted,
+		AppointmentStatusCancelled, AppointmentStatusRejected, AppointmentStatusNoShow,
+		AppointmentStatusRefunding, AppointmentStatusRefunded,
+	}
 
 	for _, status := range statuses {
 		var count int64
@@ -63,10 +67,14 @@ func GetAppointmentStats(merchantID uint, startDate, endDate string) (gin.H, err
 			query = query.Where("appointment_date BETWEEN ? AND ?", startDate, endDate)
 		}
 
-		if err := query.Where("status = ?", status).Count(&count).Error; err == nil {
+		if err := query.Where("status IN (?)", appointmentStatusValues(status)).Count(&count).Error; err == nil {
 			statusStats[status] = count
 		}
 	}
+	// 兼容旧客户端，保留 canceled 键，与 cancelled 数量相同
+	if count, ok := statusStats[AppointmentStatusCancelled]; ok {
+		statusStats[appointmentStatusCanceledLegacy] = count
+	}
 	stats["status"] = statusStats
 
 	// 5. 添加自定义日期范围统计（如果提供了日期范围）
@@ -0,0 +1,274 @@
+package models
+
+import (
+	"admin-api/database"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 员工请假类型
+const (
+	TimeOffTypeVacation = "vacation" // 休假
+	TimeOffTypeSick     = "sick"     // 病假
+	TimeOffTypeBlock    = "block"    // 临时占用（如培训、外出）
+)
+
+// 商家停业类型
+const (
+	ClosureTypeHoliday    = "holiday"    // 节假日
+	ClosureTypeRenovation = "renovation" // 装修
+	ClosureTypeOther      = "other"      // 其他
+)
+
+// StaffTimeOff 员工请假/不可预约时段
+// StartTime、EndTime 为空时表示整天不可预约，否则在日期范围内的每天按该时段屏蔽
+type StaffTimeOff struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	MerchantID uint      `gorm:"index;not null" json:"merchant_id"`
+	StaffID    uint      `gorm:"index;not null" json:"staff_id"`
+	Type       string    `gorm:"size:20;default:'vacation';not null" json:"type"`
+	StartDate  time.Time `gorm:"type:date;not null" json:"start_date"`
+	EndDate    time.Time `gorm:"type:date;not null" json:"end_date"`
+	StartTime  string    `gorm:"size:8" json:"start_time"` // HH:MM，可选
+	EndTime    string    `gorm:"size:8" json:"end_time"`   // HH:MM，可选
+	Reason     string    `gorm:"size:255" json:"reason"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// MerchantClosure 商家停业日（节假日、装修等），期间所有员工均不可预约
+type MerchantClosure struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	MerchantID uint      `gorm:"index;not null" json:"merchant_id"`
+	Type       string    `gorm:"size:20;default:'holiday';not null" json:"type"`
+	StartDate  time.Time `gorm:"type:date;not null" json:"start_date"`
+	EndDate    time.Time `gorm:"type:date;not null" json:"end_date"`
+	Reason     string    `gorm:"size:255" json:"reason"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// ValidateStaffTimeOff 校验请假记录
+func ValidateStaffTimeOff(t *StaffTimeOff) error {
+	switch t.Type {
+	case TimeOffTypeVacation, TimeOffTypeSick, TimeOffTypeBlock:
+	default:
+		return errors.New("无效的请假类型")
+	}
+	if t.EndDate.Before(t.StartDate) {
+		return errors.New("结束日期不能早于开始日期")
+	}
+	if (t.StartTime == "") != (t.EndTime == "") {
+		return errors.New("开始时间和结束时间需同时填写")
+	}
+	if t.StartTime != "" {
+		start, err := parseClock(t.StartTime)
+		if err != nil {
+			return err
+		}
+		end, err := parseClock(t.EndTime)
+		if err != nil {
+			return err
+		}
+		if start >= end {
+			return errors.New("开始时间必须早于结束时间")
+		}
+	}
+	return nil
+}
+
+// ValidateMerchantClosure 校验停业记录
+func ValidateMerchantClosure(c *MerchantClosure) error {
+	switch c.Type {
+	case ClosureTypeHoliday, ClosureTypeRenovation, ClosureTypeOther:
+	default:
+		return errors.New("无效的停业类型")
+	}
+	if c.EndDate.Before(c.StartDate) {
+		return errors.New("结束日期不能早于开始日期")
+	}
+	return nil
+}
+
+func GetStaffTimeOffs(merchantID, staffID uint, from, to string) ([]StaffTimeOff, error) {
+	var timeOffs []StaffTimeOff
+	query := database.DB.Where("merchant_id = ?", merchantID)
+	if staffID > 0 {
+		query = query.Where("staff_id = ?", staffID)
+	}
+	if from != "" {
+		query = query.Where("end_date >= ?", from)
+	}
+	if to != "" {
+		query = query.Where("start_date <= ?", to)
+	}
+	err := query.Order("start_date ASC").Find(&timeOffs).Error
+	return timeOffs, err
+}
+
+func GetStaffTimeOffByID(id uint) (*StaffTimeOff, error) {
+	var timeOff StaffTimeOff
+	err := database.DB.First(&timeOff, id).Error
+	return &timeOff, err
+}
+
+func CreateStaffTimeOff(timeOff *StaffTimeOff) error {
+	return database.DB.Create(timeOff).Error
+}
+
+func DeleteStaffTimeOff(id uint) error {
+	return database.DB.Delete(&StaffTimeOff{}, id).Error
+}
+
+func GetMerchantClosures(merchantID uint, from, to string) ([]MerchantClosure, error) {
+	var closures []MerchantClosure
+	query := database.DB.Where("merchant_id = ?", merchantID)
+	if from != "" {
+		query = query.Where("end_date >= ?", from)
+	}
+	if to != "" {
+		query = query.Where("start_date <= ?", to)
+	}
+	err := query.Order("start_date ASC").Find(&closures).Error
+	return closures, err
+}
+
+func GetMerchantClosureByID(id uint) (*MerchantClosure, error) {
+	var closure MerchantClosure
+	err := database.DB.First(&closure, id).Error
+	return &closure, err
+}
+
+func CreateMerchantClosure(closure *MerchantClosure) error {
+	return database.DB.Create(closure).Error
+}
+
+func DeleteMerchantClosure(id uint) error {
+	return database.DB.Delete(&MerchantClosure{}, id).Error
+}
+
+// GetAffectedAppointments 查询与屏蔽时段重叠的有效预约，staffID 为0时查询全部员工
+// startTime、endTime 为空时表示整天
+func GetAffectedAppointments(merchantID, staffID uint, startDate, endDate time.Time,
+	startTime, endTime string) ([]Appointment, error) {
+
+	var appointments []Appointment
+	query := database.DB.Preload("User").Preload("Service").Preload("Staff").
+		Where("merchant_id = ? AND status IN (?) AND appointment_date BETWEEN ? AND ?",
+			merchantID, activeAppointmentStatuses,
+			startDate.Format("2006-01-02"), endDate.Format("2006-01-02"))
+	if staffID > 0 {
+		query = query.Where("staff_id = ?", staffID)
+	}
+	if err := query.Order("appointment_date ASC, start_time ASC").Find(&appointments).Error; err != nil {
+		return nil, err
+	}
+
+	if startTime == "" {
+		return appointments, nil
+	}
+
+	blockStart, err := parseClock(startTime)
+	if err != nil {
+		return nil, err
+	}
+	blockEnd, err := parseClock(endTime)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Appointment, 0, len(appointments))
+	for _, appt := range appointments {
+		start, err1 := parseClock(appt.StartTime)
+		end, err2 := parseClock(appt.EndTime)
+		if err1 != nil || err2 != nil || (start < blockEnd && end > blockStart) {
+			result = append(result, appt)
+		}
+	}
+	return result, nil
+}
+
+// blockCalendar 某段日期内商家的停业日、员工请假记录和外部日历导入的忙碌时段
+type blockCalendar struct {
+	closures []MerchantClosure
+	timeOffs []StaffTimeOff
+	busy     []StaffBusyBlock
+	loc      *time.Location // 商家时区，用于将时间段换算为绝对时间与忙碌时段比较
+}
+
+// loadBlockCalendar 加载 from 到 to（含）之间与商家相关的屏蔽记录
+func loadBlockCalendar(db *gorm.DB, merchantID uint, from, to time.Time) (*blockCalendar, error) {
+	cal := &blockCalendar{}
+	fromStr, toStr := from.Format("2006-01-02"), to.Format("2006-01-02")
+
+	if err := db.Where("merchant_id = ? AND start_date <= ? AND end_date >= ?",
+		merchantID, toStr, fromStr).Find(&cal.closures).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("merchant_id = ? AND start_date <= ? AND end_date >= ?",
+		merchantID, toStr, fromStr).Find(&cal.timeOffs).Error; err != nil {
+		return nil, err
+	}
+
+	cal.loc = merchantLocation(db, merchantID)
+	rangeStart := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, cal.loc)
+	rangeEnd := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, cal.loc).AddDate(0, 0, 1)
+	if err := db.Where("merchant_id = ? AND start_at < ? AND end_at > ?",
+		merchantID, rangeEnd, rangeStart).Find(&cal.busy).Error; err != nil {
+		return nil, err
+	}
+	return cal, nil
+}
+
+// blocks 判断时间段是否落在停业日、员工请假时段或外部日历的忙碌时段内
+func (b *blockCalendar) blocks(slot TimeSlot) bool {
+	day := slot.Date.Format("2006-01-02")
+
+	for _, c := range b.closures {
+		if c.StartDate.Format("2006-01-02") <= day && c.EndDate.Format("2006-01-02") >= day {
+			return true
+		}
+	}
+
+	for _, t := range b.timeOffs {
+		if t.StaffID != slot.StaffID ||
+			t.StartDate.Format("2006-01-02") > day || t.EndDate.Format("2006-01-02") < day {
+			continue
+		}
+		if t.StartTime == "" {
+			return true
+		}
+		offStart, err1 := parseClock(t.StartTime)
+		offEnd, err2 := parseClock(t.EndTime)
+		start, err3 := parseClock(slot.StartTime)
+		end, err4 := parseClock(slot.EndTime)
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+			return true
+		}
+		if start < offEnd && end > offStart {
+			return true
+		}
+	}
+
+	if len(b.busy) > 0 {
+		start := wallClockAt(slot.Date, slot.StartTime, b.loc)
+		end := wallClockAt(slot.Date, slot.EndTime, b.loc)
+		for _, busy := range b.busy {
+			if busy.StaffID == slot.StaffID && busy.StartAt.Before(end) && busy.EndAt.After(start) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// markBlocked 将被屏蔽的时间段标记为不可用（仅修改内存中的数据）
+func (b *blockCalendar) markBlocked(slots []TimeSlot) {
+	for i := range slots {
+		if slots[i].IsAvailable && b.blocks(slots[i]) {
+			slots[i].IsAvailable = false
+		}
+	}
+}
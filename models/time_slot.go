@@ -2,8 +2,12 @@ package models
 
 import (
 	"admin-api/database"
+	"fmt"
+	"strings"
 	"time"
-	//"gorm.io/gorm"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type TimeSlot struct {
@@ -13,30 +17,96 @@ type TimeSlot struct {
 	Date        time.Time `gorm:"type:date;not null"`
 	StartTime   string    `gorm:"type:time;not null"`
 	EndTime     string    `gorm:"type:time;not null"`
-	IsAvailable bool      `gorm:"default:true;not null"`
+	IsAvailable bool      `gorm:"default:true;not null"`    // 仍有空余名额时为true，约满后为false
+	Capacity    int       `gorm:"default:1;not null"`       // 可预约人数，团课大于1
+	BookedCount int       `gorm:"default:0;not null"`       // 已预约人数
+	TemplateID  uint      `gorm:"index;default:0;not null"` // 由排班模板生成时记录模板ID，手动创建为0
+	HeldCount   int       `gorm:"-"`                        // 结账中被他人临时预留的名额，不入库
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 }
 
+// RemainingSeats 返回时间段剩余可预约名额，已扣除他人的临时预留
+func (s TimeSlot) RemainingSeats() int {
+	if !s.IsAvailable {
+		return 0
+	}
+	capacity := s.Capacity
+	if capacity < 1 {
+		capacity = 1
+	}
+	if remaining := capacity - s.BookedCount - s.HeldCount; remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// occupySlots 为已加锁的时间段各占用一个名额，约满时标记为不可用
+func occupySlots(tx *gorm.DB, slots []TimeSlot) error {
+	for _, slot := range slots {
+		if slot.RemainingSeats() <= 0 {
+			return fmt.Errorf("时间段 %s-%s 已约满", slot.StartTime, slot.EndTime)
+		}
+		booked := slot.BookedCount + 1
+		if err := tx.Model(&TimeSlot{}).Where("id = ?", slot.ID).
+			Updates(map[string]interface{}{
+				"booked_count": booked,
+				"is_available": booked < slot.Capacity,
+			}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// freeSlots 为时间段各释放一个名额并重新开放预约
+func freeSlots(tx *gorm.DB, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return tx.Model(&TimeSlot{}).Where("id IN (?)", ids).
+		Updates(map[string]interface{}{
+			"booked_count": gorm.Expr("CASE WHEN booked_count > 0 THEN booked_count - 1 ELSE 0 END"),
+			"is_available": true,
+		}).Error
+}
+
+// parseClock 将 HH:MM 或 HH:MM:SS 格式的时间转换为当天的分钟数
+func parseClock(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	layout := "15:04"
+	if strings.Count(s, ":") == 2 {
+		layout = "15:04:05"
+	}
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		return 0, fmt.Errorf("无效的时间格式: %s", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// formatClock 将当天的分钟数格式化为 HH:MM
+func formatClock(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
 func GetAvailableDates(merchantID, staffID, serviceID uint, days int) ([]time.Time, error) {
-	// 获取服务时长
-	var duration int
+	// 获取各员工提供该服务的实际时长，未关联该服务的员工不可预约
+	var staffServices map[uint]*Service
 	if serviceID > 0 {
-		var service Service
-		if err := database.DB.Select("duration").First(&service, serviceID).Error; err != nil {
+		var err error
+		if staffServices, err = staffServicesByStaff(database.DB, serviceID); err != nil {
 			return nil, err
 		}
-		duration = service.Duration
 	}
 
-	// 计算开始和结束日期
-	now := time.Now()
+	// 按商家时区计算开始和结束日期
+	now := MerchantNow(merchantID)
 	startDate := now.AddDate(0, 0, 1) // 从明天开始
 	endDate := startDate.AddDate(0, 0, days-1)
 
 	// 构建查询
-	query := database.DB.Model(&TimeSlot{}).
-		Select("DISTINCT date").
+	query := database.DB.
 		Where("merchant_id = ? AND date BETWEEN ? AND ? AND is_available = true",
 			merchantID, startDate.Format("2006-01-02"), endDate.Format("2006-01-02"))
 
@@ -44,36 +114,195 @@ func GetAvailableDates(merchantID, staffID, serviceID uint, days int) ([]time.Ti
 		query = query.Where("staff_id = ?", staffID)
 	}
 
-	// 如果有服务时长要求，过滤掉时间不足的日期
-	if duration > 0 {
-		query = query.Where("TIME_TO_SEC(TIMEDIFF(end_time, start_time)) >= ?", duration*60)
+	var slots []TimeSlot
+	if err := query.Order("date ASC, staff_id ASC, start_time ASC").Find(&slots).Error; err != nil {
+		return nil, err
 	}
 
-	var dates []struct {
-		Date time.Time `gorm:"column:date"`
+	// 排除停业日和员工请假时段
+	calendar, err := loadBlockCalendar(database.DB, merchantID, startDate, endDate)
+	if err != nil {
+		return nil, err
 	}
+	calendar.markBlocked(slots)
+	applySlotHolds(slots, 0)
 
-	if err := query.Scan(&dates).Error; err != nil {
+	// 排除已有预约前后的缓冲时间
+	buffers, err := loadBufferCalendar(database.DB, merchantID, startDate, endDate, 0)
+	if err != nil {
 		return nil, err
 	}
+	buffers.markBlocked(slots)
 
-	// 提取日期
+	// 按员工和日期分组，只保留存在足够连续空闲时长的日期
 	var result []time.Time
-	for _, d := range dates {
-		result = append(result, d.Date)
+	seen := make(map[string]bool)
+	for _, group := range groupSlotsByStaffDate(slots) {
+		day := group[0].Date.Format("2006-01-02")
+		if seen[day] {
+			continue
+		}
+		var service *Service
+		if serviceID > 0 {
+			if service = staffServices[group[0].StaffID]; service == nil {
+				continue
+			}
+		}
+		for i := range group {
+			if bookableRun(group, i, service, buffers) != nil {
+				seen[day] = true
+				result = append(result, group[0].Date)
+				break
+			}
+		}
 	}
 
 	return result, nil
 }
 
-func GetAvailableTimeSlots(merchantID, staffID uint, date time.Time) ([]TimeSlot, error) {
+// GetAvailableTimeSlots 获取员工某天的可用时间段，已排除停业日、请假时段和已有预约的缓冲时间。
+// service 不为nil时，只返回之后有足够连续空闲时长可容纳服务、且服务前后缓冲时间不与已有预约冲突的起始时间段
+func GetAvailableTimeSlots(merchantID, staffID uint, date time.Time, service *Service) ([]TimeSlot, error) {
 	var slots []TimeSlot
 	err := database.DB.
 		Where("merchant_id = ? AND staff_id = ? AND date = ? AND is_available = true",
 			merchantID, staffID, date.Format("2006-01-02")).
 		Order("start_time ASC").
 		Find(&slots).Error
-	return slots, err
+	if err != nil {
+		return nil, err
+	}
+
+	// 排除停业日和员工请假时段
+	calendar, err := loadBlockCalendar(database.DB, merchantID, date, date)
+	if err != nil {
+		return nil, err
+	}
+	calendar.markBlocked(slots)
+	applySlotHolds(slots, 0)
+	markStarted(slots, MerchantNow(merchantID))
+
+	buffers, err := loadBufferCalendar(database.DB, merchantID, date, date, 0)
+	if err != nil {
+		return nil, err
+	}
+	buffers.markBlocked(slots)
+
+	result := make([]TimeSlot, 0, len(slots))
+	for i := range slots {
+		if bookableRun(slots, i, service, buffers) != nil {
+			result = append(result, slots[i])
+		}
+	}
+	return result, nil
+}
+
+// markStarted 将商家时区中已经开始的时间段标记为不可用（仅修改内存中的数据）
+func markStarted(slots []TimeSlot, now time.Time) {
+	for i := range slots {
+		if slots[i].IsAvailable && slotStarted(slots[i], now) {
+			slots[i].IsAvailable = false
+		}
+	}
+}
+
+// contiguousRun 从 slots[i] 开始取首尾相接的可用时间段，直到总时长覆盖 duration 分钟。
+// slots 须为同一员工同一天、按开始时间升序排列；时长不足时返回nil。
+func contiguousRun(slots []TimeSlot, i int, duration int) []TimeSlot {
+	if i >= len(slots) || !slots[i].IsAvailable {
+		return nil
+	}
+
+	start, err := parseClock(slots[i].StartTime)
+	if err != nil {
+		return nil
+	}
+	end, err := parseClock(slots[i].EndTime)
+	if err != nil {
+		return nil
+	}
+
+	run := []TimeSlot{slots[i]}
+	for end-start < duration {
+		i++
+		if i >= len(slots) || !slots[i].IsAvailable {
+			return nil
+		}
+		nextStart, err1 := parseClock(slots[i].StartTime)
+		nextEnd, err2 := parseClock(slots[i].EndTime)
+		if err1 != nil || err2 != nil || nextStart != end {
+			return nil
+		}
+		run = append(run, slots[i])
+		end = nextEnd
+	}
+	return run
+}
+
+// groupSlotsByStaffDate 将按日期、员工、开始时间排序的时间段按员工和日期分组
+func groupSlotsByStaffDate(slots []TimeSlot) [][]TimeSlot {
+	var groups [][]TimeSlot
+	for i, slot := range slots {
+		if i == 0 || slot.StaffID != slots[i-1].StaffID ||
+			!slot.Date.Equal(slots[i-1].Date) {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], slot)
+	}
+	return groups
+}
+
+// lockBookingSlots 锁定从 first 开始、覆盖服务时长所需的连续时间段，并校验服务前后缓冲时间。
+// 他人的临时预留计入已占用名额，userID 本人的预留不计；excludeAppointmentID 为改约中的预约，不计入缓冲冲突
+func lockBookingSlots(tx *gorm.DB, first TimeSlot, service *Service, userID, excludeAppointmentID uint) ([]TimeSlot, error) {
+	var following []TimeSlot
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("merchant_id = ? AND staff_id = ? AND date = ? AND start_time >= ?",
+			first.MerchantID, first.StaffID, first.Date.Format("2006-01-02"), first.StartTime).
+		Order("start_time ASC").
+		Find(&following).Error; err != nil {
+		return nil, err
+	}
+
+	if len(following) == 0 || following[0].ID != first.ID {
+		return nil, fmt.Errorf("时间段不存在")
+	}
+
+	// 停业日和请假时段不可预约
+	calendar, err := loadBlockCalendar(tx, first.MerchantID, first.Date, first.Date)
+	if err != nil {
+		return nil, err
+	}
+	if calendar.blocks(following[0]) {
+		return nil, fmt.Errorf("该时间段暂停预约")
+	}
+	if slotStarted(following[0], time.Now().In(merchantLocation(tx, first.MerchantID))) {
+		return nil, fmt.Errorf("该时间段已开始，不能预约")
+	}
+	calendar.markBlocked(following)
+	applySlotHolds(following, userID)
+
+	// 已有预约前后的缓冲时间不可预约
+	buffers, err := loadBufferCalendar(tx, first.MerchantID, first.Date, first.Date, excludeAppointmentID)
+	if err != nil {
+		return nil, err
+	}
+	if buffers.blocks(following[0]) {
+		return nil, fmt.Errorf("该时间段处于其他预约的缓冲时间")
+	}
+	buffers.markBlocked(following)
+	if !following[0].IsAvailable {
+		return nil, fmt.Errorf("该时间段已被预约")
+	}
+
+	run := contiguousRun(following, 0, service.Duration)
+	if run == nil {
+		return nil, fmt.Errorf("该时间段之后的连续空闲时长不足%d分钟", service.Duration)
+	}
+	if !buffers.fits(run, service) {
+		return nil, fmt.Errorf("服务前后的缓冲时间与其他预约冲突")
+	}
+	return run, nil
 }
 
 func CheckTimeSlotAvailable(slotID uint) (bool, error) {
@@ -84,48 +313,363 @@ func CheckTimeSlotAvailable(slotID uint) (bool, error) {
 	return slot.IsAvailable, nil
 }
 
-func BatchCreateTimeSlots(merchantID, staffID uint, date time.Time, slots []TimeSlot) error {
+// TimeSlotConflict 批量保存时间段时无法处理的冲突
+type TimeSlotConflict struct {
+	TimeSlotID     uint   `json:"time_slot_id"` // 冲突涉及的已有时间段，新建时为0
+	StartTime      string `json:"start_time"`
+	EndTime        string `json:"end_time"`
+	AppointmentIDs []uint `json:"appointment_ids"` // 占用该时间段的预约
+	Reason         string `json:"reason"`
+}
+
+// TimeSlotMergeReport 批量保存时间段的合并结果
+type TimeSlotMergeReport struct {
+	Created   int                `json:"created"`
+	Updated   int                `json:"updated"`
+	Deleted   int                `json:"deleted"`
+	Unchanged int                `json:"unchanged"`
+	Conflicts []TimeSlotConflict `json:"conflicts"`
+}
+
+// ValidateTimeSlots 校验时间段格式、起止顺序以及相互之间不重叠
+func ValidateTimeSlots(slots []TimeSlot) error {
+	type period struct{ start, end int }
+	periods := make([]period, 0, len(slots))
+	for _, slot := range slots {
+		start, err := parseClock(slot.StartTime)
+		if err != nil {
+			return err
+		}
+		end, err := parseClock(slot.EndTime)
+		if err != nil {
+			return err
+		}
+		if start >= end {
+			return fmt.Errorf("时间段 %s-%s 开始时间必须早于结束时间", slot.StartTime, slot.EndTime)
+		}
+		if slot.Capacity < 0 {
+			return fmt.Errorf("时间段 %s-%s 容量不能为负数", slot.StartTime, slot.EndTime)
+		}
+		for _, p := range periods {
+			if start < p.end && end > p.start {
+				return fmt.Errorf("时间段 %s-%s 与其他时间段重叠", slot.StartTime, slot.EndTime)
+			}
+		}
+		periods = append(periods, period{start, end})
+	}
+	return nil
+}
+
+// BatchCreateTimeSlots 将员工某天的时间段与提交的列表合并：
+// 新增缺失的时间段，更新变化的时间段，删除不再需要的空闲时间段。
+// 已被占用的时间段（有占用名额的预约、候补保留名额或结账中的临时预留）不会被修改或删除，而是记录在冲突报告中。
+// 传入的时间段若带有ID，则视为对该时间段的修改；否则按起止时间匹配已有时间段。
+// 已有预约的时间段仍可调整容量（Capacity 为0表示不修改），但不能小于已占用的名额。
+func BatchCreateTimeSlots(merchantID, staffID uint, date time.Time, slots []TimeSlot) (*TimeSlotMergeReport, error) {
 	tx := database.DB.Begin()
 
-	// 1. 查找所有相关的时间段ID
-	var timeSlotIDs []uint
-	if err := tx.Model(&TimeSlot{}).
+	// 1. 锁定当天已有的时间段
+	var existing []TimeSlot
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
 		Where("merchant_id = ? AND staff_id = ? AND date = ?",
 			merchantID, staffID, date.Format("2006-01-02")).
-		Pluck("id", &timeSlotIDs).Error; err != nil {
+		Order("start_time ASC").
+		Find(&existing).Error; err != nil {
 		tx.Rollback()
-		return err
+		return nil, err
 	}
 
-	// 2. 删除关联的预约
-	if len(timeSlotIDs) > 0 {
-		if err := tx.Where("time_slot_id IN (?)", timeSlotIDs).
-			Delete(&Appointment{}).Error; err != nil {
-			tx.Rollback()
-			return err
+	booked, err := bookedAppointmentsBySlot(tx, existing)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	// 候补保留的名额没有预约记录，只计入 BookedCount；结账中的临时预留计入 HeldCount
+	applySlotHolds(existing, 0)
+	taken := func(slot TimeSlot) bool {
+		return len(booked[slot.ID]) > 0 || slot.BookedCount > 0 || slot.HeldCount > 0
+	}
+
+	report := &TimeSlotMergeReport{Conflicts: []TimeSlotConflict{}}
+	byID := make(map[uint]*TimeSlot, len(existing))
+	for i := range existing {
+		byID[existing[i].ID] = &existing[i]
+	}
+	matched := make(map[uint]bool)
+
+	conflictOf := func(slot TimeSlot, reason string) TimeSlotConflict {
+		return TimeSlotConflict{
+			TimeSlotID:     slot.ID,
+			StartTime:      slot.StartTime,
+			EndTime:        slot.EndTime,
+			AppointmentIDs: booked[slot.ID],
+			Reason:         reason,
 		}
 	}
 
-	// 3. 删除时间段
-	if err := tx.Where("merchant_id = ? AND staff_id = ? AND date = ?",
-		merchantID, staffID, date.Format("2006-01-02")).
-		Delete(&TimeSlot{}).Error; err != nil {
-		tx.Rollback()
-		return err
+	// 起止时间未变的时间段只调整容量，容量不能小于已占用的名额
+	var toResize []TimeSlot
+	resizeOrKeep := func(current TimeSlot, capacity int) {
+		if capacity < 1 || capacity == current.Capacity {
+			report.Unchanged++
+			return
+		}
+		if used := current.BookedCount + current.HeldCount; capacity < used {
+			report.Conflicts = append(report.Conflicts,
+				conflictOf(current, fmt.Sprintf("已占用%d个名额，容量不能小于已占用的名额", used)))
+			return
+		}
+		current.Capacity = capacity
+		toResize = append(toResize, current)
 	}
 
-	// 4. 创建新的时间段
+	// 2. 匹配提交的时间段：带ID的按ID匹配，否则按起止时间匹配
+	var toUpdate, toCreate []TimeSlot
 	for _, slot := range slots {
+		start, _ := parseClock(slot.StartTime)
+		end, _ := parseClock(slot.EndTime)
+
+		if slot.ID > 0 {
+			current, ok := byID[slot.ID]
+			if !ok {
+				report.Conflicts = append(report.Conflicts, conflictOf(slot, "时间段不存在"))
+				continue
+			}
+			matched[slot.ID] = true
+			if sameClock(*current, start, end) {
+				resizeOrKeep(*current, slot.Capacity)
+				continue
+			}
+			if taken(*current) {
+				report.Conflicts = append(report.Conflicts, conflictOf(*current, "该时间段已有预约或保留名额，不能修改"))
+				continue
+			}
+			toUpdate = append(toUpdate, slot)
+			continue
+		}
+
+		found := false
+		for _, current := range existing {
+			if !matched[current.ID] && sameClock(current, start, end) {
+				matched[current.ID] = true
+				resizeOrKeep(current, slot.Capacity)
+				found = true
+				break
+			}
+		}
+		if !found {
+			toCreate = append(toCreate, slot)
+		}
+	}
+
+	// 3. 未匹配的已有时间段：已被占用的保留并报告冲突，其余删除
+	var kept []TimeSlot
+	for _, current := range existing {
+		if matched[current.ID] {
+			if !containsSlotID(toUpdate, current.ID) {
+				kept = append(kept, current)
+			}
+			continue
+		}
+		if taken(current) {
+			report.Conflicts = append(report.Conflicts, conflictOf(current, "该时间段已有预约或保留名额，已保留"))
+			kept = append(kept, current)
+			continue
+		}
+		if err := tx.Delete(&TimeSlot{}, current.ID).Error; err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		report.Deleted++
+	}
+
+	// 4. 更新变化的时间段，不能与保留的时间段重叠
+	for _, slot := range toUpdate {
+		start, _ := parseClock(slot.StartTime)
+		end, _ := parseClock(slot.EndTime)
+		if overlapsExisting(kept, start, end) {
+			report.Conflicts = append(report.Conflicts, conflictOf(slot, "与已预约的时间段重叠"))
+			kept = append(kept, *byID[slot.ID])
+			continue
+		}
+		updates := map[string]interface{}{
+			"start_time": slot.StartTime,
+			"end_time":   slot.EndTime,
+		}
+		if slot.Capacity > 0 {
+			updates["capacity"] = slot.Capacity
+			updates["is_available"] = byID[slot.ID].BookedCount < slot.Capacity
+		}
+		if err := tx.Model(&TimeSlot{}).Where("id = ?", slot.ID).Updates(updates).Error; err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		kept = append(kept, slot)
+		report.Updated++
+	}
+
+	for _, slot := range toResize {
+		if err := tx.Model(&TimeSlot{}).Where("id = ?", slot.ID).
+			Updates(map[string]interface{}{
+				"capacity":     slot.Capacity,
+				"is_available": slot.BookedCount < slot.Capacity,
+			}).Error; err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		report.Updated++
+	}
+
+	// 5. 创建新的时间段
+	for _, slot := range toCreate {
+		start, _ := parseClock(slot.StartTime)
+		end, _ := parseClock(slot.EndTime)
+		if overlapsExisting(kept, start, end) {
+			report.Conflicts = append(report.Conflicts, conflictOf(slot, "与已预约的时间段重叠"))
+			continue
+		}
 		slot.MerchantID = merchantID
 		slot.StaffID = staffID
 		slot.Date = date
+		if slot.Capacity < 1 {
+			slot.Capacity = 1
+		}
 		if err := tx.Create(&slot).Error; err != nil {
 			tx.Rollback()
-			return err
+			return nil, err
 		}
+		kept = append(kept, slot)
+		report.Created++
 	}
 
-	return tx.Commit().Error
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// bookedAppointmentsBySlot 返回时间段ID到其占用名额的预约ID列表的映射
+func bookedAppointmentsBySlot(tx *gorm.DB, slots []TimeSlot) (map[uint][]uint, error) {
+	booked := make(map[uint][]uint)
+	if len(slots) == 0 {
+		return booked, nil
+	}
+
+	ids := make([]uint, 0, len(slots))
+	for _, s := range slots {
+		ids = append(ids, s.ID)
+	}
+
+	var rows []struct {
+		ID         uint
+		TimeSlotID uint
+	}
+	if err := tx.Model(&Appointment{}).
+		Select("id, time_slot_id").
+		Where("time_slot_id IN (?) AND status IN (?)", ids, slotHoldingAppointmentStatuses).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	// 跨多个时间段的预约记录在关联表中
+	var linked []struct {
+		ID         uint
+		TimeSlotID uint
+	}
+	if err := tx.Table("appointment_time_slots").
+		Select("appointments.id, appointment_time_slots.time_slot_id").
+		Joins("JOIN appointments ON appointments.id = appointment_time_slots.appointment_id").
+		Where("appointment_time_slots.time_slot_id IN (?) AND appointments.status IN (?)",
+			ids, slotHoldingAppointmentStatuses).
+		Scan(&linked).Error; err != nil {
+		return nil, err
+	}
+	rows = append(rows, linked...)
+
+	for _, r := range rows {
+		if !containsUint(booked[r.TimeSlotID], r.ID) {
+			booked[r.TimeSlotID] = append(booked[r.TimeSlotID], r.ID)
+		}
+	}
+	return booked, nil
+}
+
+func sameClock(slot TimeSlot, start, end int) bool {
+	s, err1 := parseClock(slot.StartTime)
+	e, err2 := parseClock(slot.EndTime)
+	return err1 == nil && err2 == nil && s == start && e == end
+}
+
+func containsUint(values []uint, v uint) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsSlotID(slots []TimeSlot, id uint) bool {
+	for _, s := range slots {
+		if s.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func GetTimeSlotsByIDs(ids []uint) ([]TimeSlot, error) {
+	var slots []TimeSlot
+	if len(ids) == 0 {
+		return slots, nil
+	}
+	err := database.DB.Where("id IN (?)", ids).Find(&slots).Error
+	return slots, err
+}
+
+// GetSlotAttendees 返回各时间段上的有效预约（含用户信息），按预约时间排序
+func GetSlotAttendees(slotIDs []uint) (map[uint][]Appointment, error) {
+	attendees := make(map[uint][]Appointment)
+	if len(slotIDs) == 0 {
+		return attendees, nil
+	}
+
+	var links []AppointmentTimeSlot
+	if err := database.DB.Where("time_slot_id IN (?)", slotIDs).Find(&links).Error; err != nil {
+		return nil, err
+	}
+	appointmentIDs := make([]uint, 0, len(links))
+	for _, link := range links {
+		appointmentIDs = append(appointmentIDs, link.AppointmentID)
+	}
+
+	// 兼容没有关联记录的旧预约
+	var appointments []Appointment
+	if err := database.DB.Preload("User").
+		Where("status IN (?)", activeAppointmentStatuses).
+		Where("id IN (?) OR time_slot_id IN (?)", append(appointmentIDs, 0), slotIDs).
+		Order("created_at ASC").
+		Find(&appointments).Error; err != nil {
+		return nil, err
+	}
+
+	for _, appt := range appointments {
+		var ids []uint
+		for _, link := range links {
+			if link.AppointmentID == appt.ID {
+				ids = append(ids, link.TimeSlotID)
+			}
+		}
+		if len(ids) == 0 {
+			ids = []uint{appt.TimeSlotID}
+		}
+		for _, id := range ids {
+			if containsUint(slotIDs, id) {
+				attendees[id] = append(attendees[id], appt)
+			}
+		}
+	}
+	return attendees, nil
 }
 
 func DeleteTimeSlot(id uint) error {
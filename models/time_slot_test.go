@@ -0,0 +1,305 @@
+package models
+
+import (
+	"admin-api/database"
+	"admin-api/database/dbtest"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// bookingFixture 一个商家、一名员工和一项服务，时间段为明天 10:00 起每 30 分钟一个
+type bookingFixture struct {
+	merchant Merchant
+	staff    Staff
+	service  Service
+	date     time.Time
+}
+
+// slotSpec 时间段的容量和已占用名额
+type slotSpec struct {
+	capacity int
+	booked   int
+}
+
+// setupBookingDB 重建预约流程用到的表，extra 为测试额外需要的表
+func setupBookingDB(t *testing.T, extra ...interface{}) {
+	t.Helper()
+	models := []interface{}{&Merchant{}, &MerchantSetting{}, &Service{}, &Staff{}, &StaffService{}, &TimeSlot{},
+		&Appointment{}, &AppointmentTimeSlot{}, &AppointmentEvent{}, &AppointmentReschedule{}, &WaitlistEntry{},
+		&Notification{}, &UserCoupon{}, &MerchantClosure{}, &StaffTimeOff{}, &StaffBusyBlock{}}
+	dbtest.Setup(t, append(models, extra...)...)
+}
+
+func newBookingFixture(t *testing.T, duration int) *bookingFixture {
+	t.Helper()
+	f := &bookingFixture{}
+	f.merchant = Merchant{Name: "测试门店", Address: "测试地址", Phone: "10000", Timezone: "Asia/Shanghai"}
+	mustCreate(t, &f.merchant)
+	f.staff = Staff{MerchantID: f.merchant.ID, Name: "员工", IsActive: true}
+	mustCreate(t, &f.staff)
+	f.service = Service{MerchantID: f.merchant.ID, CategoryID: 1, Name: "服务", Price: 1000, Duration: duration, IsActive: true}
+	mustCreate(t, &f.service)
+	mustCreate(t, &StaffService{MerchantID: f.merchant.ID, StaffID: f.staff.ID, ServiceID: f.service.ID})
+	f.date = civilDate(time.Now().In(f.merchant.Location()).AddDate(0, 0, 1))
+	return f
+}
+
+// createSlots 从 10:00 起依次创建 30 分钟的时间段
+func (f *bookingFixture) createSlots(t *testing.T, specs ...slotSpec) []TimeSlot {
+	t.Helper()
+	slots := make([]TimeSlot, 0, len(specs))
+	for i, spec := range specs {
+		start := 10*60 + i*30
+		slot := TimeSlot{
+			MerchantID: f.merchant.ID, StaffID: f.staff.ID, Date: f.date,
+			StartTime: formatClock(start) + ":00", EndTime: formatClock(start+30) + ":00",
+			Capacity: spec.capacity, BookedCount: spec.booked, IsAvailable: true,
+		}
+		mustCreate(t, &slot)
+		// IsAvailable 有默认值，为 false 时需单独更新
+		if spec.booked >= spec.capacity {
+			if err := database.DB.Model(&slot).Update("is_available", false).Error; err != nil {
+				t.Fatal(err)
+			}
+			slot.IsAvailable = false
+		}
+		slots = append(slots, slot)
+	}
+	return slots
+}
+
+// bookAppointment 创建占用 slots 的预约
+func (f *bookingFixture) bookAppointment(t *testing.T, userID uint, slots []TimeSlot) *Appointment {
+	t.Helper()
+	appointment := Appointment{
+		OrderNo: fmt.Sprintf("T%d%d", time.Now().UnixNano(), userID), UserID: userID,
+		MerchantID: f.merchant.ID, ServiceID: f.service.ID, StaffID: f.staff.ID, TimeSlotID: slots[0].ID,
+		AppointmentDate: f.date, StartTime: slots[0].StartTime, EndTime: slots[len(slots)-1].EndTime,
+		Status: AppointmentStatusPaid, Amount: f.service.Price,
+	}
+	mustCreate(t, &appointment)
+	for _, s := range slots {
+		mustCreate(t, &AppointmentTimeSlot{AppointmentID: appointment.ID, TimeSlotID: s.ID})
+	}
+	return &appointment
+}
+
+func mustCreate(t *testing.T, value interface{}) {
+	t.Helper()
+	if err := database.DB.Create(value).Error; err != nil {
+		t.Fatalf("创建测试数据失败: %v", err)
+	}
+}
+
+// bookedCounts 按顺序返回时间段的已占用名额
+func bookedCounts(t *testing.T, slots []TimeSlot) []int {
+	t.Helper()
+	counts := make([]int, 0, len(slots))
+	for _, s := range slots {
+		var latest TimeSlot
+		if err := database.DB.First(&latest, s.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if latest.IsAvailable != (latest.BookedCount < latest.Capacity) {
+			t.Errorf("时间段 %s 已预约 %d/%d，is_available = %v", latest.StartTime, latest.BookedCount, latest.Capacity, latest.IsAvailable)
+		}
+		counts = append(counts, latest.BookedCount)
+	}
+	return counts
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRemainingSeats(t *testing.T) {
+	tests := []struct {
+		name string
+		slot TimeSlot
+		want int
+	}{
+		{"单人空闲", TimeSlot{IsAvailable: true, Capacity: 1}, 1},
+		{"单人已约满", TimeSlot{IsAvailable: false, Capacity: 1, BookedCount: 1}, 0},
+		{"团课剩余名额", TimeSlot{IsAvailable: true, Capacity: 5, BookedCount: 2}, 3},
+		{"他人结账预留计入已占用", TimeSlot{IsAvailable: true, Capacity: 5, BookedCount: 2, HeldCount: 2}, 1},
+		{"预留占满名额", TimeSlot{IsAvailable: true, Capacity: 3, BookedCount: 1, HeldCount: 3}, 0},
+		{"容量未设置按1计算", TimeSlot{IsAvailable: true}, 1},
+		{"不可用的时间段", TimeSlot{IsAvailable: false, Capacity: 5}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.slot.RemainingSeats(); got != tt.want {
+				t.Fatalf("RemainingSeats() = %d, 期望 %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOccupyAndFreeSlots(t *testing.T) {
+	setupBookingDB(t)
+
+	tests := []struct {
+		name       string
+		specs      []slotSpec
+		occupy     int // 依次占用的次数
+		free       int // 占用后依次释放的次数
+		wantErr    bool
+		wantBooked []int
+	}{
+		{"单人时间段占用后约满", []slotSpec{{1, 0}}, 1, 0, false, []int{1}},
+		{"单人时间段不能重复占用", []slotSpec{{1, 0}}, 2, 0, true, []int{1}},
+		{"跨两个时间段同时占用", []slotSpec{{1, 0}, {1, 0}}, 1, 0, false, []int{1, 1}},
+		{"其中一个时间段已约满时整体回滚", []slotSpec{{1, 0}, {1, 1}}, 1, 0, true, []int{0, 1}},
+		{"团课占用到满员", []slotSpec{{3, 1}}, 2, 0, false, []int{3}},
+		{"团课超出容量", []slotSpec{{2, 1}}, 2, 0, true, []int{2}},
+		{"释放后重新开放", []slotSpec{{1, 0}, {1, 0}}, 1, 1, false, []int{0, 0}},
+		{"团课释放一个名额", []slotSpec{{3, 2}}, 1, 1, false, []int{2}},
+		{"释放不会减到负数", []slotSpec{{1, 0}}, 0, 2, false, []int{0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newBookingFixture(t, 30)
+			slots := f.createSlots(t, tt.specs...)
+			ids := make([]uint, 0, len(slots))
+			for _, s := range slots {
+				ids = append(ids, s.ID)
+			}
+
+			var err error
+			for i := 0; i < tt.occupy && err == nil; i++ {
+				var locked []TimeSlot
+				if err = database.DB.Where("id IN (?)", ids).Order("start_time ASC").Find(&locked).Error; err != nil {
+					t.Fatal(err)
+				}
+				// 与预约流程一致，失败时整个事务回滚
+				tx := database.DB.Begin()
+				if err = occupySlots(tx, locked); err != nil {
+					tx.Rollback()
+				} else if err := tx.Commit().Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("occupySlots err = %v, wantErr %v", err, tt.wantErr)
+			}
+			for i := 0; i < tt.free; i++ {
+				if err := freeSlots(database.DB, ids); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := bookedCounts(t, slots); !equalInts(got, tt.wantBooked) {
+				t.Fatalf("已占用名额 = %v, 期望 %v", got, tt.wantBooked)
+			}
+		})
+	}
+}
+
+func TestLockBookingSlots(t *testing.T) {
+	setupBookingDB(t)
+
+	tests := []struct {
+		name     string
+		duration int
+		specs    []slotSpec
+		wantRun  int // 锁定的时间段数，0 表示应失败
+	}{
+		{"单人时间段空闲", 30, []slotSpec{{1, 0}}, 1},
+		{"服务跨两个时间段", 60, []slotSpec{{1, 0}, {1, 0}, {1, 0}}, 2},
+		{"首个时间段已约满", 30, []slotSpec{{1, 1}}, 0},
+		{"后一个时间段已约满", 60, []slotSpec{{1, 0}, {1, 1}}, 0},
+		{"之后没有足够的时间段", 90, []slotSpec{{1, 0}, {1, 0}}, 0},
+		{"团课仍有名额", 30, []slotSpec{{3, 2}}, 1},
+		{"团课已约满", 30, []slotSpec{{2, 2}}, 0},
+		{"跨团课时间段均有名额", 60, []slotSpec{{2, 1}, {2, 1}}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newBookingFixture(t, tt.duration)
+			slots := f.createSlots(t, tt.specs...)
+
+			tx := database.DB.Begin()
+			defer tx.Rollback()
+			run, err := lockBookingSlots(tx, slots[0], &f.service, 1, 0)
+			if tt.wantRun == 0 {
+				if err == nil {
+					t.Fatalf("期望失败，实际锁定 %d 个时间段", len(run))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("锁定失败: %v", err)
+			}
+			if len(run) != tt.wantRun || run[0].ID != slots[0].ID {
+				t.Fatalf("锁定 %d 个时间段，期望 %d", len(run), tt.wantRun)
+			}
+		})
+	}
+}
+
+// TestWaitlistHoldOccupiesSlot 预约取消后为候补用户保留的名额没有预约记录，
+// 仍须阻止他人预约，批量保存时间段时也不能删除
+func TestWaitlistHoldOccupiesSlot(t *testing.T) {
+	setupBookingDB(t)
+	f := newBookingFixture(t, 30)
+	slots := f.createSlots(t, slotSpec{1, 1})
+	appointment := f.bookAppointment(t, 1, slots)
+	mustCreate(t, &WaitlistEntry{
+		UserID: 2, MerchantID: f.merchant.ID, ServiceID: f.service.ID, StaffID: f.staff.ID,
+		TimeSlotID: slots[0].ID, Date: f.date, StartTime: slots[0].StartTime, EndTime: slots[0].EndTime,
+		Status: WaitlistStatusWaiting,
+	})
+
+	if err := TransitionAppointment(appointment.ID, AppointmentStatusCancelled, ActorMerchant, f.merchant.ID, "测试取消"); err != nil {
+		t.Fatalf("取消预约失败: %v", err)
+	}
+	var entry WaitlistEntry
+	if err := database.DB.Where("user_id = ?", 2).First(&entry).Error; err != nil {
+		t.Fatal(err)
+	}
+	if entry.Status != WaitlistStatusHeld {
+		t.Fatalf("候补状态 = %s, 期望 %s", entry.Status, WaitlistStatusHeld)
+	}
+	if got := bookedCounts(t, slots); !equalInts(got, []int{1}) {
+		t.Fatalf("保留后已占用名额 = %v, 期望 [1]", got)
+	}
+
+	var first TimeSlot
+	if err := database.DB.First(&first, slots[0].ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	tx := database.DB.Begin()
+	_, err := lockBookingSlots(tx, first, &f.service, 3, 0)
+	tx.Rollback()
+	if err == nil {
+		t.Fatal("候补保留的名额不应被他人预约")
+	}
+
+	report, err := BatchCreateTimeSlots(f.merchant.ID, f.staff.ID, f.date, nil)
+	if err != nil {
+		t.Fatalf("批量保存时间段失败: %v", err)
+	}
+	if report.Deleted != 0 || len(report.Conflicts) != 1 {
+		t.Fatalf("保留名额的时间段应保留并报告冲突: %+v", report)
+	}
+
+	// 保留超时后释放名额
+	past := time.Now().Add(-time.Minute)
+	if err := database.DB.Model(&entry).Update("hold_expires_at", past).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := expireWaitlistHold(entry.ID, time.Now()); err != nil {
+		t.Fatalf("释放保留名额失败: %v", err)
+	}
+	if got := bookedCounts(t, slots); !equalInts(got, []int{0}) {
+		t.Fatalf("保留过期后已占用名额 = %v, 期望 [0]", got)
+	}
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"admin-api/database"
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultMerchantTimezone 未设置时区的商家使用的默认时区
+const DefaultMerchantTimezone = "Asia/Shanghai"
+
+var locationCache sync.Map
+
+// loadLocation 解析IANA时区名称，为空或无效时返回默认时区
+func loadLocation(name string) *time.Location {
+	if name == "" {
+		name = DefaultMerchantTimezone
+	}
+	if loc, ok := locationCache.Load(name); ok {
+		return loc.(*time.Location)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		if name == DefaultMerchantTimezone {
+			return time.UTC
+		}
+		return loadLocation(DefaultMerchantTimezone)
+	}
+	locationCache.Store(name, loc)
+	return loc
+}
+
+// ValidateTimezone 校验IANA时区名称，如 Asia/Shanghai、America/New_York
+func ValidateTimezone(name string) error {
+	if name == "" {
+		return errors.New("时区不能为空")
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return errors.New("无效的时区")
+	}
+	return nil
+}
+
+// Location 商家所在时区，营业时间、时间段和统计都按该时区计算
+func (m *Merchant) Location() *time.Location {
+	return loadLocation(m.Timezone)
+}
+
+// MerchantLocation 获取商家时区
+func MerchantLocation(merchantID uint) *time.Location {
+	return merchantLocation(database.DB, merchantID)
+}
+
+func merchantLocation(db *gorm.DB, merchantID uint) *time.Location {
+	var merchant Merchant
+	if err := db.Select("id, timezone").First(&merchant, merchantID).Error; err != nil {
+		return loadLocation("")
+	}
+	return merchant.Location()
+}
+
+// MerchantNow 商家时区的当前时间
+func MerchantNow(merchantID uint) time.Time {
+	return time.Now().In(MerchantLocation(merchantID))
+}
+
+// merchantToday 商家时区的今天（YYYY-MM-DD）
+func merchantToday(db *gorm.DB, merchantID uint) string {
+	return time.Now().In(merchantLocation(db, merchantID)).Format("2006-01-02")
+}
+
+// civilDate 取 t 在其自身时区的日期，返回数据库时区当天零点。
+// 写入 date 列的时间都应经过转换，避免驱动按数据库时区换算后日期错位
+func civilDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, database.Location)
+}
+
+// wallClockAt 返回商家时区某天 HH:MM 对应的具体时刻。
+// 直接按时分构造，夏令时切换当天零点加分钟数会差一小时
+func wallClockAt(date time.Time, clock string, loc *time.Location) time.Time {
+	minutes, err := parseClock(clock)
+	if err != nil {
+		minutes = 0
+	}
+	return time.Date(date.Year(), date.Month(), date.Day(), minutes/60, minutes%60, 0, 0, loc)
+}
+
+// slotStarted 判断时间段在商家时区是否已经开始
+func slotStarted(slot TimeSlot, now time.Time) bool {
+	return !wallClockAt(slot.Date, slot.StartTime, now.Location()).After(now)
+}
+
+// UpdateMerchantTimezone 修改商家时区
+func UpdateMerchantTimezone(merchantID uint, timezone string) error {
+	if err := ValidateTimezone(timezone); err != nil {
+		return err
+	}
+	return database.DB.Model(&Merchant{}).Where("id = ?", merchantID).Update("timezone", timezone).Error
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWallClockAt(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("缺少时区数据:", err)
+	}
+	tests := []struct {
+		name  string
+		date  time.Time
+		clock string
+		loc   *time.Location
+		want  string
+	}{
+		{"普通日期", time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC), "10:30", newYork, "2026-03-09T10:30:00-04:00"},
+		{"夏令时开始当天", time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC), "10:30", newYork, "2026-03-08T10:30:00-04:00"},
+		{"夏令时结束当天", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC), "09:00:00", newYork, "2026-11-01T09:00:00-05:00"},
+		{"无效时间取当天零点", time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC), "abc", newYork, "2026-03-08T00:00:00-05:00"},
+		{"日期按自身时区取年月日", time.Date(2026, 3, 8, 23, 0, 0, 0, time.FixedZone("CST", 8*3600)), "10:00", time.UTC, "2026-03-08T10:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wallClockAt(tt.date, tt.clock, tt.loc).Format(time.RFC3339); got != tt.want {
+				t.Errorf("wallClockAt = %s, 期望 %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -60,7 +60,7 @@ func GetUserAppointmentStats(userID uint) (*AppointmentStats, error) {
 	now := time.Now()
 	if err := database.DB.Model(&Appointment{}).
 		Where("user_id = ? AND status IN (?) AND appointment_date >= ?",
-			userID, []string{"pending", "confirmed"}, now.Format("2006-01-02")).
+			userID, activeAppointmentStatuses, now.Format("2006-01-02")).
 		Count(&stats.Upcoming).Error; err != nil {
 		return nil, err
 	}
@@ -0,0 +1,473 @@
+package models
+
+import (
+	"admin-api/database"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 候补状态
+const (
+	WaitlistStatusWaiting   = "waiting"   // 排队中
+	WaitlistStatusHeld      = "held"      // 已为其保留名额，等待确认
+	WaitlistStatusBooked    = "booked"    // 已转为预约
+	WaitlistStatusExpired   = "expired"   // 保留超时或日期已过
+	WaitlistStatusCancelled = "cancelled" // 用户取消
+)
+
+// SlotIDList 时间段ID列表，以JSON文本存储
+type SlotIDList []uint
+
+func (l *SlotIDList) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		if len(v) == 0 {
+			*l = nil
+			return nil
+		}
+		return json.Unmarshal(v, l)
+	case string:
+		if v == "" {
+			*l = nil
+			return nil
+		}
+		return json.Unmarshal([]byte(v), l)
+	default:
+		return fmt.Errorf("无法扫描类型 %T 到 SlotIDList", value)
+	}
+}
+
+func (l SlotIDList) Value() (driver.Value, error) {
+	if len(l) == 0 {
+		return "[]", nil
+	}
+	data, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// WaitlistEntry 约满时间段的候补记录，按加入时间先后放位
+type WaitlistEntry struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	UserID        uint       `gorm:"index;not null" json:"user_id"`
+	MerchantID    uint       `gorm:"index;not null" json:"merchant_id"`
+	ServiceID     uint       `gorm:"not null" json:"service_id"`
+	StaffID       uint       `gorm:"index;not null" json:"staff_id"`
+	TimeSlotID    uint       `gorm:"index;not null" json:"time_slot_id"` // 候补的起始时间段
+	Date          time.Time  `gorm:"type:date;not null" json:"date"`
+	StartTime     string     `gorm:"size:8;not null" json:"start_time"`
+	EndTime       string     `gorm:"size:8;not null" json:"end_time"`
+	Status        string     `gorm:"size:20;default:'waiting';not null" json:"status"`
+	Remark        string     `gorm:"size:255" json:"remark"`
+	HeldSlotIDs   SlotIDList `gorm:"type:text" json:"-"`                       // 保留名额占用的时间段
+	HoldExpiresAt *time.Time `json:"hold_expires_at"`                          // 保留名额的截止时间
+	AppointmentID uint       `gorm:"default:0;not null" json:"appointment_id"` // 转为预约后的预约ID
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+
+	Merchant Merchant `gorm:"foreignKey:MerchantID" json:"-"`
+	Service  Service  `gorm:"foreignKey:ServiceID" json:"-"`
+	Staff    Staff    `gorm:"foreignKey:StaffID" json:"-"`
+}
+
+// JoinWaitlist 加入约满时间段的候补名单
+func JoinWaitlist(userID, merchantID, serviceID, staffID, timeSlotID uint, remark string) (*WaitlistEntry, error) {
+	var slot TimeSlot
+	if err := database.DB.First(&slot, timeSlotID).Error; err != nil {
+		return nil, errors.New("时间段不存在")
+	}
+	if slot.MerchantID != merchantID || slot.StaffID != staffID {
+		return nil, errors.New("时间段与所选员工不匹配")
+	}
+	if slot.Date.Format("2006-01-02") < merchantToday(database.DB, merchantID) {
+		return nil, errors.New("该时间段已过期")
+	}
+	slots := []TimeSlot{slot}
+	applySlotHolds(slots, userID)
+	if slots[0].RemainingSeats() > 0 {
+		return nil, errors.New("该时间段仍有名额，请直接预约")
+	}
+
+	if _, err := staffServiceTx(database.DB, merchantID, serviceID, staffID); err != nil {
+		return nil, err
+	}
+
+	var count int64
+	if err := database.DB.Model(&WaitlistEntry{}).
+		Where("user_id = ? AND time_slot_id = ? AND status IN (?)",
+			userID, timeSlotID, []string{WaitlistStatusWaiting, WaitlistStatusHeld}).
+		Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, errors.New("您已在该时间段的候补名单中")
+	}
+
+	entry := &WaitlistEntry{
+		UserID:     userID,
+		MerchantID: merchantID,
+		ServiceID:  serviceID,
+		StaffID:    staffID,
+		TimeSlotID: timeSlotID,
+		Date:       slot.Date,
+		StartTime:  formatSlotClock(slot.StartTime),
+		EndTime:    formatSlotClock(slot.EndTime),
+		Status:     WaitlistStatusWaiting,
+		Remark:     remark,
+	}
+	if err := database.DB.Create(entry).Error; err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// formatSlotClock 将时间段的 HH:MM:SS 统一为 HH:MM
+func formatSlotClock(s string) string {
+	if minutes, err := parseClock(s); err == nil {
+		return formatClock(minutes)
+	}
+	return s
+}
+
+func GetUserWaitlist(userID uint) ([]WaitlistEntry, error) {
+	var entries []WaitlistEntry
+	err := database.DB.Preload("Merchant").Preload("Service").Preload("Staff").
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&entries).Error
+	return entries, err
+}
+
+// GetWaitlistPosition 返回候补记录在同一时间段排队中的位置（从1开始），非排队状态返回0
+func GetWaitlistPosition(entry *WaitlistEntry) (int, error) {
+	if entry.Status != WaitlistStatusWaiting {
+		return 0, nil
+	}
+	var ahead int64
+	if err := database.DB.Model(&WaitlistEntry{}).
+		Where("time_slot_id = ? AND status = ? AND id < ?", entry.TimeSlotID, WaitlistStatusWaiting, entry.ID).
+		Count(&ahead).Error; err != nil {
+		return 0, err
+	}
+	return int(ahead) + 1, nil
+}
+
+// lockUserWaitlistEntry 加锁读取用户的候补记录
+func lockUserWaitlistEntry(tx *gorm.DB, userID, entryID uint) (*WaitlistEntry, error) {
+	var entry WaitlistEntry
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&entry, entryID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("候补记录不存在")
+		}
+		return nil, err
+	}
+	if entry.UserID != userID {
+		return nil, errors.New("候补记录不存在")
+	}
+	return &entry, nil
+}
+
+// CancelWaitlistEntry 用户退出候补，已保留的名额释放给下一位候补用户
+func CancelWaitlistEntry(userID, entryID uint) error {
+	tx := database.DB.Begin()
+
+	entry, err := lockUserWaitlistEntry(tx, userID, entryID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if entry.Status != WaitlistStatusWaiting && entry.Status != WaitlistStatusHeld {
+		tx.Rollback()
+		return errors.New("当前状态不允许取消")
+	}
+
+	held := entry.Status == WaitlistStatusHeld
+	// Updates 会把 held_slot_ids 回写到 entry，需先取出保留的时间段
+	heldSlotIDs := entry.HeldSlotIDs
+	if err := tx.Model(entry).Updates(map[string]interface{}{
+		"status":        WaitlistStatusCancelled,
+		"held_slot_ids": SlotIDList(nil),
+	}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if held {
+		if err := freeSlots(tx, heldSlotIDs); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := promoteWaitlist(tx, heldSlotIDs); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit().Error
+}
+
+// BookFromWaitlist 用户在保留时限内将候补转为正式预约
+func BookFromWaitlist(userID, entryID, couponID uint, remark string) (*Appointment, error) {
+	tx := database.DB.Begin()
+
+	entry, err := lockUserWaitlistEntry(tx, userID, entryID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if entry.Status != WaitlistStatusHeld {
+		tx.Rollback()
+		return nil, errors.New("当前没有为您保留的名额")
+	}
+	if entry.HoldExpiresAt != nil && entry.HoldExpiresAt.Before(time.Now()) {
+		tx.Rollback()
+		return nil, errors.New("保留名额已过期")
+	}
+
+	// 先归还保留的名额，再按正常流程预约，整个过程在同一事务中完成，名额不会被他人占用
+	if err := freeSlots(tx, entry.HeldSlotIDs); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if remark == "" {
+		remark = entry.Remark
+	}
+	appointment, err := createAppointmentTx(tx, entry.UserID, entry.MerchantID, entry.ServiceID, entry.StaffID,
+		entry.TimeSlotID, entry.Date, couponID, remark)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Model(entry).Updates(map[string]interface{}{
+		"status":         WaitlistStatusBooked,
+		"appointment_id": appointment.ID,
+		"held_slot_ids":  SlotIDList(nil),
+	}).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("提交事务失败")
+	}
+	return appointment, nil
+}
+
+// promoteWaitlist 时间段释放名额后，按加入顺序为同一员工当天的候补用户放位。
+// 根据商家配置为候补用户保留名额或直接预约，单个候补放位失败不影响其他候补和调用方的事务。
+func promoteWaitlist(tx *gorm.DB, slotIDs []uint) error {
+	if len(slotIDs) == 0 {
+		return nil
+	}
+
+	var freed []TimeSlot
+	if err := tx.Where("id IN (?)", slotIDs).Find(&freed).Error; err != nil {
+		return err
+	}
+
+	today := make(map[uint]string)
+	visited := make(map[string]bool)
+	for _, slot := range freed {
+		if _, ok := today[slot.MerchantID]; !ok {
+			today[slot.MerchantID] = merchantToday(tx, slot.MerchantID)
+		}
+		day := slot.Date.Format("2006-01-02")
+		key := fmt.Sprintf("%d-%s", slot.StaffID, day)
+		if visited[key] || day < today[slot.MerchantID] {
+			continue
+		}
+		visited[key] = true
+
+		var entries []WaitlistEntry
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("merchant_id = ? AND staff_id = ? AND date = ? AND status = ?",
+				slot.MerchantID, slot.StaffID, day, WaitlistStatusWaiting).
+			Order("created_at ASC, id ASC").
+			Find(&entries).Error; err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			continue
+		}
+
+		setting, err := getMerchantSetting(tx, slot.MerchantID)
+		if err != nil {
+			return err
+		}
+
+		for i := range entries {
+			if err := tx.SavePoint("waitlist_promote").Error; err != nil {
+				return err
+			}
+			if err := promoteWaitlistEntry(tx, &entries[i], setting); err != nil {
+				if rbErr := tx.RollbackTo("waitlist_promote").Error; rbErr != nil {
+					return rbErr
+				}
+				continue
+			}
+		}
+	}
+	return nil
+}
+
+// promoteWaitlistEntry 尝试为单个候补放位，名额不足时返回错误
+func promoteWaitlistEntry(tx *gorm.DB, entry *WaitlistEntry, setting *MerchantSetting) error {
+	window := fmt.Sprintf("%s %s-%s", entry.Date.Format("2006-01-02"), entry.StartTime, entry.EndTime)
+
+	if setting.WaitlistMode == WaitlistModeAutoBook {
+		appointment, err := createAppointmentTx(tx, entry.UserID, entry.MerchantID, entry.ServiceID, entry.StaffID,
+			entry.TimeSlotID, entry.Date, 0, entry.Remark)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(entry).Updates(map[string]interface{}{
+			"status":         WaitlistStatusBooked,
+			"appointment_id": appointment.ID,
+		}).Error; err != nil {
+			return err
+		}
+		return notifyUser(tx, entry.UserID, NotificationTypeWaitlistBooked, "候补成功",
+			fmt.Sprintf("您候补的 %s 已有空位，已为您自动预约，订单号 %s", window, appointment.OrderNo))
+	}
+
+	var first TimeSlot
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&first, entry.TimeSlotID).Error; err != nil {
+		return err
+	}
+	service, err := staffServiceTx(tx, entry.MerchantID, entry.ServiceID, entry.StaffID)
+	if err != nil {
+		return err
+	}
+	run, err := lockBookingSlots(tx, first, service, entry.UserID, 0)
+	if err != nil {
+		return err
+	}
+	if err := occupySlots(tx, run); err != nil {
+		return err
+	}
+
+	held := make(SlotIDList, 0, len(run))
+	for _, s := range run {
+		held = append(held, s.ID)
+	}
+	expiresAt := time.Now().Add(time.Duration(setting.WaitlistHoldMinutes) * time.Minute)
+	if err := tx.Model(entry).Updates(map[string]interface{}{
+		"status":          WaitlistStatusHeld,
+		"held_slot_ids":   held,
+		"hold_expires_at": expiresAt,
+	}).Error; err != nil {
+		return err
+	}
+	return notifyUser(tx, entry.UserID, NotificationTypeWaitlistHold, "候补名额已保留",
+		fmt.Sprintf("您候补的 %s 已有空位，名额为您保留至 %s，请尽快确认预约",
+			window, expiresAt.Format("01-02 15:04")))
+}
+
+// ExpireWaitlist 释放超时未确认的保留名额并继续放位给下一位候补，同时关闭日期已过的候补。
+// 结账预留到期后名额不会触发取消流程，因此也为仍在排队的候补重新尝试放位。
+func ExpireWaitlist(now time.Time) (int, error) {
+	var expired []WaitlistEntry
+	if err := database.DB.Where("status = ? AND hold_expires_at < ?", WaitlistStatusHeld, now).
+		Find(&expired).Error; err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, e := range expired {
+		if err := expireWaitlistHold(e.ID, now); err != nil {
+			log.Printf("候补 %d 保留名额释放失败: %v", e.ID, err)
+			continue
+		}
+		count++
+	}
+
+	// 按各商家时区的今天关闭日期已过的候补
+	var merchantIDs []uint
+	if err := database.DB.Model(&WaitlistEntry{}).
+		Where("status = ?", WaitlistStatusWaiting).
+		Distinct().
+		Pluck("merchant_id", &merchantIDs).Error; err != nil {
+		return count, err
+	}
+	for _, merchantID := range merchantIDs {
+		today := now.In(MerchantLocation(merchantID)).Format("2006-01-02")
+		result := database.DB.Model(&WaitlistEntry{}).
+			Where("merchant_id = ? AND status = ? AND date < ?", merchantID, WaitlistStatusWaiting, today).
+			Update("status", WaitlistStatusExpired)
+		if result.Error != nil {
+			return count, result.Error
+		}
+		count += int(result.RowsAffected)
+	}
+
+	var slotIDs []uint
+	if err := database.DB.Model(&WaitlistEntry{}).
+		Where("status = ?", WaitlistStatusWaiting).
+		Distinct().
+		Pluck("time_slot_id", &slotIDs).Error; err != nil {
+		return count, err
+	}
+	if len(slotIDs) > 0 {
+		if err := database.DB.Transaction(func(tx *gorm.DB) error {
+			return promoteWaitlist(tx, slotIDs)
+		}); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+func expireWaitlistHold(entryID uint, now time.Time) error {
+	tx := database.DB.Begin()
+
+	var entry WaitlistEntry
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&entry, entryID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	// 加锁后重新确认，期间用户可能已确认预约
+	if entry.Status != WaitlistStatusHeld || entry.HoldExpiresAt == nil || !entry.HoldExpiresAt.Before(now) {
+		tx.Rollback()
+		return nil
+	}
+
+	// Updates 会把 held_slot_ids 回写到 entry，需先取出保留的时间段
+	heldSlotIDs := entry.HeldSlotIDs
+	if err := tx.Model(&entry).Updates(map[string]interface{}{
+		"status":        WaitlistStatusExpired,
+		"held_slot_ids": SlotIDList(nil),
+	}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := freeSlots(tx, heldSlotIDs); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := notifyUser(tx, entry.UserID, NotificationTypeWaitlistExpired, "候补名额已过期",
+		fmt.Sprintf("您候补的 %s %s-%s 未在保留时间内确认，名额已释放",
+			entry.Date.Format("2006-01-02"), entry.StartTime, entry.EndTime)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := promoteWaitlist(tx, heldSlotIDs); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
@@ -0,0 +1,250 @@
+package payment
+
+import (
+	"admin-api/config"
+	"admin-api/models"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// 支付渠道名称，保存在支付单和商家配置中
+const (
+	ProviderWechatV2 = "wechat_v2" // 微信支付 v2（XML + MD5 签名）
+	ProviderWechatV3 = "wechat_v3" // 微信支付 APIv3（JSON + RSA 签名）
+	ProviderSimulate = "simulate"  // 模拟支付，用于开发环境
+)
+
+// 回调通知类型
+const (
+	NotifyKindPayment = "payment" // 支付结果
+	NotifyKindRefund  = "refund"  // 退款结果
+)
+
+// OrderRequest 下单参数
+type OrderRequest struct {
+	PaymentID   uint
+	OutTradeNo  string
+	Amount      int // 支付金额(分)
+	Description string
+	OpenID      string
+}
+
+// OrderStatus 查询订单的结果
+type OrderStatus struct {
+	OutTradeNo    string
+	TransactionID string
+	Paid          bool // 已支付（含已支付后退款）
+	Closed        bool // 已关闭或已撤销
+	State         string
+}
+
+// RefundRequest 退款参数
+type RefundRequest struct {
+	OutTradeNo  string
+	OutRefundNo string
+	Total       int // 原支付金额(分)
+	Amount      int // 退款金额(分)
+	Reason      string
+}
+
+// RefundResult 申请退款的结果
+type RefundResult struct {
+	RefundID  string
+	Succeeded bool // 退款已完成；为 false 时等待退款回调
+}
+
+// Notification 解析后的支付或退款回调
+type Notification struct {
+	Kind string
+
+	// 支付结果
+	PaymentID     uint // 渠道回传的本地支付单ID，为 0 时不校验
+	OutTradeNo    string
+	TransactionID string
+	Amount        int
+
+	// 退款结果
+	OutRefundNo string
+	RefundID    string
+
+	Succeeded bool
+	Message   string // 失败原因或渠道状态
+	Raw       string // 原始回调内容，保存到支付记录
+}
+
+// Provider 支付渠道。控制器和后台任务只通过该接口下单、关单、退款和处理回调，
+// 新增渠道实现该接口并在 init 中调用 RegisterProvider 即可
+type Provider interface {
+	// Name 渠道名称，保存在支付单中，回调地址 /payments/notify/:provider 按名称查找渠道
+	Name() string
+	// TradeNoPrefix 商户订单号前缀
+	TradeNoPrefix() string
+	// CreateOrder 下单，返回前端调起支付所需的参数
+	CreateOrder(req OrderRequest) (interface{}, error)
+	// QueryOrder 按商户订单号查询订单
+	QueryOrder(outTradeNo string) (*OrderStatus, error)
+	// CloseOrder 关闭订单，已支付的返回 ErrOrderPaid，已关闭或未下单的视为成功
+	CloseOrder(outTradeNo string) error
+	// Refund 申请退款
+	Refund(req RefundRequest) (*RefundResult, error)
+	// VerifySignature 验证回调签名
+	VerifySignature(header http.Header, body []byte) error
+	// ParseNotify 解析已验签的回调
+	ParseNotify(header http.Header, body []byte) (*Notification, error)
+	// WriteNotifyResponse 按渠道要求的格式应答回调，err 不为 nil 时渠道会重新通知
+	WriteNotifyResponse(w http.ResponseWriter, err error)
+}
+
+var providers = map[string]Provider{}
+
+// RegisterProvider 注册支付渠道
+func RegisterProvider(p Provider) {
+	providers[p.Name()] = p
+}
+
+// GetProvider 按名称获取支付渠道
+func GetProvider(name string) (Provider, error) {
+	p, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("不支持的支付渠道: %s", name)
+	}
+	return p, nil
+}
+
+// ProviderNames 已注册的支付渠道名称
+func ProviderNames() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WechatProvider 按 wechat_pay.api_version 选择的微信支付渠道，也用于处理未带渠道名称的回调地址
+func WechatProvider() Provider {
+	if APIv3Enabled() {
+		return providers[ProviderWechatV3]
+	}
+	return providers[ProviderWechatV2]
+}
+
+// DefaultProvider 部署默认的支付渠道：开启模拟支付时为模拟支付，否则为微信支付
+func DefaultProvider() Provider {
+	if config.Config.WechatPay.UseSimulate {
+		return providers[ProviderSimulate]
+	}
+	return WechatProvider()
+}
+
+// ProviderForMerchant 商家新建支付单使用的渠道，商家未配置时使用部署默认的渠道
+func ProviderForMerchant(merchantID uint) (Provider, error) {
+	if merchantID == 0 {
+		return DefaultProvider(), nil
+	}
+	setting, err := models.GetMerchantSetting(merchantID)
+	if err != nil {
+		return nil, err
+	}
+	if setting.PaymentProvider == "" {
+		return DefaultProvider(), nil
+	}
+	return GetProvider(setting.PaymentProvider)
+}
+
+// ProviderForPayment 支付单所属的渠道。未记录渠道的历史支付单按订单号前缀推断
+func ProviderForPayment(payment *models.Payment) (Provider, error) {
+	if payment.Provider != "" {
+		return GetProvider(payment.Provider)
+	}
+	if strings.HasPrefix(payment.OutTradeNo, "SIM") {
+		return GetProvider(ProviderSimulate)
+	}
+	return WechatProvider(), nil
+}
+
+// HandleNotification 处理渠道已验签的回调，支付单须属于该渠道，重复通知直接返回成功
+func HandleNotification(p Provider, n *Notification) error {
+	switch n.Kind {
+	case NotifyKindPayment:
+		return handlePaymentNotification(p, n)
+	case NotifyKindRefund:
+		if n.Succeeded {
+			return models.CompleteChannelRefund(n.OutRefundNo, n.RefundID)
+		}
+		return models.FailChannelRefund(n.OutRefundNo, n.Message)
+	}
+	log.Printf("未处理的%s回调类型: %s", p.Name(), n.Kind)
+	return nil
+}
+
+func handlePaymentNotification(p Provider, n *Notification) error {
+	payment, err := models.GetPaymentByOutTradeNo(n.OutTradeNo)
+	if err != nil {
+		return fmt.Errorf("未找到支付记录: %s", n.OutTradeNo)
+	}
+	if n.PaymentID != 0 && n.PaymentID != payment.ID {
+		return errors.New("订单号不匹配")
+	}
+	owner, err := ProviderForPayment(payment)
+	if err != nil {
+		return err
+	}
+	if owner.Name() != p.Name() {
+		return fmt.Errorf("支付单 %s 不属于支付渠道 %s", n.OutTradeNo, p.Name())
+	}
+
+	if !n.Succeeded {
+		if _, err := models.MarkPaymentFailed(payment.ID, n.Message); err != nil {
+			return fmt.Errorf("更新支付状态失败: %v", err)
+		}
+		return nil
+	}
+	return completePayment(payment, n.TransactionID, n.Amount, n.Raw)
+}
+
+// completePayment 支付成功后更新支付记录及关联的预约或订单，重复通知直接返回成功
+func completePayment(payment *models.Payment, transactionID string, totalFee int, rawNotify string) error {
+	if payment.Status == models.PaymentStatusSucceeded {
+		return nil
+	}
+
+	// 检查金额是否一致
+	if totalFee != payment.Amount {
+		return fmt.Errorf("金额不一致: 本地%d, 渠道%d", payment.Amount, totalFee)
+	}
+
+	// 只更新待支付的支付单，超时关闭的不再改为成功
+	ok, err := models.MarkPaymentSucceeded(payment.ID, transactionID, rawNotify)
+	if err != nil {
+		return fmt.Errorf("更新支付状态失败: %v", err)
+	}
+	if !ok {
+		latest, err := models.GetPaymentByID(payment.ID)
+		if err == nil && latest.Status == models.PaymentStatusSucceeded {
+			return nil
+		}
+		return errors.New("支付单已关闭或已处理")
+	}
+
+	// 更新关联预约状态
+	if payment.AppointmentID != 0 {
+		// 记录错误但不中断整个流程
+		if err := models.MarkAppointmentPaid(payment.AppointmentID, payment.ID); err != nil {
+			log.Printf("更新预约状态失败: %v", err)
+		}
+	}
+
+	// 组合订单支付成功后更新订单及其项目
+	if payment.OrderID != 0 {
+		if err := models.MarkOrderPaid(payment.OrderID, payment.ID); err != nil {
+			log.Printf("更新订单状态失败: %v", err)
+		}
+	}
+
+	return nil
+}
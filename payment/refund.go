@@ -0,0 +1,51 @@
+package payment
+
+import (
+	"admin-api/models"
+	"log"
+)
+
+// ExecuteRefund 通过支付单所属的渠道发起已创建的退款：渠道直接完成的退款预约变为已退款；
+// 否则提交成功后支付单和预约变为退款中，等待退款回调。
+// 提交前出错或渠道拒绝时退款记录标记为失败，预约和支付单保持原状态，调用方可重新发起
+func ExecuteRefund(refund *models.Refund, actorType string, actorID uint) error {
+	payment, err := models.GetPaymentByID(refund.PaymentID)
+	if err != nil {
+		return failRefund(refund, err)
+	}
+	provider, err := ProviderForPayment(payment)
+	if err != nil {
+		return failRefund(refund, err)
+	}
+
+	result, err := provider.Refund(RefundRequest{
+		OutTradeNo:  payment.OutTradeNo,
+		OutRefundNo: refund.OutRefundNo,
+		Total:       payment.Amount,
+		Amount:      refund.Amount,
+		Reason:      refund.Reason,
+	})
+	if err != nil {
+		return failRefund(refund, err)
+	}
+
+	if result.Succeeded {
+		if err := models.CompleteRefund(refund.ID, actorType, actorID); err != nil {
+			return err
+		}
+		refund.Status = models.RefundStatusSuccess
+		return nil
+	}
+
+	return models.MarkRefundSubmitted(refund.ID, actorType, actorID)
+}
+
+// failRefund 将未提交成功的退款标记为失败并返回原错误
+func failRefund(refund *models.Refund, err error) error {
+	if failErr := models.FailRefund(refund.ID, err.Error()); failErr != nil {
+		log.Printf("更新退款 %d 状态失败: %v", refund.ID, failErr)
+	}
+	refund.Status = models.RefundStatusFailed
+	refund.FailReason = err.Error()
+	return err
+}
@@ -0,0 +1,126 @@
+package payment
+
+import (
+	"admin-api/config"
+	"admin-api/models"
+	"admin-api/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// 模拟支付不验签、不实际退款，只在开启 wechat_pay.use_simulate 时注册，
+// 否则商家不能选择，模拟回调地址返回 404
+func init() {
+	if config.Config.WechatPay.UseSimulate {
+		RegisterProvider(simulateProvider{})
+	}
+}
+
+// SimulateNotifyRequest 模拟支付回调请求
+type SimulateNotifyRequest struct {
+	PaymentID  uint   `json:"paymentId"`
+	OutTradeNo string `json:"outTradeNo"`
+	Status     string `json:"status"` // success, failed
+}
+
+// SimulateOrderResponse 模拟支付下单结果，前端据此调用模拟回调完成支付
+type SimulateOrderResponse struct {
+	Simulate   bool   `json:"simulate"`
+	PaymentID  uint   `json:"paymentId"`
+	OutTradeNo string `json:"outTradeNo"`
+}
+
+// simulateProvider 模拟支付渠道，用于开发环境：下单只返回支付单信息，
+// 由 /payments/simulate-notify 回调完成支付，退款直接成功
+type simulateProvider struct{}
+
+func (simulateProvider) Name() string { return ProviderSimulate }
+
+func (simulateProvider) TradeNoPrefix() string { return "SIM" }
+
+func (simulateProvider) CreateOrder(req OrderRequest) (interface{}, error) {
+	return &SimulateOrderResponse{
+		Simulate:   true,
+		PaymentID:  req.PaymentID,
+		OutTradeNo: req.OutTradeNo,
+	}, nil
+}
+
+// QueryOrder 模拟支付没有外部订单，以本地支付单状态为准
+func (simulateProvider) QueryOrder(outTradeNo string) (*OrderStatus, error) {
+	payment, err := models.GetPaymentByOutTradeNo(outTradeNo)
+	if err != nil {
+		return nil, errors.New("支付记录不存在")
+	}
+	status := &OrderStatus{
+		OutTradeNo:    outTradeNo,
+		TransactionID: payment.TransactionID,
+		State:         payment.Status,
+	}
+	switch payment.Status {
+	case models.PaymentStatusSucceeded, models.PaymentStatusRefunding, models.PaymentStatusRefunded:
+		status.Paid = true
+	case models.PaymentStatusClosed:
+		status.Closed = true
+	}
+	return status, nil
+}
+
+func (simulateProvider) CloseOrder(outTradeNo string) error {
+	return nil
+}
+
+func (simulateProvider) Refund(req RefundRequest) (*RefundResult, error) {
+	return &RefundResult{Succeeded: true}, nil
+}
+
+// VerifySignature 模拟回调不签名
+func (simulateProvider) VerifySignature(header http.Header, body []byte) error {
+	return nil
+}
+
+// ParseNotify 模拟支付按支付单金额全额支付
+func (simulateProvider) ParseNotify(header http.Header, body []byte) (*Notification, error) {
+	var req SimulateNotifyRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, errors.New("参数错误: " + err.Error())
+	}
+	if req.PaymentID == 0 || req.OutTradeNo == "" {
+		return nil, errors.New("参数错误: 缺少支付单")
+	}
+	if req.Status != models.PaymentStatusSucceeded && req.Status != models.PaymentStatusFailed {
+		return nil, errors.New("参数错误: 无效的支付状态")
+	}
+
+	payment, err := models.GetPaymentByID(req.PaymentID)
+	if err != nil {
+		return nil, errors.New("支付记录不存在")
+	}
+	if payment.OutTradeNo != req.OutTradeNo {
+		return nil, errors.New("订单号不匹配")
+	}
+
+	n := &Notification{
+		Kind:       NotifyKindPayment,
+		PaymentID:  req.PaymentID,
+		OutTradeNo: req.OutTradeNo,
+		Amount:     payment.Amount,
+		Succeeded:  req.Status == models.PaymentStatusSucceeded,
+		Raw:        string(body),
+	}
+	if !n.Succeeded {
+		n.Message = "模拟支付失败"
+	}
+	return n, nil
+}
+
+func (simulateProvider) WriteNotifyResponse(w http.ResponseWriter, err error) {
+	resp := utils.Response{Code: 0, Msg: "success", Data: "支付状态更新成功"}
+	if err != nil {
+		resp = utils.Response{Code: 400, Msg: err.Error()}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
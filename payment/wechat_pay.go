@@ -2,18 +2,17 @@ package payment
 
 import (
 	"admin-api/config"
-	"admin-api/models"
-	"admin-api/utils"
 	"bytes"
+	"crypto/aes"
 	"crypto/md5"
 	"crypto/tls"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"math/rand"
 	"net/http"
 	"sort"
@@ -28,6 +27,9 @@ type WechatPayClient struct {
 	MchID     string
 	APIKey    string
 	NotifyURL string
+	BaseURL   string // 支付网关地址
+
+	RefundNotifyURL string // 退款结果回调地址
 }
 
 var (
@@ -41,9 +43,26 @@ func init() {
 		MchID:     config.Config.WechatPay.MchID,
 		APIKey:    config.Config.WechatPay.APIKey,
 		NotifyURL: config.Config.WechatPay.NotifyURL,
+		BaseURL:   gatewayBaseURL(config.Config.WechatPay.BaseURL),
+
+		RefundNotifyURL: config.Config.WechatPay.RefundNotifyURL,
+	}
+	if wechatPayClient.RefundNotifyURL == "" {
+		wechatPayClient.RefundNotifyURL = wechatPayClient.NotifyURL
 	}
 }
 
+// 微信支付正式网关地址
+const wechatPayHost = "https://api.mch.weixin.qq.com"
+
+// gatewayBaseURL 配置的支付网关地址，未配置时为微信支付正式地址
+func gatewayBaseURL(baseURL string) string {
+	if baseURL == "" {
+		return wechatPayHost
+	}
+	return strings.TrimRight(baseURL, "/")
+}
+
 // PrepayResponse 预支付响应
 type PrepayResponse struct {
 	AppID     string `json:"appId"`
@@ -75,12 +94,27 @@ type WechatNotifyRequest struct {
 	OutTradeNo    string `xml:"out_trade_no"`
 	Attach        string `xml:"attach"`
 	TimeEnd       string `xml:"time_end"`
+	ReqInfo       string `xml:"req_info"` // 退款结果回调的加密内容，退款回调不带 sign
+}
+
+// WechatRefundInfo 退款结果回调中 req_info 解密后的内容
+type WechatRefundInfo struct {
+	TransactionID       string `xml:"transaction_id"`
+	OutTradeNo          string `xml:"out_trade_no"`
+	RefundID            string `xml:"refund_id"`
+	OutRefundNo         string `xml:"out_refund_no"`
+	TotalFee            int    `xml:"total_fee"`
+	RefundFee           int    `xml:"refund_fee"`
+	SettlementRefundFee int    `xml:"settlement_refund_fee"`
+	RefundStatus        string `xml:"refund_status"` // SUCCESS, CHANGE（退款异常）, REFUNDCLOSE（退款关闭）
+	SuccessTime         string `xml:"success_time"`
 }
 
 // WechatNotifyResponse 微信支付回调响应
 type WechatNotifyResponse struct {
-	ReturnCode string `xml:"return_code"`
-	ReturnMsg  string `xml:"return_msg"`
+	XMLName    xml.Name `xml:"xml"`
+	ReturnCode string   `xml:"return_code"`
+	ReturnMsg  string   `xml:"return_msg"`
 }
 
 // CreateWechatPayOrder 创建微信支付订单
@@ -133,7 +167,7 @@ func CreateWechatPayOrder(options ...func(map[string]interface{})) (*PrepayRespo
 	fmt.Println(string(xmlData))
 
 	// 发送请求
-	resp, err := sendWechatRequest("https://api.mch.weixin.qq.com/pay/unifiedorder", xmlData)
+	resp, err := sendWechatRequest(wechatPayClient.BaseURL+"/pay/unifiedorder", xmlData)
 	if err != nil {
 		return nil, err
 	}
@@ -171,68 +205,62 @@ func CreateWechatPayOrder(options ...func(map[string]interface{})) (*PrepayRespo
 	return prepayResp, nil
 }
 
-// HandlePaymentResult 处理支付结果
-func HandlePaymentResult(req WechatNotifyRequest) error {
-	// 验证支付结果
-	if req.ReturnCode != "SUCCESS" || req.ResultCode != "SUCCESS" {
-		return fmt.Errorf("支付失败: %s", req.ReturnMsg)
+// CreateWechatRefund 创建微信退款，返回微信退款单号
+func CreateWechatRefund(outTradeNo, outRefundNo string, totalFee, refundFee int, reason string) (string, error) {
+	params := map[string]interface{}{
+		"appid":         wechatPayClient.AppID,
+		"mch_id":        wechatPayClient.MchID,
+		"nonce_str":     generateNonceStr(32),
+		"out_trade_no":  outTradeNo,
+		"out_refund_no": outRefundNo,
+		"total_fee":     totalFee,
+		"refund_fee":    refundFee,
+	}
+	// 签名包含所有字段，微信支付验签时忽略空值，可选字段为空时不传
+	if reason != "" {
+		params["refund_desc"] = reason
+	}
+	if wechatPayClient.RefundNotifyURL != "" {
+		params["notify_url"] = wechatPayClient.RefundNotifyURL
 	}
 
-	// 查询本地支付记录
-	payment, err := models.GetPaymentByOutTradeNo(req.OutTradeNo)
+	// 生成签名
+	params["sign"] = generateSign(params, wechatPayClient.APIKey)
+
+	// 转换为XML
+	xmlData, err := mapToXML(params)
 	if err != nil {
-		return fmt.Errorf("未找到支付记录: %s", req.OutTradeNo)
+		return "", err
 	}
 
-	// 检查金额是否一致
-	if req.TotalFee != payment.Amount {
-		return fmt.Errorf("金额不一致: 本地%d, 微信%d", payment.Amount, req.TotalFee)
+	// 发送退款请求
+	resp, err := sendWechatRequest(wechatPayClient.BaseURL+"/secapi/pay/refund", xmlData, true)
+	if err != nil {
+		return "", err
 	}
 
-	// 获取当前时间（用于 PaidAt）
-	now := time.Now()
-
-	// 更新支付记录
-	payment.Status = models.PaymentStatusSucceeded
-	payment.PaidAt = &now // 使用指针赋值
-	payment.TransactionID = req.TransactionID
-	payment.RawNotify = utils.ToJSONString(req) // 使用新实现的工具函数
-
-	if err := models.UpdatePayment(payment); err != nil {
-		return fmt.Errorf("更新支付状态失败: %v", err)
+	// 解析响应
+	if resp["return_code"] != "SUCCESS" {
+		return "", errors.New("微信退款错误: " + resp["return_msg"])
 	}
 
-	// 更新关联预约状态
-	if payment.AppointmentID != 0 {
-		appointment, err := models.GetAppointmentByID(payment.AppointmentID)
-		if err != nil {
-			// 记录错误但不中断整个流程
-			log.Printf("获取预约失败: %v", err)
-		} else {
-			// 更新预约状态和支付关联
-			appointment.Status = models.AppointmentStatusPaid
-			appointment.PaymentID = payment.ID // 关联支付记录
-
-			if err := models.UpdateAppointment(appointment); err != nil {
-				log.Printf("更新预约状态失败: %v", err)
-			}
-		}
+	if resp["result_code"] != "SUCCESS" {
+		return "", errors.New("微信退款业务错误: " + resp["err_code_des"])
 	}
 
-	return nil
+	return resp["refund_id"], nil
 }
 
-// CreateWechatRefund 创建微信退款
-func CreateWechatRefund(outTradeNo, outRefundNo string, totalFee, refundFee int, reason string) error {
+// ErrOrderPaid 关闭订单时微信返回订单已支付，应等待支付回调而不是关闭
+var ErrOrderPaid = errors.New("订单已支付")
+
+// CloseWechatOrder 关闭微信支付订单，关闭后用户无法再支付
+func CloseWechatOrder(outTradeNo string) error {
 	params := map[string]interface{}{
-		"appid":         wechatPayClient.AppID,
-		"mch_id":        wechatPayClient.MchID,
-		"nonce_str":     generateNonceStr(32),
-		"out_trade_no":  outTradeNo,
-		"out_refund_no": outRefundNo,
-		"total_fee":     totalFee,
-		"refund_fee":    refundFee,
-		"refund_desc":   reason,
+		"appid":        wechatPayClient.AppID,
+		"mch_id":       wechatPayClient.MchID,
+		"nonce_str":    generateNonceStr(32),
+		"out_trade_no": outTradeNo,
 	}
 
 	// 生成签名
@@ -244,56 +272,112 @@ func CreateWechatRefund(outTradeNo, outRefundNo string, totalFee, refundFee int,
 		return err
 	}
 
-	// 发送退款请求
-	resp, err := sendWechatRequest("https://api.mch.weixin.qq.com/secapi/pay/refund", xmlData, true)
+	// 发送关单请求
+	resp, err := sendWechatRequest(wechatPayClient.BaseURL+"/pay/closeorder", xmlData)
 	if err != nil {
 		return err
 	}
 
 	// 解析响应
 	if resp["return_code"] != "SUCCESS" {
-		return errors.New("微信退款错误: " + resp["return_msg"])
+		return errors.New("微信关单错误: " + resp["return_msg"])
 	}
 
 	if resp["result_code"] != "SUCCESS" {
-		return errors.New("微信退款业务错误: " + resp["err_code_des"])
+		switch resp["err_code"] {
+		case "ORDERPAID":
+			return ErrOrderPaid
+		case "ORDERCLOSED":
+			return nil
+		}
+		return errors.New("微信关单业务错误: " + resp["err_code_des"])
 	}
 
 	return nil
 }
 
-// VerifyWechatSign 验证微信签名
-func VerifyWechatSign(req WechatNotifyRequest, apiKey string) bool {
+// QueryWechatOrder 按商户订单号查询微信支付订单
+func QueryWechatOrder(outTradeNo string) (map[string]string, error) {
 	params := map[string]interface{}{
-		"return_code":    req.ReturnCode,
-		"return_msg":     req.ReturnMsg,
-		"appid":          req.AppID,
-		"mch_id":         req.MchID,
-		"nonce_str":      req.NonceStr,
-		"result_code":    req.ResultCode,
-		"openid":         req.OpenID,
-		"is_subscribe":   req.IsSubscribe,
-		"trade_type":     req.TradeType,
-		"bank_type":      req.BankType,
-		"total_fee":      req.TotalFee,
-		"fee_type":       req.FeeType,
-		"cash_fee":       req.CashFee,
-		"cash_fee_type":  req.CashFeeType,
-		"transaction_id": req.TransactionID,
-		"out_trade_no":   req.OutTradeNo,
-		"attach":         req.Attach,
-		"time_end":       req.TimeEnd,
-	}
-
-	// 移除空值
-	for k, v := range params {
-		if v == "" || v == 0 {
-			delete(params, k)
+		"appid":        wechatPayClient.AppID,
+		"mch_id":       wechatPayClient.MchID,
+		"nonce_str":    generateNonceStr(32),
+		"out_trade_no": outTradeNo,
+	}
+
+	// 生成签名
+	params["sign"] = generateSign(params, wechatPayClient.APIKey)
+
+	// 转换为XML
+	xmlData, err := mapToXML(params)
+	if err != nil {
+		return nil, err
+	}
+
+	// 发送查询请求
+	resp, err := sendWechatRequest(wechatPayClient.BaseURL+"/pay/orderquery", xmlData)
+	if err != nil {
+		return nil, err
+	}
+
+	// 解析响应
+	if resp["return_code"] != "SUCCESS" {
+		return nil, errors.New("微信查单错误: " + resp["return_msg"])
+	}
+
+	if resp["result_code"] != "SUCCESS" {
+		return nil, errors.New("微信查单业务错误: " + resp["err_code_des"])
+	}
+
+	return resp, nil
+}
+
+// VerifyWechatSign 验证微信签名，参与签名的为除 sign 外的全部非空字段
+func VerifyWechatSign(values map[string]string, apiKey string) bool {
+	params := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		if v != "" {
+			params[k] = v
 		}
 	}
+	return values["sign"] != "" && generateSign(params, apiKey) == values["sign"]
+}
 
-	calculatedSign := generateSign(params, apiKey)
-	return calculatedSign == req.Sign
+// DecryptWechatRefundInfo 解密退款结果回调的 req_info：base64 解码后用商户密钥 MD5 的小写十六进制作为密钥，
+// AES-256-ECB 解密，PKCS#7 填充。密钥不对时填充或 XML 校验失败，以此确认回调来自微信支付
+func DecryptWechatRefundInfo(reqInfo, apiKey string) (*WechatRefundInfo, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(reqInfo)
+	if err != nil {
+		return nil, errors.New("req_info 格式错误")
+	}
+	sum := md5.Sum([]byte(apiKey))
+	block, err := aes.NewCipher([]byte(hex.EncodeToString(sum[:])))
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, errors.New("req_info 长度错误")
+	}
+
+	plaintext := make([]byte, len(ciphertext))
+	for i := 0; i < len(ciphertext); i += aes.BlockSize {
+		block.Decrypt(plaintext[i:i+aes.BlockSize], ciphertext[i:i+aes.BlockSize])
+	}
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, errors.New("req_info 解密失败")
+	}
+	for _, b := range plaintext[len(plaintext)-padding:] {
+		if int(b) != padding {
+			return nil, errors.New("req_info 解密失败")
+		}
+	}
+
+	var info WechatRefundInfo
+	if err := xml.Unmarshal(plaintext[:len(plaintext)-padding], &info); err != nil || info.OutRefundNo == "" {
+		return nil, errors.New("req_info 解密失败")
+	}
+	return &info, nil
 }
 
 // ========== 辅助函数 ==========
@@ -369,8 +453,8 @@ func sendWechatRequest(url, xmlData string, useCert ...bool) (map[string]string,
 		Timeout: 15 * time.Second,
 	}
 
-	// 如果需要证书
-	if len(useCert) > 0 && useCert[0] {
+	// 如果需要证书，本地测试服务器使用 HTTP，不加载证书
+	if len(useCert) > 0 && useCert[0] && strings.HasPrefix(url, "https://") {
 		cert, err := tls.LoadX509KeyPair(
 			config.Config.WechatPay.CertPath,
 			config.Config.WechatPay.KeyPath,
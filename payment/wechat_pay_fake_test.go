@@ -0,0 +1,309 @@
+package payment
+
+import (
+	"admin-api/database"
+	"admin-api/database/dbtest"
+	"admin-api/models"
+	"admin-api/pkg/wechatpayfake"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeGateway 本地模拟的 v2 网关及接收回调的服务，回调按 handleProviderNotify 的流程处理
+type fakeGateway struct {
+	server *wechatpayfake.Server
+
+	mu            sync.Mutex
+	notifications []*Notification
+	handle        bool // 为 true 时调用 HandleNotification 更新数据库
+}
+
+func newFakeGateway(t *testing.T, handle bool) *fakeGateway {
+	t.Helper()
+	g := &fakeGateway{
+		server: wechatpayfake.NewServer(wechatpayfake.Config{
+			AppID:  wechatPayClient.AppID,
+			MchID:  wechatPayClient.MchID,
+			APIKey: wechatPayClient.APIKey,
+		}),
+		handle: handle,
+	}
+	gateway := httptest.NewServer(g.server)
+	notify := httptest.NewServer(http.HandlerFunc(g.serveNotify))
+	t.Cleanup(gateway.Close)
+	t.Cleanup(notify.Close)
+
+	previous := *wechatPayClient
+	wechatPayClient.BaseURL = gateway.URL
+	wechatPayClient.NotifyURL = notify.URL
+	wechatPayClient.RefundNotifyURL = notify.URL
+	t.Cleanup(func() { *wechatPayClient = previous })
+	return g
+}
+
+func (g *fakeGateway) serveNotify(w http.ResponseWriter, r *http.Request) {
+	provider := providers[ProviderWechatV2]
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = provider.VerifySignature(r.Header, body)
+	}
+	var n *Notification
+	if err == nil {
+		n, err = provider.ParseNotify(r.Header, body)
+	}
+	if err == nil {
+		g.mu.Lock()
+		g.notifications = append(g.notifications, n)
+		g.mu.Unlock()
+		if g.handle {
+			err = HandleNotification(provider, n)
+		}
+	}
+	provider.WriteNotifyResponse(w, err)
+}
+
+func (g *fakeGateway) lastNotification(t *testing.T) *Notification {
+	t.Helper()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.notifications) == 0 {
+		t.Fatal("未收到回调")
+	}
+	return g.notifications[len(g.notifications)-1]
+}
+
+func TestWechatV2FakeGatewayNotify(t *testing.T) {
+	g := newFakeGateway(t, false)
+	provider := providers[ProviderWechatV2]
+
+	prepay, err := provider.CreateOrder(OrderRequest{
+		OutTradeNo:  "P-NOTIFY-1",
+		Amount:      1200,
+		Description: "测试服务",
+		OpenID:      "openid-1",
+	})
+	if err != nil {
+		t.Fatalf("下单失败: %v", err)
+	}
+	if prepay.(*PrepayResponse).Package == "" {
+		t.Fatal("下单结果缺少 package")
+	}
+
+	if err := g.server.Pay("P-NOTIFY-1"); err != nil {
+		t.Fatalf("支付回调失败: %v", err)
+	}
+	n := g.lastNotification(t)
+	if n.Kind != NotifyKindPayment || !n.Succeeded || n.Amount != 1200 || n.OutTradeNo != "P-NOTIFY-1" {
+		t.Fatalf("支付回调内容错误: %+v", n)
+	}
+
+	status, err := provider.QueryOrder("P-NOTIFY-1")
+	if err != nil || !status.Paid || status.TransactionID != n.TransactionID {
+		t.Fatalf("查询订单结果错误: %+v, %v", status, err)
+	}
+	if err := provider.CloseOrder("P-NOTIFY-1"); err != ErrOrderPaid {
+		t.Fatalf("已支付订单关单应返回 ErrOrderPaid，实际 %v", err)
+	}
+
+	result, err := provider.Refund(RefundRequest{
+		OutTradeNo: "P-NOTIFY-1", OutRefundNo: "R-NOTIFY-1", Total: 1200, Amount: 500, Reason: "测试",
+	})
+	if err != nil || result.Succeeded || result.RefundID == "" {
+		t.Fatalf("v2 退款应等待回调: %+v, %v", result, err)
+	}
+	if err := g.server.SettleRefund("R-NOTIFY-1"); err != nil {
+		t.Fatalf("退款回调失败: %v", err)
+	}
+	n = g.lastNotification(t)
+	if n.Kind != NotifyKindRefund || !n.Succeeded || n.OutRefundNo != "R-NOTIFY-1" || n.RefundID != result.RefundID {
+		t.Fatalf("退款回调内容错误: %+v", n)
+	}
+
+	// 用错误密钥加密的退款回调不能通过验签
+	if _, err := provider.Refund(RefundRequest{
+		OutTradeNo: "P-NOTIFY-1", OutRefundNo: "R-NOTIFY-2", Total: 1200, Amount: 100,
+	}); err != nil {
+		t.Fatalf("退款失败: %v", err)
+	}
+	g.server.Script(wechatpayfake.APIRefundNotify, wechatpayfake.Failure{BadSign: true})
+	if err := g.server.SettleRefund("R-NOTIFY-2"); err == nil {
+		t.Fatal("错误密钥加密的退款回调应被拒绝")
+	}
+}
+
+func TestDecryptWechatRefundInfo(t *testing.T) {
+	info := map[string]string{
+		"out_trade_no":  "P1",
+		"out_refund_no": "R1",
+		"refund_id":     "5000001",
+		"refund_fee":    "100",
+		"refund_status": "SUCCESS",
+	}
+	tests := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{"商户密钥", "232fc9c655456253aed21efb6b230df3", false},
+		{"错误密钥", "232fc9c655456253aed21efb6b230df4", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reqInfo, err := wechatpayfake.EncryptRefundInfo(info, tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := DecryptWechatRefundInfo(reqInfo, "232fc9c655456253aed21efb6b230df3")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (got.OutRefundNo != "R1" || got.RefundFee != 100 || got.RefundStatus != "SUCCESS") {
+				t.Fatalf("解密结果错误: %+v", got)
+			}
+		})
+	}
+}
+
+// TestWechatV2PaymentAndRefundLifecycle 通过模拟网关完成下单、支付回调、退款和退款回调，检查数据库状态
+func TestWechatV2PaymentAndRefundLifecycle(t *testing.T) {
+	dbtest.Setup(t, &models.Merchant{}, &models.MerchantSetting{}, &models.TimeSlot{}, &models.Appointment{},
+		&models.AppointmentTimeSlot{}, &models.AppointmentEvent{}, &models.Payment{}, &models.Refund{},
+		&models.WaitlistEntry{}, &models.Notification{}, &models.UserCoupon{})
+	g := newFakeGateway(t, true)
+
+	tests := []struct {
+		name          string
+		refundSuccess bool
+		wantRefund    string
+		wantPayment   string
+		wantStatus    string
+	}{
+		{"退款成功", true, models.RefundStatusSuccess, models.PaymentStatusRefunded, models.AppointmentStatusRefunded},
+		// 退款异常时支付单恢复为已支付，预约保持退款中，等待商家重新发起
+		{"退款异常", false, models.RefundStatusFailed, models.PaymentStatusSucceeded, models.AppointmentStatusRefunding},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appointment, pay := createPaymentFixture(t, uint(i+1))
+
+			if _, err := providers[ProviderWechatV2].CreateOrder(OrderRequest{
+				PaymentID: pay.ID, OutTradeNo: pay.OutTradeNo, Amount: pay.Amount,
+				Description: "测试服务", OpenID: "openid-1",
+			}); err != nil {
+				t.Fatalf("下单失败: %v", err)
+			}
+			if err := g.server.Pay(pay.OutTradeNo); err != nil {
+				t.Fatalf("支付回调失败: %v", err)
+			}
+			// 重复的支付回调直接应答成功
+			if err := HandleNotification(providers[ProviderWechatV2], g.lastNotification(t)); err != nil {
+				t.Fatalf("重复支付回调处理失败: %v", err)
+			}
+			assertStatus(t, appointment.ID, pay.ID, models.AppointmentStatusPaid, models.PaymentStatusSucceeded)
+
+			refund, err := models.CreateAppointmentRefund(appointment.MerchantID, appointment.ID, pay.Amount, "测试退款")
+			if err != nil {
+				t.Fatalf("创建退款失败: %v", err)
+			}
+			if err := ExecuteRefund(refund, models.ActorMerchant, appointment.MerchantID); err != nil {
+				t.Fatalf("发起退款失败: %v", err)
+			}
+			assertStatus(t, appointment.ID, pay.ID, models.AppointmentStatusRefunding, models.PaymentStatusRefunding)
+			// 退款中的预约不再占用名额
+			assertBooked(t, appointment.TimeSlotID, 0)
+
+			if tt.refundSuccess {
+				err = g.server.SettleRefund(refund.OutRefundNo)
+			} else {
+				err = g.server.FailRefund(refund.OutRefundNo)
+			}
+			if err != nil {
+				t.Fatalf("退款回调失败: %v", err)
+			}
+
+			latest, err := models.GetRefundByID(refund.ID)
+			if err != nil || latest.Status != tt.wantRefund {
+				t.Fatalf("退款状态 = %v, 期望 %s (%v)", latest.Status, tt.wantRefund, err)
+			}
+			assertStatus(t, appointment.ID, pay.ID, tt.wantStatus, tt.wantPayment)
+			assertBooked(t, appointment.TimeSlotID, 0)
+			if tt.refundSuccess {
+				return
+			}
+
+			// 退款异常后商家可重新发起退款
+			retry, err := models.CreateAppointmentRefund(appointment.MerchantID, appointment.ID, pay.Amount, "重新退款")
+			if err != nil {
+				t.Fatalf("重新发起退款失败: %v", err)
+			}
+			if err := ExecuteRefund(retry, models.ActorMerchant, appointment.MerchantID); err != nil {
+				t.Fatalf("重新发起退款失败: %v", err)
+			}
+			if err := g.server.SettleRefund(retry.OutRefundNo); err != nil {
+				t.Fatalf("退款回调失败: %v", err)
+			}
+			assertStatus(t, appointment.ID, pay.ID, models.AppointmentStatusRefunded, models.PaymentStatusRefunded)
+			assertBooked(t, appointment.TimeSlotID, 0)
+		})
+	}
+}
+
+func createPaymentFixture(t *testing.T, n uint) (*models.Appointment, *models.Payment) {
+	t.Helper()
+	slot := models.TimeSlot{
+		MerchantID: n, StaffID: 1, Date: time.Now().AddDate(0, 0, 1),
+		StartTime: "10:00:00", EndTime: "11:00:00", Capacity: 1, BookedCount: 1,
+	}
+	if err := database.DB.Create(&slot).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Model(&slot).Update("is_available", false).Error; err != nil {
+		t.Fatal(err)
+	}
+	appointment := models.Appointment{
+		OrderNo: "A" + time.Now().Format("150405.000000"), UserID: 1, MerchantID: n, ServiceID: 1, StaffID: 1,
+		TimeSlotID: slot.ID, AppointmentDate: slot.Date, StartTime: slot.StartTime, EndTime: slot.EndTime,
+		Status: models.AppointmentStatusConfirmed, Amount: 1200,
+	}
+	if err := database.DB.Create(&appointment).Error; err != nil {
+		t.Fatal(err)
+	}
+	pay := models.Payment{
+		CustomerID: 1, MerchantID: n, AppointmentID: appointment.ID, Provider: ProviderWechatV2,
+		OutTradeNo: "P" + appointment.OrderNo, Amount: 1200, Status: models.PaymentStatusPending,
+	}
+	if err := database.DB.Create(&pay).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &appointment, &pay
+}
+
+func assertStatus(t *testing.T, appointmentID, paymentID uint, wantAppointment, wantPayment string) {
+	t.Helper()
+	var appointment models.Appointment
+	if err := database.DB.First(&appointment, appointmentID).Error; err != nil {
+		t.Fatal(err)
+	}
+	pay, err := models.GetPaymentByID(paymentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if appointment.Status != wantAppointment || pay.Status != wantPayment {
+		t.Fatalf("预约状态 %s 支付状态 %s, 期望 %s %s", appointment.Status, pay.Status, wantAppointment, wantPayment)
+	}
+}
+
+func assertBooked(t *testing.T, slotID uint, want int) {
+	t.Helper()
+	var slot models.TimeSlot
+	if err := database.DB.First(&slot, slotID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if slot.BookedCount != want {
+		t.Fatalf("时间段已预约人数 = %d, 期望 %d", slot.BookedCount, want)
+	}
+}
@@ -0,0 +1,632 @@
+package payment
+
+import (
+	"admin-api/config"
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 微信支付 APIv3：请求和应答均为 JSON，请求用商户私钥 SHA256-RSA 签名，
+// 应答和回调用微信支付平台证书验签，回调内容及平台证书用 APIv3 密钥 AES-256-GCM 加密
+
+const (
+	wechatPayV3AuthSchema = "WECHATPAY2-SHA256-RSA2048"
+	// 应答和回调的时间戳与本地时间相差超过该时长时拒绝，防止重放
+	wechatPayV3MaxClockSkew = 5 * time.Minute
+	// 遇到本地没有的证书序列号时重新下载平台证书的最小间隔，避免伪造的回调每次都触发下载
+	wechatPayV3CertRetryInterval = time.Minute
+)
+
+// APIv3Enabled 当前部署是否使用微信支付 APIv3
+func APIv3Enabled() bool {
+	return config.Config.WechatPay.APIVersion == "v3"
+}
+
+// WechatPayV3Client 微信支付 APIv3 客户端
+type WechatPayV3Client struct {
+	AppID           string
+	MchID           string
+	SerialNo        string // 商户证书序列号
+	NotifyURL       string
+	RefundNotifyURL string
+	BaseURL         string
+
+	privateKey *rsa.PrivateKey
+	apiV3Key   []byte
+	httpClient *http.Client
+
+	mu            sync.RWMutex
+	platformCerts map[string]*x509.Certificate // 平台证书序列号 -> 证书
+
+	certDownloadMu   sync.Mutex // 同一时间只下载一次平台证书
+	lastCertDownload time.Time  // 上次下载平台证书的时间，无论成功与否
+}
+
+// V3Error 微信支付 APIv3 返回的错误
+type V3Error struct {
+	StatusCode int
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+}
+
+func (e *V3Error) Error() string {
+	return fmt.Sprintf("微信支付错误(%d %s): %s", e.StatusCode, e.Code, e.Message)
+}
+
+// V3Amount 订单金额
+type V3Amount struct {
+	Total         int    `json:"total"`
+	PayerTotal    int    `json:"payer_total,omitempty"`
+	Currency      string `json:"currency,omitempty"`
+	PayerCurrency string `json:"payer_currency,omitempty"`
+}
+
+// V3Transaction 支付订单，查询订单和支付回调解密后的内容
+type V3Transaction struct {
+	AppID          string   `json:"appid"`
+	MchID          string   `json:"mchid"`
+	OutTradeNo     string   `json:"out_trade_no"`
+	TransactionID  string   `json:"transaction_id"`
+	TradeType      string   `json:"trade_type"`
+	TradeState     string   `json:"trade_state"` // SUCCESS, REFUND, NOTPAY, CLOSED, REVOKED, USERPAYING, PAYERROR
+	TradeStateDesc string   `json:"trade_state_desc"`
+	SuccessTime    string   `json:"success_time"`
+	Amount         V3Amount `json:"amount"`
+	Payer          struct {
+		OpenID string `json:"openid"`
+	} `json:"payer"`
+}
+
+// V3Refund 退款单，申请退款的应答和退款回调解密后的内容
+type V3Refund struct {
+	MchID         string `json:"mchid"`
+	OutTradeNo    string `json:"out_trade_no"`
+	TransactionID string `json:"transaction_id"`
+	OutRefundNo   string `json:"out_refund_no"`
+	RefundID      string `json:"refund_id"`
+	// 申请退款应答中为 status，退款回调中为 refund_status：SUCCESS, CLOSED, PROCESSING, ABNORMAL
+	Status       string `json:"status"`
+	RefundStatus string `json:"refund_status"`
+	SuccessTime  string `json:"success_time"`
+	Amount       struct {
+		Total       int    `json:"total"`
+		Refund      int    `json:"refund"`
+		PayerTotal  int    `json:"payer_total"`
+		PayerRefund int    `json:"payer_refund"`
+		Currency    string `json:"currency,omitempty"`
+	} `json:"amount"`
+}
+
+// V3EncryptedResource 回调和平台证书中的加密内容
+type V3EncryptedResource struct {
+	Algorithm      string `json:"algorithm"` // AEAD_AES_256_GCM
+	Ciphertext     string `json:"ciphertext"`
+	AssociatedData string `json:"associated_data"`
+	Nonce          string `json:"nonce"`
+	OriginalType   string `json:"original_type"`
+}
+
+// V3Notify 支付和退款结果回调
+type V3Notify struct {
+	ID           string              `json:"id"`
+	CreateTime   string              `json:"create_time"`
+	EventType    string              `json:"event_type"` // TRANSACTION.SUCCESS, REFUND.SUCCESS, REFUND.ABNORMAL, REFUND.CLOSED
+	ResourceType string              `json:"resource_type"`
+	Summary      string              `json:"summary"`
+	Resource     V3EncryptedResource `json:"resource"`
+}
+
+// V3NotifyResponse 回调应答，处理失败时微信支付会重新通知
+type V3NotifyResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+var (
+	wechatPayV3Client    *WechatPayV3Client
+	wechatPayV3ClientErr error
+	wechatPayV3Once      sync.Once
+)
+
+// getWechatPayV3Client 按配置创建 APIv3 客户端，首次使用时加载证书
+func getWechatPayV3Client() (*WechatPayV3Client, error) {
+	wechatPayV3Once.Do(func() {
+		wechatPayV3Client, wechatPayV3ClientErr = NewWechatPayV3Client(config.Config.WechatPay)
+	})
+	return wechatPayV3Client, wechatPayV3ClientErr
+}
+
+// RefreshWechatPayV3Certificates 重新下载 APIv3 平台证书
+func RefreshWechatPayV3Certificates() error {
+	client, err := getWechatPayV3Client()
+	if err != nil {
+		return err
+	}
+	return client.RefreshCertificates()
+}
+
+// NewWechatPayV3Client 创建 APIv3 客户端。未配置平台证书时，首次验签前从微信支付下载
+func NewWechatPayV3Client(cfg config.WechatPayConfig) (*WechatPayV3Client, error) {
+	if len(cfg.APIv3Key) != 32 {
+		return nil, errors.New("APIv3密钥须为32个字符")
+	}
+
+	keyPEM, err := os.ReadFile(cfg.KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("读取商户私钥失败: %v", err)
+	}
+	privateKey, err := parseRSAPrivateKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	serialNo := cfg.CertSerialNo
+	if serialNo == "" {
+		certPEM, err := os.ReadFile(cfg.CertPath)
+		if err != nil {
+			return nil, fmt.Errorf("读取商户证书失败: %v", err)
+		}
+		certs, err := parseCertificates(certPEM)
+		if err != nil || len(certs) == 0 {
+			return nil, fmt.Errorf("解析商户证书失败: %v", err)
+		}
+		serialNo = certificateSerialNo(certs[0])
+	}
+
+	refundNotifyURL := cfg.RefundNotifyURL
+	if refundNotifyURL == "" {
+		refundNotifyURL = cfg.NotifyURL
+	}
+
+	client := &WechatPayV3Client{
+		AppID:           cfg.AppID,
+		MchID:           cfg.MchID,
+		SerialNo:        serialNo,
+		NotifyURL:       cfg.NotifyURL,
+		RefundNotifyURL: refundNotifyURL,
+		BaseURL:         gatewayBaseURL(cfg.BaseURL),
+		privateKey:      privateKey,
+		apiV3Key:        []byte(cfg.APIv3Key),
+		httpClient:      &http.Client{Timeout: 15 * time.Second},
+		platformCerts:   make(map[string]*x509.Certificate),
+	}
+
+	if cfg.PlatformCertPath != "" {
+		certPEM, err := os.ReadFile(cfg.PlatformCertPath)
+		if err != nil {
+			return nil, fmt.Errorf("读取平台证书失败: %v", err)
+		}
+		certs, err := parseCertificates(certPEM)
+		if err != nil {
+			return nil, fmt.Errorf("解析平台证书失败: %v", err)
+		}
+		for _, cert := range certs {
+			client.platformCerts[certificateSerialNo(cert)] = cert
+		}
+	}
+
+	return client, nil
+}
+
+// ========== 签名与验签 ==========
+
+// sign 用商户私钥对消息做 SHA256-RSA 签名，返回 base64
+func (c *WechatPayV3Client) sign(message string) (string, error) {
+	hashed := sha256.Sum256([]byte(message))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, c.privateKey, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", fmt.Errorf("签名失败: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// authorization 生成请求的 Authorization 头，签名串为 方法\nURL\n时间戳\n随机串\n请求体\n
+func (c *WechatPayV3Client) authorization(method, urlPath string, body []byte) (string, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := generateNonceStr(32)
+	message := method + "\n" + urlPath + "\n" + timestamp + "\n" + nonce + "\n" + string(body) + "\n"
+	signature, err := c.sign(message)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`%s mchid="%s",nonce_str="%s",signature="%s",timestamp="%s",serial_no="%s"`,
+		wechatPayV3AuthSchema, c.MchID, nonce, signature, timestamp, c.SerialNo), nil
+}
+
+// platformCert 按序列号获取平台证书，本地没有时重新下载。
+// 距上次下载不足 wechatPayV3CertRetryInterval 时不再下载，直接返回错误
+func (c *WechatPayV3Client) platformCert(serialNo string) (*x509.Certificate, error) {
+	if cert := c.cachedPlatformCert(serialNo); cert != nil {
+		return cert, nil
+	}
+
+	c.certDownloadMu.Lock()
+	defer c.certDownloadMu.Unlock()
+	// 等待期间其他请求可能已下载到该证书
+	if cert := c.cachedPlatformCert(serialNo); cert != nil {
+		return cert, nil
+	}
+	if time.Since(c.lastCertDownload) < wechatPayV3CertRetryInterval {
+		return nil, fmt.Errorf("未找到序列号为 %s 的平台证书", serialNo)
+	}
+	c.lastCertDownload = time.Now()
+	if err := c.downloadCertificates(); err != nil {
+		return nil, err
+	}
+
+	cert := c.cachedPlatformCert(serialNo)
+	if cert == nil {
+		return nil, fmt.Errorf("未找到序列号为 %s 的平台证书", serialNo)
+	}
+	return cert, nil
+}
+
+func (c *WechatPayV3Client) cachedPlatformCert(serialNo string) *x509.Certificate {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.platformCerts[serialNo]
+}
+
+// RefreshCertificates 重新下载平台证书，由后台任务定期调用，以便在微信支付轮换证书前取得新证书
+func (c *WechatPayV3Client) RefreshCertificates() error {
+	c.certDownloadMu.Lock()
+	defer c.certDownloadMu.Unlock()
+	c.lastCertDownload = time.Now()
+	return c.downloadCertificates()
+}
+
+// verify 用平台证书验证应答或回调的签名，签名串为 时间戳\n随机串\n报文\n
+func (c *WechatPayV3Client) verify(header http.Header, body []byte) error {
+	serialNo := header.Get("Wechatpay-Serial")
+	timestamp := header.Get("Wechatpay-Timestamp")
+	nonce := header.Get("Wechatpay-Nonce")
+	signature := header.Get("Wechatpay-Signature")
+	if serialNo == "" || timestamp == "" || nonce == "" || signature == "" {
+		return errors.New("缺少微信支付签名信息")
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("无效的签名时间戳")
+	}
+	if skew := time.Since(time.Unix(ts, 0)); skew > wechatPayV3MaxClockSkew || skew < -wechatPayV3MaxClockSkew {
+		return errors.New("签名时间戳超出允许范围")
+	}
+
+	cert, err := c.platformCert(serialNo)
+	if err != nil {
+		return err
+	}
+	return verifyWithCert(cert, timestamp+"\n"+nonce+"\n"+string(body)+"\n", signature)
+}
+
+func verifyWithCert(cert *x509.Certificate, message, signature string) error {
+	publicKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("平台证书不是RSA证书")
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return errors.New("无效的签名")
+	}
+	hashed := sha256.Sum256([]byte(message))
+	if err := rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hashed[:], sig); err != nil {
+		return errors.New("签名验证失败")
+	}
+	return nil
+}
+
+// decrypt 用 APIv3 密钥解密 AEAD_AES_256_GCM 加密的内容
+func (c *WechatPayV3Client) decrypt(resource V3EncryptedResource) ([]byte, error) {
+	if resource.Algorithm != "AEAD_AES_256_GCM" {
+		return nil, fmt.Errorf("不支持的加密算法: %s", resource.Algorithm)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(resource.Ciphertext)
+	if err != nil {
+		return nil, errors.New("无效的密文")
+	}
+	block, err := aes.NewCipher(c.apiV3Key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(resource.Nonce) != gcm.NonceSize() {
+		return nil, errors.New("无效的加密随机串")
+	}
+	plaintext, err := gcm.Open(nil, []byte(resource.Nonce), ciphertext, []byte(resource.AssociatedData))
+	if err != nil {
+		return nil, errors.New("解密失败，请检查APIv3密钥")
+	}
+	return plaintext, nil
+}
+
+// ========== 请求 ==========
+
+// send 发送签名后的请求，返回未验签的应答
+func (c *WechatPayV3Client) send(method, urlPath string, body interface{}) (int, http.Header, []byte, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return 0, nil, nil, err
+		}
+	}
+
+	req, err := http.NewRequest(method, c.BaseURL+urlPath, bytes.NewReader(payload))
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	authorization, err := c.authorization(method, urlPath, payload)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "admin-api")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("读取响应失败: %v", err)
+	}
+	return resp.StatusCode, resp.Header, respBody, nil
+}
+
+// do 发送请求并验证应答签名，成功时将应答解析到 result
+func (c *WechatPayV3Client) do(method, urlPath string, body, result interface{}) error {
+	status, header, respBody, err := c.send(method, urlPath, body)
+	if err != nil {
+		return err
+	}
+	if err := c.verify(header, respBody); err != nil {
+		return fmt.Errorf("微信支付应答验签失败: %v", err)
+	}
+
+	if status < 200 || status >= 300 {
+		apiErr := &V3Error{StatusCode: status}
+		if err := json.Unmarshal(respBody, apiErr); err != nil {
+			apiErr.Message = string(respBody)
+		}
+		return apiErr
+	}
+	if result != nil && len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, result); err != nil {
+			return fmt.Errorf("解析响应失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// downloadCertificates 下载并解密平台证书，再用下载到的证书验证本次应答
+func (c *WechatPayV3Client) downloadCertificates() error {
+	status, header, body, err := c.send(http.MethodGet, "/v3/certificates", nil)
+	if err != nil {
+		return fmt.Errorf("下载平台证书失败: %v", err)
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("下载平台证书失败: %d %s", status, string(body))
+	}
+
+	var result struct {
+		Data []struct {
+			SerialNo           string              `json:"serial_no"`
+			EncryptCertificate V3EncryptedResource `json:"encrypt_certificate"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("解析平台证书失败: %v", err)
+	}
+
+	certs := make(map[string]*x509.Certificate)
+	for _, item := range result.Data {
+		certPEM, err := c.decrypt(item.EncryptCertificate)
+		if err != nil {
+			return fmt.Errorf("解密平台证书失败: %v", err)
+		}
+		parsed, err := parseCertificates(certPEM)
+		if err != nil || len(parsed) == 0 {
+			return fmt.Errorf("解析平台证书失败: %v", err)
+		}
+		certs[item.SerialNo] = parsed[0]
+	}
+
+	cert := certs[header.Get("Wechatpay-Serial")]
+	if cert == nil {
+		return errors.New("平台证书应答的签名证书不在下载结果中")
+	}
+	message := header.Get("Wechatpay-Timestamp") + "\n" + header.Get("Wechatpay-Nonce") + "\n" + string(body) + "\n"
+	if err := verifyWithCert(cert, message, header.Get("Wechatpay-Signature")); err != nil {
+		return fmt.Errorf("平台证书应答验签失败: %v", err)
+	}
+
+	c.mu.Lock()
+	for serialNo, cert := range certs {
+		c.platformCerts[serialNo] = cert
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+// ========== 接口 ==========
+
+// CreateJSAPIOrder JSAPI/小程序下单，返回调起支付所需的参数
+func (c *WechatPayV3Client) CreateJSAPIOrder(outTradeNo, description, openID string, total int) (*PrepayResponse, error) {
+	body := map[string]interface{}{
+		"appid":        c.AppID,
+		"mchid":        c.MchID,
+		"description":  description,
+		"out_trade_no": outTradeNo,
+		"notify_url":   c.NotifyURL,
+		"amount":       map[string]interface{}{"total": total, "currency": "CNY"},
+		"payer":        map[string]interface{}{"openid": openID},
+	}
+	var result struct {
+		PrepayID string `json:"prepay_id"`
+	}
+	if err := c.do(http.MethodPost, "/v3/pay/transactions/jsapi", body, &result); err != nil {
+		return nil, err
+	}
+
+	prepayResp := &PrepayResponse{
+		AppID:     c.AppID,
+		TimeStamp: strconv.FormatInt(time.Now().Unix(), 10),
+		NonceStr:  generateNonceStr(32),
+		Package:   "prepay_id=" + result.PrepayID,
+		SignType:  "RSA",
+	}
+	paySign, err := c.sign(prepayResp.AppID + "\n" + prepayResp.TimeStamp + "\n" +
+		prepayResp.NonceStr + "\n" + prepayResp.Package + "\n")
+	if err != nil {
+		return nil, err
+	}
+	prepayResp.PaySign = paySign
+	return prepayResp, nil
+}
+
+// QueryOrder 按商户订单号查询订单
+func (c *WechatPayV3Client) QueryOrder(outTradeNo string) (*V3Transaction, error) {
+	var result V3Transaction
+	urlPath := "/v3/pay/transactions/out-trade-no/" + url.PathEscape(outTradeNo) + "?mchid=" + url.QueryEscape(c.MchID)
+	if err := c.do(http.MethodGet, urlPath, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// CloseOrder 关闭订单，已支付的订单返回 ErrOrderPaid，已关闭的订单视为成功
+func (c *WechatPayV3Client) CloseOrder(outTradeNo string) error {
+	transaction, err := c.QueryOrder(outTradeNo)
+	if err != nil {
+		var apiErr *V3Error
+		// 未下单成功的订单无需关闭
+		if errors.As(err, &apiErr) && apiErr.Code == "ORDER_NOT_EXIST" {
+			return nil
+		}
+		return err
+	}
+	switch transaction.TradeState {
+	case "SUCCESS", "REFUND":
+		return ErrOrderPaid
+	case "CLOSED", "REVOKED":
+		return nil
+	}
+
+	urlPath := "/v3/pay/transactions/out-trade-no/" + url.PathEscape(outTradeNo) + "/close"
+	return c.do(http.MethodPost, urlPath, map[string]interface{}{"mchid": c.MchID}, nil)
+}
+
+// CreateRefund 申请退款，结果通过退款回调通知
+func (c *WechatPayV3Client) CreateRefund(outTradeNo, outRefundNo string, total, refund int, reason string) (*V3Refund, error) {
+	body := map[string]interface{}{
+		"out_trade_no":  outTradeNo,
+		"out_refund_no": outRefundNo,
+		"notify_url":    c.RefundNotifyURL,
+		"amount":        map[string]interface{}{"refund": refund, "total": total, "currency": "CNY"},
+	}
+	if reason != "" {
+		body["reason"] = reason
+	}
+	var result V3Refund
+	if err := c.do(http.MethodPost, "/v3/refund/domestic/refunds", body, &result); err != nil {
+		return nil, err
+	}
+	if result.Status == "CLOSED" || result.Status == "ABNORMAL" {
+		return &result, fmt.Errorf("微信退款失败: %s", result.Status)
+	}
+	return &result, nil
+}
+
+// VerifyNotify 验证回调签名
+func (c *WechatPayV3Client) VerifyNotify(header http.Header, body []byte) error {
+	return c.verify(header, body)
+}
+
+// DecodeNotify 解密已验签的回调内容
+func (c *WechatPayV3Client) DecodeNotify(body []byte) (*V3Notify, []byte, error) {
+	var notify V3Notify
+	if err := json.Unmarshal(body, &notify); err != nil {
+		return nil, nil, fmt.Errorf("解析回调失败: %v", err)
+	}
+	plaintext, err := c.decrypt(notify.Resource)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &notify, plaintext, nil
+}
+
+// ========== 证书 ==========
+
+func parseRSAPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("商户私钥格式错误")
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("商户私钥不是RSA私钥")
+		}
+		return rsaKey, nil
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("解析商户私钥失败: %v", err)
+	}
+	return key, nil
+}
+
+// parseCertificates 解析 PEM 中的全部证书
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// certificateSerialNo 证书序列号，大写十六进制
+func certificateSerialNo(cert *x509.Certificate) string {
+	return strings.ToUpper(cert.SerialNumber.Text(16))
+}
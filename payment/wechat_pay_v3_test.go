@@ -0,0 +1,184 @@
+package payment
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testAPIv3Key = "0123456789abcdef0123456789abcdef"
+
+// certGateway 只提供 /v3/certificates 的 APIv3 网关，返回加密并签名的平台证书
+type certGateway struct {
+	key       *rsa.PrivateKey
+	certPEM   []byte
+	serialNo  string
+	fail      atomic.Bool // 为 true 时返回 500
+	downloads atomic.Int32
+}
+
+func newCertGateway(t *testing.T) *certGateway {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(0x5157F09EFDC096DE),
+		Subject:      pkix.Name{CommonName: "Tenpay.com Root CA"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &certGateway{
+		key:      key,
+		certPEM:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		serialNo: "5157F09EFDC096DE",
+	}
+}
+
+func (g *certGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.downloads.Add(1)
+	if g.fail.Load() || r.URL.Path != "/v3/certificates" {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	block, _ := aes.NewCipher([]byte(testAPIv3Key))
+	gcm, _ := cipher.NewGCM(block)
+	nonce, associatedData := "0123456789ab", "certificate"
+	ciphertext := gcm.Seal(nil, []byte(nonce), g.certPEM, []byte(associatedData))
+	body, _ := json.Marshal(map[string]interface{}{
+		"data": []map[string]interface{}{{
+			"serial_no": g.serialNo,
+			"encrypt_certificate": V3EncryptedResource{
+				Algorithm:      "AEAD_AES_256_GCM",
+				Ciphertext:     base64.StdEncoding.EncodeToString(ciphertext),
+				AssociatedData: associatedData,
+				Nonce:          nonce,
+			},
+		}},
+	})
+
+	timestamp, responseNonce := strconv.FormatInt(time.Now().Unix(), 10), generateNonceStr(32)
+	hashed := sha256.Sum256([]byte(timestamp + "\n" + responseNonce + "\n" + string(body) + "\n"))
+	signature, _ := rsa.SignPKCS1v15(rand.Reader, g.key, crypto.SHA256, hashed[:])
+	w.Header().Set("Wechatpay-Serial", g.serialNo)
+	w.Header().Set("Wechatpay-Timestamp", timestamp)
+	w.Header().Set("Wechatpay-Nonce", responseNonce)
+	w.Header().Set("Wechatpay-Signature", base64.StdEncoding.EncodeToString(signature))
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+func newTestV3Client(t *testing.T, gateway *certGateway) *WechatPayV3Client {
+	t.Helper()
+	server := httptest.NewServer(gateway)
+	t.Cleanup(server.Close)
+	merchantKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &WechatPayV3Client{
+		MchID:         "1900000001",
+		SerialNo:      "MERCHANT",
+		BaseURL:       server.URL,
+		privateKey:    merchantKey,
+		apiV3Key:      []byte(testAPIv3Key),
+		httpClient:    server.Client(),
+		platformCerts: make(map[string]*x509.Certificate),
+	}
+}
+
+func TestPlatformCertDownload(t *testing.T) {
+	gateway := newCertGateway(t)
+	client := newTestV3Client(t, gateway)
+
+	cert, err := client.platformCert(gateway.serialNo)
+	if err != nil {
+		t.Fatalf("获取平台证书失败: %v", err)
+	}
+	if certificateSerialNo(cert) != gateway.serialNo {
+		t.Fatalf("证书序列号 = %s, 期望 %s", certificateSerialNo(cert), gateway.serialNo)
+	}
+	// 已下载的证书不再请求网关
+	if _, err := client.platformCert(gateway.serialNo); err != nil {
+		t.Fatal(err)
+	}
+	if n := gateway.downloads.Load(); n != 1 {
+		t.Fatalf("下载 %d 次, 期望 1", n)
+	}
+}
+
+// TestPlatformCertUnknownSerialRateLimited 未知序列号在间隔内只触发一次下载，下载失败时同样如此
+func TestPlatformCertUnknownSerialRateLimited(t *testing.T) {
+	tests := []struct {
+		name string
+		fail bool
+	}{
+		{"下载成功但没有该证书", false},
+		{"下载失败", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gateway := newCertGateway(t)
+			gateway.fail.Store(tt.fail)
+			client := newTestV3Client(t, gateway)
+
+			for i := 0; i < 5; i++ {
+				if _, err := client.platformCert("FORGED"); err == nil {
+					t.Fatal("未知序列号应返回错误")
+				}
+			}
+			if n := gateway.downloads.Load(); n != 1 {
+				t.Fatalf("下载 %d 次, 期望 1", n)
+			}
+
+			// 超过间隔后允许再次下载
+			client.lastCertDownload = time.Now().Add(-wechatPayV3CertRetryInterval)
+			if _, err := client.platformCert("FORGED"); err == nil {
+				t.Fatal("未知序列号应返回错误")
+			}
+			if n := gateway.downloads.Load(); n != 2 {
+				t.Fatalf("下载 %d 次, 期望 2", n)
+			}
+		})
+	}
+}
+
+func TestRefreshCertificates(t *testing.T) {
+	gateway := newCertGateway(t)
+	client := newTestV3Client(t, gateway)
+
+	if err := client.RefreshCertificates(); err != nil {
+		t.Fatalf("刷新平台证书失败: %v", err)
+	}
+	if client.cachedPlatformCert(gateway.serialNo) == nil {
+		t.Fatal("刷新后应缓存平台证书")
+	}
+	// 定时刷新不受未知序列号下载间隔的限制
+	if err := client.RefreshCertificates(); err != nil {
+		t.Fatal(err)
+	}
+	if n := gateway.downloads.Load(); n != 2 {
+		t.Fatalf("下载 %d 次, 期望 2", n)
+	}
+}
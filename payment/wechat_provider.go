@@ -0,0 +1,249 @@
+package payment
+
+import (
+	"admin-api/utils"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+func init() {
+	RegisterProvider(wechatV2Provider{})
+	RegisterProvider(wechatV3Provider{})
+}
+
+// wechatV2Provider 微信支付 v2 渠道
+type wechatV2Provider struct{}
+
+func (wechatV2Provider) Name() string { return ProviderWechatV2 }
+
+func (wechatV2Provider) TradeNoPrefix() string { return "P" }
+
+func (wechatV2Provider) CreateOrder(req OrderRequest) (interface{}, error) {
+	return CreateWechatPayOrder(OutTradeNo(req.OutTradeNo),
+		Amount(req.Amount),
+		Description(req.Description),
+		OpenID(req.OpenID),
+	)
+}
+
+func (wechatV2Provider) QueryOrder(outTradeNo string) (*OrderStatus, error) {
+	resp, err := QueryWechatOrder(outTradeNo)
+	if err != nil {
+		return nil, err
+	}
+	return wechatOrderStatus(outTradeNo, resp["transaction_id"], resp["trade_state"]), nil
+}
+
+func (wechatV2Provider) CloseOrder(outTradeNo string) error {
+	return CloseWechatOrder(outTradeNo)
+}
+
+// Refund v2 退款提交成功后等待退款结果回调，退款单保持处理中
+func (wechatV2Provider) Refund(req RefundRequest) (*RefundResult, error) {
+	refundID, err := CreateWechatRefund(req.OutTradeNo, req.OutRefundNo, req.Total, req.Amount, req.Reason)
+	if err != nil {
+		return nil, err
+	}
+	return &RefundResult{RefundID: refundID}, nil
+}
+
+func (wechatV2Provider) VerifySignature(header http.Header, body []byte) error {
+	values := make(map[string]string)
+	if err := xml.Unmarshal(body, (*mapStringString)(&values)); err != nil {
+		return errors.New("解析XML失败")
+	}
+	// 退款结果回调不签名，能用商户密钥解密即视为有效
+	if values["req_info"] != "" && values["sign"] == "" {
+		_, err := DecryptWechatRefundInfo(values["req_info"], wechatPayClient.APIKey)
+		return err
+	}
+	if !VerifyWechatSign(values, wechatPayClient.APIKey) {
+		return errors.New("签名验证失败")
+	}
+	return nil
+}
+
+func (wechatV2Provider) ParseNotify(header http.Header, body []byte) (*Notification, error) {
+	var req WechatNotifyRequest
+	if err := xml.Unmarshal(body, &req); err != nil {
+		return nil, errors.New("解析XML失败")
+	}
+	if req.ReqInfo != "" {
+		return parseWechatRefundNotify(req)
+	}
+
+	n := &Notification{
+		Kind:          NotifyKindPayment,
+		OutTradeNo:    req.OutTradeNo,
+		TransactionID: req.TransactionID,
+		Amount:        req.TotalFee,
+		Succeeded:     req.ReturnCode == "SUCCESS" && req.ResultCode == "SUCCESS",
+		Raw:           utils.ToJSONString(req),
+	}
+	if !n.Succeeded {
+		n.Message = "支付失败: " + req.ReturnMsg
+	}
+	return n, nil
+}
+
+// parseWechatRefundNotify 解析 v2 退款结果回调
+func parseWechatRefundNotify(req WechatNotifyRequest) (*Notification, error) {
+	if req.ReturnCode != "SUCCESS" {
+		return nil, errors.New("退款回调失败: " + req.ReturnMsg)
+	}
+	info, err := DecryptWechatRefundInfo(req.ReqInfo, wechatPayClient.APIKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Notification{
+		Kind:        NotifyKindRefund,
+		OutTradeNo:  info.OutTradeNo,
+		OutRefundNo: info.OutRefundNo,
+		RefundID:    info.RefundID,
+		Succeeded:   info.RefundStatus == "SUCCESS",
+		Message:     "微信退款失败: " + info.RefundStatus,
+		Raw:         utils.ToJSONString(info),
+	}, nil
+}
+
+func (wechatV2Provider) WriteNotifyResponse(w http.ResponseWriter, err error) {
+	resp := WechatNotifyResponse{ReturnCode: "SUCCESS", ReturnMsg: "OK"}
+	if err != nil {
+		resp = WechatNotifyResponse{ReturnCode: "FAIL", ReturnMsg: "处理失败"}
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(resp)
+}
+
+// wechatV3Provider 微信支付 APIv3 渠道，支付和退款结果均通过回调通知
+type wechatV3Provider struct{}
+
+func (wechatV3Provider) Name() string { return ProviderWechatV3 }
+
+func (wechatV3Provider) TradeNoPrefix() string { return "P" }
+
+func (wechatV3Provider) CreateOrder(req OrderRequest) (interface{}, error) {
+	if req.OutTradeNo == "" || req.Description == "" || req.OpenID == "" || req.Amount <= 0 {
+		return nil, errors.New("缺少必要参数")
+	}
+	client, err := getWechatPayV3Client()
+	if err != nil {
+		return nil, err
+	}
+	return client.CreateJSAPIOrder(req.OutTradeNo, req.Description, req.OpenID, req.Amount)
+}
+
+func (wechatV3Provider) QueryOrder(outTradeNo string) (*OrderStatus, error) {
+	client, err := getWechatPayV3Client()
+	if err != nil {
+		return nil, err
+	}
+	transaction, err := client.QueryOrder(outTradeNo)
+	if err != nil {
+		return nil, err
+	}
+	return wechatOrderStatus(outTradeNo, transaction.TransactionID, transaction.TradeState), nil
+}
+
+func (wechatV3Provider) CloseOrder(outTradeNo string) error {
+	client, err := getWechatPayV3Client()
+	if err != nil {
+		return err
+	}
+	return client.CloseOrder(outTradeNo)
+}
+
+func (wechatV3Provider) Refund(req RefundRequest) (*RefundResult, error) {
+	client, err := getWechatPayV3Client()
+	if err != nil {
+		return nil, err
+	}
+	refund, err := client.CreateRefund(req.OutTradeNo, req.OutRefundNo, req.Total, req.Amount, req.Reason)
+	if err != nil {
+		return nil, err
+	}
+	return &RefundResult{RefundID: refund.RefundID, Succeeded: refund.Status == "SUCCESS"}, nil
+}
+
+func (wechatV3Provider) VerifySignature(header http.Header, body []byte) error {
+	client, err := getWechatPayV3Client()
+	if err != nil {
+		return err
+	}
+	return client.VerifyNotify(header, body)
+}
+
+func (wechatV3Provider) ParseNotify(header http.Header, body []byte) (*Notification, error) {
+	client, err := getWechatPayV3Client()
+	if err != nil {
+		return nil, err
+	}
+	notify, plaintext, err := client.DecodeNotify(body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case strings.HasPrefix(notify.EventType, "TRANSACTION."):
+		var transaction V3Transaction
+		if err := json.Unmarshal(plaintext, &transaction); err != nil {
+			return nil, fmt.Errorf("解析支付结果失败: %v", err)
+		}
+		n := &Notification{
+			Kind:          NotifyKindPayment,
+			OutTradeNo:    transaction.OutTradeNo,
+			TransactionID: transaction.TransactionID,
+			Amount:        transaction.Amount.Total,
+			Succeeded:     transaction.TradeState == "SUCCESS",
+			Raw:           string(plaintext),
+		}
+		if !n.Succeeded {
+			n.Message = "微信支付状态: " + transaction.TradeState
+		}
+		return n, nil
+
+	case strings.HasPrefix(notify.EventType, "REFUND."):
+		var refund V3Refund
+		if err := json.Unmarshal(plaintext, &refund); err != nil {
+			return nil, fmt.Errorf("解析退款结果失败: %v", err)
+		}
+		return &Notification{
+			Kind:        NotifyKindRefund,
+			OutTradeNo:  refund.OutTradeNo,
+			OutRefundNo: refund.OutRefundNo,
+			RefundID:    refund.RefundID,
+			Succeeded:   refund.RefundStatus == "SUCCESS",
+			Message:     "微信退款失败: " + refund.RefundStatus,
+			Raw:         string(plaintext),
+		}, nil
+	}
+
+	return &Notification{Kind: notify.EventType, Raw: string(plaintext)}, nil
+}
+
+// WriteNotifyResponse 处理失败时返回错误状态码，微信支付会重新通知
+func (wechatV3Provider) WriteNotifyResponse(w http.ResponseWriter, err error) {
+	status, resp := http.StatusOK, V3NotifyResponse{Code: "SUCCESS", Message: "成功"}
+	if err != nil {
+		status, resp = http.StatusInternalServerError, V3NotifyResponse{Code: "FAIL", Message: "处理失败"}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// wechatOrderStatus 将 v2 和 APIv3 共用的交易状态转换为 OrderStatus
+func wechatOrderStatus(outTradeNo, transactionID, state string) *OrderStatus {
+	return &OrderStatus{
+		OutTradeNo:    outTradeNo,
+		TransactionID: transactionID,
+		Paid:          state == "SUCCESS" || state == "REFUND",
+		Closed:        state == "CLOSED" || state == "REVOKED",
+		State:         state,
+	}
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"admin-api/config"
+)
+
+// 日历订阅的所有者类型
+const (
+	FeedOwnerStaff    = "staff"
+	FeedOwnerCustomer = "customer"
+)
+
+// 示例配置中曾使用的占位密钥，不能用于签名
+const feedSecretPlaceholder = "change-me-calendar-feed-secret"
+
+// 订阅链接签名密钥的最小长度
+const feedSecretMinLength = 32
+
+// ErrFeedDisabled 未配置签名密钥，日历订阅不可用
+var ErrFeedDisabled = errors.New("未配置 calendar.feed_secret（或环境变量 CALENDAR_FEED_SECRET），日历订阅不可用")
+
+// ValidateFeedSecret 检查日历订阅链接签名密钥，未配置时返回 ErrFeedDisabled，配置了但不安全时返回其他错误。
+// 订阅链接不能过期，密钥泄露或可被猜到时任何人都能伪造链接，因此不使用默认值，也不与登录令牌共用密钥
+func ValidateFeedSecret() error {
+	value := ""
+	if config.Config != nil {
+		value = config.Config.Calendar.FeedSecret
+	}
+	switch {
+	case value == "":
+		return ErrFeedDisabled
+	case value == feedSecretPlaceholder:
+		return errors.New("calendar.feed_secret 仍为示例值，请改为随机字符串")
+	case value == string(secret):
+		return errors.New("calendar.feed_secret 不能与登录令牌密钥相同")
+	case len(value) < feedSecretMinLength:
+		return fmt.Errorf("calendar.feed_secret 至少需要%d个字符", feedSecretMinLength)
+	}
+	return nil
+}
+
+// FeedEnabled 是否配置了可用的签名密钥，未配置时日历订阅接口返回错误
+func FeedEnabled() bool {
+	return ValidateFeedSecret() == nil
+}
+
+// SignFeedToken 生成日历订阅链接的签名。version 变化后旧链接失效，用于重置订阅地址。
+// 签名密钥不可用时返回错误
+func SignFeedToken(ownerType string, ownerID uint, version int) (string, error) {
+	if err := ValidateFeedSecret(); err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, []byte(config.Config.Calendar.FeedSecret))
+	mac.Write([]byte(fmt.Sprintf("%s:%d:%d", ownerType, ownerID, version)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// VerifyFeedToken 校验日历订阅链接的签名，签名密钥不可用时一律不通过
+func VerifyFeedToken(token, ownerType string, ownerID uint, version int) bool {
+	expected, err := SignFeedToken(ownerType, ownerID, version)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(expected))
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"admin-api/config"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateFeedSecret(t *testing.T) {
+	previous := config.Config.Calendar.FeedSecret
+	t.Cleanup(func() { config.Config.Calendar.FeedSecret = previous })
+
+	tests := []struct {
+		name         string
+		secret       string
+		wantErr      bool
+		wantDisabled bool // 未配置时只是不提供日历订阅，不阻止启动
+	}{
+		{"未配置", "", true, true},
+		{"示例值", feedSecretPlaceholder, true, false},
+		{"与登录令牌密钥相同", string(secret), true, false},
+		{"长度不足", "short-secret", true, false},
+		{"随机密钥", strings.Repeat("a1", 16), false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Config.Calendar.FeedSecret = tt.secret
+			err := ValidateFeedSecret()
+			if (err != nil) != tt.wantErr || errors.Is(err, ErrFeedDisabled) != tt.wantDisabled {
+				t.Fatalf("ValidateFeedSecret() err = %v, wantErr %v, wantDisabled %v", err, tt.wantErr, tt.wantDisabled)
+			}
+			if FeedEnabled() != !tt.wantErr {
+				t.Fatalf("FeedEnabled() = %v, 期望 %v", FeedEnabled(), !tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFeedTokenUsesFeedSecret(t *testing.T) {
+	previous := config.Config.Calendar.FeedSecret
+	t.Cleanup(func() { config.Config.Calendar.FeedSecret = previous })
+
+	config.Config.Calendar.FeedSecret = strings.Repeat("k", 32)
+	token, err := SignFeedToken(FeedOwnerStaff, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifyFeedToken(token, FeedOwnerStaff, 1, 1) {
+		t.Fatal("签名校验失败")
+	}
+	if VerifyFeedToken(token, FeedOwnerStaff, 1, 2) || VerifyFeedToken(token, FeedOwnerCustomer, 1, 1) {
+		t.Fatal("版本或所有者变化后旧签名不应通过")
+	}
+	// 更换密钥后旧链接失效
+	config.Config.Calendar.FeedSecret = strings.Repeat("j", 32)
+	if VerifyFeedToken(token, FeedOwnerStaff, 1, 1) {
+		t.Fatal("更换密钥后旧签名不应通过")
+	}
+}
+
+// TestFeedTokenWithoutSecret 未配置或配置了不安全的密钥时不签发也不接受订阅链接
+func TestFeedTokenWithoutSecret(t *testing.T) {
+	previous := config.Config.Calendar.FeedSecret
+	t.Cleanup(func() { config.Config.Calendar.FeedSecret = previous })
+
+	for _, value := range []string{"", feedSecretPlaceholder} {
+		config.Config.Calendar.FeedSecret = value
+		if token, err := SignFeedToken(FeedOwnerStaff, 1, 1); err == nil {
+			t.Fatalf("密钥为 %q 时签发了订阅链接 %s", value, token)
+		}
+		// 用当前密钥算出的签名也不能通过
+		mac := hmac.New(sha256.New, []byte(value))
+		mac.Write([]byte("staff:1:1"))
+		if VerifyFeedToken(base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), FeedOwnerStaff, 1, 1) {
+			t.Fatalf("密钥为 %q 时订阅链接校验通过", value)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Package ical 生成 iCalendar（RFC 5545）订阅内容，供手机日历订阅预约
+package ical
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 事件状态
+const (
+	StatusTentative = "TENTATIVE"
+	StatusConfirmed = "CONFIRMED"
+	StatusCancelled = "CANCELLED"
+)
+
+// Event 日历中的一个事件
+type Event struct {
+	UID          string // 稳定的唯一标识，日历据此更新同一事件
+	Sequence     int    // 修改次数，改约后递增
+	Start        time.Time
+	End          time.Time
+	Summary      string
+	Description  string
+	Location     string
+	Status       string
+	LastModified time.Time
+}
+
+// Calendar 一个日历订阅
+type Calendar struct {
+	Name   string
+	Events []Event
+}
+
+const timeFormat = "20060102T150405Z"
+
+// Bytes 生成 .ics 内容，时间统一以UTC输出
+func (c *Calendar) Bytes() []byte {
+	var buf bytes.Buffer
+	line := func(s string) {
+		buf.WriteString(fold(s))
+		buf.WriteString("\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//admin-api//appointment//CN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	if c.Name != "" {
+		line("X-WR-CALNAME:" + escape(c.Name))
+	}
+
+	now := time.Now().UTC().Format(timeFormat)
+	for _, e := range c.Events {
+		line("BEGIN:VEVENT")
+		line("UID:" + e.UID)
+		line("DTSTAMP:" + now)
+		line("DTSTART:" + e.Start.UTC().Format(timeFormat))
+		line("DTEND:" + e.End.UTC().Format(timeFormat))
+		line(fmt.Sprintf("SEQUENCE:%d", e.Sequence))
+		if !e.LastModified.IsZero() {
+			line("LAST-MODIFIED:" + e.LastModified.UTC().Format(timeFormat))
+		}
+		line("SUMMARY:" + escape(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION:" + escape(e.Description))
+		}
+		if e.Location != "" {
+			line("LOCATION:" + escape(e.Location))
+		}
+		if e.Status != "" {
+			line("STATUS:" + e.Status)
+		}
+		line("END:VEVENT")
+	}
+
+	line("END:VCALENDAR")
+	return buf.Bytes()
+}
+
+// escape 转义文本值中的特殊字符
+func escape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return r.Replace(s)
+}
+
+// fold 按 RFC 5545 将超过75字节的行折行，不拆开多字节字符
+func fold(s string) string {
+	const limit = 75
+	if len(s) <= limit {
+		return s
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range s {
+		size := len(string(r))
+		if n+size > limit {
+			b.WriteString("\r\n ")
+			n = 1
+		}
+		b.WriteRune(r)
+		n += size
+	}
+	return b.String()
+}
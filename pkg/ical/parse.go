@@ -0,0 +1,442 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParsedEvent 从 .ics 文件解析出的一次事件。重复事件按 RRULE 展开为多次，
+// 每次的 RecurrenceID 为该次的原始开始时间（UTC），非重复事件为空
+type ParsedEvent struct {
+	UID          string
+	RecurrenceID string
+	Start        time.Time
+	End          time.Time
+	AllDay       bool
+	Summary      string
+	Status       string // 大写，如 CONFIRMED、CANCELLED
+	Transparent  bool   // TRANSP:TRANSPARENT，不占用时间
+}
+
+// 单个重复事件最多展开的次数，防止异常的 RRULE 无限展开
+const maxOccurrences = 1000
+
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+type rawEvent struct {
+	props []property
+}
+
+func (e *rawEvent) get(name string) *property {
+	for i := range e.props {
+		if e.props[i].name == name {
+			return &e.props[i]
+		}
+	}
+	return nil
+}
+
+func (e *rawEvent) all(name string) []property {
+	var result []property
+	for _, p := range e.props {
+		if p.name == name {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// Parse 解析 .ics 内容，返回 [from, to) 区间内的事件。
+// 支持 UTC、TZID 和全天日期，RRULE 支持 DAILY、WEEKLY（含 BYDAY）、MONTHLY、YEARLY 及 INTERVAL、COUNT、UNTIL、EXDATE，
+// RECURRENCE-ID 覆盖对应的重复实例。无时区的时间按 defaultLoc 解析
+func Parse(r io.Reader, from, to time.Time, defaultLoc *time.Location) ([]ParsedEvent, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []rawEvent
+	var current *rawEvent
+	depth := 0
+	for _, line := range lines {
+		prop, ok := parseLine(line)
+		if !ok {
+			continue
+		}
+		switch {
+		case prop.name == "BEGIN" && strings.EqualFold(prop.value, "VEVENT"):
+			current = &rawEvent{}
+			depth = 0
+		case prop.name == "BEGIN" && current != nil:
+			depth++ // VALARM 等嵌套组件，其属性不属于事件本身
+		case prop.name == "END" && current != nil && depth > 0:
+			depth--
+		case prop.name == "END" && strings.EqualFold(prop.value, "VEVENT") && current != nil:
+			events = append(events, *current)
+			current = nil
+		case current != nil && depth == 0:
+			current.props = append(current.props, prop)
+		}
+	}
+	if current != nil {
+		return nil, errors.New("日历文件格式错误：VEVENT 未结束")
+	}
+
+	// 先处理 RECURRENCE-ID 覆盖的实例
+	overrides := make(map[string]ParsedEvent)
+	var result []ParsedEvent
+	for i := range events {
+		e := &events[i]
+		rid := e.get("RECURRENCE-ID")
+		if rid == nil {
+			continue
+		}
+		ev, err := baseEvent(e, defaultLoc)
+		if err != nil {
+			continue
+		}
+		ridTime, _, err := parseTime(*rid, defaultLoc)
+		if err != nil {
+			continue
+		}
+		ev.RecurrenceID = ridTime.UTC().Format(timeFormat)
+		overrides[ev.UID+"#"+ev.RecurrenceID] = ev
+	}
+
+	for i := range events {
+		e := &events[i]
+		if e.get("RECURRENCE-ID") != nil {
+			continue
+		}
+		ev, err := baseEvent(e, defaultLoc)
+		if err != nil {
+			continue
+		}
+		rrule := e.get("RRULE")
+		if rrule == nil {
+			if overlaps(ev, from, to) {
+				result = append(result, ev)
+			}
+			continue
+		}
+
+		exdates := make(map[string]bool)
+		for _, p := range e.all("EXDATE") {
+			for _, v := range strings.Split(p.value, ",") {
+				t, _, err := parseTime(property{name: p.name, params: p.params, value: v}, defaultLoc)
+				if err == nil {
+					exdates[t.UTC().Format(timeFormat)] = true
+				}
+			}
+		}
+
+		duration := ev.End.Sub(ev.Start)
+		for _, start := range expand(ev.Start, rrule.value, to) {
+			key := start.UTC().Format(timeFormat)
+			if exdates[key] {
+				continue
+			}
+			occurrence := ev
+			occurrence.RecurrenceID = key
+			occurrence.Start = start
+			occurrence.End = start.Add(duration)
+			if o, ok := overrides[ev.UID+"#"+key]; ok {
+				occurrence = o
+				delete(overrides, ev.UID+"#"+key)
+			}
+			if overlaps(occurrence, from, to) {
+				result = append(result, occurrence)
+			}
+		}
+	}
+
+	// 覆盖了展开范围之外实例的（如移动到窗口内），单独加入
+	for _, o := range overrides {
+		if overlaps(o, from, to) {
+			result = append(result, o)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Start.Before(result[j].Start) })
+	return result, nil
+}
+
+func overlaps(e ParsedEvent, from, to time.Time) bool {
+	return e.Start.Before(to) && e.End.After(from)
+}
+
+// baseEvent 解析事件的基本属性
+func baseEvent(e *rawEvent, defaultLoc *time.Location) (ParsedEvent, error) {
+	var ev ParsedEvent
+	uid := e.get("UID")
+	start := e.get("DTSTART")
+	if uid == nil || start == nil {
+		return ev, errors.New("缺少 UID 或 DTSTART")
+	}
+	ev.UID = uid.value
+
+	var err error
+	if ev.Start, ev.AllDay, err = parseTime(*start, defaultLoc); err != nil {
+		return ev, err
+	}
+
+	switch {
+	case e.get("DTEND") != nil:
+		if ev.End, _, err = parseTime(*e.get("DTEND"), defaultLoc); err != nil {
+			return ev, err
+		}
+	case e.get("DURATION") != nil:
+		d, err := parseDuration(e.get("DURATION").value)
+		if err != nil {
+			return ev, err
+		}
+		ev.End = ev.Start.Add(d)
+	case ev.AllDay:
+		ev.End = ev.Start.AddDate(0, 0, 1)
+	default:
+		ev.End = ev.Start
+	}
+	if !ev.End.After(ev.Start) {
+		return ev, errors.New("事件结束时间早于开始时间")
+	}
+
+	if p := e.get("SUMMARY"); p != nil {
+		ev.Summary = unescape(p.value)
+	}
+	if p := e.get("STATUS"); p != nil {
+		ev.Status = strings.ToUpper(p.value)
+	}
+	if p := e.get("TRANSP"); p != nil {
+		ev.Transparent = strings.EqualFold(p.value, "TRANSPARENT")
+	}
+	return ev, nil
+}
+
+// unfold 读取内容并合并折行
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// parseLine 解析 NAME;PARAM=VALUE:VALUE 形式的内容行
+func parseLine(line string) (property, bool) {
+	var prop property
+	colon := -1
+	inQuote := false
+	for i, r := range line {
+		if r == '"' {
+			inQuote = !inQuote
+		} else if r == ':' && !inQuote {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return prop, false
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	prop.name = strings.ToUpper(parts[0])
+	prop.value = line[colon+1:]
+	prop.params = make(map[string]string)
+	for _, p := range parts[1:] {
+		if kv := strings.SplitN(p, "=", 2); len(kv) == 2 {
+			prop.params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], `"`)
+		}
+	}
+	return prop, true
+}
+
+// parseTime 解析 DATE 或 DATE-TIME 值，返回时间和是否为全天
+func parseTime(p property, defaultLoc *time.Location) (time.Time, bool, error) {
+	value := strings.TrimSpace(p.value)
+	loc := defaultLoc
+	if tzid, ok := p.params["TZID"]; ok {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+
+	if p.params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(timeFormat, value)
+		return t, false, err
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+// parseDuration 解析 RFC 5545 的 DURATION，如 PT1H30M、P1D
+func parseDuration(s string) (time.Duration, error) {
+	sign := time.Duration(1)
+	if strings.HasPrefix(s, "-") {
+		sign = -1
+		s = s[1:]
+	}
+	s = strings.TrimPrefix(s, "+")
+	if !strings.HasPrefix(s, "P") {
+		return 0, errors.New("无效的 DURATION")
+	}
+	s = s[1:]
+
+	var d time.Duration
+	inTime := false
+	num := ""
+	for _, r := range s {
+		switch {
+		case r == 'T':
+			inTime = true
+		case r >= '0' && r <= '9':
+			num += string(r)
+		default:
+			n, err := strconv.Atoi(num)
+			if err != nil {
+				return 0, errors.New("无效的 DURATION")
+			}
+			num = ""
+			switch {
+			case r == 'W':
+				d += time.Duration(n) * 7 * 24 * time.Hour
+			case r == 'D':
+				d += time.Duration(n) * 24 * time.Hour
+			case r == 'H' && inTime:
+				d += time.Duration(n) * time.Hour
+			case r == 'M' && inTime:
+				d += time.Duration(n) * time.Minute
+			case r == 'S' && inTime:
+				d += time.Duration(n) * time.Second
+			default:
+				return 0, errors.New("无效的 DURATION")
+			}
+		}
+	}
+	return sign * d, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// expand 按 RRULE 展开重复事件在 until 之前的开始时间（含首次）
+func expand(start time.Time, rule string, limit time.Time) []time.Time {
+	params := make(map[string]string)
+	for _, part := range strings.Split(rule, ";") {
+		if kv := strings.SplitN(part, "=", 2); len(kv) == 2 {
+			params[strings.ToUpper(kv[0])] = strings.ToUpper(kv[1])
+		}
+	}
+
+	interval := 1
+	if n, err := strconv.Atoi(params["INTERVAL"]); err == nil && n > 0 {
+		interval = n
+	}
+	count := 0
+	if n, err := strconv.Atoi(params["COUNT"]); err == nil && n > 0 {
+		count = n
+	}
+	until := limit
+	if v, ok := params["UNTIL"]; ok {
+		if t, _, err := parseTime(property{value: v}, start.Location()); err == nil && t.Before(until) {
+			until = t.Add(time.Second) // UNTIL 含当次
+		}
+	}
+
+	var byDay []time.Weekday
+	if v, ok := params["BYDAY"]; ok {
+		for _, d := range strings.Split(v, ",") {
+			// 忽略 1MO、-1FR 这类序号，按星期展开
+			d = strings.TrimLeft(d, "+-0123456789")
+			if wd, ok := weekdays[d]; ok {
+				byDay = append(byDay, wd)
+			}
+		}
+	}
+
+	var result []time.Time
+	add := func(t time.Time) bool {
+		if !t.Before(until) || len(result) >= maxOccurrences || (count > 0 && len(result) >= count) {
+			return false
+		}
+		if !t.Before(start) {
+			result = append(result, t)
+		}
+		return true
+	}
+
+	switch params["FREQ"] {
+	case "DAILY":
+		for t := start; add(t); t = t.AddDate(0, 0, interval) {
+		}
+	case "WEEKLY":
+		if len(byDay) == 0 {
+			for t := start; add(t); t = t.AddDate(0, 0, 7*interval) {
+			}
+			break
+		}
+		sort.Slice(byDay, func(i, j int) bool { return byDay[i] < byDay[j] })
+		// 从开始所在周的周日起，每隔 interval 周按 BYDAY 取日期
+		weekStart := start.AddDate(0, 0, -int(start.Weekday()))
+		for w := weekStart; ; w = w.AddDate(0, 0, 7*interval) {
+			stop := false
+			for _, wd := range byDay {
+				if !add(w.AddDate(0, 0, int(wd))) {
+					stop = true
+					break
+				}
+			}
+			if stop {
+				break
+			}
+		}
+	case "MONTHLY":
+		for i := 0; ; i += interval {
+			t := start.AddDate(0, i, 0)
+			if t.Day() != start.Day() {
+				continue // 跳过没有该日期的月份（如31日）
+			}
+			if !add(t) {
+				break
+			}
+		}
+	case "YEARLY":
+		for i := 0; ; i += interval {
+			if !add(start.AddDate(i, 0, 0)) {
+				break
+			}
+		}
+	default:
+		result = append(result, start)
+	}
+	return result
+}
+
+// unescape 还原文本值中的转义字符
+func unescape(s string) string {
+	r := strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+	return r.Replace(s)
+}
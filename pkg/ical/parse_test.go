@@ -0,0 +1,103 @@
+package ical
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "用解析结果重写 testdata 中的 .golden 文件")
+
+// TestParseGolden 解析 testdata 下的每个 .ics 文件，与同名 .golden 文件比较
+func TestParseGolden(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, loc)
+	to := time.Date(2026, 4, 1, 0, 0, 0, 0, loc)
+
+	files, err := filepath.Glob(filepath.Join("testdata", "*.ics"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("testdata 下没有 .ics 文件")
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".ics")
+		t.Run(name, func(t *testing.T) {
+			f, err := os.Open(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			events, err := Parse(f, from, to, loc)
+			if err != nil {
+				t.Fatalf("Parse() err = %v", err)
+			}
+			got := formatEvents(events)
+
+			golden := strings.TrimSuffix(file, ".ics") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("读取 %s 失败: %v（可用 -update 生成）", golden, err)
+			}
+			if got != string(want) {
+				t.Fatalf("解析结果与 %s 不一致\n得到:\n%s\n期望:\n%s", golden, got, want)
+			}
+		})
+	}
+}
+
+// formatEvents 每个事件一行，时间带时区偏移以便核对 TZID 的处理
+func formatEvents(events []ParsedEvent) string {
+	var b strings.Builder
+	for _, e := range events {
+		fmt.Fprintf(&b, "%s rid=%q start=%s end=%s allday=%t status=%q transparent=%t summary=%q\n",
+			e.UID, e.RecurrenceID, e.Start.Format(time.RFC3339), e.End.Format(time.RFC3339),
+			e.AllDay, e.Status, e.Transparent, e.Summary)
+	}
+	return b.String()
+}
+
+func TestParseUnterminatedEvent(t *testing.T) {
+	ics := "BEGIN:VCALENDAR\nBEGIN:VEVENT\nUID:a\nDTSTART:20260310T020000Z\n"
+	if _, err := Parse(strings.NewReader(ics), time.Time{}, time.Now(), time.UTC); err == nil {
+		t.Fatal("VEVENT 未结束应返回错误")
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"PT1H30M", 90 * time.Minute, false},
+		{"PT45M30S", 45*time.Minute + 30*time.Second, false},
+		{"P1D", 24 * time.Hour, false},
+		{"+P1DT2H", 26 * time.Hour, false},
+		{"P2W", 14 * 24 * time.Hour, false},
+		{"-PT15M", -15 * time.Minute, false},
+		{"P1H", 0, true},
+		{"1H", 0, true},
+		{"PTH", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseDuration(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseDuration(%q) = %v, %v, 期望 %v, wantErr %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,550 @@
+package qrcode
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// 以下按 ISO/IEC 18004 实现一个只支持字节模式、纠错等级 M 的解码器，
+// 不复用编码器的代码，用于验证生成的图片能被正确读出
+
+// 纠错等级 M 下各版本的字节模式容量
+var specByteCapacity = []int{0, 14, 26, 42, 62, 84, 106, 122, 152, 180, 213}
+
+// specBlocks 纠错等级 M 下各版本的分块：第一组块数和每块数据码字数、第二组块数和每块数据码字数、每块纠错码字数
+var specBlocks = []struct{ n1, k1, n2, k2, ec int }{
+	{},
+	{1, 16, 0, 0, 10},
+	{1, 28, 0, 0, 16},
+	{1, 44, 0, 0, 26},
+	{2, 32, 0, 0, 18},
+	{2, 43, 0, 0, 24},
+	{4, 27, 0, 0, 16},
+	{4, 31, 0, 0, 18},
+	{2, 38, 2, 39, 22},
+	{3, 36, 2, 37, 22},
+	{4, 43, 1, 44, 26},
+}
+
+// 各版本的剩余位数
+var specRemainderBits = []int{0, 0, 7, 7, 7, 7, 7, 0, 0, 0, 0}
+
+// 各版本校正图形的中心坐标
+var specAlignment = [][]int{
+	nil, nil,
+	{6, 18}, {6, 22}, {6, 26}, {6, 30}, {6, 34},
+	{6, 22, 38}, {6, 24, 42}, {6, 26, 46}, {6, 28, 50},
+}
+
+// decodedCode 解码结果
+type decodedCode struct {
+	content string
+	version int
+	mask    int
+}
+
+// decodePNG 从 PNG 中读出模块矩阵并解码
+func decodePNG(data []byte, scale int) (*decodedCode, error) {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	width := img.Bounds().Dx()
+	if img.Bounds().Dy() != width || width%scale != 0 {
+		return nil, fmt.Errorf("图片尺寸 %v 不是 %d 的整数倍", img.Bounds(), scale)
+	}
+	size := width/scale - quietZone*2
+	dark := func(px, py int) bool {
+		return color.GrayModel.Convert(img.At(px, py)).(color.Gray).Y < 128
+	}
+
+	// 空白边须全为浅色
+	for py := 0; py < width; py++ {
+		for px := 0; px < width; px++ {
+			x, y := px/scale-quietZone, py/scale-quietZone
+			if (x < 0 || y < 0 || x >= size || y >= size) && dark(px, py) {
+				return nil, fmt.Errorf("空白边 (%d,%d) 为深色", px, py)
+			}
+		}
+	}
+
+	modules := make([][]bool, size)
+	for y := range modules {
+		modules[y] = make([]bool, size)
+		for x := range modules[y] {
+			modules[y][x] = dark((x+quietZone)*scale+scale/2, (y+quietZone)*scale+scale/2)
+		}
+	}
+	return decodeModules(modules)
+}
+
+// decodeModules 按规范解码模块矩阵，modules[y][x] 为 true 表示深色
+func decodeModules(m [][]bool) (*decodedCode, error) {
+	size := len(m)
+	if size < 21 || (size-17)%4 != 0 {
+		return nil, fmt.Errorf("无效的尺寸 %d", size)
+	}
+	version := (size - 17) / 4
+	if version >= len(specBlocks) {
+		return nil, fmt.Errorf("不支持的版本 %d", version)
+	}
+	if err := checkFunctionPatterns(m, version); err != nil {
+		return nil, err
+	}
+
+	// 格式信息：两份须一致，纠错等级须为 M
+	format1, format2 := 0, 0
+	for i := 0; i <= 5; i++ {
+		format1 |= bit(m[i][8]) << uint(i)
+	}
+	format1 |= bit(m[7][8])<<6 | bit(m[8][8])<<7 | bit(m[8][7])<<8
+	for i := 9; i < 15; i++ {
+		format1 |= bit(m[8][14-i]) << uint(i)
+	}
+	for i := 0; i < 8; i++ {
+		format2 |= bit(m[8][size-1-i]) << uint(i)
+	}
+	for i := 8; i < 15; i++ {
+		format2 |= bit(m[size-15+i][8]) << uint(i)
+	}
+	if format1 != format2 {
+		return nil, fmt.Errorf("两份格式信息不一致: %015b %015b", format1, format2)
+	}
+	formatData := -1
+	for d := 0; d < 32; d++ {
+		if bchFormat(d) == format1 {
+			formatData = d
+		}
+	}
+	if formatData < 0 {
+		return nil, fmt.Errorf("无效的格式信息 %015b", format1)
+	}
+	if formatData>>3 != 0 {
+		return nil, fmt.Errorf("纠错等级指示位 %02b 不是 M", formatData>>3)
+	}
+	mask := formatData & 7
+
+	// 版本信息：版本 7 及以上两份均须与尺寸一致
+	if version >= 7 {
+		v1, v2 := 0, 0
+		for i := 0; i < 18; i++ {
+			v1 |= bit(m[i/3][size-11+i%3]) << uint(i)
+			v2 |= bit(m[size-11+i%3][i/3]) << uint(i)
+		}
+		if want := bchVersion(version); v1 != want || v2 != want {
+			return nil, fmt.Errorf("版本信息 %018b %018b, 期望 %018b", v1, v2, want)
+		}
+	}
+
+	// 按之字形读出数据位并去掉掩模
+	function := functionModules(size, version)
+	var bits []bool
+	upward := true
+	for col := size - 1; col > 0; col -= 2 {
+		if col == 6 {
+			col--
+		}
+		for i := 0; i < size; i++ {
+			row := i
+			if upward {
+				row = size - 1 - i
+			}
+			for dx := 0; dx < 2; dx++ {
+				c := col - dx
+				if !function[row][c] {
+					bits = append(bits, m[row][c] != maskBit(mask, row, c))
+				}
+			}
+		}
+		upward = !upward
+	}
+
+	b := specBlocks[version]
+	total := b.n1*(b.k1+b.ec) + b.n2*(b.k2+b.ec)
+	if len(bits) != total*8+specRemainderBits[version] {
+		return nil, fmt.Errorf("数据位数 %d, 期望 %d", len(bits), total*8+specRemainderBits[version])
+	}
+	codewords := make([]byte, total)
+	for i := range codewords {
+		for j := 0; j < 8; j++ {
+			codewords[i] = codewords[i]<<1 | byte(bit(bits[i*8+j]))
+		}
+	}
+
+	// 拆分交错的码字并校验每块的 Reed-Solomon 纠错码
+	var blocks [][]byte
+	var dataLens []int
+	for i := 0; i < b.n1; i++ {
+		dataLens = append(dataLens, b.k1)
+	}
+	for i := 0; i < b.n2; i++ {
+		dataLens = append(dataLens, b.k2)
+	}
+	blocks = make([][]byte, len(dataLens))
+	pos := 0
+	for i := 0; i < b.k2 || i < b.k1; i++ {
+		for j, k := range dataLens {
+			if i < k {
+				blocks[j] = append(blocks[j], codewords[pos])
+				pos++
+			}
+		}
+	}
+	for i := 0; i < b.ec; i++ {
+		for j := range blocks {
+			blocks[j] = append(blocks[j], codewords[pos])
+			pos++
+		}
+	}
+	var data []byte
+	for j, block := range blocks {
+		for i := 0; i < b.ec; i++ {
+			if s := rsSyndrome(block, i); s != 0 {
+				return nil, fmt.Errorf("第%d块纠错码校验失败", j+1)
+			}
+		}
+		data = append(data, block[:dataLens[j]]...)
+	}
+
+	content, err := parseByteSegment(data, version)
+	if err != nil {
+		return nil, err
+	}
+	return &decodedCode{content: content, version: version, mask: mask}, nil
+}
+
+// parseByteSegment 解析字节模式的数据段、结束符和填充码字
+func parseByteSegment(data []byte, version int) (string, error) {
+	pos := 0
+	read := func(n int) int {
+		v := 0
+		for i := 0; i < n; i++ {
+			v = v<<1 | int(data[pos/8]>>uint(7-pos%8)&1)
+			pos++
+		}
+		return v
+	}
+	if mode := read(4); mode != 0x4 {
+		return "", fmt.Errorf("模式指示符 %04b 不是字节模式", mode)
+	}
+	countBits := 8
+	if version >= 10 {
+		countBits = 16
+	}
+	length := read(countBits)
+	if pos+length*8 > len(data)*8 {
+		return "", fmt.Errorf("字符数 %d 超出数据长度", length)
+	}
+	content := make([]byte, length)
+	for i := range content {
+		content[i] = byte(read(8))
+	}
+	// 结束符最多 4 位 0，再补 0 到字节边界
+	for i := 0; i < 4 && pos < len(data)*8; i++ {
+		if read(1) != 0 {
+			return "", errors.New("结束符不为 0")
+		}
+	}
+	for pos%8 != 0 {
+		if read(1) != 0 {
+			return "", errors.New("补齐位不为 0")
+		}
+	}
+	for i, pad := 0, pos/8; pad < len(data); i, pad = i+1, pad+1 {
+		want := byte(0xEC)
+		if i%2 == 1 {
+			want = 0x11
+		}
+		if data[pad] != want {
+			return "", fmt.Errorf("填充码字 %#x, 期望 %#x", data[pad], want)
+		}
+	}
+	return string(content), nil
+}
+
+// checkFunctionPatterns 校验定位图形、分隔符、时序图形、校正图形和固定深色模块
+func checkFunctionPatterns(m [][]bool, version int) error {
+	size := len(m)
+	for _, c := range [][2]int{{3, 3}, {size - 4, 3}, {3, size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x < 0 || y < 0 || x >= size || y >= size {
+					continue
+				}
+				d := max(abs(dx), abs(dy))
+				if want := d != 2 && d != 4; m[y][x] != want {
+					return fmt.Errorf("定位图形 (%d,%d) 错误", x, y)
+				}
+			}
+		}
+	}
+	for i := 8; i < size-8; i++ {
+		if m[6][i] != (i%2 == 0) || m[i][6] != (i%2 == 0) {
+			return fmt.Errorf("时序图形第 %d 个模块错误", i)
+		}
+	}
+	for _, c := range alignmentCenters(size, version) {
+		for dy := -2; dy <= 2; dy++ {
+			for dx := -2; dx <= 2; dx++ {
+				if want := max(abs(dx), abs(dy)) != 1; m[c[1]+dy][c[0]+dx] != want {
+					return fmt.Errorf("校正图形 (%d,%d) 错误", c[0], c[1])
+				}
+			}
+		}
+	}
+	if !m[size-8][8] {
+		return errors.New("固定深色模块为浅色")
+	}
+	return nil
+}
+
+// alignmentCenters 与定位图形不重叠的校正图形中心
+func alignmentCenters(size, version int) [][2]int {
+	var centers [][2]int
+	for _, y := range specAlignment[version] {
+		for _, x := range specAlignment[version] {
+			if (x == 6 && y == 6) || (x == 6 && y == size-7) || (x == size-7 && y == 6) {
+				continue
+			}
+			centers = append(centers, [2]int{x, y})
+		}
+	}
+	return centers
+}
+
+// functionModules 标记不存放数据的模块
+func functionModules(size, version int) [][]bool {
+	f := make([][]bool, size)
+	for y := range f {
+		f[y] = make([]bool, size)
+	}
+	fill := func(x0, y0, w, h int) {
+		for y := y0; y < y0+h; y++ {
+			for x := x0; x < x0+w; x++ {
+				f[y][x] = true
+			}
+		}
+	}
+	// 定位图形、分隔符和格式信息
+	fill(0, 0, 9, 9)
+	fill(size-8, 0, 8, 9)
+	fill(0, size-8, 9, 8)
+	// 时序图形
+	fill(6, 0, 1, size)
+	fill(0, 6, size, 1)
+	for _, c := range alignmentCenters(size, version) {
+		fill(c[0]-2, c[1]-2, 5, 5)
+	}
+	if version >= 7 {
+		fill(size-11, 0, 3, 6)
+		fill(0, size-11, 6, 3)
+	}
+	return f
+}
+
+// maskBit 掩模条件，i 为行、j 为列
+func maskBit(mask, i, j int) bool {
+	switch mask {
+	case 0:
+		return (i+j)%2 == 0
+	case 1:
+		return i%2 == 0
+	case 2:
+		return j%3 == 0
+	case 3:
+		return (i+j)%3 == 0
+	case 4:
+		return (i/2+j/3)%2 == 0
+	case 5:
+		return (i*j)%2+(i*j)%3 == 0
+	case 6:
+		return ((i*j)%2+(i*j)%3)%2 == 0
+	default:
+		return ((i+j)%2+(i*j)%3)%2 == 0
+	}
+}
+
+// bchFormat 格式信息的 BCH(15,5) 编码并与 101010000010010 异或
+func bchFormat(data int) int {
+	return (data<<10 | bchRemainder(data<<10, 0x537, 10)) ^ 0x5412
+}
+
+// bchVersion 版本信息的 BCH(18,6) 编码
+func bchVersion(version int) int {
+	return version<<12 | bchRemainder(version<<12, 0x1F25, 12)
+}
+
+func bchRemainder(value, generator, degree int) int {
+	for i := 30; i >= degree; i-- {
+		if value>>uint(i)&1 == 1 {
+			value ^= generator << uint(i-degree)
+		}
+	}
+	return value
+}
+
+// rsSyndrome 码字多项式在 α^i 处的值，无错误时为 0
+func rsSyndrome(block []byte, i int) byte {
+	x := byte(1)
+	for j := 0; j < i; j++ {
+		x = gfMul(x, 2)
+	}
+	var s byte
+	for _, c := range block {
+		s = gfMul(s, x) ^ c
+	}
+	return s
+}
+
+// gfMul GF(256) 乘法，本原多项式 x^8+x^4+x^3+x^2+1
+func gfMul(a, b byte) byte {
+	var p byte
+	for b > 0 {
+		if b&1 == 1 {
+			p ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1D
+		}
+		b >>= 1
+	}
+	return p
+}
+
+func bit(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// expectedVersion 能容纳 n 字节的最小版本
+func expectedVersion(n int) int {
+	for v := 1; v < len(specByteCapacity); v++ {
+		if n <= specByteCapacity[v] {
+			return v
+		}
+	}
+	return 0
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"单个字符", "a"},
+		{"签到码", "CHECKIN:1024:3f9a2c7e5b1d4e8f9a0b1c2d3e4f5a6b"},
+		{"签到链接", "https://example.com/checkin?token=3f9a2c7e5b1d4e8f9a0b1c2d3e4f5a6b7c8d9e0f1a2b3c4d"},
+		{"中文", "到店签到：预约单号 A20261016001"},
+		{"二进制字节", "\x00\x01\xfe\xff\xec\x11"},
+	}
+	// 每个版本容量的边界
+	for v := 1; v < len(specByteCapacity); v++ {
+		tests = append(tests, struct {
+			name    string
+			content string
+		}{fmt.Sprintf("版本%d满容量", v), strings.Repeat("x", specByteCapacity[v])})
+		if v < len(specByteCapacity)-1 {
+			tests = append(tests, struct {
+				name    string
+				content string
+			}{fmt.Sprintf("超出版本%d容量", v), strings.Repeat("y", specByteCapacity[v]+1)})
+		}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := Encode(tt.content)
+			if err != nil {
+				t.Fatalf("Encode() err = %v", err)
+			}
+			wantVersion := expectedVersion(len(tt.content))
+			if code.Size() != wantVersion*4+17 {
+				t.Fatalf("Size() = %d, 期望版本 %d 的 %d", code.Size(), wantVersion, wantVersion*4+17)
+			}
+			for _, scale := range []int{1, 3} {
+				img, err := code.PNG(scale)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := decodePNG(img, scale)
+				if err != nil {
+					t.Fatalf("scale %d 解码失败: %v", scale, err)
+				}
+				if got.content != tt.content || got.version != wantVersion {
+					t.Fatalf("scale %d 解码得到 %q (版本 %d), 期望 %q (版本 %d)",
+						scale, got.content, got.version, tt.content, wantVersion)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	if _, err := Encode(strings.Repeat("z", specByteCapacity[maxVersion]+1)); !errors.Is(err, ErrTooLong) {
+		t.Fatalf("Encode() err = %v, 期望 ErrTooLong", err)
+	}
+}
+
+func TestBase64PNG(t *testing.T) {
+	const content = "CHECKIN:42:abcdef"
+	uri, err := Base64PNG(content, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const prefix = "data:image/png;base64,"
+	if !strings.HasPrefix(uri, prefix) {
+		t.Fatalf("data URI 前缀错误: %.40s", uri)
+	}
+	img, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(uri, prefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := png.DecodeConfig(bytes.NewReader(img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (expectedVersion(len(content))*4 + 17 + quietZone*2) * 4; cfg.Width != want || cfg.Height != want {
+		t.Fatalf("图片尺寸 %dx%d, 期望 %dx%d", cfg.Width, cfg.Height, want, want)
+	}
+	got, err := decodePNG(img, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.content != content {
+		t.Fatalf("解码得到 %q, 期望 %q", got.content, content)
+	}
+}
+
+// TestEncodeUsesAllMasks 不同内容会选中不同的掩模，解码器对每种掩模都能读出
+func TestEncodeUsesAllMasks(t *testing.T) {
+	seen := make(map[int]bool)
+	for i := 0; i < 400 && len(seen) < 8; i++ {
+		content := fmt.Sprintf("token-%d", i)
+		code, err := Encode(content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := decodeModules(code.modules)
+		if err != nil {
+			t.Fatalf("%q 解码失败: %v", content, err)
+		}
+		if got.content != content {
+			t.Fatalf("解码得到 %q, 期望 %q", got.content, content)
+		}
+		seen[got.mask] = true
+	}
+	if len(seen) < 8 {
+		t.Fatalf("只覆盖了 %d 种掩模", len(seen))
+	}
+}
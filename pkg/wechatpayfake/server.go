@@ -0,0 +1,757 @@
+// Package wechatpayfake 本地模拟的微信支付 v2 网关，用于离线联调和集成测试。
+//
+// 支持统一下单、查询订单、关闭订单和申请退款，校验请求的 MD5 签名，应答按 v2 规则签名；
+// 调用 Pay 或 POST /fake/pay 模拟用户支付，向下单时的 notify_url 发送签名的支付结果回调；
+// 退款申请受理后处于退款中，调用 SettleRefund 或 POST /fake/refund 完成退款，
+// 向退款申请的 notify_url 发送 req_info 加密的退款结果回调；
+// 调用 Script 或 POST /fake/script 为指定接口预设失败，按顺序各生效一次。
+// 将 wechat_pay.base_url 配置为该服务的地址即可让支付模块请求本地网关，APIv3 接口不支持
+package wechatpayfake
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 接口名称，用于 Script 预设失败
+const (
+	APIUnifiedOrder = "unifiedorder" // 统一下单
+	APIOrderQuery   = "orderquery"   // 查询订单
+	APICloseOrder   = "closeorder"   // 关闭订单
+	APIRefund       = "refund"       // 申请退款
+	APINotify       = "notify"       // 支付结果回调
+	APIRefundNotify = "refundnotify" // 退款结果回调
+)
+
+// 订单交易状态，与微信支付 trade_state 一致
+const (
+	TradeStateNotPay   = "NOTPAY"
+	TradeStateSuccess  = "SUCCESS"
+	TradeStateRefund   = "REFUND"
+	TradeStateClosed   = "CLOSED"
+	TradeStatePayError = "PAYERROR"
+)
+
+// 退款状态，与微信支付 refund_status 一致
+const (
+	RefundStatusProcessing = "PROCESSING"
+	RefundStatusSuccess    = "SUCCESS"
+	RefundStatusChange     = "CHANGE" // 退款异常
+)
+
+// Config 网关配置，须与支付模块的 wechat_pay 配置一致
+type Config struct {
+	AppID     string
+	MchID     string
+	APIKey    string
+	NotifyURL string // 回调地址，为空时使用下单参数中的 notify_url
+
+	RefundNotifyURL string // 退款结果回调地址，为空时使用退款申请中的 notify_url
+}
+
+// Failure 预设的失败，按字段优先级生效：StatusCode > ReturnMsg > ErrCode > BadSign。
+// 退款结果回调不签名，BadSign 时用错误的密钥加密 req_info
+type Failure struct {
+	StatusCode int    `json:"status_code"`  // 直接返回该 HTTP 状态码
+	ReturnMsg  string `json:"return_msg"`   // 返回 return_code=FAIL（通信失败）
+	ErrCode    string `json:"err_code"`     // 返回 result_code=FAIL（业务失败），如 SYSTEMERROR、NOTENOUGH
+	ErrCodeDes string `json:"err_code_des"` // 业务失败描述
+	BadSign    bool   `json:"bad_sign"`     // 应答或回调使用错误的签名
+}
+
+// Order 网关中的订单
+type Order struct {
+	OutTradeNo    string   `json:"out_trade_no"`
+	PrepayID      string   `json:"prepay_id"`
+	TransactionID string   `json:"transaction_id"`
+	OpenID        string   `json:"openid"`
+	Body          string   `json:"body"`
+	TotalFee      int      `json:"total_fee"`
+	NotifyURL     string   `json:"notify_url"`
+	TradeState    string   `json:"trade_state"`
+	RefundedFee   int      `json:"refunded_fee"`
+	Refunds       []Refund `json:"refunds"`
+}
+
+// Refund 网关中的退款单
+type Refund struct {
+	OutRefundNo  string `json:"out_refund_no"`
+	RefundID     string `json:"refund_id"`
+	RefundFee    int    `json:"refund_fee"`
+	NotifyURL    string `json:"notify_url"`
+	RefundStatus string `json:"refund_status"`
+}
+
+// Server 模拟的微信支付 v2 网关
+type Server struct {
+	cfg        Config
+	httpClient *http.Client
+	mux        *http.ServeMux
+
+	mu       sync.Mutex
+	seq      int
+	orders   map[string]*Order
+	failures map[string][]Failure
+}
+
+// NewServer 创建模拟网关
+func NewServer(cfg Config) *Server {
+	s := &Server{
+		cfg:        cfg,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		mux:        http.NewServeMux(),
+		orders:     make(map[string]*Order),
+		failures:   make(map[string][]Failure),
+	}
+	s.mux.HandleFunc("/pay/unifiedorder", s.api(APIUnifiedOrder, s.unifiedOrder))
+	s.mux.HandleFunc("/pay/orderquery", s.api(APIOrderQuery, s.orderQuery))
+	s.mux.HandleFunc("/pay/closeorder", s.api(APICloseOrder, s.closeOrder))
+	s.mux.HandleFunc("/secapi/pay/refund", s.api(APIRefund, s.refund))
+	s.mux.HandleFunc("/fake/pay", s.handlePay)
+	s.mux.HandleFunc("/fake/refund", s.handleRefund)
+	s.mux.HandleFunc("/fake/script", s.handleScript)
+	s.mux.HandleFunc("/fake/orders/", s.handleOrder)
+	return s
+}
+
+// ServeHTTP 实现 http.Handler，可直接用于 httptest.NewServer
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Script 为接口预设失败，每次调用按顺序消耗一个
+func (s *Server) Script(api string, failures ...Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[api] = append(s.failures[api], failures...)
+}
+
+// Order 查询订单，返回副本
+func (s *Server) Order(outTradeNo string) (Order, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	order, ok := s.orders[outTradeNo]
+	if !ok {
+		return Order{}, false
+	}
+	copied := *order
+	copied.Refunds = append([]Refund(nil), order.Refunds...)
+	return copied, true
+}
+
+// Pay 模拟用户支付成功并发送支付结果回调，回调未应答 SUCCESS 时返回错误，订单仍为已支付
+func (s *Server) Pay(outTradeNo string) error {
+	return s.settle(outTradeNo, true)
+}
+
+// FailPay 模拟用户支付失败并发送支付结果回调
+func (s *Server) FailPay(outTradeNo string) error {
+	return s.settle(outTradeNo, false)
+}
+
+func (s *Server) settle(outTradeNo string, success bool) error {
+	s.mu.Lock()
+	order, ok := s.orders[outTradeNo]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("订单不存在: %s", outTradeNo)
+	}
+	if order.TradeState != TradeStateNotPay {
+		s.mu.Unlock()
+		return fmt.Errorf("订单状态为 %s，不能支付", order.TradeState)
+	}
+
+	params := map[string]string{
+		"appid":        s.cfg.AppID,
+		"mch_id":       s.cfg.MchID,
+		"nonce_str":    s.nextID("n"),
+		"openid":       order.OpenID,
+		"is_subscribe": "N",
+		"trade_type":   "JSAPI",
+		"bank_type":    "OTHERS",
+		"total_fee":    strconv.Itoa(order.TotalFee),
+		"fee_type":     "CNY",
+		"out_trade_no": order.OutTradeNo,
+		"time_end":     time.Now().Format("20060102150405"),
+		"return_code":  "SUCCESS",
+	}
+	if success {
+		order.TradeState = TradeStateSuccess
+		order.TransactionID = s.nextID("4200")
+		params["result_code"] = "SUCCESS"
+		params["transaction_id"] = order.TransactionID
+		params["cash_fee"] = params["total_fee"]
+	} else {
+		order.TradeState = TradeStatePayError
+		params["result_code"] = "FAIL"
+		params["err_code"] = "PAYERROR"
+		params["err_code_des"] = "支付失败"
+	}
+	notifyURL := order.NotifyURL
+	if s.cfg.NotifyURL != "" {
+		notifyURL = s.cfg.NotifyURL
+	}
+	failure, scripted := s.popFailure(APINotify)
+	s.mu.Unlock()
+
+	s.sign(params, scripted && failure.BadSign)
+	return s.sendNotify(notifyURL, params)
+}
+
+// SettleRefund 完成退款中的退款单并发送退款结果回调，回调未应答 SUCCESS 时返回错误，退款单仍为已完成
+func (s *Server) SettleRefund(outRefundNo string) error {
+	return s.settleRefund(outRefundNo, true)
+}
+
+// FailRefund 模拟退款异常（CHANGE），可退金额恢复，并发送退款结果回调
+func (s *Server) FailRefund(outRefundNo string) error {
+	return s.settleRefund(outRefundNo, false)
+}
+
+func (s *Server) settleRefund(outRefundNo string, success bool) error {
+	s.mu.Lock()
+	order, refund := s.findRefund(outRefundNo)
+	if refund == nil {
+		s.mu.Unlock()
+		return fmt.Errorf("退款单不存在: %s", outRefundNo)
+	}
+	if refund.RefundStatus != RefundStatusProcessing {
+		s.mu.Unlock()
+		return fmt.Errorf("退款单状态为 %s，不能处理", refund.RefundStatus)
+	}
+
+	info := map[string]string{
+		"transaction_id":        order.TransactionID,
+		"out_trade_no":          order.OutTradeNo,
+		"refund_id":             refund.RefundID,
+		"out_refund_no":         refund.OutRefundNo,
+		"total_fee":             strconv.Itoa(order.TotalFee),
+		"refund_fee":            strconv.Itoa(refund.RefundFee),
+		"settlement_refund_fee": strconv.Itoa(refund.RefundFee),
+		"refund_recv_accout":    "支付用户零钱",
+		"refund_account":        "REFUND_SOURCE_RECHARGE_FUNDS",
+		"refund_request_source": "API",
+	}
+	if success {
+		refund.RefundStatus = RefundStatusSuccess
+		info["success_time"] = time.Now().Format("2006-01-02 15:04:05")
+	} else {
+		refund.RefundStatus = RefundStatusChange
+		order.RefundedFee -= refund.RefundFee
+		if order.RefundedFee == 0 {
+			order.TradeState = TradeStateSuccess
+		}
+	}
+	info["refund_status"] = refund.RefundStatus
+
+	notifyURL := refund.NotifyURL
+	if s.cfg.RefundNotifyURL != "" {
+		notifyURL = s.cfg.RefundNotifyURL
+	}
+	key := s.cfg.APIKey
+	if failure, scripted := s.popFailure(APIRefundNotify); scripted && failure.BadSign {
+		key += "-bad"
+	}
+	params := map[string]string{
+		"return_code": "SUCCESS",
+		"appid":       s.cfg.AppID,
+		"mch_id":      s.cfg.MchID,
+		"nonce_str":   s.nextID("n"),
+	}
+	s.mu.Unlock()
+
+	if notifyURL == "" {
+		return errors.New("退款申请未提供 notify_url")
+	}
+	reqInfo, err := EncryptRefundInfo(info, key)
+	if err != nil {
+		return err
+	}
+	params["req_info"] = reqInfo
+	return s.sendNotify(notifyURL, params)
+}
+
+// sendNotify 发送回调并检查应答
+func (s *Server) sendNotify(notifyURL string, params map[string]string) error {
+	resp, err := s.httpClient.Post(notifyURL, "text/xml", bytes.NewReader(encodeXML(params)))
+	if err != nil {
+		return fmt.Errorf("发送回调失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("读取回调应答失败: %v", err)
+	}
+	ack, err := decodeXML(body)
+	if err != nil {
+		return fmt.Errorf("回调应答格式错误(%d): %s", resp.StatusCode, body)
+	}
+	if ack["return_code"] != "SUCCESS" {
+		return fmt.Errorf("回调处理失败: %s", ack["return_msg"])
+	}
+	return nil
+}
+
+// ========== 支付接口 ==========
+
+// apiHandler 处理已验签的请求，返回业务错误码或应答字段
+type apiHandler func(req map[string]string) (resp map[string]string, errCode, errCodeDes string)
+
+// api 统一处理请求解析、验签、预设失败和应答签名
+func (s *Server) api(name string, handle apiHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		failure, scripted := s.popFailure(name)
+		if scripted && failure.StatusCode != 0 {
+			http.Error(w, http.StatusText(failure.StatusCode), failure.StatusCode)
+			return
+		}
+		if scripted && failure.ReturnMsg != "" {
+			writeXML(w, map[string]string{"return_code": "FAIL", "return_msg": failure.ReturnMsg})
+			return
+		}
+
+		req, err := decodeXML(body)
+		if err != nil {
+			writeXML(w, map[string]string{"return_code": "FAIL", "return_msg": "XML格式错误"})
+			return
+		}
+		if req["appid"] != s.cfg.AppID || req["mch_id"] != s.cfg.MchID {
+			writeXML(w, map[string]string{"return_code": "FAIL", "return_msg": "appid和mch_id不匹配"})
+			return
+		}
+		if req["sign_type"] != "" && req["sign_type"] != "MD5" {
+			writeXML(w, map[string]string{"return_code": "FAIL", "return_msg": "仅支持MD5签名"})
+			return
+		}
+		if req["sign"] == "" || req["sign"] != Sign(req, s.cfg.APIKey) {
+			writeXML(w, map[string]string{"return_code": "FAIL", "return_msg": "签名错误"})
+			return
+		}
+
+		// 预设的业务失败不改变订单状态
+		var resp map[string]string
+		var errCode, errCodeDes string
+		if scripted && failure.ErrCode != "" {
+			errCode, errCodeDes = failure.ErrCode, failure.ErrCodeDes
+		} else {
+			resp, errCode, errCodeDes = handle(req)
+		}
+		if resp == nil {
+			resp = map[string]string{}
+		}
+		resp["return_code"] = "SUCCESS"
+		resp["return_msg"] = "OK"
+		resp["appid"] = s.cfg.AppID
+		resp["mch_id"] = s.cfg.MchID
+		resp["nonce_str"] = s.nextID("n")
+		if errCode != "" {
+			resp["result_code"] = "FAIL"
+			resp["err_code"] = errCode
+			resp["err_code_des"] = errCodeDes
+		} else {
+			resp["result_code"] = "SUCCESS"
+		}
+		s.sign(resp, scripted && failure.BadSign)
+		writeXML(w, resp)
+	}
+}
+
+func (s *Server) unifiedOrder(req map[string]string) (map[string]string, string, string) {
+	for _, key := range []string{"out_trade_no", "body", "total_fee", "notify_url", "trade_type", "spbill_create_ip"} {
+		if req[key] == "" {
+			return nil, "PARAM_ERROR", "缺少参数" + key
+		}
+	}
+	if req["trade_type"] == "JSAPI" && req["openid"] == "" {
+		return nil, "PARAM_ERROR", "JSAPI支付必须传openid"
+	}
+	totalFee, err := strconv.Atoi(req["total_fee"])
+	if err != nil || totalFee <= 0 {
+		return nil, "PARAM_ERROR", "total_fee无效"
+	}
+
+	order, ok := s.orders[req["out_trade_no"]]
+	if ok {
+		switch order.TradeState {
+		case TradeStateSuccess, TradeStateRefund:
+			return nil, "ORDERPAID", "该订单已支付"
+		case TradeStateClosed:
+			return nil, "ORDERCLOSED", "该订单已关闭"
+		}
+		if order.TotalFee != totalFee || order.OpenID != req["openid"] {
+			return nil, "INVALID_REQUEST", "商户订单号重复"
+		}
+	} else {
+		order = &Order{
+			OutTradeNo: req["out_trade_no"],
+			PrepayID:   s.nextID("wx"),
+			OpenID:     req["openid"],
+			Body:       req["body"],
+			TotalFee:   totalFee,
+			NotifyURL:  req["notify_url"],
+			TradeState: TradeStateNotPay,
+		}
+		s.orders[order.OutTradeNo] = order
+	}
+
+	return map[string]string{
+		"trade_type": req["trade_type"],
+		"prepay_id":  order.PrepayID,
+	}, "", ""
+}
+
+func (s *Server) orderQuery(req map[string]string) (map[string]string, string, string) {
+	order, ok := s.findOrder(req)
+	if !ok {
+		return nil, "ORDERNOTEXIST", "此交易订单号不存在"
+	}
+	return map[string]string{
+		"out_trade_no":   order.OutTradeNo,
+		"transaction_id": order.TransactionID,
+		"openid":         order.OpenID,
+		"trade_state":    order.TradeState,
+		"total_fee":      strconv.Itoa(order.TotalFee),
+	}, "", ""
+}
+
+func (s *Server) closeOrder(req map[string]string) (map[string]string, string, string) {
+	order, ok := s.orders[req["out_trade_no"]]
+	if !ok {
+		return nil, "ORDERNOTEXIST", "此交易订单号不存在"
+	}
+	switch order.TradeState {
+	case TradeStateSuccess, TradeStateRefund:
+		return nil, "ORDERPAID", "该订单已支付"
+	case TradeStateClosed:
+		return nil, "ORDERCLOSED", "该订单已关闭"
+	}
+	order.TradeState = TradeStateClosed
+	return nil, "", ""
+}
+
+func (s *Server) refund(req map[string]string) (map[string]string, string, string) {
+	if req["out_refund_no"] == "" || req["total_fee"] == "" || req["refund_fee"] == "" {
+		return nil, "PARAM_ERROR", "缺少参数"
+	}
+	order, ok := s.findOrder(req)
+	if !ok {
+		return nil, "ORDERNOTEXIST", "此交易订单号不存在"
+	}
+	totalFee, _ := strconv.Atoi(req["total_fee"])
+	refundFee, err := strconv.Atoi(req["refund_fee"])
+	if err != nil || refundFee <= 0 {
+		return nil, "PARAM_ERROR", "refund_fee无效"
+	}
+
+	resp := func(refund Refund) map[string]string {
+		return map[string]string{
+			"out_trade_no":   order.OutTradeNo,
+			"transaction_id": order.TransactionID,
+			"out_refund_no":  refund.OutRefundNo,
+			"refund_id":      refund.RefundID,
+			"refund_fee":     strconv.Itoa(refund.RefundFee),
+			"total_fee":      strconv.Itoa(order.TotalFee),
+			"cash_fee":       strconv.Itoa(order.TotalFee),
+		}
+	}
+	// 同一退款单号重复申请返回原退款单
+	for _, refund := range order.Refunds {
+		if refund.OutRefundNo == req["out_refund_no"] {
+			return resp(refund), "", ""
+		}
+	}
+
+	if order.TradeState != TradeStateSuccess && order.TradeState != TradeStateRefund {
+		return nil, "TRADE_STATE_ERROR", "订单状态错误"
+	}
+	if totalFee != order.TotalFee {
+		return nil, "INVALID_REQUEST", "订单金额不一致"
+	}
+	if refundFee > order.TotalFee-order.RefundedFee {
+		return nil, "NOTENOUGH", "退款金额超过可退金额"
+	}
+
+	refund := Refund{
+		OutRefundNo:  req["out_refund_no"],
+		RefundID:     s.nextID("5000"),
+		RefundFee:    refundFee,
+		NotifyURL:    req["notify_url"],
+		RefundStatus: RefundStatusProcessing,
+	}
+	order.Refunds = append(order.Refunds, refund)
+	order.RefundedFee += refundFee
+	order.TradeState = TradeStateRefund
+	return resp(refund), "", ""
+}
+
+func (s *Server) findOrder(req map[string]string) (*Order, bool) {
+	if order, ok := s.orders[req["out_trade_no"]]; ok {
+		return order, true
+	}
+	if req["transaction_id"] == "" {
+		return nil, false
+	}
+	for _, order := range s.orders {
+		if order.TransactionID == req["transaction_id"] {
+			return order, true
+		}
+	}
+	return nil, false
+}
+
+// findRefund 按退款单号查找退款单，调用方须持有锁
+func (s *Server) findRefund(outRefundNo string) (*Order, *Refund) {
+	for _, order := range s.orders {
+		for i := range order.Refunds {
+			if order.Refunds[i].OutRefundNo == outRefundNo {
+				return order, &order.Refunds[i]
+			}
+		}
+	}
+	return nil, nil
+}
+
+// ========== 控制接口 ==========
+
+// handlePay POST /fake/pay {"out_trade_no": "...", "success": true}，success 省略时为支付成功
+func (s *Server) handlePay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		OutTradeNo string `json:"out_trade_no"`
+		Success    *bool  `json:"success"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.OutTradeNo == "" {
+		http.Error(w, "参数错误", http.StatusBadRequest)
+		return
+	}
+	if err := s.settle(req.OutTradeNo, req.Success == nil || *req.Success); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	order, _ := s.Order(req.OutTradeNo)
+	writeJSON(w, order)
+}
+
+// handleRefund POST /fake/refund {"out_refund_no": "...", "success": true}，success 省略时为退款成功
+func (s *Server) handleRefund(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		OutRefundNo string `json:"out_refund_no"`
+		Success     *bool  `json:"success"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.OutRefundNo == "" {
+		http.Error(w, "参数错误", http.StatusBadRequest)
+		return
+	}
+	if err := s.settleRefund(req.OutRefundNo, req.Success == nil || *req.Success); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleScript POST /fake/script {"api": "refund", "failures": [{"err_code": "SYSTEMERROR"}]}
+func (s *Server) handleScript(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		API      string    `json:"api"`
+		Failures []Failure `json:"failures"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.API == "" {
+		http.Error(w, "参数错误", http.StatusBadRequest)
+		return
+	}
+	s.Script(req.API, req.Failures...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleOrder GET /fake/orders/{out_trade_no}
+func (s *Server) handleOrder(w http.ResponseWriter, r *http.Request) {
+	order, ok := s.Order(strings.TrimPrefix(r.URL.Path, "/fake/orders/"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, order)
+}
+
+// ========== 辅助函数 ==========
+
+// popFailure 取出接口的下一个预设失败，调用方须持有锁
+func (s *Server) popFailure(api string) (Failure, bool) {
+	queue := s.failures[api]
+	if len(queue) == 0 {
+		return Failure{}, false
+	}
+	s.failures[api] = queue[1:]
+	return queue[0], true
+}
+
+// nextID 生成递增的单号，调用方须持有锁
+func (s *Server) nextID(prefix string) string {
+	s.seq++
+	return fmt.Sprintf("%s%s%06d", prefix, time.Now().Format("20060102150405"), s.seq)
+}
+
+// sign 为应答或回调签名，bad 为 true 时使用错误的密钥
+func (s *Server) sign(params map[string]string, bad bool) {
+	key := s.cfg.APIKey
+	if bad {
+		key += "-bad"
+	}
+	delete(params, "sign")
+	params["sign"] = Sign(params, key)
+}
+
+// Sign 按微信支付 v2 规则计算 MD5 签名：除 sign 外的非空字段按键名排序拼接，末尾加 &key=密钥
+func Sign(params map[string]string, apiKey string) string {
+	keys := make([]string, 0, len(params))
+	for k, v := range params {
+		if k != "sign" && v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, k := range keys {
+		buf.WriteString(k)
+		buf.WriteByte('=')
+		buf.WriteString(params[k])
+		buf.WriteByte('&')
+	}
+	buf.WriteString("key=")
+	buf.WriteString(apiKey)
+
+	sum := md5.Sum(buf.Bytes())
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// EncryptRefundInfo 按微信支付 v2 退款结果回调的规则生成 req_info：<root> 报文用 PKCS#7 填充，
+// 以商户密钥 MD5 的小写十六进制为密钥 AES-256-ECB 加密后 base64 编码
+func EncryptRefundInfo(info map[string]string, apiKey string) (string, error) {
+	sum := md5.Sum([]byte(apiKey))
+	block, err := aes.NewCipher([]byte(hex.EncodeToString(sum[:])))
+	if err != nil {
+		return "", err
+	}
+	plaintext := encodeElement("root", info)
+	padding := aes.BlockSize - len(plaintext)%aes.BlockSize
+	plaintext = append(plaintext, bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+	ciphertext := make([]byte, len(plaintext))
+	for i := 0; i < len(plaintext); i += aes.BlockSize {
+		block.Encrypt(ciphertext[i:i+aes.BlockSize], plaintext[i:i+aes.BlockSize])
+	}
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// encodeXML 按键名排序生成 <xml> 报文
+func encodeXML(params map[string]string) []byte {
+	return encodeElement("xml", params)
+}
+
+// encodeElement 按键名排序生成单层报文，root 为根元素名
+func encodeElement(root string, params map[string]string) []byte {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	buf.WriteString("<" + root + ">")
+	for _, k := range keys {
+		buf.WriteString("<" + k + ">")
+		xml.EscapeText(&buf, []byte(params[k]))
+		buf.WriteString("</" + k + ">")
+	}
+	buf.WriteString("</" + root + ">")
+	return buf.Bytes()
+}
+
+// decodeXML 解析单层 <xml> 报文
+func decodeXML(data []byte) (map[string]string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	result := make(map[string]string)
+	depth := 0
+	var key string
+	var value bytes.Buffer
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 2 {
+				key = t.Name.Local
+				value.Reset()
+			}
+		case xml.CharData:
+			if depth == 2 {
+				value.Write(t)
+			}
+		case xml.EndElement:
+			if depth == 2 {
+				result[key] = value.String()
+			}
+			depth--
+		}
+	}
+	if depth != 0 {
+		return nil, errors.New("XML不完整")
+	}
+	return result, nil
+}
+
+func writeXML(w http.ResponseWriter, params map[string]string) {
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.Write(encodeXML(params))
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(v)
+}
@@ -22,6 +22,10 @@ func SetupCustomerRoutes(r *gin.Engine) {
 		// 支付回调
 		public.POST("/payments/notify", customer.HandlePaymentNotify)
 		public.POST("/payments/simulate-notify", customer.HandleSimulatePaymentNotify)
+		public.POST("/payments/notify/:provider", customer.HandleProviderNotify)
+
+		// 日历订阅（通过链接签名校验）
+		public.GET("/calendar/:userId/appointments.ics", customer.GetCalendarFeedICS)
 
 		// 商家相关
 		merchantGroup := public.Group("/merchants")
@@ -52,6 +56,10 @@ func SetupCustomerRoutes(r *gin.Engine) {
 		auth.PUT("/phone", customer.UpdatePhone)
 		auth.GET("/profile", customer.GetUserProfile)
 
+		// 日历订阅地址
+		auth.GET("/calendar-feed", customer.GetCalendarFeed)
+		auth.POST("/calendar-feed/reset", customer.ResetCalendarFeed)
+
 		// 支付管理
 		paymentGroup := auth.Group("/payments")
 		{
@@ -64,20 +72,79 @@ func SetupCustomerRoutes(r *gin.Engine) {
 		{
 			appointmentGroup.GET("", customer.GetUserAppointments)
 			appointmentGroup.POST("", customer.CreateAppointment)
+			appointmentGroup.POST("/any-staff", customer.CreateAnyStaffAppointment)
 
 			// 特定预约操作
 			specificAppointment := appointmentGroup.Group("/:appointmentId")
 			{
 				specificAppointment.GET("", customer.GetAppointmentDetail)
+				specificAppointment.GET("/cancel-preview", customer.PreviewCancelAppointment)
 				specificAppointment.PUT("/cancel", customer.CancelAppointment)
 				specificAppointment.POST("/pay", customer.PayForAppointment)
+				specificAppointment.PUT("/reschedule", customer.RescheduleAppointment)
+				specificAppointment.GET("/reschedules", customer.GetAppointmentReschedules)
+				specificAppointment.GET("/check-in-code", customer.GetCheckInCode)
+				specificAppointment.POST("/refund-requests", customer.CreateRefundRequest)
 			}
 		}
 
+		// 退款申请
+		refundRequestGroup := auth.Group("/refund-requests")
+		{
+			refundRequestGroup.GET("", customer.GetUserRefundRequests)
+			refundRequestGroup.GET("/:requestId", customer.GetRefundRequestDetail)
+			refundRequestGroup.PUT("/:requestId/accept", customer.AcceptRefundCounter)
+			refundRequestGroup.PUT("/:requestId/withdraw", customer.WithdrawRefundRequest)
+		}
+
+		// 组合订单
+		orderGroup := auth.Group("/orders")
+		{
+			orderGroup.GET("", customer.GetUserOrders)
+			orderGroup.POST("", customer.CreateOrder)
+			orderGroup.GET("/:orderId", customer.GetOrderDetail)
+			orderGroup.PUT("/:orderId/cancel", customer.CancelOrder)
+			orderGroup.POST("/:orderId/pay", customer.PayForOrder)
+		}
+
+		// 周期预约
+		seriesGroup := auth.Group("/appointment-series")
+		{
+			seriesGroup.GET("", customer.GetUserAppointmentSeries)
+			seriesGroup.POST("", customer.CreateAppointmentSeries)
+			seriesGroup.GET("/:seriesId", customer.GetAppointmentSeriesDetail)
+			seriesGroup.PUT("/:seriesId/cancel", customer.CancelAppointmentSeries)
+		}
+
+		// 时间段预留
+		holdGroup := auth.Group("/holds")
+		{
+			holdGroup.POST("", customer.CreateSlotHold)
+			holdGroup.GET("/:holdId", customer.GetSlotHold)
+			holdGroup.DELETE("/:holdId", customer.ReleaseSlotHold)
+		}
+
+		// 候补
+		waitlistGroup := auth.Group("/waitlist")
+		{
+			waitlistGroup.GET("", customer.GetUserWaitlist)
+			waitlistGroup.POST("", customer.JoinWaitlist)
+			waitlistGroup.DELETE("/:waitlistId", customer.CancelWaitlist)
+			waitlistGroup.POST("/:waitlistId/book", customer.BookFromWaitlist)
+		}
+
+		// 站内通知
+		notificationGroup := auth.Group("/notifications")
+		{
+			notificationGroup.GET("", customer.GetNotifications)
+			notificationGroup.PUT("/:notificationId/read", customer.MarkNotificationRead)
+		}
+
 		// 时间槽
 		timeslotGroup := auth.Group("/timeslots")
 		{
 			timeslotGroup.GET("/dates", customer.GetAvailableDates)
+			timeslotGroup.GET("/any-staff", customer.GetAnyStaffTimes)
 			timeslotGroup.GET("", customer.GetTimeSlots)
 		}
 
@@ -30,6 +30,9 @@ func SetupInternalRoutes(r *gin.Engine) {
 		merchantGroup.POST("/:merchantId/admins", internal.CreateMerchantAdmin)
 		merchantGroup.GET("/:merchantId/admins", internal.GetMerchantAdmins)         // 新增：获取商家管理员列表
 		merchantGroup.GET("/:merchantId/admins/:adminId", internal.GetMerchantAdmin) // 新增：获取单个管理员
+		merchantGroup.GET("/:merchantId/business-hours", internal.GetMerchantBusinessHours)
+		merchantGroup.PUT("/:merchantId/business-hours", internal.UpdateMerchantBusinessHours)
+		merchantGroup.PUT("/:merchantId/timezone", internal.UpdateMerchantTimezone)
 	}
 
 	//merchantGroup := internals.Group("/merchants")
@@ -12,6 +12,9 @@ func SetupMerchantRoutes(r *gin.Engine) {
 	{
 		public.GET("/captcha", merchant.GetCaptcha)
 		public.POST("/login", middlewares.LoginGuardMiddleware(), merchant.Login)
+
+		// 员工日历订阅（通过链接签名校验）
+		public.GET("/calendar/staff/:staffId/appointments.ics", merchant.GetStaffCalendarFeedICS)
 	}
 
 	// 认证路由组 (需要商家认证)
@@ -38,15 +41,38 @@ func SetupMerchantRoutes(r *gin.Engine) {
 		appointmentGroup := auth.Group("/appointments")
 		{
 			appointmentGroup.GET("", merchant.GetMerchantAppointments)
+			appointmentGroup.POST("/check-in", merchant.CheckInAppointment)
 
 			// 特定预约操作
 			specificAppointment := appointmentGroup.Group("/:appointmentId")
 			{
+				specificAppointment.GET("", merchant.GetAppointmentDetail)
 				specificAppointment.PUT("/status", merchant.UpdateAppointmentStatus)
 				specificAppointment.POST("/refund", merchant.InitiateRefund)
+				specificAppointment.PUT("/reschedule", merchant.RescheduleAppointment)
+				specificAppointment.GET("/reschedules", merchant.GetAppointmentReschedules)
+				specificAppointment.PUT("/check-out", merchant.CheckOutAppointment)
 			}
 		}
 
+		// 退款申请
+		refundRequestGroup := auth.Group("/refund-requests")
+		{
+			refundRequestGroup.GET("", merchant.GetRefundRequests)
+			refundRequestGroup.GET("/:requestId", merchant.GetRefundRequestDetail)
+			refundRequestGroup.PUT("/:requestId/approve", merchant.ApproveRefundRequest)
+			refundRequestGroup.PUT("/:requestId/reject", merchant.RejectRefundRequest)
+			refundRequestGroup.PUT("/:requestId/counter", merchant.CounterRefundRequest)
+		}
+
+		// 组合订单
+		orderGroup := auth.Group("/orders")
+		{
+			orderGroup.GET("", merchant.GetMerchantOrders)
+			orderGroup.GET("/:orderId", merchant.GetMerchantOrderDetail)
+			orderGroup.PUT("/:orderId/confirm", merchant.ConfirmMerchantOrder)
+		}
+
 		// 服务管理
 		serviceGroup := auth.Group("/services")
 		{
@@ -58,6 +84,8 @@ func SetupMerchantRoutes(r *gin.Engine) {
 			{
 				specificService.PUT("", merchant.UpdateService)
 				specificService.DELETE("", merchant.DeleteService)
+				specificService.GET("/staff", merchant.GetServiceStaff)
+				specificService.PUT("/staff", merchant.UpdateServiceStaff)
 			}
 		}
 
@@ -72,6 +100,16 @@ func SetupMerchantRoutes(r *gin.Engine) {
 			{
 				specificStaff.PUT("", merchant.UpdateStaff)
 				specificStaff.DELETE("", merchant.DeleteStaff)
+				specificStaff.GET("/services", merchant.GetStaffServices)
+				specificStaff.PUT("/services", merchant.UpdateStaffServices)
+				specificStaff.GET("/calendar-feed", merchant.GetStaffCalendarFeed)
+				specificStaff.POST("/calendar-feed/reset", merchant.ResetStaffCalendarFeed)
+				specificStaff.POST("/busy-calendar/upload", merchant.UploadStaffBusyCalendar)
+				specificStaff.GET("/busy-calendar/sources", merchant.GetStaffCalendarSources)
+				specificStaff.POST("/busy-calendar/sources", merchant.CreateStaffCalendarSource)
+				specificStaff.POST("/busy-calendar/sources/:sourceId/sync", merchant.SyncStaffCalendarSource)
+				specificStaff.DELETE("/busy-calendar/sources/:sourceId", merchant.DeleteStaffCalendarSource)
+				specificStaff.GET("/busy-blocks", merchant.GetStaffBusyBlocks)
 			}
 		}
 
@@ -79,15 +117,56 @@ func SetupMerchantRoutes(r *gin.Engine) {
 		timeslotGroup := auth.Group("/timeslots")
 		{
 			timeslotGroup.GET("", merchant.GetTimeSlots)
+			timeslotGroup.GET("/calendar", merchant.GetStaffCalendar)
 			timeslotGroup.POST("/:staffId/batch", merchant.BatchCreateTimeSlots)
 
 			// 特定时间槽操作
 			specificTimeslot := timeslotGroup.Group("/:timeslotId")
 			{
 				specificTimeslot.DELETE("", merchant.DeleteTimeSlot)
+				specificTimeslot.GET("/attendees", merchant.GetTimeSlotAttendees)
 			}
 		}
 
+		// 排班模板
+		scheduleGroup := auth.Group("/schedule-templates")
+		{
+			scheduleGroup.GET("", merchant.GetScheduleTemplates)
+			scheduleGroup.POST("", merchant.CreateScheduleTemplate)
+			scheduleGroup.POST("/generate", merchant.GenerateScheduleTimeSlots)
+
+			// 特定模板操作
+			specificTemplate := scheduleGroup.Group("/:templateId")
+			{
+				specificTemplate.PUT("", merchant.UpdateScheduleTemplate)
+				specificTemplate.DELETE("", merchant.DeleteScheduleTemplate)
+			}
+		}
+
+		// 商家配置
+		auth.GET("/settings", merchant.GetMerchantSetting)
+		auth.PUT("/settings", merchant.UpdateMerchantSetting)
+
+		// 营业时间
+		auth.GET("/business-hours", merchant.GetBusinessHours)
+		auth.PUT("/business-hours", merchant.UpdateBusinessHours)
+
+		// 员工请假
+		timeOffGroup := auth.Group("/time-offs")
+		{
+			timeOffGroup.GET("", merchant.GetStaffTimeOffs)
+			timeOffGroup.POST("", merchant.CreateStaffTimeOff)
+			timeOffGroup.DELETE("/:timeOffId", merchant.DeleteStaffTimeOff)
+		}
+
+		// 停业日
+		closureGroup := auth.Group("/closures")
+		{
+			closureGroup.GET("", merchant.GetMerchantClosures)
+			closureGroup.POST("", merchant.CreateMerchantClosure)
+			closureGroup.DELETE("/:closureId", merchant.DeleteMerchantClosure)
+		}
+
 		// 优惠券管理
 		couponGroup := auth.Group("/coupons")
 		{
@@ -114,3 +114,15 @@ func ToJSONString(v interface{}) string {
 	}
 	return string(bytes)
 }
+
+// RequestBaseURL 根据请求推断对外访问的根地址（协议+域名），支持反向代理传入的 X-Forwarded-Proto
+func RequestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + c.Request.Host
+}